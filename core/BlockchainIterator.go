@@ -1,6 +1,10 @@
 package core
 
-import "github.com/boltdb/bolt"
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
 
 // 区块链迭代器
 // block chain iterator
@@ -10,18 +14,24 @@ type BlockchainIterator struct {
 	// Blockchain refers to a Blockchain instance that stores a database connection
 }
 
-// 只会做一件事情：返回链中的下一个块。
-// Will only do one thing: return the next block in the chain.
+// 只会做一件事情：返回链中的下一个块。迭代器只沿链上保存的哈希前进，读不出区块说明数据库已损坏
+// Will only do one thing: return the next block in the chain. The iterator only follows the
+// hashes stored in the chain, a block that cannot be read means the database is corrupted
 func (bci *BlockchainIterator) Next() *Block {
 	var block *Block
 
-	bci.db.View(func(tx *bolt.Tx) error {
+	err := bci.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		encodedBlock := b.Get([]byte(bci.currentHash))
-		block = DeserializeBlock(encodedBlock)
+
+		var err error
+		if block, err = DeserializeBlock(encodedBlock); err != nil {
+			return fmt.Errorf("block %x: %v", bci.currentHash, err)
+		}
 
 		return nil
 	})
+	HandleErr(err)
 
 	bci.currentHash = block.PrevBlockHash
 
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 地址索引：每个地址一个子bucket，记录支付给该地址的输出和花费该地址输出的输入。
+// 键为 高度(4) | 交易在区块中的位置(4) | 类型(1) | 输出或输入序号(4)，按时间顺序排列，
+// 值为 区块哈希 | 交易ID
+// Address index: a sub bucket per address recording the outputs paying the address and
+// the inputs spending its outputs. Keys are height(4) | position of the tx in the block(4) |
+// kind(1) | output or input index(4), so they sort chronologically, values are block hash | txid
+type addrIndexer struct{}
+
+// 索引记录的类型，同一交易中输入排在输出前面
+// Kinds of index entries, the inputs of a transaction sort before its outputs
+const (
+	addrIndexInput  byte = 0
+	addrIndexOutput byte = 1
+)
+
+const addrIndexKeyLen = 13
+
+func (addrIndexer) Name() string {
+	return "addrindex"
+}
+
+func (addrIndexer) Bucket() []byte {
+	return []byte(addrIndexBucket)
+}
+
+// 地址索引中的一条记录
+// One entry of the address index
+type addrIndexEntry struct {
+	Height    int
+	TxPos     int
+	Input     bool // 是否为花费该地址输出的输入 whether it is an input spending an output of the address
+	Index     int  // 输出或输入序号 output or input index
+	BlockHash []byte
+	TxID      []byte
+}
+
+func addrIndexKey(height, txPos int, kind byte, index int) []byte {
+	key := make([]byte, addrIndexKeyLen)
+	binary.BigEndian.PutUint32(key[0:4], uint32(height))
+	binary.BigEndian.PutUint32(key[4:8], uint32(txPos))
+	key[8] = kind
+	binary.BigEndian.PutUint32(key[9:13], uint32(index))
+
+	return key
+}
+
+func decodeAddrIndexEntry(key, value []byte) (addrIndexEntry, error) {
+	if len(key) != addrIndexKeyLen || len(value) < sha256.Size {
+		return addrIndexEntry{}, fmt.Errorf("malformed address index entry %x", key)
+	}
+
+	return addrIndexEntry{
+		Height:    int(binary.BigEndian.Uint32(key[0:4])),
+		TxPos:     int(binary.BigEndian.Uint32(key[4:8])),
+		Input:     key[8] == addrIndexInput,
+		Index:     int(binary.BigEndian.Uint32(key[9:13])),
+		BlockHash: value[:sha256.Size],
+		TxID:      value[sha256.Size:],
+	}, nil
+}
+
+// 遍历区块中与地址有关的所有输入和输出
+// Visit every input and output of the block that involves an address
+func forEachAddrIndexEntry(block *Block, prevOuts map[string]TXOutput, fn func(address string, key, value []byte) error) error {
+	for txPos, tx := range block.Transactions {
+		value := append(append([]byte{}, block.Hash...), tx.ID...)
+
+		if !tx.IsCoinbase() {
+			for i, in := range tx.Vin {
+				prevOut, ok := prevOuts[outpointKey(in.Txid, in.Vout)]
+				if !ok {
+					return fmt.Errorf("output %s spent by %x is unknown", outpointKey(in.Txid, in.Vout), tx.ID)
+				}
+				if address, ok := ExtractAddress(prevOut.ScriptPubKey); ok {
+					if err := fn(address, addrIndexKey(block.Height, txPos, addrIndexInput, i), value); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for i, out := range tx.Vout {
+			if address, ok := ExtractAddress(out.ScriptPubKey); ok {
+				if err := fn(address, addrIndexKey(block.Height, txPos, addrIndexOutput, i), value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ix addrIndexer) ConnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	index := dbTx.Bucket(ix.Bucket())
+
+	return forEachAddrIndexEntry(block, prevOuts, func(address string, key, value []byte) error {
+		b, err := index.CreateBucketIfNotExists([]byte(address))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(key, value)
+	})
+}
+
+func (ix addrIndexer) DisconnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	index := dbTx.Bucket(ix.Bucket())
+
+	return forEachAddrIndexEntry(block, prevOuts, func(address string, key, value []byte) error {
+		b := index.Bucket([]byte(address))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete(key)
+	})
+}
+
+// 按时间顺序读取地址的所有索引记录
+// Read all index entries of the address in chronological order
+func (bc *BlockChain) addrIndexEntries(address string) ([]addrIndexEntry, error) {
+	var entries []addrIndexEntry
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket([]byte(addrIndexBucket))
+		if index == nil {
+			return fmt.Errorf("address index is not enabled")
+		}
+		b := index.Bucket([]byte(address))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			entry, err := decodeAddrIndexEntry(k, v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// 按区块哈希和位置读取索引记录指向的交易，读过的区块会被缓存
+// Load the transaction an index entry points to, blocks that were read are cached
+func (bc *BlockChain) addrIndexTransaction(entry addrIndexEntry, cache map[string]*Block) (*Block, *Transaction, error) {
+	block, ok := cache[string(entry.BlockHash)]
+	if !ok {
+		var err error
+		if block, err = bc.GetBlock(entry.BlockHash); err != nil {
+			return nil, nil, err
+		}
+		cache[string(entry.BlockHash)] = block
+	}
+	if entry.TxPos >= len(block.Transactions) || !bytes.Equal(block.Transactions[entry.TxPos].ID, entry.TxID) {
+		return nil, nil, fmt.Errorf("address index entry for %x does not match block %x", entry.TxID, entry.BlockHash)
+	}
+
+	return block, block.Transactions[entry.TxPos], nil
+}
+
+// 通过地址索引找到address的所有未花费输出
+// Find all unspent outputs of address using the address index
+func (bc *BlockChain) findUTXOsIndexed(address string) ([]UTXO, error) {
+	entries, err := bc.addrIndexEntries(address)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := make(map[string]*Block)
+	spent := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Input {
+			continue
+		}
+		_, tx, err := bc.addrIndexTransaction(entry, cache)
+		if err != nil {
+			return nil, err
+		}
+		in := tx.Vin[entry.Index]
+		spent[outpointKey(in.Txid, in.Vout)] = true
+	}
+
+	var UTXOs []UTXO
+	for _, entry := range entries {
+		if entry.Input || spent[outpointKey(entry.TxID, entry.Index)] {
+			continue
+		}
+		block, tx, err := bc.addrIndexTransaction(entry, cache)
+		if err != nil {
+			return nil, err
+		}
+		UTXOs = append(UTXOs, UTXO{tx.ID, entry.Index, tx.Vout[entry.Index], block.Height, tx.IsCoinbase()})
+	}
+
+	return UTXOs, nil
+}
+
+// 通过地址索引按时间顺序找到与address有关的所有交易
+// Find all transactions involving address in chronological order using the address index
+func (bc *BlockChain) findAddressTransactionsIndexed(address string) ([]*Block, []*Transaction, error) {
+	entries, err := bc.addrIndexEntries(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []*Block
+	var txs []*Transaction
+	cache := make(map[string]*Block)
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[string(entry.TxID)] {
+			continue
+		}
+		seen[string(entry.TxID)] = true
+
+		block, tx, err := bc.addrIndexTransaction(entry, cache)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks = append(blocks, block)
+		txs = append(txs, tx)
+	}
+
+	return blocks, txs, nil
+}
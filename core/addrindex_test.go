@@ -0,0 +1,63 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 重组移除区块后，区块中的交易也从地址索引中消失，被花费的输出重新可用
+// After a reorganization removes a block, its transactions disappear from the address index and
+// the outputs they spent become unspent again
+func TestAddrIndexReorganize(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	if err := bc.Reindex(addrIndexer{}.Name()); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payer := wallet.GetAddress()
+	payee := NewWallet().GetAddress()
+	miner := NewWallet().GetAddress()
+
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{payee, 3}}, TxOptions{}, nil)
+	mineTestBlock(t, bc, miner, tx)
+	for address, count := range map[string]int{payer: 2, payee: 1, miner: 1} {
+		_, txs, err := bc.findAddressTransactionsIndexed(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(txs) != count {
+			t.Fatalf("%d transactions indexed for %s before the reorganization, expected %d", len(txs), address, count)
+		}
+	}
+
+	if _, err := bc.Reorganize(newTestBranch(genesis, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, address := range []string{payee, miner} {
+		entries, err := bc.addrIndexEntries(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("%d index entries left for %s after the reorganization", len(entries), address)
+		}
+	}
+	_, txs, err := bc.findAddressTransactionsIndexed(payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || !bytes.Equal(txs[0].ID, genesis.Transactions[0].ID) {
+		t.Fatalf("%d transactions indexed for the payer after the reorganization, expected only the genesis coinbase", len(txs))
+	}
+	utxos, err := bc.findUTXOsIndexed(payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(utxos) != 1 || utxos[0].Output.Value != subsidy {
+		t.Fatalf("the payer has %d outputs after the reorganization, expected the genesis reward", len(utxos))
+	}
+}
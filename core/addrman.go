@@ -0,0 +1,285 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// 地址管理器的参数
+// Parameters of the address manager
+const (
+	maxKnownAddresses = 5000                // 最多保存的地址数 max addresses kept
+	maxAddrPerMessage = 1000                // 一条addr消息中的最大地址数 max addresses in an addr message
+	retryBaseDelay    = 5 * time.Second     // 第一次连接失败后的重试间隔，之后每次加倍 delay after the first failed connection, doubled after every further failure
+	retryMaxDelay     = 30 * time.Minute    // 重试间隔的上限 upper bound of the retry delay
+	maxFailedAttempts = 10                  // 连续失败这么多次后地址被丢弃 addresses are dropped after this many consecutive failures
+	addressMaxAge     = 30 * 24 * time.Hour // 这么久没有见到的地址被丢弃 addresses not seen for this long are dropped
+)
+
+// 已知的节点地址
+// A known node address
+type KnownAddress struct {
+	Addr        string    // host:port
+	Source      string    // 从哪里得知：seed、manual或告诉我们的节点 where it was learned: seed, manual or the peer that told us
+	LastSeen    time.Time // 最后一次确认节点在线的时间 the last time the node was known to be online
+	LastAttempt time.Time
+	LastSuccess time.Time
+	Attempts    int // 连续失败的连接次数 consecutive failed connection attempts
+}
+
+// 下一次可以尝试连接的时间，失败后按指数退避
+// When the next connection may be attempted, with exponential backoff after failures
+func (ka *KnownAddress) nextAttempt() time.Time {
+	if ka.Attempts == 0 {
+		return ka.LastAttempt
+	}
+
+	return ka.LastAttempt.Add(retryDelay(ka.Attempts))
+}
+
+// 已经没有用的地址：连续失败太多次或太久没有见到
+// An address that is no longer useful: too many consecutive failures or not seen for too long
+func (ka *KnownAddress) isTerrible(now time.Time) bool {
+	return ka.Attempts >= maxFailedAttempts || now.Sub(ka.LastSeen) > addressMaxAge
+}
+
+// 连续失败attempts次后的重试间隔
+// The retry delay after attempts consecutive failures
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	return delay
+}
+
+// 检查节点地址的格式：主机和1到65535之间的端口
+// Check the format of a node address: a host and a port between 1 and 65535
+func validateNodeAddress(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("address %s has no host", addr)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return fmt.Errorf("address %s has an unspecified IP", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("address %s has an invalid port", addr)
+	}
+
+	return nil
+}
+
+// 地址管理器：保存已知的节点地址和它们的连接记录，节点用它选择要连接的地址，
+// 并把地址告诉其他节点。地址保存在区块链数据库中，重启后仍然可用
+// Address manager: keeps the known node addresses with their connection history. The node picks
+// the addresses to connect to from it and tells other nodes about them. The addresses are saved
+// in the blockchain database, so they survive restarts
+type AddrManager struct {
+	mu    sync.Mutex
+	addrs map[string]*KnownAddress
+}
+
+func NewAddrManager() *AddrManager {
+	return &AddrManager{addrs: make(map[string]*KnownAddress)}
+}
+
+// 从数据库读取保存的地址
+// Read the saved addresses from the database
+func loadAddrManager(db *bolt.DB) (*AddrManager, error) {
+	a := NewAddrManager()
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(peersBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var ka KnownAddress
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&ka); err != nil {
+				return fmt.Errorf("peer address %s: %v", k, err)
+			}
+			a.addrs[ka.Addr] = &ka
+			return nil
+		})
+	})
+
+	return a, err
+}
+
+// 把所有地址写入数据库，替换之前保存的地址
+// Write every address to the database, replacing the addresses saved before
+func (a *AddrManager) save(db *bolt.DB) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(peersBucket)) != nil {
+			if err := tx.DeleteBucket([]byte(peersBucket)); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(peersBucket))
+		if err != nil {
+			return err
+		}
+		for addr, ka := range a.addrs {
+			data, err := gobEncode(ka)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(addr), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// 加入地址或更新最后见到的时间，返回地址是否是新的
+// Add an address or update when it was last seen, returns whether the address is new
+func (a *AddrManager) Add(addr, source string, lastSeen time.Time) bool {
+	if validateNodeAddress(addr) != nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ka, ok := a.addrs[addr]; ok {
+		if lastSeen.After(ka.LastSeen) {
+			ka.LastSeen = lastSeen
+		}
+		return false
+	}
+	if len(a.addrs) >= maxKnownAddresses {
+		a.evict()
+	}
+	a.addrs[addr] = &KnownAddress{Addr: addr, Source: source, LastSeen: lastSeen}
+
+	return true
+}
+
+// 地址已满时丢弃没有用的地址，没有的话丢弃最久没有见到的地址
+// Drop the useless addresses when full, or the address not seen for the longest time if there are none
+func (a *AddrManager) evict() {
+	now := time.Now()
+	var oldest *KnownAddress
+	for addr, ka := range a.addrs {
+		if ka.isTerrible(now) {
+			delete(a.addrs, addr)
+			continue
+		}
+		if oldest == nil || ka.LastSeen.Before(oldest.LastSeen) {
+			oldest = ka
+		}
+	}
+	if len(a.addrs) >= maxKnownAddresses && oldest != nil {
+		delete(a.addrs, oldest.Addr)
+	}
+}
+
+// 记录一次连接尝试，连接成功时调用Good
+// Record a connection attempt, Good is called when it succeeds
+func (a *AddrManager) Attempt(addr string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ka, ok := a.addrs[addr]; ok {
+		ka.LastAttempt = time.Now()
+		ka.Attempts++
+	}
+}
+
+// 记录一次成功的连接
+// Record a successful connection
+func (a *AddrManager) Good(addr string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ka, ok := a.addrs[addr]; ok {
+		now := time.Now()
+		ka.LastSeen = now
+		ka.LastSuccess = now
+		ka.Attempts = 0
+	}
+}
+
+func (a *AddrManager) Remove(addr string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.addrs, addr)
+}
+
+func (a *AddrManager) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.addrs)
+}
+
+// 选一个可以连接的地址：不在exclude中、不在退避期内、也不是没有用的地址。
+// 优先选择最近见到的地址，在它们之中随机选择。没有可用地址时返回空字符串
+// Pick an address to connect to: not excluded, not backing off and not useless. Recently seen
+// addresses are preferred and picked from at random. Returns an empty string when none is available
+func (a *AddrManager) Pick(exclude func(addr string) bool) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	var candidates []*KnownAddress
+	for addr, ka := range a.addrs {
+		if exclude(addr) || ka.isTerrible(now) || now.Before(ka.nextAttempt()) {
+			continue
+		}
+		candidates = append(candidates, ka)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	// 在最近见到的一半中随机选择
+	// Pick at random from the more recently seen half
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].LastSeen.After(candidates[j].LastSeen) })
+
+	return candidates[rand.Intn((len(candidates)+1)/2)].Addr
+}
+
+// 随机选出最多max个有用的地址，用于回复getaddr
+// Pick at most max useful addresses at random, used to answer getaddr
+func (a *AddrManager) Sample(max int) []KnownAddress {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	var sample []KnownAddress
+	for _, ka := range a.addrs {
+		if !ka.isTerrible(now) {
+			sample = append(sample, *ka)
+		}
+	}
+	rand.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+	if len(sample) > max {
+		sample = sample[:max]
+	}
+
+	return sample
+}
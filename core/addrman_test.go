@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAddrManagerAdd(t *testing.T) {
+	a := NewAddrManager()
+	now := time.Now()
+
+	for _, addr := range []string{"", "10.0.0.1", "10.0.0.1:0", "10.0.0.1:70000", ":8333", "0.0.0.0:8333", "[::]:8333"} {
+		if a.Add(addr, "test", now) {
+			t.Errorf("invalid address %q was added", addr)
+		}
+	}
+	if !a.Add("10.0.0.1:8333", "seed", now.Add(-time.Hour)) {
+		t.Fatal("a new address was not added")
+	}
+	// 再次加入只更新更晚的最后见到时间
+	// Adding again only moves the last seen time forward
+	if a.Add("10.0.0.1:8333", "peer", now.Add(-2*time.Hour)) {
+		t.Fatal("a known address was added again")
+	}
+	if ka := a.addrs["10.0.0.1:8333"]; !ka.LastSeen.Equal(now.Add(-time.Hour)) || ka.Source != "seed" {
+		t.Fatalf("an older sighting changed the address to %+v", ka)
+	}
+	a.Add("10.0.0.1:8333", "peer", now)
+	if ka := a.addrs["10.0.0.1:8333"]; !ka.LastSeen.Equal(now) {
+		t.Fatalf("last seen %v, expected %v", ka.LastSeen, now)
+	}
+	if a.Len() != 1 {
+		t.Fatalf("%d addresses, expected 1", a.Len())
+	}
+}
+
+// 地址和连接记录保存到数据库后重新加载不变，再次保存会替换之前的地址
+// The addresses and their connection history are unchanged after saving and loading again,
+// and saving again replaces the addresses saved before
+func TestAddrManagerPersistence(t *testing.T) {
+	bc, _ := newTestChain(t, testChainParams())
+	a := NewAddrManager()
+	now := time.Now()
+	a.Add("10.0.0.1:8333", "seed", now)
+	a.Add("10.0.0.2:8333", "manual", now.Add(-time.Hour))
+	a.Add("node.example.com:8333", "10.0.0.1:8333", now.Add(-2*time.Hour))
+	a.Attempt("10.0.0.2:8333")
+	a.Good("10.0.0.1:8333")
+
+	if err := a.save(bc.db); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadAddrManager(bc.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != a.Len() {
+		t.Fatalf("loaded %d addresses, expected %d", loaded.Len(), a.Len())
+	}
+	for addr, expected := range a.addrs {
+		ka, ok := loaded.addrs[addr]
+		if !ok {
+			t.Fatalf("%s was not loaded", addr)
+		}
+		if ka.Addr != expected.Addr || ka.Source != expected.Source || ka.Attempts != expected.Attempts ||
+			!ka.LastSeen.Equal(expected.LastSeen) || !ka.LastAttempt.Equal(expected.LastAttempt) ||
+			!ka.LastSuccess.Equal(expected.LastSuccess) {
+			t.Fatalf("loaded %+v, expected %+v", ka, expected)
+		}
+	}
+
+	a.Remove("10.0.0.2:8333")
+	if err := a.save(bc.db); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = loadAddrManager(bc.db); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.addrs["10.0.0.2:8333"]; ok || loaded.Len() != 2 {
+		t.Fatalf("loaded %d addresses after removing one, expected 2", loaded.Len())
+	}
+}
+
+func TestAddrManagerRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{20, retryMaxDelay},
+		{1000, retryMaxDelay},
+	}
+	for _, test := range tests {
+		if delay := retryDelay(test.attempts); delay != test.delay {
+			t.Errorf("%d attempts: delay %v, expected %v", test.attempts, delay, test.delay)
+		}
+	}
+
+	a := NewAddrManager()
+	addr := "10.0.0.1:8333"
+	a.Add(addr, "seed", time.Now())
+	none := func(string) bool { return false }
+
+	// 失败后在退避期内不会被选中，退避期过后可以再次尝试
+	// After a failure it is not picked while backing off, and can be tried again afterwards
+	a.Attempt(addr)
+	if picked := a.Pick(none); picked != "" {
+		t.Fatalf("picked %s while it is backing off", picked)
+	}
+	a.addrs[addr].LastAttempt = time.Now().Add(-retryDelay(1) - time.Second)
+	if picked := a.Pick(none); picked != addr {
+		t.Fatalf("picked %q after the backoff", picked)
+	}
+	if picked := a.Pick(func(s string) bool { return s == addr }); picked != "" {
+		t.Fatalf("picked the excluded address %s", picked)
+	}
+
+	// 第二次失败后退避期加倍
+	// After a second failure the backoff doubles
+	a.Attempt(addr)
+	a.addrs[addr].LastAttempt = time.Now().Add(-retryDelay(1) - time.Second)
+	if picked := a.Pick(none); picked != "" {
+		t.Fatalf("picked %s before the doubled backoff passed", picked)
+	}
+
+	// 连接成功后清除失败记录
+	// A successful connection clears the failures
+	a.Good(addr)
+	if a.addrs[addr].Attempts != 0 || a.Pick(none) != addr {
+		t.Fatalf("%d attempts after a successful connection", a.addrs[addr].Attempts)
+	}
+
+	// 连续失败太多次的地址不再被选中，也不会告诉其他节点
+	// An address with too many consecutive failures is no longer picked or told to other nodes
+	a.addrs[addr].Attempts = maxFailedAttempts
+	a.addrs[addr].LastAttempt = time.Now().Add(-2 * retryMaxDelay)
+	if picked := a.Pick(none); picked != "" {
+		t.Fatalf("picked %s after %d failures", picked, maxFailedAttempts)
+	}
+	if sample := a.Sample(10); len(sample) != 0 {
+		t.Fatalf("sampled %d useless addresses", len(sample))
+	}
+}
+
+// 地址已满时先丢弃没有用的地址，没有的话丢弃最久没有见到的地址
+// When full the useless addresses are dropped first, otherwise the one not seen for the longest time
+func TestAddrManagerEvictsWhenFull(t *testing.T) {
+	a := NewAddrManager()
+	now := time.Now()
+	fill := func() {
+		for i := 0; a.Len() < maxKnownAddresses; i++ {
+			a.Add(fmt.Sprintf("10.%d.%d.%d:8333", i>>16&0xff, i>>8&0xff, i&0xff), "test", now.Add(-time.Minute))
+		}
+	}
+	fill()
+
+	oldest := "10.0.0.7:8333"
+	a.addrs[oldest].LastSeen = now.Add(-time.Hour)
+	if !a.Add("192.168.0.1:8333", "test", now) {
+		t.Fatal("a new address was not added to a full table")
+	}
+	if a.Len() != maxKnownAddresses {
+		t.Fatalf("%d addresses, expected %d", a.Len(), maxKnownAddresses)
+	}
+	if _, ok := a.addrs[oldest]; ok {
+		t.Fatal("the address not seen for the longest time was kept")
+	}
+
+	// 没有用的地址全部被丢弃，最久没见到的地址则被保留
+	// Every useless address is dropped, and the one not seen for the longest time is kept
+	a.addrs["10.0.0.1:8333"].Attempts = maxFailedAttempts
+	a.addrs["10.0.0.2:8333"].LastSeen = now.Add(-2 * addressMaxAge)
+	a.addrs["10.0.0.3:8333"].LastSeen = now.Add(-addressMaxAge / 2)
+	a.Add("192.168.0.2:8333", "test", now)
+	for _, addr := range []string{"10.0.0.1:8333", "10.0.0.2:8333"} {
+		if _, ok := a.addrs[addr]; ok {
+			t.Fatalf("the useless address %s was kept", addr)
+		}
+	}
+	if _, ok := a.addrs["10.0.0.3:8333"]; !ok {
+		t.Fatal("an address was evicted although useless addresses made room")
+	}
+	if a.Len() != maxKnownAddresses-1 {
+		t.Fatalf("%d addresses, expected %d", a.Len(), maxKnownAddresses-1)
+	}
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// 不当行为的分数和封禁的参数
+// Misbehavior scores and ban parameters
+const (
+	banThreshold       = 100            // 分数达到这个值时封禁节点 peers are banned when their score reaches this
+	defaultBanDuration = 24 * time.Hour // 默认的封禁时长 default ban duration
+	banScoreInvalid    = 100            // 无效的区块或区块头，例如工作量证明或签名错误 invalid blocks or headers, like a bad proof of work or signature
+	banScoreMalformed  = 50             // 无法解码的消息 messages that cannot be decoded
+	banScoreProtocol   = 20             // 违反协议限制，例如一条消息中的项目太多 broken protocol limits, like too many items in a message
+)
+
+// 节点的不当行为：消息被忽略，分数累计到banThreshold时封禁节点的IP
+// Misbehavior of a peer: the message is ignored and the IP of the peer is banned once
+// its score reaches banThreshold
+type misbehavior struct {
+	score int
+	err   error
+}
+
+func (m *misbehavior) Error() string {
+	return m.err.Error()
+}
+
+func misbehaviorf(score int, format string, args ...interface{}) error {
+	return &misbehavior{score, fmt.Errorf(format, args...)}
+}
+
+// 一个被封禁的子网，单个IP的子网包含所有位
+// A banned subnet, the subnet of a single IP covers every bit
+type BanEntry struct {
+	Subnet  string    `json:"subnet"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+	Reason  string    `json:"reason"`
+}
+
+// 解析IP或CIDR格式的子网
+// Parse an IP or a subnet in CIDR notation
+func parseBanSubnet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, subnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %s", s)
+		}
+		return subnet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %s", s)
+	}
+
+	return ipSubnet(ip), nil
+}
+
+// 只包含一个IP的子网
+// The subnet containing only one IP
+func ipSubnet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// 地址中的IP，主机名没有IP时返回nil
+// The IP of an address, nil when the host is a name
+func addrIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+// 封禁列表：被封禁的子网和到期时间，保存在区块链数据库中，重启后仍然有效
+// Ban list: the banned subnets and when their bans expire. It is saved in the blockchain
+// database, so the bans survive restarts
+type BanList struct {
+	mu   sync.Mutex
+	db   *bolt.DB
+	bans map[string]*BanEntry
+}
+
+// 从数据库读取封禁列表，跳过已到期的封禁
+// Read the ban list from the database, skipping expired bans
+func loadBanList(db *bolt.DB) (*BanList, error) {
+	l := &BanList{db: db, bans: make(map[string]*BanEntry)}
+	now := time.Now()
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bannedBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var ban BanEntry
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&ban); err != nil {
+				return fmt.Errorf("ban of %s: %v", k, err)
+			}
+			if ban.Until.After(now) {
+				l.bans[ban.Subnet] = &ban
+			}
+			return nil
+		})
+	})
+
+	return l, err
+}
+
+// 把封禁列表写入数据库，替换之前保存的列表。调用时持有l.mu
+// Write the ban list to the database, replacing the list saved before. Called with l.mu held
+func (l *BanList) save() error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bannedBucket)) != nil {
+			if err := tx.DeleteBucket([]byte(bannedBucket)); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(bannedBucket))
+		if err != nil {
+			return err
+		}
+		for subnet, ban := range l.bans {
+			data, err := gobEncode(ban)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(subnet), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// 封禁子网到until，已封禁时更新到期时间和原因
+// Ban a subnet until the given time, updating the expiry and reason when it is banned already
+func (l *BanList) Ban(subnet *net.IPNet, until time.Time, reason string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := subnet.String()
+	l.bans[key] = &BanEntry{Subnet: key, Created: time.Now(), Until: until, Reason: reason}
+
+	return l.save()
+}
+
+// 解除对子网的封禁
+// Lift the ban of a subnet
+func (l *BanList) Unban(subnet *net.IPNet) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := subnet.String()
+	if l.bans[key] == nil {
+		return fmt.Errorf("%s is not banned", key)
+	}
+	delete(l.bans, key)
+
+	return l.save()
+}
+
+// 解除所有封禁
+// Lift every ban
+func (l *BanList) Clear() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bans = make(map[string]*BanEntry)
+
+	return l.save()
+}
+
+// IP是否在未到期的封禁中
+// Whether the IP is in a ban that has not expired
+func (l *BanList) IsBanned(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, ban := range l.bans {
+		if !ban.Until.After(now) {
+			continue
+		}
+		if _, subnet, err := net.ParseCIDR(ban.Subnet); err == nil && subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 未到期的封禁，按子网排列
+// The bans that have not expired, sorted by subnet
+func (l *BanList) List() []BanEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bans := make([]BanEntry, 0, len(l.bans))
+	for _, ban := range l.bans {
+		if ban.Until.After(now) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Subnet < bans[j].Subnet })
+
+	return bans
+}
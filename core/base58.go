@@ -0,0 +1,68 @@
+package core
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// Base58字母表，去掉了容易混淆的0、O、I、l
+// Base58 alphabet, without the easily confused 0, O, I and l
+var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
+
+// Base58编码
+// Base58 encoding
+func Base58Encode(input []byte) []byte {
+	var result []byte
+
+	x := new(big.Int).SetBytes(input)
+	base := big.NewInt(int64(len(b58Alphabet)))
+	zero := big.NewInt(0)
+	mod := &big.Int{}
+
+	for x.Cmp(zero) != 0 {
+		x.DivMod(x, base, mod)
+		result = append(result, b58Alphabet[mod.Int64()])
+	}
+
+	// 前导的零字节编码为'1'
+	// Leading zero bytes are encoded as '1'
+	for _, b := range input {
+		if b != 0x00 {
+			break
+		}
+		result = append(result, b58Alphabet[0])
+	}
+
+	ReverseBytes(result)
+
+	return result
+}
+
+// Base58解码，遇到非法字符时返回false
+// Base58 decoding, returns false on invalid characters
+func Base58Decode(input []byte) ([]byte, bool) {
+	result := big.NewInt(0)
+	base := big.NewInt(int64(len(b58Alphabet)))
+
+	zeroBytes := 0
+	for _, b := range input {
+		if b != b58Alphabet[0] {
+			break
+		}
+		zeroBytes++
+	}
+
+	for _, b := range input[zeroBytes:] {
+		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, false
+		}
+		result.Mul(result, base)
+		result.Add(result, big.NewInt(int64(charIndex)))
+	}
+
+	decoded := result.Bytes()
+	decoded = append(bytes.Repeat([]byte{0x00}, zeroBytes), decoded...)
+
+	return decoded, true
+}
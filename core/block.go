@@ -4,35 +4,151 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/gob"
-	"log"
 	"time"
 )
 
+// 区块头版本：版本1的区块头对交易ID的拼接做一次哈希，版本2使用Merkle树根并把版本纳入工作量证明
+// Block header versions: version 1 hashes the concatenated transaction IDs once,
+// version 2 uses a Merkle root and includes the version in the proof of work
+const (
+	legacyBlockVersion = 1
+	blockVersion       = 2
+)
+
+// 区块头：区块中除交易以外的部分，交易只保留它们的Merkle树根。
+// 工作量证明只依赖区块头，同步时先下载并验证区块头，修剪后的区块也只保留区块头
+// Block header: everything of a block except its transactions, which are only kept as
+// their Merkle root. The proof of work only depends on the header, so headers are downloaded
+// and validated first when syncing, and only the header of a pruned block is kept
+type BlockHeader struct {
+	Version       int
+	PrevBlockHash []byte // 前一个区块的哈希值 // Hash value for the previous Block
+	MerkleRoot    []byte // 交易的Merkle树根 // Merkle root of the transactions
+	Timestamp     int64  // 区块创建时间戳 // time stamp for the Block creation
+	Bits          int    // 挖矿难度值 // mining difficulty
+	Nonce         int    // 工作量证明值,用来校验数据的  // Proof of work, used to verify data.
+}
+
 // 区块结构体定义
 // Definition for Block struct
 type Block struct {
-	Timestamp     int64 // 区块创建时间戳 // time stamp for the Block creation
-	Transactions  []*Transaction
-	PrevBlockHash []byte // 前一个区块的哈希值 // Hash value for the previous Block
-	Hash          []byte // 区块自身的哈希值，用于校验区块数据有效 // Hash value of the current block, used
+	BlockHeader
+	Transactions []*Transaction
+	Hash         []byte // 区块自身的哈希值，用于校验区块数据有效 // Hash value of the current block, used
 	// to verify the valididy of the block data
-	Nonce int // 工作量证明值,用来校验数据的  // Proof of work, used to verify data.
+	Height int // 区块高度，创世区块为0 // Block height, the genesis block is 0
+}
+
+// 数据库中保存的区块头，附带区块的哈希和高度
+// Block header as stored in the database, with the hash and the height of the block
+type ChainHeader struct {
+	BlockHeader
+	Hash   []byte
+	Height int
+}
+
+// 区块的区块头
+// Header of the block
+func (b *Block) Header() *ChainHeader {
+	return &ChainHeader{b.BlockHeader, b.Hash, b.Height}
+}
+
+// 把区块头序列化为一个字节数组
+// Serialize the header into a byte array
+func (h *ChainHeader) Serialize() []byte {
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(h)
+	HandleErr(err)
+
+	return result.Bytes()
+}
+
+// 把字节数组反序列化为区块头，数据无效时返回错误
+// Deserialize the byte array into a header, an error is returned for invalid data
+func decodeBlockHeader(d []byte) (*ChainHeader, error) {
+	var header ChainHeader
+	if err := gob.NewDecoder(bytes.NewReader(d)).Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.Bits == 0 {
+		return decodeLegacyBlockHeader(d)
+	}
+
+	return &header, nil
+}
+
+// 旧版本程序写入的区块和区块头，区块头的字段直接放在区块中。
+// 新的区块头中Bits不会为0，以此识别旧的格式
+// Blocks and headers written by older binaries, the header fields were part of the block.
+// Bits is never 0 in the new header, which identifies the old format
+type legacyBlock struct {
+	Timestamp     int64
+	Transactions  []*Transaction
+	PrevBlockHash []byte
+	Hash          []byte
+	Nonce         int
+	Height        int
+}
+
+type legacyBlockHeader struct {
+	Timestamp     int64
+	PrevBlockHash []byte
+	Hash          []byte
+	TxHash        []byte
+	Nonce         int
+	Height        int
+}
+
+func decodeLegacyBlock(d []byte) (*Block, error) {
+	var old legacyBlock
+	if err := gob.NewDecoder(bytes.NewReader(d)).Decode(&old); err != nil {
+		return nil, err
+	}
+	block := &Block{
+		BlockHeader:  BlockHeader{legacyBlockVersion, old.PrevBlockHash, nil, old.Timestamp, targetBits, old.Nonce},
+		Transactions: old.Transactions,
+		Hash:         old.Hash,
+		Height:       old.Height,
+	}
+	block.MerkleRoot = block.HashTransaction()
+
+	return block, nil
+}
+
+func decodeLegacyBlockHeader(d []byte) (*ChainHeader, error) {
+	var old legacyBlockHeader
+	if err := gob.NewDecoder(bytes.NewReader(d)).Decode(&old); err != nil {
+		return nil, err
+	}
+
+	return &ChainHeader{
+		BlockHeader: BlockHeader{legacyBlockVersion, old.PrevBlockHash, old.TxHash, old.Timestamp, targetBits, old.Nonce},
+		Hash:        old.Hash,
+		Height:      old.Height,
+	}, nil
+}
+
+// 区块是否包含该交易
+// Whether the block contains the transaction
+func (b *Block) hasTransaction(ID []byte) bool {
+	for _, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, ID) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // 创建创世区块
 // Create Genesis Block
 func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{})
+	return NewBlock([]*Transaction{coinbase}, []byte{}, 0)
 }
 
 // NewBlock create and return Block
-func NewBlock(transactions []*Transaction, prevBlockHash []byte) *Block {
-	block := &Block{
-		Timestamp:     time.Now().UnixNano(),
-		Transactions:  transactions,
-		PrevBlockHash: prevBlockHash,
-		Hash:          []byte{},
-	}
+func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int) *Block {
+	block := newBlockTemplate(transactions, prevBlockHash, height)
 
 	// 采用工作量证明得出的新区块
 	// new block derived from proof of work
@@ -44,6 +160,25 @@ func NewBlock(transactions []*Transaction, prevBlockHash []byte) *Block {
 	return block
 }
 
+// 还没有工作量证明的新区块
+// A new block without its proof of work yet
+func newBlockTemplate(transactions []*Transaction, prevBlockHash []byte, height int) *Block {
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:       blockVersion,
+			PrevBlockHash: prevBlockHash,
+			Timestamp:     time.Now().UnixNano(),
+			Bits:          targetBits,
+		},
+		Transactions: transactions,
+		Hash:         []byte{},
+		Height:       height,
+	}
+	block.MerkleRoot = block.computeMerkleRoot()
+
+	return block
+}
+
 // 把Block序列化为一个字节数组
 // Serialize the block into a byte array
 func (b *Block) Serialize() []byte {
@@ -55,20 +190,28 @@ func (b *Block) Serialize() []byte {
 	return result.Bytes()
 }
 
-// 把字节数组反序列化为一个Block
-// Deserialize the byte array into a Block
-func DeserializeBlock(d []byte) *Block {
+// 区块时间(秒)，用于锁定时间的比较
+// Block time in seconds, used when comparing lock times
+func (b *Block) Time() int64 {
+	return b.Timestamp / int64(time.Second)
+}
+
+// 把字节数组反序列化为一个Block，数据无效时返回错误
+// Deserialize the byte array into a Block, an error is returned for invalid data
+func DeserializeBlock(d []byte) (*Block, error) {
 	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	if err := decoder.Decode(&block); err != nil {
-		log.Panic(err)
+	if err := gob.NewDecoder(bytes.NewReader(d)).Decode(&block); err != nil {
+		return nil, err
+	}
+	if block.Bits == 0 {
+		return decodeLegacyBlock(d)
 	}
 
-	return &block
+	return &block, nil
 }
 
-// 把区块的所有交易ID做个hash处理
-// make a hash for all the transaction ID in the Block
+// 把区块的所有交易ID做个hash处理，版本1的区块用它代替Merkle树根
+// make a hash for all the transaction ID in the Block, version 1 blocks use it instead of a Merkle root
 func (b *Block) HashTransaction() []byte {
 	var txHashes [][]byte
 	var txHash [32]byte
@@ -81,6 +224,52 @@ func (b *Block) HashTransaction() []byte {
 	return txHash[:]
 }
 
+// 按区块头版本计算交易的承诺值
+// Compute the commitment to the transactions according to the header version
+func (b *Block) computeMerkleRoot() []byte {
+	if b.Version == legacyBlockVersion {
+		return b.HashTransaction()
+	}
+
+	return merkleRoot(b.txIDs())
+}
+
+func (b *Block) txIDs() [][]byte {
+	var txIDs [][]byte
+	for _, tx := range b.Transactions {
+		txIDs = append(txIDs, tx.ID)
+	}
+
+	return txIDs
+}
+
+// 第index笔交易包含在区块中的证明。版本1的区块头承诺的是所有交易ID拼接后的哈希，
+// 证明只能是全部交易ID；之后的版本是Merkle分支
+// The proof that transaction index is included in the block. A version 1 header commits
+// to the hash of every transaction ID joined, so the proof is all transaction IDs; later
+// versions use the Merkle branch
+func (b *Block) TxProof(index int) [][]byte {
+	if b.Version == legacyBlockVersion {
+		return b.txIDs()
+	}
+
+	return merkleBranch(b.txIDs(), index)
+}
+
+// 根据区块头验证交易txID是有count笔交易的区块中的第index笔
+// Verify against the header that txID is transaction index of a block with count transactions
+func (h *BlockHeader) VerifyTxProof(txID []byte, index, count int, proof [][]byte) bool {
+	if h.Version != legacyBlockVersion {
+		return verifyMerkleBranch(txID, index, count, proof, h.MerkleRoot)
+	}
+	if len(proof) != count || index < 0 || index >= count || !bytes.Equal(proof[index], txID) {
+		return false
+	}
+	hash := sha256.Sum256(bytes.Join(proof, []byte{}))
+
+	return bytes.Equal(hash[:], h.MerkleRoot)
+}
+
 // 设置区块自身的Hash值
 // set the hash value for the block itself.
 //func (b *Block) SetHash()  {
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestDeserializeBlockRejectsMalformedData(t *testing.T) {
+	address := NewWallet().GetAddress()
+	data := newTestBlock(&Block{Hash: sha256Bytes([]byte("parent"))}, address).Serialize()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"hash", sha256Bytes([]byte("not a block"))},
+		{"truncated", data[:len(data)/2]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if block, err := DeserializeBlock(test.data); err == nil {
+				t.Fatalf("decoded block %x from malformed data", block.Hash)
+			}
+		})
+	}
+
+	if _, err := DeserializeBlock(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 无法解码的区块记录返回错误，HTTP处理函数不会panic
+// A block record that cannot be decoded returns an error, the HTTP handlers do not panic
+func TestGetMalformedBlock(t *testing.T) {
+	bc, _ := newTestChain(t, testChainParams())
+	hash := sha256Bytes([]byte("malformed"))
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(blocksBucket)).Put(hash, []byte("malformed"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bc.GetBlock(hash); err == nil {
+		t.Fatal("read a malformed block")
+	}
+
+	server := httptest.NewServer(NewRESTServer(bc).Handler())
+	t.Cleanup(server.Close)
+	resp, err := http.Get(server.URL + "/blocks/" + hex.EncodeToString(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("served a malformed block")
+	}
+}
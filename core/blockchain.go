@@ -1,9 +1,13 @@
 package core
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -12,38 +16,376 @@ import (
 // struct for the blockchain
 type BlockChain struct {
 	//Blocks []*Block
-	tip []byte // 区块链的最后一个区块的Hash  // the hash for the last block in the block chain
-	db  *bolt.DB
+	tip    []byte // 区块链的最后一个区块的Hash  // the hash for the last block in the block chain
+	db     *bolt.DB
+	events *EventBus // 区块和交易事件 block and transaction events
+	params ChainParams
+	faults func(point string) error // 测试注入故障的钩子，正常运行时为nil  // hook tests inject faults with, nil in normal operation
+}
+
+// 写区块时的故障点：测试可以在每一步之后注入写入错误或崩溃
+// Fault points while writing a block: tests can inject a write error or a crash after every step
+const (
+	faultConnectBlock        = "connect:block"        // 区块已写入 the block is written
+	faultConnectTip          = "connect:tip"          // 链末端已更新 the tip is updated
+	faultConnectCommitted    = "connect:committed"    // 事务已提交 the transaction is committed
+	faultDisconnectTip       = "disconnect:tip"       // 链末端已回退 the tip is moved back
+	faultDisconnectCommitted = "disconnect:committed" // 事务已提交 the transaction is committed
+)
+
+// 在故障点调用测试设置的钩子，没有钩子时什么也不做
+// Call the hook set by a test at the fault point, nothing happens without a hook
+func (bc *BlockChain) fault(point string) error {
+	if bc.faults == nil {
+		return nil
+	}
+
+	return bc.faults(point)
+}
+
+// 元数据中保存主链末端区块哈希的键，blocks bucket中只有区块，用户给出的哈希不会查到其他数据
+// Key of the hash of the tip block in the metadata, the blocks bucket holds only blocks so a
+// hash given by a user cannot find anything else
+const tipKey = "tip"
+
+// 在事务中读取主链末端区块的哈希。版本6之前的数据库把它保存在blocks bucket的"l"键中
+// Read the hash of the tip block within the transaction. Databases before version 6 keep it
+// under the "l" key of the blocks bucket
+func chainTip(tx *bolt.Tx) []byte {
+	if meta := tx.Bucket([]byte(metaBucket)); meta != nil {
+		if hash := meta.Get([]byte(tipKey)); hash != nil {
+			return hash
+		}
+	}
+
+	return tx.Bucket([]byte(blocksBucket)).Get([]byte(legacyTipKey))
+}
+
+func putChainTip(tx *bolt.Tx, hash []byte) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+
+	return meta.Put([]byte(tipKey), hash)
 }
 
 // MineBlock mines a new block with the provided transactions
 // 发送币意味着创建新的交易，并通过挖出新块的方式将交易打包到区块链中
 // Sending coins means creating a new transaction and
 // packing the transaction into the blockchain by mining a new block
-func (bc *BlockChain) MineBlock(transactions []*Transaction) {
-	var lastHash []byte
-	var err error
+func (bc *BlockChain) MineBlock(transactions []*Transaction) (*Block, error) {
+	var lastBlock *Block
 
-	bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
+	if err := bc.checkSnapshot(); err != nil {
+		return nil, err
+	}
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		lastHash := chainTip(tx)
+		data := tx.Bucket([]byte(blocksBucket)).Get(lastHash)
+		if data == nil {
+			return fmt.Errorf("tip block %x is missing", lastHash)
+		}
 
-		return nil
+		var err error
+		lastBlock, err = DeserializeBlock(data)
+
+		return err
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 打包前验证每一笔交易的签名脚本和锁定时间，时间锁定按链末端的中位时间判断
+	// Verify the scripts and the lock times of every transaction before packing them, time
+	// locks are evaluated against the median time past of the tip
+	medianTime, err := bc.medianTimePast(lastBlock.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.validateTransactions(transactions, lastBlock.Height+1, medianTime); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	newBlock := NewBlock(transactions, lastBlock.Hash, lastBlock.Height+1)
+	if err := bc.connectBlock(newBlock); err != nil {
+		return nil, err
+	}
 
-	newBlock := NewBlock(transactions, lastHash)
+	return newBlock, nil
+}
+
+// 把已验证的区块连接到链的末端，同时更新索引并发布事件
+// Connect a validated block to the end of the chain, updating the indexes and publishing events
+func (bc *BlockChain) connectBlock(block *Block) error {
+	// 启用了索引或有事件订阅者时需要被花费的输出
+	// The spent outputs are needed when any index is enabled or there are event subscribers
+	var prevOuts map[string]TXOutput
+	if bc.anyIndexEnabled() || bc.events.HasSubscribers() {
+		var err error
+		if prevOuts, err = bc.blockPrevOutputs(block); err != nil {
+			return err
+		}
+	}
 
-	bc.db.Update(func(tx *bolt.Tx) error {
+	// 区块、链末端和所有索引在同一个事务中写入，任何一步失败都会整体回滚
+	// The block, the tip and all indexes are written in one transaction,
+	// a failure at any step rolls back all of it
+	err := bc.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		err = b.Put(newBlock.Hash, newBlock.Serialize())
-		err = b.Put([]byte("l"), newBlock.Hash) // 存储链中最后一个块的哈希
+
+		// 挖矿期间链末端可能已被其他区块改变
+		// The tip may have been moved by another block while mining
+		if tip := chainTip(tx); !bytes.Equal(tip, block.PrevBlockHash) {
+			return fmt.Errorf("block %x does not extend the current tip %x", block.Hash, tip)
+		}
+
+		if err := b.Put(block.Hash, block.Serialize()); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(headersBucket)).Put(block.Hash, block.Header().Serialize()); err != nil {
+			return err
+		}
+		if err := updateBestHeader(tx, block.Header()); err != nil {
+			return err
+		}
+		if err := bc.fault(faultConnectBlock); err != nil {
+			return err
+		}
+		// 存储链中最后一个块的哈希
 		// Stores the hash of the last block in the chain
-		HandleErr(err)
+		if err := putChainTip(tx, block.Hash); err != nil {
+			return err
+		}
+		if err := bc.fault(faultConnectTip); err != nil {
+			return err
+		}
+
+		if err := connectBlockIndexes(tx, block, prevOuts); err != nil {
+			return err
+		}
+
+		// 修剪模式下删除超出保留范围的区块
+		// Delete the blocks outside the kept range in pruned mode
+		return pruneBlocks(tx)
+	})
+	if err != nil {
+		return err
+	}
+	// 事务已提交，只有内存中的状态还未更新
+	// The transaction is committed, only the in-memory state is not updated yet
+	if err := bc.fault(faultConnectCommitted); err != nil {
+		return err
+	}
+	bc.tip = block.Hash
+
+	bc.events.publishBlock(EventBlockConnected, block, prevOuts)
+
+	return nil
+}
+
+// 验证从其他来源(导入文件或其他节点)得到的区块，并把它连接到链的末端
+// Validate a block obtained elsewhere (an import file or another node) and connect it to the end of the chain
+func (bc *BlockChain) AddBlock(block *Block) error {
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.PrevBlockHash, tip.Hash) || block.Height != tip.Height+1 {
+		return fmt.Errorf("block %x at height %d does not extend the tip %x at height %d",
+			block.Hash, block.Height, tip.Hash, tip.Height)
+	}
+	if err := bc.validateBlock(block); err != nil {
+		return err
+	}
+
+	return bc.connectBlock(block)
+}
+
+// 从链上移除最新区块，区块数据仍然保留，链的末端回到前一个区块
+// Disconnect the latest block from the chain, its data is kept and the tip
+// moves back to the previous block
+func (bc *BlockChain) DisconnectTip() (*Block, error) {
+	block, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.PrevBlockHash) == 0 {
+		return nil, fmt.Errorf("the genesis block cannot be disconnected")
+	}
+	// 新的链末端必须是完整区块
+	// The new tip must be a full block
+	if _, err := bc.GetBlock(block.PrevBlockHash); err != nil {
+		return nil, fmt.Errorf("cannot disconnect block %x: %v", block.Hash, err)
+	}
+
+	var prevOuts map[string]TXOutput
+	if bc.anyIndexEnabled() {
+		if prevOuts, err = bc.blockPrevOutputs(block); err != nil {
+			return nil, err
+		}
+	}
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		if tip := chainTip(tx); !bytes.Equal(tip, block.Hash) {
+			return fmt.Errorf("block %x is no longer the tip, the tip is %x", block.Hash, tip)
+		}
+		if err := putChainTip(tx, block.PrevBlockHash); err != nil {
+			return err
+		}
+		if err := bc.fault(faultDisconnectTip); err != nil {
+			return err
+		}
+
+		return disconnectBlockIndexes(tx, block, prevOuts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.fault(faultDisconnectCommitted); err != nil {
+		return nil, err
+	}
+	bc.tip = block.PrevBlockHash
+
+	bc.events.publishBlock(EventBlockDisconnected, block, prevOuts)
+
+	return block, nil
+}
+
+// 重组到分叉链：branch从主链的一个区块分出，按高度排列。分叉链的工作量必须多于它替换的主链区块，
+// 移除任何区块前先对分叉区块做不依赖链的检查。分叉区块连接失败时移除已连接的分叉区块并重新连接
+// 原来的区块。出错时返回无效的分叉区块，错误与分叉区块无关时为nil
+// Reorganize to a fork: branch leaves the main chain at one of its blocks and is in height order.
+// The branch must have more work than the main chain blocks it replaces, and its blocks pass the
+// checks that do not need the chain before anything is disconnected. When a branch block fails to
+// connect, the branch blocks connected so far are disconnected and the original blocks connected
+// again. On error returns the invalid branch block, nil when the error is not about one
+func (bc *BlockChain) Reorganize(branch []*Block) (*Block, error) {
+	if len(branch) == 0 {
+		return nil, fmt.Errorf("the branch is empty")
+	}
+	work := new(big.Int)
+	for i, block := range branch {
+		if i > 0 && (!bytes.Equal(block.PrevBlockHash, branch[i-1].Hash) || block.Height != branch[i-1].Height+1) {
+			return block, fmt.Errorf("block %x does not extend the previous block of the branch", block.Hash)
+		}
+		if err := block.checkBlock(); err != nil {
+			return block, err
+		}
+		work.Add(work, block.work())
+	}
+
+	mainWork, err := bc.chainWorkAfter(branch[0].PrevBlockHash)
+	if err != nil {
+		return nil, err
+	}
+	if work.Cmp(mainWork) <= 0 {
+		return nil, fmt.Errorf("the branch to %x does not have more work than the main chain", branch[len(branch)-1].Hash)
+	}
+
+	var disconnected []*Block
+	for !bytes.Equal(bc.tip, branch[0].PrevBlockHash) {
+		block, err := bc.DisconnectTip()
+		if err != nil {
+			return nil, bc.restoreChain(0, disconnected, err)
+		}
+		disconnected = append(disconnected, block)
+	}
+	for i, block := range branch {
+		if err := bc.AddBlock(block); err != nil {
+			return block, bc.restoreChain(i, disconnected, err)
+		}
+	}
+
+	return nil, nil
+}
+
+// 重组失败后恢复原来的主链：移除connected个已连接的分叉区块，再按相反的顺序连接移除的区块。
+// 返回导致重组失败的错误，恢复也失败时包含两个错误
+// Restore the original main chain after a failed reorganization: disconnect the connected branch
+// blocks, then connect the disconnected blocks in reverse order. Returns the error that made the
+// reorganization fail, with both errors when restoring fails too
+func (bc *BlockChain) restoreChain(connected int, disconnected []*Block, cause error) error {
+	for i := 0; i < connected; i++ {
+		if _, err := bc.DisconnectTip(); err != nil {
+			return fmt.Errorf("%w, then restoring the chain failed: %v", cause, err)
+		}
+	}
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if err := bc.connectBlock(disconnected[i]); err != nil {
+			return fmt.Errorf("%w, then restoring the chain failed: %v", cause, err)
+		}
+	}
+
+	return cause
+}
 
-		bc.tip = newBlock.Hash
+// 最新区块的高度
+// Height of the latest block
+func (bc *BlockChain) GetBestHeight() int {
+	height, err := bc.bestHeight()
+	HandleErr(err)
+
+	return height
+}
+
+// 最新区块的高度，读取失败时返回错误
+// The height of the latest block, returns an error when it cannot be read
+func (bc *BlockChain) bestHeight() (int, error) {
+	var lastBlock *Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+
+		var err error
+		if lastBlock, err = DeserializeBlock(b.Get(bc.tip)); err != nil {
+			return fmt.Errorf("tip block %x: %v", bc.tip, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return lastBlock.Height, nil
+}
+
+// 根据哈希读取区块
+// Read a block by its hash
+func (bc *BlockChain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(blocksBucket)).Get(hash)
+		if data != nil {
+			var err error
+			if block, err = DeserializeBlock(data); err != nil {
+				return fmt.Errorf("block %x: %v", hash, err)
+			}
+			return nil
+		}
+
+		// 修剪后的区块只剩下区块头
+		// Only the header of a pruned block is left
+		if data := tx.Bucket([]byte(headersBucket)).Get(hash); data != nil {
+			header, err := decodeBlockHeader(data)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("block %x at height %d has been %w", hash, header.Height, errBlockPruned)
+		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+
+	return block, nil
 }
 
 // 迭代器的初始状态为链中的 tip，因此区块将从尾到头（创世块为头）
@@ -60,23 +402,23 @@ func (bc *BlockChain) Iterator() *BlockchainIterator {
 // Spendable outputs
 func (bc *BlockChain) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
 	unspentOutputs := make(map[string][]int)
-	// 该地址没有被花掉的交易，意思说交易有输出没有被输入引用
-	// There is no spent transaction at this address,
-	// which means that the transaction has an output that is not referenced by an input
-	unspentTXs := bc.FindUnspentTransactions(address)
 	accumulated := 0 // 总币数 total coin
 
-Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
-		for outIdx, out := range tx.Vout {
-			if out.CanBeUnlockedWith(address) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				if accumulated >= amount {
-					break Work
-				}
-			}
+	// 未成熟的挖矿奖励和锁定时间未到的输出在下一个区块中还不能被花费
+	// Immature coinbase outputs and outputs whose lock time has not passed
+	// cannot be spent in the next block yet
+	nextHeight := bc.GetBestHeight() + 1
+	now := time.Now().Unix()
+
+	for _, utxo := range bc.FindUTXOs(address) {
+		if !utxo.IsSpendable(nextHeight, now, bc.params) {
+			continue
+		}
+		txID := hex.EncodeToString(utxo.TxID)
+		accumulated += utxo.Output.Value
+		unspentOutputs[txID] = append(unspentOutputs[txID], utxo.Index)
+		if accumulated >= amount {
+			break
 		}
 	}
 
@@ -87,6 +429,27 @@ Work:
 // Find the set of all transactions that contain unspent outputs
 func (bc *BlockChain) FindUnspentTransactions(address string) []Transaction {
 	var unspentTXs []Transaction
+
+	// 启用了地址索引时只需读取该地址的交易
+	// Only the transactions of the address have to be read when the address index is enabled
+	if bc.indexEnabled(addrIndexer{}) {
+		utxos, err := bc.findUTXOsIndexed(address)
+		HandleErr(err)
+		unspent := make(map[string]bool)
+		for _, utxo := range utxos {
+			unspent[string(utxo.TxID)] = true
+		}
+		_, txs, err := bc.findAddressTransactionsIndexed(address)
+		HandleErr(err)
+		for _, tx := range txs {
+			if unspent[string(tx.ID)] {
+				unspentTXs = append(unspentTXs, *tx)
+			}
+		}
+
+		return unspentTXs
+	}
+
 	spentTXOs := make(map[string][]int)
 	bci := bc.Iterator()
 
@@ -114,12 +477,12 @@ func (bc *BlockChain) FindUnspentTransactions(address string) []Transaction {
 
 			// 判断是否是创世区块
 			// determine if it is genesis block
+			// 输入是否属于address由脚本决定，这里记录所有被花费的输出
+			// Whether an input belongs to address is up to the scripts, so record every spent output
 			if tx.IsCoinbase() == false {
 				for _, in := range tx.Vin {
-					if in.CanUnlockOutputWith(address) {
-						inTxID := hex.EncodeToString(in.Txid)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-					}
+					inTxID := hex.EncodeToString(in.Txid)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
 				}
 			}
 		}
@@ -139,18 +502,84 @@ func (bc *BlockChain) FindUnspentTransactions(address string) []Transaction {
 func (bc *BlockChain) FindUTXO(address string) []TXOutput {
 	var UTXOs []TXOutput
 
-	// 所有包含未花费输出的交易
-	unspentTransactions := bc.FindUnspentTransactions(address)
+	for _, utxo := range bc.FindUTXOs(address) {
+		UTXOs = append(UTXOs, utxo.Output)
+	}
+
+	return UTXOs
+}
+
+// 根据ID查找交易，同时返回包含它的区块高度
+// Find a transaction by its ID, together with the height of the block containing it
+func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, int, error) {
+	block, err := bc.findTransactionBlock(ID)
+	if err != nil {
+		return Transaction{}, 0, err
+	}
+
+	for _, tx := range block.Transactions {
+		if bytes.Equal(tx.ID, ID) {
+			return *tx, block.Height, nil
+		}
+	}
+
+	return Transaction{}, 0, fmt.Errorf("transaction %x not found", ID)
+}
 
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Vout {
-			if out.CanBeUnlockedWith(address) {
-				UTXOs = append(UTXOs, out)
+// 查找交易的输入所引用的所有交易
+// Find all the transactions referenced by the inputs of tx
+func (bc *BlockChain) findPrevTransactions(tx *Transaction) (map[string]Transaction, error) {
+	prevTXs := make(map[string]Transaction)
+
+	for _, in := range tx.Vin {
+		prevTX, _, err := bc.FindTransaction(in.Txid)
+		if err != nil {
+			// 修剪后的区块中的交易只能从未花费输出集合中得到被花费的输出
+			// Of a transaction in a pruned block only the spent output is known, from the UTXO set
+			entry, _, setErr := bc.lookupUTXOSet(in.Txid, in.Vout)
+			if setErr != nil || entry == nil {
+				return nil, err
+			}
+			prevTX = prevTXs[hex.EncodeToString(in.Txid)]
+			prevTX.ID = in.Txid
+			for len(prevTX.Vout) <= in.Vout {
+				prevTX.Vout = append(prevTX.Vout, TXOutput{})
 			}
+			prevTX.Vout[in.Vout] = entry.Output
 		}
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	return UTXOs
+	return prevTXs, nil
+}
+
+// 使用钱包对交易签名
+// Sign the transaction with the wallet
+func (bc *BlockChain) SignTransaction(tx *Transaction, wallet *Wallet) error {
+	prevTXs, err := bc.findPrevTransactions(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Sign(wallet, prevTXs)
+}
+
+// 执行脚本验证交易的所有输入
+// Verify all inputs of the transaction by executing their scripts
+func (bc *BlockChain) VerifyTransaction(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	prevTXs, err := bc.findPrevTransactions(tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Verify(prevTXs); err != nil {
+		return &consensusError{err}
+	}
+
+	return nil
 }
 
 // 判断db数据库是否存在，也就是判断文件是否存在
@@ -195,9 +624,29 @@ func NewBlockChain() *BlockChain {
 		os.Exit(1)
 	}
 
+	bc, err := openBlockChain(dbFile, DefaultChainParams(), os.Stdout)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	return bc
+}
+
+// 打开path上的区块链数据库，旧版本程序创建的数据库先升级到当前结构
+// Open the blockchain database at path, databases created by older binaries are upgraded
+// to the current schema first
+func openBlockChain(path string, params ChainParams, log io.Writer) (*BlockChain, error) {
 	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil)
-	HandleErr(err)
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateDB(db, false, log); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	// 打开一个 BoltDB 文件的标准做法:这个数据库是key-value形式的。
 	// 数据库操作通过一个事务（transaction）进行操作。有两种类型的事务：只读（read-only）和读写（read-write）
@@ -209,13 +658,15 @@ func NewBlockChain() *BlockChain {
 		   because we may add a genesis block to the database
 	*/
 	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket)) // 获取区块链数据 // obtain blockchain data
-		tip = b.Get([]byte("l"))             // 最后一个区块的哈希值 // hash value of the last block
+		// 最后一个区块的哈希值，复制一份，事务结束后数据库返回的切片不再有效
+		// hash value of the last block, copied because the slice returned by the database
+		// is only valid within the transaction
+		tip = append([]byte{}, chainTip(tx)...)
 
 		return nil
 	})
 
-	return &BlockChain{tip, db}
+	return &BlockChain{tip: tip, db: db, events: NewEventBus(), params: params}, nil
 }
 
 // 创建区块链，即是初始化区块链，添加创世区块
@@ -225,32 +676,73 @@ func CreateBlockchain(address string) *BlockChain {
 		fmt.Println("Blockchain already exists.")
 		os.Exit(1)
 	}
-	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil)
+
+	// 创世区块交易，只有输出，没有输入
+	// Genesis block transaction, only output, no input
+	cbtx := NewCoinbaseTransaction(address, genesisCoinbaseData)
+	genesis := NewGenesisBlock(cbtx)
+
+	bc, err := createBlockchainWithGenesis(genesis)
 	HandleErr(err)
 
-	db.Update(func(tx *bolt.Tx) error {
-		// 创世区块交易，只有输出，没有输入
-		// Genesis block transaction, only output, no input
-		cbtx := NewCoinbaseTransaction(address, genesisCoinbaseData)
-		genesis := NewGenesisBlock(cbtx)
+	return bc
+}
 
-		b, err := tx.CreateBucket([]byte(blocksBucket))
-		HandleErr(err)
+// 用给定的创世区块创建区块链数据库
+// Create the blockchain database with the given genesis block
+func createBlockchainWithGenesis(genesis *Block) (*BlockChain, error) {
+	return createBlockchainDB(dbFile, genesis, DefaultChainParams())
+}
 
-		err = b.Put(genesis.Hash, genesis.Serialize())
-		HandleErr(err)
+// 在path上创建以genesis为创世区块的区块链数据库
+// Create a blockchain database at path with genesis as its genesis block
+func createBlockchainDB(path string, genesis *Block, params ChainParams) (*BlockChain, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
 
-		err = b.Put([]byte("l"), genesis.Hash) // 最新块哈希值 // Hash value of the genesis hash
-		HandleErr(err)
-		tip = genesis.Hash
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(genesis.Hash, genesis.Serialize()); err != nil {
+			return err
+		}
+		// 最新块哈希值
+		// Hash value of the genesis hash
+		if err := putChainTip(tx, genesis.Hash); err != nil {
+			return err
+		}
+		headers, err := tx.CreateBucket([]byte(headersBucket))
+		if err != nil {
+			return err
+		}
+		if err := headers.Put(genesis.Hash, genesis.Header().Serialize()); err != nil {
+			return err
+		}
 
-		return nil
-	})
+		// 新的区块链默认启用交易索引和未花费输出集合
+		// New blockchains have the transaction index and the UTXO set enabled by default
+		if _, err := tx.CreateBucket([]byte(txIndexBucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(utxoSetBucket)); err != nil {
+			return err
+		}
+		if err := setSchemaVersion(tx, currentSchemaVersion); err != nil {
+			return err
+		}
 
-	bc := BlockChain{tip, db}
+		return connectBlockIndexes(tx, genesis, nil)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	return &bc
+	return &BlockChain{tip: genesis.Hash, db: db, events: NewEventBus(), params: params}, nil
 }
 
 // 关闭db数据库连接
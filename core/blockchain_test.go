@@ -0,0 +1,192 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 测试用的链参数：挖矿奖励立即成熟
+// Chain parameters for tests: coinbase rewards mature immediately
+func testChainParams() ChainParams {
+	return ChainParams{CoinbaseMaturity: 0}
+}
+
+// 在临时目录中创建一条只有创世区块的链，创世区块的奖励属于返回的钱包
+// Create a chain with only a genesis block in a temporary directory, the genesis
+// reward belongs to the returned wallet
+func newTestChain(t *testing.T, params ChainParams) (*BlockChain, *Wallet) {
+	t.Helper()
+
+	wallet := NewWallet()
+	genesis := solveTestBlock([]*Transaction{NewCoinbaseTransaction(wallet.GetAddress(), "")}, []byte{}, 0)
+	bc, err := createBlockchainDB(filepath.Join(t.TempDir(), "blockchain.db"), genesis, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(bc.DbClose)
+
+	return bc, wallet
+}
+
+// 创建一笔由wallet签名的交易，先用edit修改未签名的交易
+// Create a transaction signed by wallet, edit changes the unsigned transaction first
+func newTestTransaction(t *testing.T, bc *BlockChain, wallet *Wallet, recipients []Recipient, opts TxOptions, edit func(*Transaction)) *Transaction {
+	t.Helper()
+
+	tx, err := newUnsignedTransaction(wallet.GetAddress(), recipients, opts, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		edit(tx)
+		tx.ID = tx.Hash()
+	}
+	if err := bc.SignTransaction(tx, wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// 不打印进度地为区块计算工作量证明
+// Compute the proof of work of a block without printing progress
+func solveTestBlock(txs []*Transaction, prevBlockHash []byte, height int) *Block {
+	block := newBlockTemplate(txs, prevBlockHash, height)
+	block.Nonce, block.Hash, _ = NewProofOfWork(block).solve(nil)
+
+	return block
+}
+
+// 在parent之后挖出一个奖励给to并包含txs的区块，不连接到链上
+// Mine a block after parent rewarding to and containing txs, without connecting it
+func newTestBlock(parent *Block, to string, txs ...*Transaction) *Block {
+	txs = append([]*Transaction{NewCoinbaseTransaction(to, "")}, txs...)
+
+	return solveTestBlock(txs, parent.Hash, parent.Height+1)
+}
+
+// 挖出奖励给to并包含txs的下一个区块并连接到链上
+// Mine the next block rewarding to and containing txs, and connect it to the chain
+func mineTestBlock(t *testing.T, bc *BlockChain, to string, txs ...*Transaction) *Block {
+	t.Helper()
+
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := newTestBlock(tip, to, txs...)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// 在parent之后挖出n个区块的分叉链
+// Mine a fork of n blocks after parent
+func newTestBranch(parent *Block, n int) []*Block {
+	var branch []*Block
+	for i := 0; i < n; i++ {
+		block := newTestBlock(parent, NewWallet().GetAddress())
+		branch = append(branch, block)
+		parent = block
+	}
+
+	return branch
+}
+
+// 在主链的创世区块之后挖出两个区块，返回创世区块和链末端
+// Mine two blocks after the genesis block of the main chain, returns the genesis block and the tip
+func newTestForkChain(t *testing.T) (*BlockChain, *Wallet, *Block, *Block) {
+	t.Helper()
+
+	bc, wallet := newTestChain(t, testChainParams())
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, wallet.GetAddress())
+	tip := mineTestBlock(t, bc, wallet.GetAddress())
+
+	return bc, wallet, genesis, tip
+}
+
+func TestReorganize(t *testing.T) {
+	bc, _, genesis, _ := newTestForkChain(t)
+
+	branch := newTestBranch(genesis, 3)
+	if invalid, err := bc.Reorganize(branch); err != nil {
+		t.Fatalf("reorganize: %v (invalid block %v)", err, invalid != nil)
+	}
+	if !bytes.Equal(bc.tip, branch[2].Hash) || bc.GetBestHeight() != 3 {
+		t.Fatalf("tip %x at height %d after the reorganization", bc.tip, bc.GetBestHeight())
+	}
+}
+
+func TestReorganizeNeedsMoreWork(t *testing.T) {
+	bc, _, genesis, tip := newTestForkChain(t)
+
+	// 与主链一样长的分叉链工作量相同，不会重组
+	// A fork as long as the main chain has the same work and is not reorganized to
+	_, err := bc.Reorganize(newTestBranch(genesis, 2))
+	if err == nil || !strings.Contains(err.Error(), "more work") {
+		t.Fatalf("reorganize to an equal fork: got %v", err)
+	}
+	if !bytes.Equal(bc.tip, tip.Hash) {
+		t.Fatalf("tip %x, want %x", bc.tip, tip.Hash)
+	}
+}
+
+func TestReorganizeRestoresTipOnInvalidBlock(t *testing.T) {
+	bc, wallet, genesis, tip := newTestForkChain(t)
+	balance := len(bc.FindUTXO(wallet.GetAddress()))
+
+	// 分叉链的最后一个区块的挖矿奖励过多，只有在连接时才能发现
+	// The last block of the fork claims too much reward, which is only found when connecting it
+	branch := newTestBranch(genesis, 2)
+	coinbase := NewCoinbaseTransaction(NewWallet().GetAddress(), "")
+	coinbase.Vout[0].Value = subsidy * 2
+	coinbase.SetID()
+	branch = append(branch, solveTestBlock([]*Transaction{coinbase}, branch[1].Hash, branch[1].Height+1))
+
+	invalid, err := bc.Reorganize(branch)
+	if err == nil {
+		t.Fatal("reorganized to a fork with an invalid block")
+	}
+	if invalid == nil || !bytes.Equal(invalid.Hash, branch[2].Hash) {
+		t.Fatalf("the invalid block was not reported: %v", err)
+	}
+	if !isConsensusError(err) {
+		t.Fatalf("the error of the invalid block is not a consensus error: %v", err)
+	}
+	if !bytes.Equal(bc.tip, tip.Hash) || bc.GetBestHeight() != tip.Height {
+		t.Fatalf("tip %x at height %d, want %x at height %d", bc.tip, bc.GetBestHeight(), tip.Hash, tip.Height)
+	}
+	if got := len(bc.FindUTXO(wallet.GetAddress())); got != balance {
+		t.Fatalf("%d outputs of the wallet after the failed reorganization, want %d", got, balance)
+	}
+
+	// 原来的链可以继续延长
+	// The original chain can still be extended
+	mineTestBlock(t, bc, wallet.GetAddress())
+	if bc.GetBestHeight() != tip.Height+1 {
+		t.Fatalf("height %d after extending the restored chain", bc.GetBestHeight())
+	}
+}
+
+func TestReorganizeRejectsBadBlockBeforeDisconnecting(t *testing.T) {
+	bc, _, genesis, tip := newTestForkChain(t)
+
+	branch := newTestBranch(genesis, 3)
+	branch[1].MerkleRoot = make([]byte, len(branch[1].MerkleRoot))
+
+	invalid, err := bc.Reorganize(branch)
+	if err == nil || invalid == nil || !bytes.Equal(invalid.Hash, branch[1].Hash) || !isConsensusError(err) {
+		t.Fatalf("fork with a bad header: invalid block %v, error %v", invalid != nil, err)
+	}
+	if !bytes.Equal(bc.tip, tip.Hash) {
+		t.Fatalf("tip %x, want %x", bc.tip, tip.Hash)
+	}
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 紧凑区块过滤器未启用
+// The compact block filters are not enabled
+var errCFiltersDisabled = errors.New("compact block filters are not enabled, build them with reindex -cfilters")
+
+// 紧凑区块过滤器索引：区块哈希 -> 区块的Golomb编码集合过滤器。轻节点下载过滤器后在本地匹配
+// 自己的地址，只下载命中的区块，不会像按地址过滤区块那样把地址告诉完整节点
+// Compact block filter index: block hash -> Golomb coded set filter of the block. Light clients
+// download the filters and match their own addresses locally, then download only the blocks
+// that hit. Unlike filtering blocks by address they do not tell the full node their addresses
+type cfIndexer struct{}
+
+func (cfIndexer) Name() string {
+	return "cfilters"
+}
+
+func (cfIndexer) Bucket() []byte {
+	return []byte(cfIndexBucket)
+}
+
+func (ix cfIndexer) ConnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	return dbTx.Bucket(ix.Bucket()).Put(block.Hash, buildBlockFilter(block))
+}
+
+func (ix cfIndexer) DisconnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	return dbTx.Bucket(ix.Bucket()).Delete(block.Hash)
+}
+
+// 过滤器的元素：所有输出的锁定脚本(OP_RETURN数据输出除外)和所有被花费的输出
+// Elements of the filter: the locking script of every output (except OP_RETURN data outputs)
+// and every spent output
+func blockFilterElements(block *Block) [][]byte {
+	var elements [][]byte
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Vout {
+			if len(out.ScriptPubKey) > 0 && ClassifyScript(out.ScriptPubKey) != NullDataTy {
+				elements = append(elements, out.ScriptPubKey)
+			}
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Vin {
+			elements = append(elements, filterOutpoint(in.Txid, in.Vout))
+		}
+	}
+
+	return elements
+}
+
+// 过滤器中输出引用的编码：交易ID | 输出序号(4字节大端)
+// Encoding of an output reference in filters: txid | output index(4 bytes big endian)
+func filterOutpoint(txID []byte, vout int) []byte {
+	element := make([]byte, len(txID)+4)
+	copy(element, txID)
+	binary.BigEndian.PutUint32(element[len(txID):], uint32(vout))
+
+	return element
+}
+
+// SipHash的密钥是区块哈希的前16字节，每个区块的映射都不同
+// The SipHash key is the first 16 bytes of the block hash, so every block maps differently
+func blockFilterKey(blockHash []byte) [16]byte {
+	var key [16]byte
+	copy(key[:], blockHash)
+
+	return key
+}
+
+func buildBlockFilter(block *Block) []byte {
+	return buildGCSFilter(blockFilterKey(block.Hash), blockFilterElements(block))
+}
+
+// 区块的紧凑过滤器
+// The compact filter of a block
+type BlockFilter struct {
+	BlockHash []byte
+	Filter    []byte
+}
+
+// 区块的过滤器
+// The filter of a block
+func (bc *BlockChain) GetCFilter(hash []byte) ([]byte, error) {
+	var filter []byte
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(cfIndexBucket))
+		if bucket == nil {
+			return errCFiltersDisabled
+		}
+		data := bucket.Get(hash)
+		if data == nil {
+			return fmt.Errorf("no filter for block %x", hash)
+		}
+		filter = append([]byte{}, data...)
+
+		return nil
+	})
+
+	return filter, err
+}
+
+// 从区块stop向前到高度start的过滤器，按高度排列，最多max个
+// The filters from height start up to block stop in height order, at most max of them
+func (bc *BlockChain) GetCFilters(start int, stop []byte, max int) ([]BlockFilter, error) {
+	var filters []BlockFilter
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(cfIndexBucket))
+		if bucket == nil {
+			return errCFiltersDisabled
+		}
+		headers := tx.Bucket([]byte(headersBucket))
+		header, err := readBlockHeader(headers, stop)
+		if err != nil {
+			return err
+		}
+		if start < 0 || start > header.Height || header.Height-start >= max {
+			return fmt.Errorf("invalid filter range from height %d to %d", start, header.Height)
+		}
+
+		filters = make([]BlockFilter, header.Height-start+1)
+		for {
+			filter := bucket.Get(header.Hash)
+			if filter == nil {
+				return fmt.Errorf("no filter for block %x", header.Hash)
+			}
+			filters[header.Height-start] = BlockFilter{header.Hash, append([]byte{}, filter...)}
+			if header.Height == start {
+				return nil
+			}
+			if header, err = readBlockHeader(headers, header.PrevBlockHash); err != nil {
+				return err
+			}
+		}
+	})
+
+	return filters, err
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 链文件格式：文件头(魔数和版本)，之后每个区块为 长度(4字节大端) | 序列化的区块，从创世区块开始按顺序排列
+// Chain file format: a header (magic and version) followed by every block as
+// length(4 bytes big endian) | serialized block, in order starting with the genesis block
+const (
+	chainFileMagic   = "COINCHAIN"
+	chainFileVersion = 1
+
+	// 单个区块的最大长度，防止损坏的文件导致分配过大的内存
+	// Max size of a single block, so a corrupt file cannot cause a huge allocation
+	maxChainFileBlockSize = 32 << 20
+)
+
+// 把整条链导出到w，返回导出的区块数
+// Export the whole chain to w, returns the number of exported blocks
+func (bc *BlockChain) ExportChain(w io.Writer) (int, error) {
+	if err := bc.requireFullChain("exporting the chain"); err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.WriteString(chainFileMagic); err != nil {
+		return 0, err
+	}
+	if err := bw.WriteByte(chainFileVersion); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, block := range bc.chainBlocks() {
+		data := block.Serialize()
+		if err := binary.Write(bw, binary.BigEndian, uint32(len(data))); err != nil {
+			return count, err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, bw.Flush()
+}
+
+// 读取链文件的文件头
+// Read the header of a chain file
+func readChainFileHeader(r io.Reader) error {
+	header := make([]byte, len(chainFileMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("reading chain file header: %v", err)
+	}
+	if !bytes.Equal(header[:len(chainFileMagic)], []byte(chainFileMagic)) {
+		return fmt.Errorf("not a chain file")
+	}
+	if header[len(chainFileMagic)] != chainFileVersion {
+		return fmt.Errorf("unsupported chain file version %d", header[len(chainFileMagic)])
+	}
+
+	return nil
+}
+
+// 读取链文件中的下一个区块，文件结束时返回io.EOF
+// Read the next block of a chain file, io.EOF is returned at the end of the file
+func readChainFileBlock(r io.Reader) (*Block, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading block length: %v", err)
+	}
+	if size == 0 || size > maxChainFileBlockSize {
+		return nil, fmt.Errorf("invalid block length %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading block: %v", err)
+	}
+
+	return DeserializeBlock(data)
+}
+
+// 读取链文件的第一个区块，它必须是有效的创世区块
+// Read the first block of a chain file, which must be a valid genesis block
+func readChainFileGenesis(r io.Reader) (*Block, error) {
+	genesis, err := readChainFileBlock(r)
+	if err == io.EOF {
+		return nil, fmt.Errorf("chain file has no blocks")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(genesis.PrevBlockHash) != 0 || genesis.Height != 0 {
+		return nil, fmt.Errorf("the first block %x is not a genesis block", genesis.Hash)
+	}
+	if err := genesis.checkHeader(); err != nil {
+		return nil, err
+	}
+
+	return genesis, nil
+}
+
+// 从链文件导入区块到新的区块链数据库：每个区块都经过完整验证后再连接到链上，
+// 交易索引默认重建，addrIndex为true时同时建立地址索引，prune启用时导入过程中就会修剪。
+// 返回导入后的区块链和区块数
+// Import the blocks of a chain file into a new blockchain database: every block is fully
+// validated before it is connected to the chain. The transaction index is always rebuilt,
+// the address index too when addrIndex is true. With prune enabled blocks are already
+// pruned while importing. Returns the imported chain and its block count
+func ImportChain(r io.Reader, addrIndex bool, prune PruneConfig) (*BlockChain, int, error) {
+	if dbExists() {
+		return nil, 0, fmt.Errorf("blockchain already exists, import needs a fresh data directory")
+	}
+
+	br := bufio.NewReader(r)
+	if err := readChainFileHeader(br); err != nil {
+		return nil, 0, err
+	}
+
+	genesis, err := readChainFileGenesis(br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bc, err := createBlockchainWithGenesis(genesis)
+	if err != nil {
+		return nil, 0, err
+	}
+	if addrIndex {
+		if err := bc.Reindex(addrIndexer{}.Name()); err != nil {
+			return bc, 1, err
+		}
+	}
+	if prune.Enabled() {
+		if err := bc.SetPruneConfig(prune); err != nil {
+			return bc, 1, err
+		}
+	}
+
+	count := 1
+	for {
+		block, err := readChainFileBlock(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bc, count, fmt.Errorf("block %d: %v", count, err)
+		}
+		if err := bc.AddBlock(block); err != nil {
+			return bc, count, fmt.Errorf("block %d: %v", count, err)
+		}
+		count++
+	}
+
+	return bc, count, nil
+}
+
+// 导入失败时删除不完整的区块链数据库
+// Remove the incomplete blockchain database after a failed import
+func removeChainDB(bc *BlockChain) error {
+	if bc != nil {
+		bc.DbClose()
+	}
+
+	return os.Remove(dbFile)
+}
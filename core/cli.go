@@ -1,10 +1,19 @@
 package core
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // cli命令常量列表
@@ -14,6 +23,34 @@ const (
 	cliCreateBlockchain = "createblockchain"
 	cliSend             = "send"
 	cliPrintChain       = "printchain"
+	cliCreateWallet     = "createwallet"
+	cliListAddresses    = "listaddresses"
+	cliGetPubKey        = "getpubkey"
+	cliCreateMultiSig   = "createmultisig"
+	cliSignTx           = "signtx"
+	cliSendTx           = "sendtx"
+	cliMine             = "mine"
+	cliSendMany         = "sendmany"
+	cliListTransactions = "listtransactions"
+	cliReindex          = "reindex"
+	cliGetTransaction   = "gettransaction"
+	cliExplorer         = "explorer"
+	cliRESTAPI          = "restapi"
+	cliExportChain      = "exportchain"
+	cliImportChain      = "importchain"
+	cliMigrate          = "migrate"
+	cliPrune            = "prune"
+	cliDumpUTXO         = "dumputxo"
+	cliLoadUTXO         = "loadutxo"
+	cliValidateSnapshot = "validatesnapshot"
+	cliStartNode        = "startnode"
+	cliSPVSync          = "spvsync"
+	cliSPVBalance       = "spvbalance"
+	cliGetPeerInfo      = "getpeerinfo"
+	cliListBanned       = "listbanned"
+	cliSetBan           = "setban"
+	cliClearBanned      = "clearbanned"
+	cliGetMempool       = "getmempool"
 )
 
 // cli命令结构体
@@ -32,12 +69,100 @@ func (cli *CLI) Run() {
 	createBlockchainCmd := flag.NewFlagSet(cliCreateBlockchain, flag.ExitOnError)
 	sendCmd := flag.NewFlagSet(cliSend, flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet(cliPrintChain, flag.ExitOnError)
+	createWalletCmd := flag.NewFlagSet(cliCreateWallet, flag.ExitOnError)
+	listAddressesCmd := flag.NewFlagSet(cliListAddresses, flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet(cliGetPubKey, flag.ExitOnError)
+	createMultiSigCmd := flag.NewFlagSet(cliCreateMultiSig, flag.ExitOnError)
+	signTxCmd := flag.NewFlagSet(cliSignTx, flag.ExitOnError)
+	sendTxCmd := flag.NewFlagSet(cliSendTx, flag.ExitOnError)
+	mineCmd := flag.NewFlagSet(cliMine, flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet(cliSendMany, flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet(cliListTransactions, flag.ExitOnError)
+	reindexCmd := flag.NewFlagSet(cliReindex, flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet(cliGetTransaction, flag.ExitOnError)
+	explorerCmd := flag.NewFlagSet(cliExplorer, flag.ExitOnError)
+	restAPICmd := flag.NewFlagSet(cliRESTAPI, flag.ExitOnError)
+	exportChainCmd := flag.NewFlagSet(cliExportChain, flag.ExitOnError)
+	importChainCmd := flag.NewFlagSet(cliImportChain, flag.ExitOnError)
+	migrateCmd := flag.NewFlagSet(cliMigrate, flag.ExitOnError)
+	pruneCmd := flag.NewFlagSet(cliPrune, flag.ExitOnError)
+	dumpUTXOCmd := flag.NewFlagSet(cliDumpUTXO, flag.ExitOnError)
+	loadUTXOCmd := flag.NewFlagSet(cliLoadUTXO, flag.ExitOnError)
+	validateSnapshotCmd := flag.NewFlagSet(cliValidateSnapshot, flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet(cliStartNode, flag.ExitOnError)
+	spvSyncCmd := flag.NewFlagSet(cliSPVSync, flag.ExitOnError)
+	spvBalanceCmd := flag.NewFlagSet(cliSPVBalance, flag.ExitOnError)
+	getPeerInfoCmd := flag.NewFlagSet(cliGetPeerInfo, flag.ExitOnError)
+	listBannedCmd := flag.NewFlagSet(cliListBanned, flag.ExitOnError)
+	setBanCmd := flag.NewFlagSet(cliSetBan, flag.ExitOnError)
+	clearBannedCmd := flag.NewFlagSet(cliClearBanned, flag.ExitOnError)
+	getMempoolCmd := flag.NewFlagSet(cliGetMempool, flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFile := sendCmd.String("file", "", "Write the transaction to FILE when sending from a multisig address or while it is locked")
+	sendOpts := newTxOptionFlags(sendCmd)
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address")
+	sendManyTo := sendManyCmd.String("to", "", "Comma separated recipients: address:amount,address:amount")
+	sendManyRecipients := sendManyCmd.String("recipients", "", "CSV (address,amount) or JSON file with the recipients")
+	sendManyFile := sendManyCmd.String("file", "", "Write the transaction to FILE when sending from a multisig address or while it is locked")
+	sendManyOpts := newTxOptionFlags(sendManyCmd)
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "The wallet address to show the public key of")
+	createMultiSigM := createMultiSigCmd.Int("m", 0, "Number of signatures required")
+	createMultiSigKeys := createMultiSigCmd.String("keys", "", "Comma separated public keys (hex) or wallet addresses")
+	signTxFile := signTxCmd.String("file", "", "The partially signed transaction file")
+	signTxAddress := signTxCmd.String("address", "", "The wallet address to sign with")
+	sendTxFile := sendTxCmd.String("file", "", "The partially signed transaction file")
+	sendTxRPCPort := sendTxCmd.Int("rpcport", 0, "Send to the running node with this control port instead of mining the transaction")
+	mineAddress := mineCmd.String("address", "", "The address to send the block rewards to")
+	mineBlocks := mineCmd.Int("blocks", 1, "Number of blocks to mine")
+	listTransactionsAddress := listTransactionsCmd.String("address", "", "The address to list the transactions of")
+	listTransactionsFormat := listTransactionsCmd.String("format", "text", "Output format: text, json or csv")
+	listTransactionsOutput := listTransactionsCmd.String("output", "", "Write the transactions to FILE instead of stdout")
+	reindexAddrIndex := reindexCmd.Bool("addrindex", false, "Build the address index")
+	reindexTxIndex := reindexCmd.Bool("txindex", false, "Build the transaction index")
+	reindexUTXO := reindexCmd.Bool("utxo", false, "Build the UTXO set")
+	reindexCFilters := reindexCmd.Bool("cfilters", false, "Build the compact block filters served to light clients")
+	reindexDrop := reindexCmd.Bool("drop", false, "Drop the selected indexes instead of building them")
+	getTransactionID := getTransactionCmd.String("id", "", "The transaction ID (hex)")
+	explorerHost := explorerCmd.String("host", "127.0.0.1", "The address the explorer listens on, 0.0.0.0 for every interface")
+	explorerPort := explorerCmd.Int("port", 8080, "The port the explorer listens on")
+	restAPIHost := restAPICmd.String("host", "127.0.0.1", "The address the REST API listens on, 0.0.0.0 for every interface")
+	restAPIPort := restAPICmd.Int("port", 8081, "The port the REST API listens on")
+	restAPIValidate := restAPICmd.String("validate", "", "Validate the historical blocks of a snapshot from this chain file in the background")
+	exportChainFile := exportChainCmd.String("file", "", "The file to write the chain to")
+	importChainFile := importChainCmd.String("file", "", "The chain file to import")
+	importChainAddrIndex := importChainCmd.Bool("addrindex", false, "Also build the address index")
+	importChainPrune := importChainCmd.Int("prune", 0, "Only keep the last N full blocks while importing")
+	pruneBlocks := pruneCmd.Int("blocks", 0, fmt.Sprintf("Only keep the last N full blocks (at least %d), 0 to not limit by count", minPruneBlocks))
+	pruneSize := pruneCmd.Int("size", 0, "Only keep as many full blocks as fit in MB megabytes, 0 to not limit by size")
+	dumpUTXOFile := dumpUTXOCmd.String("file", "", "The file to write the UTXO snapshot to")
+	loadUTXOFile := loadUTXOCmd.String("file", "", "The UTXO snapshot file to load")
+	loadUTXOCommitment := loadUTXOCmd.String("commitment", "", "The known commitment (hex) of the snapshot")
+	validateSnapshotBlocks := validateSnapshotCmd.String("blocks", "", "Chain file with the historical blocks, without it only the state is printed")
+	startNodePort := startNodeCmd.Int("port", 3000, "The port the node listens on for other nodes, 0 to not listen")
+	startNodeConnect := startNodeCmd.String("connect", "", "Comma separated addresses (host:port) of nodes to always stay connected to")
+	startNodeSeeds := startNodeCmd.String("seeds", "", "Comma separated addresses (host:port) of seed nodes to learn other addresses from")
+	startNodeMaxOutbound := startNodeCmd.Int("maxoutbound", defaultMaxOutbound, "The number of outbound connections to keep")
+	startNodeRPCPort := startNodeCmd.Int("rpcport", defaultNodeRPCPort, "The localhost port of the control interface, 0 to disable it")
+	startNodeMine := startNodeCmd.String("mine", "", "Mine the mempool transactions into blocks and send the rewards to this address")
+	spvSyncConnect := spvSyncCmd.String("connect", "", "The address (host:port) of the full node to sync with")
+	spvSyncGenesis := spvSyncCmd.String("genesis", "", "The genesis block hash (hex), needed for the first sync")
+	spvSyncAddresses := spvSyncCmd.String("addresses", "", "Comma separated addresses to watch, all wallet addresses by default")
+	spvSyncCFilters := spvSyncCmd.Bool("cfilters", false, "Match compact block filters locally instead of sending the addresses to the node")
+	spvBalanceAddress := spvBalanceCmd.String("address", "", "The address to get the balance for, all wallet addresses by default")
+	getPeerInfoRPCPort := getPeerInfoCmd.Int("rpcport", defaultNodeRPCPort, "The control interface port of the node")
+	listBannedRPCPort := listBannedCmd.Int("rpcport", defaultNodeRPCPort, "The control interface port of the node")
+	setBanAddress := setBanCmd.String("address", "", "The IP or subnet (CIDR) to ban")
+	setBanDuration := setBanCmd.Duration("duration", defaultBanDuration, "How long the ban lasts")
+	setBanRemove := setBanCmd.Bool("remove", false, "Lift the ban instead")
+	setBanRPCPort := setBanCmd.Int("rpcport", defaultNodeRPCPort, "The control interface port of the node")
+	clearBannedRPCPort := clearBannedCmd.Int("rpcport", defaultNodeRPCPort, "The control interface port of the node")
+	getMempoolRPCPort := getMempoolCmd.Int("rpcport", defaultNodeRPCPort, "The control interface port of the node")
+	migrateDryRun := migrateCmd.Bool("dryrun", false, "Only check that the pending migrations succeed, without changing the database")
 
 	// 解析命令行参数
 	// Parse command line arguments
@@ -65,6 +190,16 @@ func (cli *CLI) Run() {
 		HandleErr(err)
 		cli.printChain()
 
+	case cliCreateWallet:
+		err = createWalletCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.createWallet()
+
+	case cliListAddresses:
+		err = listAddressesCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.listAddresses()
+
 	case cliSend:
 		err = sendCmd.Parse(os.Args[2:])
 		HandleErr(err)
@@ -72,7 +207,235 @@ func (cli *CLI) Run() {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.send(*sendFrom, []Recipient{{*sendTo, *sendAmount}}, sendOpts.options(), *sendFile, *sendOpts.rpcPort)
+
+	case cliSendMany:
+		err = sendManyCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *sendManyFrom == "" || (*sendManyTo == "") == (*sendManyRecipients == "") {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+		var recipients []Recipient
+		if *sendManyTo != "" {
+			recipients, err = ParseRecipients(*sendManyTo)
+		} else {
+			recipients, err = LoadRecipientsFile(*sendManyRecipients)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cli.send(*sendManyFrom, recipients, sendManyOpts.options(), *sendManyFile, *sendManyOpts.rpcPort)
+
+	case cliGetPubKey:
+		err = getPubKeyCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getPubKey(*getPubKeyAddress)
+
+	case cliCreateMultiSig:
+		err = createMultiSigCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *createMultiSigM <= 0 || *createMultiSigKeys == "" {
+			createMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createMultiSig(*createMultiSigM, strings.Split(*createMultiSigKeys, ","))
+
+	case cliSignTx:
+		err = signTxCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *signTxFile == "" || *signTxAddress == "" {
+			signTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signTx(*signTxFile, *signTxAddress)
+
+	case cliMine:
+		err = mineCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *mineAddress == "" || *mineBlocks <= 0 {
+			mineCmd.Usage()
+			os.Exit(1)
+		}
+		cli.mine(*mineAddress, *mineBlocks)
+
+	case cliSendTx:
+		err = sendTxCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *sendTxFile == "" {
+			sendTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendTx(*sendTxFile, *sendTxRPCPort)
+
+	case cliListTransactions:
+		err = listTransactionsCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *listTransactionsAddress == "" {
+			listTransactionsCmd.Usage()
+			os.Exit(1)
+		}
+		cli.listTransactions(*listTransactionsAddress, *listTransactionsFormat, *listTransactionsOutput)
+
+	case cliReindex:
+		err = reindexCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		var indexes []string
+		if *reindexAddrIndex {
+			indexes = append(indexes, addrIndexer{}.Name())
+		}
+		if *reindexTxIndex {
+			indexes = append(indexes, txIndexer{}.Name())
+		}
+		if *reindexUTXO {
+			indexes = append(indexes, utxoIndexer{}.Name())
+		}
+		if *reindexCFilters {
+			indexes = append(indexes, cfIndexer{}.Name())
+		}
+		if len(indexes) == 0 {
+			reindexCmd.Usage()
+			os.Exit(1)
+		}
+		cli.reindex(indexes, *reindexDrop)
+
+	case cliGetTransaction:
+		err = getTransactionCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *getTransactionID == "" {
+			getTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getTransaction(*getTransactionID)
+
+	case cliExplorer:
+		err = explorerCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.explorer(*explorerHost, *explorerPort)
+
+	case cliRESTAPI:
+		err = restAPICmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.restAPI(*restAPIHost, *restAPIPort, *restAPIValidate)
+
+	case cliExportChain:
+		err = exportChainCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *exportChainFile == "" {
+			exportChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.exportChain(*exportChainFile)
+
+	case cliImportChain:
+		err = importChainCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *importChainFile == "" {
+			importChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importChain(*importChainFile, *importChainAddrIndex, PruneConfig{Blocks: *importChainPrune})
+
+	case cliMigrate:
+		err = migrateCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.migrate(*migrateDryRun)
+
+	case cliPrune:
+		err = pruneCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.prune(PruneConfig{*pruneBlocks, *pruneSize}, pruneCmd.NFlag() > 0)
+
+	case cliDumpUTXO:
+		err = dumpUTXOCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *dumpUTXOFile == "" {
+			dumpUTXOCmd.Usage()
+			os.Exit(1)
+		}
+		cli.dumpUTXO(*dumpUTXOFile)
+
+	case cliLoadUTXO:
+		err = loadUTXOCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *loadUTXOFile == "" || *loadUTXOCommitment == "" {
+			loadUTXOCmd.Usage()
+			os.Exit(1)
+		}
+		cli.loadUTXO(*loadUTXOFile, *loadUTXOCommitment)
+
+	case cliValidateSnapshot:
+		err = validateSnapshotCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.validateSnapshot(*validateSnapshotBlocks)
+
+	case cliStartNode:
+		err = startNodeCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		var peers, seeds []string
+		if *startNodeConnect != "" {
+			peers = strings.Split(*startNodeConnect, ",")
+		}
+		if *startNodeSeeds != "" {
+			seeds = strings.Split(*startNodeSeeds, ",")
+		}
+		cli.startNode(*startNodePort, peers, seeds, *startNodeMaxOutbound, *startNodeRPCPort, *startNodeMine)
+
+	case cliSPVSync:
+		err = spvSyncCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *spvSyncConnect == "" {
+			spvSyncCmd.Usage()
+			os.Exit(1)
+		}
+		var addresses []string
+		if *spvSyncAddresses != "" {
+			addresses = strings.Split(*spvSyncAddresses, ",")
+		}
+		cli.spvSync(*spvSyncConnect, *spvSyncGenesis, addresses, *spvSyncCFilters)
+
+	case cliSPVBalance:
+		err = spvBalanceCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		var addresses []string
+		if *spvBalanceAddress != "" {
+			addresses = []string{*spvBalanceAddress}
+		}
+		cli.spvBalance(addresses)
+
+	case cliGetPeerInfo:
+		err = getPeerInfoCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.getPeerInfo(*getPeerInfoRPCPort)
+
+	case cliListBanned:
+		err = listBannedCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.listBanned(*listBannedRPCPort)
+
+	case cliSetBan:
+		err = setBanCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		if *setBanAddress == "" {
+			setBanCmd.Usage()
+			os.Exit(1)
+		}
+		cli.setBan(*setBanRPCPort, *setBanAddress, *setBanDuration, *setBanRemove)
+
+	case cliClearBanned:
+		err = clearBannedCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.clearBanned(*clearBannedRPCPort)
+
+	case cliGetMempool:
+		err = getMempoolCmd.Parse(os.Args[2:])
+		HandleErr(err)
+		cli.getMempool(*getMempoolRPCPort)
 
 	default:
 		cli.printUsage()
@@ -95,8 +458,50 @@ func (cli *CLI) printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
 	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
 	fmt.Println("  printchain - Print all the blocks of the blockchain")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT - Send AMOUNT of coins from FROM address to TO")
+	fmt.Println("  listtransactions -address ADDRESS [-format text|json|csv] [-output FILE]" +
+		" - List the payments ADDRESS sent and received with its running balance")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-locktime LOCKTIME] [-sequence BLOCKS] [-lockoutput LOCKTIME]" +
+		" [-coinselect STRATEGY] [-inputs TXID:VOUT,...] [-file FILE] [-rpcport PORT]" +
+		" - Send AMOUNT of coins from FROM address to TO. From a multisig address, or while the transaction is locked," +
+		" it is written to FILE. With PORT the running node creates the transaction and relays it to its peers")
+	fmt.Println("  sendmany -from FROM (-to ADDRESS:AMOUNT,... | -recipients FILE) [send options]" +
+		" - Pay many recipients in one transaction, FILE is CSV (address,amount) or JSON")
+	fmt.Println("  reindex [-addrindex] [-txindex] [-utxo] [-cfilters] [-drop] - Build the selected indexes from the whole chain, or drop them")
+	fmt.Println("  gettransaction -id TXID - Print a transaction, the outputs it spends and which of its outputs are unspent")
+	fmt.Println("  explorer [-host HOST] [-port PORT] - Serve a block explorer web UI on HOST:PORT")
+	fmt.Println("  restapi [-host HOST] [-port PORT] [-validate FILE] - Serve the JSON REST API on HOST:PORT, with Server-Sent Events at /events." +
+		" POST requests need the secret of the cookie file written next to the blockchain. With FILE the snapshot is validated in the background")
+	fmt.Println("  exportchain -file FILE - Write all blocks from genesis to FILE")
+	fmt.Println("  importchain -file FILE [-addrindex] [-prune N] - Validate the blocks in FILE and replay them into a new blockchain")
+	fmt.Println("  prune [-blocks N] [-size MB] - Only keep the newest full blocks and headers for the rest, without flags print the settings")
+	fmt.Println("  dumputxo -file FILE - Write the UTXO set at the current tip to FILE and print its commitment")
+	fmt.Println("  loadutxo -file FILE -commitment HEX - Start a new blockchain from the UTXO snapshot in FILE if its commitment is HEX")
+	fmt.Println("  validatesnapshot [-blocks FILE] - Replay the historical blocks in FILE and check them against the loaded snapshot")
+	fmt.Println("  startnode [-port PORT] [-connect HOST:PORT,...] [-seeds HOST:PORT,...] [-maxoutbound N] [-rpcport PORT] [-mine ADDRESS]" +
+		" - Run a node that syncs headers first, then downloads blocks from its peers in parallel." +
+		" It learns peer addresses from seeds and other nodes, keeps N outbound connections and reconnects -connect nodes." +
+		" Transactions are relayed between the mempools of the nodes, with ADDRESS the node mines them." +
+		" The control interface on PORT writes a cookie file that the commands below read from the node's directory")
+	fmt.Println("  getpeerinfo [-rpcport PORT] - Print the peers of the running node with their state, heights and byte counts")
+	fmt.Println("  listbanned [-rpcport PORT] - Print the IPs and subnets the running node has banned")
+	fmt.Println("  setban -address IP|SUBNET [-duration DURATION] [-remove] [-rpcport PORT]" +
+		" - Ban an IP or subnet (CIDR) on the running node and disconnect its peers, or lift the ban")
+	fmt.Println("  clearbanned [-rpcport PORT] - Lift every ban of the running node")
+	fmt.Println("  getmempool [-rpcport PORT] - Print the IDs of the transactions in the mempool of the running node")
+	fmt.Println("  spvsync -connect HOST:PORT [-genesis HASH] [-addresses ADDRESS,...] [-cfilters] - Sync the light client: verify the headers," +
+		" fetch the transactions of the addresses with Merkle proofs and print the balances." +
+		" With -cfilters compact block filters are matched locally, so the node does not learn the addresses")
+	fmt.Println("  spvbalance [-address ADDRESS] - Print the balances the light client computed from proven transactions")
+	fmt.Println("  migrate [-dryrun] - Upgrade the database schema, opening the blockchain also does this")
+	fmt.Println("  mine -address ADDRESS [-blocks N] - Mine N blocks and send their rewards to ADDRESS")
+	fmt.Println("  getpubkey -address ADDRESS - Print the public key of a wallet address")
+	fmt.Println("  createmultisig -m M -keys KEY1,KEY2,... - Create an M-of-N multisig address from public keys or wallet addresses")
+	fmt.Println("  signtx -file FILE -address ADDRESS - Add the signature of ADDRESS to the partially signed transaction in FILE")
+	fmt.Println("  sendtx -file FILE [-rpcport PORT] - Mine the transaction in FILE once it has enough signatures and its locks have passed." +
+		" With PORT it is sent to the running node, which relays it to its peers")
 }
 
 // 添加一个新区块
@@ -109,6 +514,7 @@ func (cli *CLI) printUsage() {
 // 创建区块链，创世区块
 // create block chain, genesis block
 func (cli *CLI) createBlockchain(address string) {
+	cli.validateAddress(address)
 	bc := CreateBlockchain(address)
 	defer bc.db.Close()
 	fmt.Println("Done!")
@@ -120,6 +526,7 @@ func (cli *CLI) printChain() {
 	bc := NewBlockChain()
 	defer bc.db.Close()
 
+	pruned := bc.PruneHeight()
 	bci := bc.Iterator()
 
 	for {
@@ -127,42 +534,844 @@ func (cli *CLI) printChain() {
 
 		fmt.Printf("Prev. hash: %x\n", block.PrevBlockHash)
 		fmt.Printf("Hash: %x\n", block.Hash)
+		fmt.Printf("Version: %d, Merkle root: %x\n", block.Version, block.MerkleRoot)
 		pow := NewProofOfWork(block)
 		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate()))
+		for _, tx := range block.Transactions {
+			fmt.Println(tx)
+		}
 		fmt.Println()
 
 		if len(block.PrevBlockHash) == 0 {
 			break
 		}
+		if block.Height <= pruned {
+			fmt.Printf("Blocks below height %d have been pruned\n", pruned)
+			break
+		}
 	}
 }
 
 // 获取余额
 // obtain balance
 func (cli *CLI) getBalance(address string) {
+	cli.validateAddress(address)
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	balance := bc.GetBalance(address)
+
+	fmt.Printf("Balance of '%s': %d BTC\n", address, balance.Total)
+	fmt.Printf("  Confirmed: %d BTC\n", balance.Confirmed)
+	fmt.Printf("  Immature:  %d BTC (coinbase rewards mature after %d blocks)\n", balance.Immature, bc.params.CoinbaseMaturity)
+	if balance.Locked > 0 {
+		fmt.Printf("  Locked:    %d BTC\n", balance.Locked)
+	}
+}
+
+// 列出地址的交易历史
+// list the transaction history of an address
+func (cli *CLI) listTransactions(address, format, output string) {
+	cli.validateAddress(address)
+	// 在创建输出文件之前检查格式
+	// Check the format before the output file is created
+	write, ok := historyWriters[format]
+	if !ok {
+		fmt.Printf("Unknown format '%s', use text, json or csv\n", format)
+		os.Exit(1)
+	}
+
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	history, err := bc.GetTransactionHistory(address)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	w := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	HandleErr(write(w, history))
+}
+
+// 重建或删除索引
+// rebuild or drop indexes
+func (cli *CLI) reindex(indexes []string, drop bool) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	for _, name := range indexes {
+		var err error
+		if drop {
+			err = bc.DropIndex(name)
+		} else {
+			err = bc.Reindex(name)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if drop {
+			fmt.Printf("Dropped %s\n", name)
+		} else {
+			fmt.Printf("Built %s\n", name)
+		}
+	}
+}
+
+// 打印交易详情
+// print the details of a transaction
+func (cli *CLI) getTransaction(id string) {
+	txID, err := hex.DecodeString(id)
+	if err != nil {
+		fmt.Printf("Invalid transaction ID '%s'\n", id)
+		os.Exit(1)
+	}
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	tx, height, err := bc.FindTransaction(txID)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Transaction %x\n", tx.ID)
+	fmt.Printf("  Height:        %d\n", height)
+	fmt.Printf("  Confirmations: %d\n", bc.GetBestHeight()-height+1)
+
+	if !tx.IsCoinbase() {
+		fmt.Println("  Inputs:")
+		for i, in := range tx.Vin {
+			prevTx, _, err := bc.FindTransaction(in.Txid)
+			if err != nil || in.Vout >= len(prevTx.Vout) {
+				fmt.Printf("    %d: %s (unknown output)\n", i, outpointKey(in.Txid, in.Vout))
+				continue
+			}
+			prevOut := prevTx.Vout[in.Vout]
+			address, _ := ExtractAddress(prevOut.ScriptPubKey)
+			fmt.Printf("    %d: %s %d BTC from %s\n", i, outpointKey(in.Txid, in.Vout), prevOut.Value, address)
+		}
+	}
+
+	fmt.Println("  Outputs:")
+	spenders := bc.FindSpendingTransactions(tx.ID)
+	for i, out := range tx.Vout {
+		address, ok := ExtractAddress(out.ScriptPubKey)
+		if !ok {
+			address = ClassifyScript(out.ScriptPubKey).String()
+		}
+		status := "unspent"
+		if spender, ok := spenders[i]; ok {
+			status = fmt.Sprintf("spent by %x", spender)
+		}
+		fmt.Printf("    %d: %d BTC to %s, %s\n", i, out.Value, address, status)
+	}
+
+	fmt.Println(tx)
+}
+
+// 启动区块浏览器
+// start the block explorer
+func (cli *CLI) explorer(host string, port int) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	fmt.Printf("Block explorer listening on http://%s/\n", addr)
+	if err := NewExplorer(bc).ListenAndServe(addr); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// 启动REST接口
+// start the REST API
+func (cli *CLI) restAPI(host string, port int, validate string) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	server := NewRESTServer(bc)
+	if validate != "" {
+		v, err := NewSnapshotValidator(bc, validate)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+		server.ValidateSnapshot(v)
+		fmt.Println("Validating the snapshot in the background, see /snapshot")
+	}
+
+	listener, err := server.Listen(net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	defer listener.Close()
+	fmt.Printf("REST API listening on http://%s/, cookie in %s\n", listener.Addr(), server.cookie.path)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	fmt.Println("Stopping the REST API")
+}
+
+// 导出区块链到文件
+// export the blockchain to a file
+func (cli *CLI) exportChain(file string) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	f, err := os.Create(file)
+	HandleErr(err)
+	defer f.Close()
+
+	count, err := bc.ExportChain(f)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d blocks to %s\n", count, file)
+}
+
+// 从文件导入区块链
+// import the blockchain from a file
+func (cli *CLI) importChain(file string, addrIndex bool, prune PruneConfig) {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	bc, count, err := ImportChain(f, addrIndex, prune)
+	if err != nil {
+		// 不保留导入了一部分的区块链
+		// Do not keep a partially imported blockchain
+		if bc != nil {
+			HandleErr(removeChainDB(bc))
+		}
+		fmt.Printf("ERROR: import failed after %d blocks: %v\n", count, err)
+		os.Exit(1)
+	}
+	defer bc.DbClose()
+
+	fmt.Printf("Imported %d blocks, tip %x at height %d\n", count, bc.tip, bc.GetBestHeight())
+}
+
+// 升级数据库结构
+// upgrade the database schema
+func (cli *CLI) migrate(dryRun bool) {
+	if err := MigrateDatabase(dryRun, os.Stdout); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if dryRun {
+		fmt.Println("Dry run succeeded, nothing was changed")
+	} else {
+		fmt.Println("Database is up to date")
+	}
+}
+
+// 显示或修改修剪设置
+// show or change the prune settings
+func (cli *CLI) prune(cfg PruneConfig, set bool) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	if set {
+		if err := bc.SetPruneConfig(cfg); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Pruning: %s\n", bc.GetPruneConfig())
+	if height := bc.PruneHeight(); height > 0 {
+		fmt.Printf("Full blocks are kept from height %d, only headers below it\n", height)
+	}
+}
+
+// 把未花费输出集合写入快照文件
+// write the UTXO set to a snapshot file
+func (cli *CLI) dumpUTXO(file string) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	f, err := os.Create(file)
+	HandleErr(err)
+	defer f.Close()
+
+	info, err := bc.DumpUTXOSet(f)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %d unspent outputs at height %d (block %x) to %s\n", info.Outputs, info.Height, info.Tip, file)
+	fmt.Printf("Commitment: %x\n", info.Commitment)
+}
+
+// 从快照文件启动新的区块链
+// start a new blockchain from a snapshot file
+func (cli *CLI) loadUTXO(file, commitment string) {
+	expected, err := hex.DecodeString(commitment)
+	if err != nil {
+		fmt.Println("ERROR: invalid commitment:", err)
+		os.Exit(1)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	bc, info, err := LoadUTXOSnapshot(f, expected)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	defer bc.DbClose()
+
+	fmt.Printf("Loaded %d unspent outputs at height %d (block %x)\n", info.Outputs, info.Height, info.Tip)
+	fmt.Println("The blocks below the snapshot are not available, validate them with validatesnapshot or restapi -validate")
+}
+
+// 验证加载的快照
+// validate the loaded snapshot
+func (cli *CLI) validateSnapshot(blocksFile string) {
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	status, ok := bc.SnapshotStatus()
+	if !ok {
+		fmt.Println("The blockchain was not loaded from a snapshot")
+		return
+	}
+	fmt.Printf("Snapshot at height %d, commitment %s: %s\n", status.Height, status.Commitment, status.State)
+	if blocksFile == "" {
+		return
+	}
+
+	v, err := NewSnapshotValidator(bc, blocksFile)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	v.Start()
+	if err := v.Wait(); err != nil {
+		fmt.Printf("ERROR: validation stopped at height %d: %v\n", v.Status().ValidatedHeight, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Validated %d historical blocks, the snapshot is valid\n", v.Status().ValidatedHeight)
+}
+
+// 启动节点，直到收到中断信号
+// run a node until it is interrupted
+func (cli *CLI) startNode(port int, peers, seeds []string, maxOutbound, rpcPort int, miningAddress string) {
+	if miningAddress != "" {
+		cli.validateAddress(miningAddress)
+	}
 	bc := NewBlockChain()
 	defer bc.DbClose()
 
-	balance := 0
-	UTXOs := bc.FindUTXO(address)
+	node, err := NewNode(bc, os.Stdout)
+	HandleErr(err)
+	node.MaxOutbound = maxOutbound
+	node.MiningAddress = miningAddress
+	for i := range seeds {
+		seeds[i] = strings.TrimSpace(seeds[i])
+	}
+	if err := node.AddSeeds(seeds); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	for _, addr := range peers {
+		if err := node.AddPersistentPeer(strings.TrimSpace(addr)); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+	}
+
+	listen := ""
+	if port != 0 {
+		listen = fmt.Sprintf(":%d", port)
+	}
+	if err := node.Start(listen); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	defer node.Stop()
+	if listen != "" {
+		fmt.Printf("Node listening on %s, best height %d\n", listen, bc.GetBestHeight())
+	}
+	if rpcPort != 0 {
+		listener, err := NewNodeRPCServer(node).Listen(rpcPort)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+		fmt.Printf("Control interface listening on 127.0.0.1:%d, cookie in %s\n", rpcPort, cookieFileName(rpcPort))
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	fmt.Println("Stopping the node")
+}
+
+// 打印运行中节点的连接
+// print the connections of the running node
+func (cli *CLI) getPeerInfo(rpcPort int) {
+	var peers []PeerInfo
+	if err := nodeRPCCall(rpcPort, http.MethodGet, "/peers", nil, &peers); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if len(peers) == 0 {
+		fmt.Println("No peers connected")
+		return
+	}
+
+	now := time.Now().Unix()
+	fmt.Printf("%-22s %-4s %-12s %8s %8s %8s %12s %12s %10s %10s\n",
+		"ADDRESS", "DIR", "STATE", "START", "HEIGHT", "INFLIGHT", "SENT", "RECEIVED", "CONNECTED", "LAST RECV")
+	for _, p := range peers {
+		dir := "out"
+		if p.Inbound {
+			dir = "in"
+		}
+		lastRecv := "-"
+		if p.LastRecv != 0 {
+			lastRecv = fmt.Sprintf("%ds ago", now-p.LastRecv)
+		}
+		fmt.Printf("%-22s %-4s %-12s %8d %8d %8d %12d %12d %9ds %10s\n",
+			p.Addr, dir, p.State, p.StartHeight, p.BestHeight, p.BlocksInFlight, p.BytesSent, p.BytesRecv, now-p.ConnTime, lastRecv)
+	}
+}
+
+// 打印运行中节点的封禁列表
+// print the ban list of the running node
+func (cli *CLI) listBanned(rpcPort int) {
+	var bans []BanEntry
+	if err := nodeRPCCall(rpcPort, http.MethodGet, "/banned", nil, &bans); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if len(bans) == 0 {
+		fmt.Println("No bans")
+		return
+	}
+
+	fmt.Printf("%-20s %-20s %-20s %s\n", "SUBNET", "BANNED AT", "BANNED UNTIL", "REASON")
+	for _, ban := range bans {
+		fmt.Printf("%-20s %-20s %-20s %s\n", ban.Subnet,
+			ban.Created.Format("2006-01-02 15:04:05"), ban.Until.Format("2006-01-02 15:04:05"), ban.Reason)
+	}
+}
+
+// 在运行中的节点上封禁IP或子网，或解除封禁
+// ban an IP or subnet on the running node, or lift the ban
+func (cli *CLI) setBan(rpcPort int, address string, duration time.Duration, remove bool) {
+	subnet, err := parseBanSubnet(address)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	path := "/banned?subnet=" + url.QueryEscape(subnet.String())
+
+	if remove {
+		err = nodeRPCCall(rpcPort, http.MethodDelete, path, nil, nil)
+	} else {
+		if duration < time.Second {
+			fmt.Println("ERROR: the ban must last at least a second")
+			os.Exit(1)
+		}
+		err = nodeRPCCall(rpcPort, http.MethodPost, fmt.Sprintf("%s&duration=%d", path, int(duration.Seconds())), nil, nil)
+	}
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if remove {
+		fmt.Printf("Lifted the ban of %s\n", subnet)
+	} else {
+		fmt.Printf("Banned %s for %s\n", subnet, duration)
+	}
+}
+
+// 解除运行中节点的所有封禁
+// lift every ban of the running node
+func (cli *CLI) clearBanned(rpcPort int) {
+	if err := nodeRPCCall(rpcPort, http.MethodPost, "/clearbanned", nil, nil); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Lifted every ban")
+}
+
+// 打印运行中节点交易池中的交易
+// print the transactions in the mempool of the running node
+func (cli *CLI) getMempool(rpcPort int) {
+	var ids []string
+	if err := nodeRPCCall(rpcPort, http.MethodGet, "/mempool", nil, &ids); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	fmt.Printf("%d transactions in the mempool\n", len(ids))
+}
+
+// 轻节点的地址：指定的地址或钱包中的所有地址
+// Addresses of the light client: the given ones or every wallet address
+func (cli *CLI) lightClientAddresses(addresses []string) []string {
+	if len(addresses) == 0 {
+		wallets, err := NewWallets()
+		HandleErr(err)
+		addresses = wallets.GetAddresses()
+	}
+	for i, address := range addresses {
+		addresses[i] = strings.TrimSpace(address)
+		cli.validateAddress(addresses[i])
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+func printLightClientBalances(client *LightClient, addresses []string) {
+	balances, err := client.Balances(addresses)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	for _, address := range addresses {
+		fmt.Printf("Balance of '%s': %d BTC\n", address, balances[address])
+	}
+}
+
+// 同步轻节点
+// sync the light client
+func (cli *CLI) spvSync(peer, genesis string, addresses []string, useCFilters bool) {
+	addresses = cli.lightClientAddresses(addresses)
+	genesisHash, err := hex.DecodeString(genesis)
+	if err != nil {
+		fmt.Println("ERROR: invalid genesis block hash:", err)
+		os.Exit(1)
+	}
+	if genesis == "" {
+		genesisHash = nil
+	}
 
-	for _, out := range UTXOs {
-		balance += out.Value
+	client, err := OpenLightClient(os.Stdout)
+	HandleErr(err)
+	defer client.Close()
+
+	if err := client.Sync(peer, genesisHash, addresses, useCFilters); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
 	}
+	best, err := client.BestHeader()
+	HandleErr(err)
+	fmt.Printf("Synced headers to height %d (%x)\n", best.Height, best.Hash)
+	printLightClientBalances(client, addresses)
+}
 
-	fmt.Printf("Balance of '%s': %d BTC\n", address, balance)
+// 轻节点的余额
+// balances of the light client
+func (cli *CLI) spvBalance(addresses []string) {
+	addresses = cli.lightClientAddresses(addresses)
+
+	client, err := OpenLightClient(os.Stdout)
+	HandleErr(err)
+	defer client.Close()
+
+	best, err := client.BestHeader()
+	HandleErr(err)
+	if best == nil {
+		fmt.Println("ERROR: the light client has not synced yet, run spvsync first")
+		os.Exit(1)
+	}
+	fmt.Printf("Light client at height %d (%x)\n", best.Height, best.Hash)
+	printLightClientBalances(client, addresses)
 }
 
 // 转账(即是转币)
 // send coin
-func (cli *CLI) send(from, to string, amount int) {
+func (cli *CLI) send(from string, recipients []Recipient, sendOpts SendOptions, file string, rpcPort int) {
+	cli.validateAddress(from)
+	if err := ValidateRecipients(recipients); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if rpcPort != 0 {
+		var result map[string]string
+		if err := nodeRPCCall(rpcPort, http.MethodPost, "/send", SendRequest{from, recipients, sendOpts}, &result); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Transaction %s sent to the node\n", result["txid"])
+		return
+	}
+	opts, err := sendOpts.TxOptions()
+	HandleErr(err)
 	bc := NewBlockChain()
 	defer bc.DbClose()
 
+	// 从多重签名地址转出时只生成未签名的交易文件，签名数满足后通过sendtx广播
+	// Sending from a multisig address only writes the unsigned transaction file,
+	// it is broadcast by sendtx once enough signatures were added
+	wallets, err := NewWallets()
+	HandleErr(err)
+	if _, ok := wallets.GetRedeemScript(from); ok {
+		if file == "" {
+			fmt.Println("Sending from a multisig address requires -file")
+			os.Exit(1)
+		}
+		pt, err := NewPartialTransaction(from, recipients, opts, bc)
+		HandleErr(err)
+		HandleErr(pt.SaveToFile(file))
+		_, need := pt.SignatureCount()
+		fmt.Printf("Unsigned transaction %x written to %s, it needs %d signatures\n", pt.Tx.ID, file, need)
+		return
+	}
+
 	// 创建转账交易记录
 	// Create transfer transaction records
-	tx := NewUTXOTransaction(from, to, amount, bc)
-	bc.MineBlock([]*Transaction{tx})
+	tx, err := NewMultiRecipientTransaction(from, recipients, opts, bc)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	// 锁定时间未到的交易不能打包，保存到文件等锁定时间过后再用sendtx广播
+	// A locked transaction cannot be mined yet, it is saved to a file
+	// and broadcast with sendtx once the lock has passed
+	lockTime, err := bc.nextBlockLockTime()
+	HandleErr(err)
+	if err := bc.CheckTransactionLocks(tx, bc.GetBestHeight()+1, lockTime); err != nil {
+		if file == "" {
+			fmt.Println("ERROR:", err, "- use -file to save it for later")
+			os.Exit(1)
+		}
+		HandleErr((&PartialTransaction{Tx: *tx}).SaveToFile(file))
+		fmt.Printf("%v, saved to %s. Broadcast it with sendtx once the lock has passed\n", err, file)
+		return
+	}
+	if _, err := bc.MineBlock([]*Transaction{tx}); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
 
 	fmt.Println("Success!")
 }
+
+// 创建钱包
+// create a wallet
+func (cli *CLI) createWallet() {
+	wallets, err := NewWallets()
+	HandleErr(err)
+	address := wallets.CreateWallet()
+	HandleErr(wallets.SaveToFile())
+
+	fmt.Printf("Your new address: %s\n", address)
+}
+
+// 列出钱包文件中的所有地址
+// list all addresses in the wallet file
+func (cli *CLI) listAddresses() {
+	wallets, err := NewWallets()
+	HandleErr(err)
+
+	for _, address := range wallets.GetAddresses() {
+		fmt.Println(address)
+	}
+}
+
+// 地址无效时退出
+// exit when the address is invalid
+func (cli *CLI) validateAddress(address string) {
+	if !ValidateAddress(address) {
+		fmt.Printf("Address '%s' is not valid\n", address)
+		os.Exit(1)
+	}
+}
+
+// 打印钱包地址的公钥
+// print the public key of a wallet address
+func (cli *CLI) getPubKey(address string) {
+	wallets, err := NewWallets()
+	HandleErr(err)
+	wallet, err := wallets.GetWallet(address)
+	HandleErr(err)
+
+	fmt.Printf("%x\n", wallet.PublicKey)
+}
+
+// 创建多重签名地址，并把赎回脚本保存到钱包文件
+// create a multisig address and save its redeem script into the wallet file
+func (cli *CLI) createMultiSig(m int, keys []string) {
+	wallets, err := NewWallets()
+	HandleErr(err)
+
+	var pubKeys [][]byte
+	for _, key := range keys {
+		// 本地钱包地址直接取其公钥，否则按十六进制公钥解析
+		// Local wallet addresses use their public key, anything else is parsed as a hex public key
+		if wallet, err := wallets.GetWallet(key); err == nil {
+			pubKeys = append(pubKeys, wallet.PublicKey)
+			continue
+		}
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			fmt.Printf("Key '%s' is neither a wallet address nor a hex public key\n", key)
+			os.Exit(1)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	address, err := wallets.AddMultiSig(m, pubKeys)
+	HandleErr(err)
+	HandleErr(wallets.SaveToFile())
+
+	redeemScript, _ := wallets.GetRedeemScript(address)
+	fmt.Printf("Multisig address: %s\n", address)
+	fmt.Printf("Redeem script: %x\n", redeemScript)
+}
+
+// 为部分签名交易添加签名
+// add a signature to a partially signed transaction
+func (cli *CLI) signTx(file, address string) {
+	wallets, err := NewWallets()
+	HandleErr(err)
+	wallet, err := wallets.GetWallet(address)
+	HandleErr(err)
+
+	pt, err := LoadPartialTransaction(file)
+	HandleErr(err)
+	signed, err := pt.Sign(wallet)
+	HandleErr(err)
+	if signed == 0 {
+		fmt.Printf("Address '%s' is not a signer of this transaction\n", address)
+		os.Exit(1)
+	}
+	HandleErr(pt.SaveToFile(file))
+
+	have, need := pt.SignatureCount()
+	fmt.Printf("Signed %d inputs, transaction has %d of %d required signatures\n", signed, have, need)
+}
+
+// 签名数满足要求后把交易打包进区块
+// mine the transaction into a block once it has enough signatures
+func (cli *CLI) sendTx(file string, rpcPort int) {
+	pt, err := LoadPartialTransaction(file)
+	HandleErr(err)
+
+	tx, err := pt.Finalize()
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if rpcPort != 0 {
+		if err := nodeRPCCall(rpcPort, http.MethodPost, "/tx", NewTransactionJSON(tx), nil); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Transaction %x sent to the node\n", tx.ID)
+		return
+	}
+
+	bc := NewBlockChain()
+	defer bc.DbClose()
+	lockTime, err := bc.nextBlockLockTime()
+	HandleErr(err)
+	if err := bc.CheckTransactionLocks(tx, bc.GetBestHeight()+1, lockTime); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if _, err := bc.MineBlock([]*Transaction{tx}); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Success!")
+}
+
+// 挖出只包含奖励交易的区块
+// mine blocks containing only the reward transaction
+func (cli *CLI) mine(address string, blocks int) {
+	cli.validateAddress(address)
+	bc := NewBlockChain()
+	defer bc.DbClose()
+
+	for i := 0; i < blocks; i++ {
+		cbTx := NewCoinbaseTransaction(address, "")
+		if _, err := bc.MineBlock([]*Transaction{cbTx}); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Mined %d blocks, best height is %d\n", blocks, bc.GetBestHeight())
+}
+
+// send和sendmany共用的交易选项参数
+// transaction option flags shared by send and sendmany
+type txOptionFlags struct {
+	lockTime     *uint
+	sequence     *uint
+	lockOutput   *uint
+	coinSelector *string
+	inputs       *string
+	rpcPort      *int
+}
+
+func newTxOptionFlags(fs *flag.FlagSet) *txOptionFlags {
+	return &txOptionFlags{
+		lockTime:     fs.Uint("locktime", 0, "Transaction lock time: a block height below 500000000, otherwise a unix timestamp"),
+		sequence:     fs.Uint("sequence", 0, "Relative lock: the inputs can only be mined SEQUENCE blocks after the outputs they spend"),
+		lockOutput:   fs.Uint("lockoutput", 0, "Lock the payments until this height or unix timestamp"),
+		coinSelector: fs.String("coinselect", "", "Coin selection strategy (default "+defaultCoinSelector+"): "+strings.Join(CoinSelectorNames(), ", ")),
+		inputs:       fs.String("inputs", "", "Comma separated outputs (txid:vout) that must be spent"),
+		rpcPort:      fs.Int("rpcport", 0, "Send through the running node with this control port, which relays the transaction instead of mining it"),
+	}
+}
+
+// 把解析后的参数转换为交易选项，参数无效时退出。通过节点转账时选项原样发给节点
+// convert the parsed flags into transaction options, exit when they are invalid. When sending
+// through the node the options are passed on to it as they are
+func (f *txOptionFlags) options() SendOptions {
+	if *f.sequence > uint(SequenceLockTimeMask) {
+		fmt.Printf("Sequence must not exceed %d blocks\n", SequenceLockTimeMask)
+		os.Exit(1)
+	}
+
+	opts := SendOptions{
+		LockTime:       uint32(*f.lockTime),
+		Sequence:       uint32(*f.sequence),
+		OutputLockTime: uint32(*f.lockOutput),
+		CoinSelector:   *f.coinSelector,
+	}
+	if *f.inputs != "" {
+		opts.Inputs = strings.Split(*f.inputs, ",")
+	}
+	if _, err := opts.TxOptions(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return opts
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInsufficientFunds = errors.New("not enough funds to spend")
+
+// 选币策略：从可花费的输出中选出总额不少于amount的一组输出
+// Coin selection strategy: pick outputs from the spendable ones whose total is at least amount
+type CoinSelector interface {
+	Select(utxos []UTXO, amount int) ([]UTXO, error)
+}
+
+// 可用的选币策略，按名称注册
+// Available coin selection strategies, registered by name
+var coinSelectors = map[string]CoinSelector{
+	"largest":  LargestFirstSelector{},
+	"smallest": SmallestFirstSelector{},
+	"bnb":      BranchAndBoundSelector{},
+	"random":   RandomSelector{},
+}
+
+// 默认选币策略：优先使用金额最大的输出。寻找不需要找零的组合需要用"bnb"显式启用
+// Default coin selection strategy: the largest outputs first. Looking for a combination
+// that needs no change is opt-in with "bnb"
+const defaultCoinSelector = "largest"
+
+// 根据名称获取选币策略，名称为空时返回默认策略
+// Get a coin selection strategy by name, the default one is returned for an empty name
+func NewCoinSelector(name string) (CoinSelector, error) {
+	if name == "" {
+		name = defaultCoinSelector
+	}
+	selector, ok := coinSelectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin selector '%s', use one of %s", name, strings.Join(CoinSelectorNames(), ", "))
+	}
+
+	return selector, nil
+}
+
+// 所有选币策略的名称
+// Names of all coin selection strategies
+func CoinSelectorNames() []string {
+	var names []string
+	for name := range coinSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// 按顺序累加输出直到满足金额
+// Accumulate outputs in order until the amount is reached
+func accumulate(utxos []UTXO, amount int) ([]UTXO, error) {
+	var selected []UTXO
+	total := 0
+
+	for _, utxo := range utxos {
+		if total >= amount {
+			break
+		}
+		selected = append(selected, utxo)
+		total += utxo.Output.Value
+	}
+	if total < amount {
+		return nil, ErrInsufficientFunds
+	}
+
+	return selected, nil
+}
+
+// 按金额从大到小排序的副本
+// Copy of the outputs sorted by value, largest first
+func sortedByValue(utxos []UTXO, largestFirst bool) []UTXO {
+	sorted := append([]UTXO{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if largestFirst {
+			return sorted[i].Output.Value > sorted[j].Output.Value
+		}
+		return sorted[i].Output.Value < sorted[j].Output.Value
+	})
+
+	return sorted
+}
+
+// 优先使用金额最大的输出，使用的输入最少
+// Use the largest outputs first, which needs the fewest inputs
+type LargestFirstSelector struct{}
+
+func (LargestFirstSelector) Select(utxos []UTXO, amount int) ([]UTXO, error) {
+	return accumulate(sortedByValue(utxos, true), amount)
+}
+
+// 优先使用金额最小的输出，顺便合并零钱
+// Use the smallest outputs first, which consolidates dust along the way
+type SmallestFirstSelector struct{}
+
+func (SmallestFirstSelector) Select(utxos []UTXO, amount int) ([]UTXO, error) {
+	return accumulate(sortedByValue(utxos, false), amount)
+}
+
+// 随机顺序选择输出，使地址的输出使用模式难以被分析
+// Pick outputs in random order, so the spending pattern of an address is harder to analyse
+type RandomSelector struct{}
+
+func (RandomSelector) Select(utxos []UTXO, amount int) ([]UTXO, error) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shuffled := make([]UTXO, len(utxos))
+	for i, j := range r.Perm(len(utxos)) {
+		shuffled[i] = utxos[j]
+	}
+
+	return accumulate(shuffled, amount)
+}
+
+// 分支定界搜索总额恰好等于amount的组合，这样交易就不需要找零输出。
+// 搜索次数有上限，找不到时使用Fallback(默认为LargestFirstSelector)
+// Branch and bound search for a combination adding up to exactly amount, so the
+// transaction needs no change output. The search is bounded, when no exact match
+// is found Fallback (LargestFirstSelector by default) is used
+type BranchAndBoundSelector struct {
+	Fallback CoinSelector
+}
+
+// 分支定界最多尝试的次数
+// Max number of tries of the branch and bound search
+const bnbMaxTries = 100000
+
+func (s BranchAndBoundSelector) Select(utxos []UTXO, amount int) ([]UTXO, error) {
+	sorted := sortedByValue(utxos, true)
+
+	// remaining[i]为第i个及之后所有输出的总额，用于剪枝
+	// remaining[i] is the total of output i and everything after it, used for pruning
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Output.Value
+	}
+
+	var selected []int
+	tries := 0
+	var search func(i, total int) bool
+	search = func(i, total int) bool {
+		tries++
+		switch {
+		case total == amount:
+			return true
+		case total > amount, i == len(sorted), total+remaining[i] < amount, tries > bnbMaxTries:
+			return false
+		}
+
+		// 先尝试包含当前输出，再尝试跳过
+		// Try including the current output first, then skipping it
+		selected = append(selected, i)
+		if search(i+1, total+sorted[i].Output.Value) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		return search(i+1, total)
+	}
+
+	if amount > 0 && search(0, 0) {
+		var result []UTXO
+		for _, i := range selected {
+			result = append(result, sorted[i])
+		}
+		return result, nil
+	}
+
+	fallback := s.Fallback
+	if fallback == nil {
+		fallback = LargestFirstSelector{}
+	}
+
+	return fallback.Select(utxos, amount)
+}
+
+// 交易输出的引用: 交易ID和输出序号
+// Reference to a transaction output: transaction ID and output index
+type Outpoint struct {
+	TxID  []byte
+	Index int
+}
+
+func (o Outpoint) String() string {
+	return outpointKey(o.TxID, o.Index)
+}
+
+// 解析"txid:vout"格式的输出引用
+// Parse an output reference in the "txid:vout" format
+func ParseOutpoint(s string) (Outpoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Outpoint{}, fmt.Errorf("invalid outpoint '%s', expected txid:vout", s)
+	}
+	txID, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return Outpoint{}, fmt.Errorf("invalid txid in '%s': %v", s, err)
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil || index < 0 {
+		return Outpoint{}, fmt.Errorf("invalid output index in '%s'", s)
+	}
+
+	return Outpoint{txID, index}, nil
+}
+
+// 为address选出支付amount所需的输出：先使用指定的输出，不足部分再由选币策略补足，
+// excluded中的输出不会被选中
+// Select the outputs of address needed to pay amount: the pinned outputs are used
+// first, the selector covers whatever is still missing. Excluded outputs are never selected
+func (bc *BlockChain) SelectCoins(address string, amount int, selector CoinSelector, pinned, excluded []Outpoint) ([]UTXO, error) {
+	nextHeight := bc.GetBestHeight() + 1
+	now := time.Now().Unix()
+
+	excludedKeys := make(map[string]bool)
+	for _, outpoint := range excluded {
+		excludedKeys[outpoint.String()] = true
+	}
+	var spendable []UTXO
+	for _, utxo := range bc.FindUTXOs(address) {
+		if utxo.IsSpendable(nextHeight, now, bc.params) && !excludedKeys[outpointKey(utxo.TxID, utxo.Index)] {
+			spendable = append(spendable, utxo)
+		}
+	}
+
+	var selected, rest []UTXO
+	total := 0
+	pinnedKeys := make(map[string]bool)
+	for _, outpoint := range pinned {
+		pinnedKeys[outpoint.String()] = true
+	}
+	for _, utxo := range spendable {
+		key := outpointKey(utxo.TxID, utxo.Index)
+		if pinnedKeys[key] {
+			selected = append(selected, utxo)
+			total += utxo.Output.Value
+			delete(pinnedKeys, key)
+		} else {
+			rest = append(rest, utxo)
+		}
+	}
+	for key := range pinnedKeys {
+		return nil, fmt.Errorf("output %s is not a spendable output of '%s'", key, address)
+	}
+
+	if total >= amount {
+		return selected, nil
+	}
+	if selector == nil {
+		var err error
+		if selector, err = NewCoinSelector(""); err != nil {
+			return nil, err
+		}
+	}
+	more, err := selector.Select(rest, amount-total)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(selected, more...), nil
+}
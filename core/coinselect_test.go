@@ -0,0 +1,60 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newTestUTXOs(values ...int) []UTXO {
+	var utxos []UTXO
+	for i, value := range values {
+		utxos = append(utxos, UTXO{TxID: []byte{byte(i)}, Output: TXOutput{Value: value}})
+	}
+
+	return utxos
+}
+
+// 选中输出的金额，从小到大
+// Values of the selected outputs, smallest first
+func selectedValues(utxos []UTXO) []int {
+	var values []int
+	for _, utxo := range utxos {
+		values = append(values, utxo.Output.Value)
+	}
+	sort.Ints(values)
+
+	return values
+}
+
+// 默认使用最大优先，只有指定"bnb"时才寻找不需要找零的组合
+// Largest first is the default, a combination without change is only looked for with "bnb"
+func TestDefaultCoinSelectorIsLargestFirst(t *testing.T) {
+	utxos := newTestUTXOs(2, 3, 10)
+
+	tests := []struct {
+		name     string
+		expected []int
+	}{
+		{"", []int{10}},
+		{"largest", []int{10}},
+		{"bnb", []int{2, 3}},
+	}
+	for _, test := range tests {
+		selector, err := NewCoinSelector(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected, err := selector.Select(utxos, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values := selectedValues(selected); !reflect.DeepEqual(values, test.expected) {
+			t.Fatalf("selector '%s' picked %v, expected %v", test.name, values, test.expected)
+		}
+	}
+
+	if _, err := NewCoinSelector("unknown"); err == nil {
+		t.Fatal("an unknown coin selector was accepted")
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// cookie文件中的用户名，与bitcoind相同
+// User name in the cookie file, the same as bitcoind's
+const cookieUser = "__cookie__"
+
+// 监听port的接口的cookie文件，写在当前目录中
+// The cookie file of the interface listening on port, written in the current directory
+func cookieFileName(port int) string {
+	return fmt.Sprintf(".cookie_%d", port)
+}
+
+// 认证cookie：接口启动时生成随机口令，写入只有当前用户可以读取的文件，与bitcoind的.cookie文件相同。
+// 客户端读取这个文件，用HTTP基本认证发送口令
+// Authentication cookie: a random secret generated when an interface starts and written to a
+// file only the current user can read, like the .cookie file of bitcoind. Clients read the file
+// and send the secret with HTTP basic authentication
+type authCookie struct {
+	path   string
+	secret string
+}
+
+// 生成新的口令并写入path，覆盖之前的cookie文件
+// Generate a new secret and write it to path, replacing an earlier cookie file
+func newAuthCookie(path string) (*authCookie, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	c := &authCookie{path, hex.EncodeToString(buf)}
+
+	// 先删除旧文件，新文件才会以0600权限创建
+	// Remove the old file first so the new one is created with mode 0600
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(cookieUser+":"+c.secret), 0600); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// 请求带有正确的口令，没有cookie时拒绝所有请求
+// The request carries the right secret, every request is refused without a cookie
+func (c *authCookie) check(r *http.Request) bool {
+	if c == nil {
+		return false
+	}
+	user, secret, ok := r.BasicAuth()
+
+	return ok && user == cookieUser && subtle.ConstantTimeCompare([]byte(secret), []byte(c.secret)) == 1
+}
+
+// 只处理通过认证的请求
+// Only handle authenticated requests
+func (c *authCookie) require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.check(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="coin"`)
+			writeRESTError(w, restErrorf(http.StatusUnauthorized, "authentication required, send the secret of the cookie file"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// 读取cookie文件中的用户名和口令
+// Read the user name and the secret of a cookie file
+func readAuthCookie(path string) (string, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot read the cookie file, run the command in the directory of the server: %v", err)
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(data)), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid cookie file %s", path)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// 关闭时删除cookie文件的监听器
+// A listener removing the cookie file when it is closed
+type cookieListener struct {
+	net.Listener
+	cookie *authCookie
+}
+
+func (l *cookieListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.cookie.path)
+
+	return err
+}
+
+// 请求体必须是JSON格式
+// The request body must be JSON
+func requireJSON(r *http.Request) *restError {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return restErrorf(http.StatusUnsupportedMediaType, "the request body must be application/json")
+	}
+
+	return nil
+}
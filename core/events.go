@@ -0,0 +1,159 @@
+package core
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// 事件类型
+// Event types
+const (
+	EventBlockConnected    = "block_connected"    // 区块连接到链上 a block was connected to the chain
+	EventBlockDisconnected = "block_disconnected" // 区块在重组中被移除 a block was disconnected in a reorg
+	EventTxMempool         = "tx_mempool"         // 交易进入交易池 a transaction entered the mempool
+	EventTxConfirmed       = "tx_confirmed"       // 交易被打包进区块 a transaction was mined into a block
+)
+
+// 订阅者缓冲的事件数，缓冲满时新事件会被丢弃，避免慢的订阅者阻塞挖矿
+// Events buffered per subscriber, new events are dropped when the buffer is full
+// so a slow subscriber cannot block mining
+const eventBufferSize = 64
+
+// 推送给订阅者的事件，交易事件带有交易涉及的地址
+// Event pushed to subscribers, transaction events carry the addresses the transaction touches
+type Event struct {
+	Type      string   `json:"type"`
+	BlockHash string   `json:"blockHash,omitempty"`
+	Height    int      `json:"height"`
+	TxID      string   `json:"txid,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// 事件订阅：addresses为空时接收所有事件，否则只接收区块事件和涉及这些地址的交易事件
+// Event subscription: with no addresses every event is received, otherwise only block
+// events and the transaction events touching those addresses
+type Subscription struct {
+	Events    chan Event
+	addresses map[string]bool
+}
+
+func (s *Subscription) wants(e Event) bool {
+	if len(s.addresses) == 0 || e.TxID == "" {
+		return true
+	}
+	for _, address := range e.Addresses {
+		if s.addresses[address] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 事件总线：把链和交易池的事件分发给所有订阅者
+// Event bus: dispatches the events of the chain and the mempool to all subscribers
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]bool)}
+}
+
+// 订阅事件，addresses为关注的地址
+// Subscribe to events, addresses are the watched addresses
+func (bus *EventBus) Subscribe(addresses []string) *Subscription {
+	sub := &Subscription{make(chan Event, eventBufferSize), make(map[string]bool)}
+	for _, address := range addresses {
+		sub.addresses[address] = true
+	}
+
+	bus.mu.Lock()
+	bus.subs[sub] = true
+	bus.mu.Unlock()
+
+	return sub
+}
+
+// 取消订阅并关闭事件通道
+// Cancel the subscription and close its event channel
+func (bus *EventBus) Unsubscribe(sub *Subscription) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if bus.subs[sub] {
+		delete(bus.subs, sub)
+		close(sub.Events)
+	}
+}
+
+// 是否有订阅者，没有时不需要准备事件
+// Whether there are subscribers, events need not be prepared without any
+func (bus *EventBus) HasSubscribers() bool {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	return len(bus.subs) > 0
+}
+
+// 发布事件
+// Publish an event
+func (bus *EventBus) Publish(e Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	for sub := range bus.subs {
+		if !sub.wants(e) {
+			continue
+		}
+		select {
+		case sub.Events <- e:
+		default:
+		}
+	}
+}
+
+// 交易涉及的所有地址：输出的收款地址和被花费输出的地址
+// All addresses a transaction touches: the addresses of its outputs and of the outputs it spends
+func transactionAddresses(tx *Transaction, prevOuts map[string]TXOutput) []string {
+	var addresses []string
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Vin {
+			if out, ok := prevOuts[outpointKey(in.Txid, in.Vout)]; ok {
+				if address, ok := ExtractAddress(out.ScriptPubKey); ok {
+					addresses = appendUnique(addresses, address)
+				}
+			}
+		}
+	}
+	for _, out := range tx.Vout {
+		if address, ok := ExtractAddress(out.ScriptPubKey); ok {
+			addresses = appendUnique(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// 发布区块连接或移除事件，以及其中每笔交易的确认事件
+// Publish the block connected or disconnected event, and a confirmation event for
+// every transaction of a connected block
+func (bus *EventBus) publishBlock(eventType string, block *Block, prevOuts map[string]TXOutput) {
+	blockHash := hex.EncodeToString(block.Hash)
+	bus.Publish(Event{Type: eventType, BlockHash: blockHash, Height: block.Height})
+	if eventType != EventBlockConnected {
+		return
+	}
+
+	for _, tx := range block.Transactions {
+		bus.Publish(Event{
+			Type:      EventTxConfirmed,
+			BlockHash: blockHash,
+			Height:    block.Height,
+			TxID:      hex.EncodeToString(tx.ID),
+			Addresses: transactionAddresses(tx, prevOuts),
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 接收一个事件，超时则失败
+// Receive one event, fail on a timeout
+func receiveTestEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-sub.Events:
+		if !ok {
+			t.Fatal("the event channel is closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+
+	return Event{}
+}
+
+// 没有待接收的事件
+// No event is waiting to be received
+func expectNoTestEvent(t *testing.T, sub *Subscription) {
+	t.Helper()
+
+	select {
+	case e := <-sub.Events:
+		t.Fatalf("unexpected %s event", e.Type)
+	default:
+	}
+}
+
+func TestEventBusFiltersByAddress(t *testing.T) {
+	bus := NewEventBus()
+	if bus.HasSubscribers() {
+		t.Fatal("a new bus has subscribers")
+	}
+	all := bus.Subscribe(nil)
+	watched := bus.Subscribe([]string{"A"})
+	if !bus.HasSubscribers() {
+		t.Fatal("the bus has no subscribers")
+	}
+
+	// 区块事件发给所有订阅者，交易事件只发给关注其地址的订阅者
+	// Block events go to every subscriber, transaction events only to those watching their addresses
+	bus.Publish(Event{Type: EventBlockConnected, BlockHash: "00", Height: 1})
+	bus.Publish(Event{Type: EventTxMempool, TxID: "01", Addresses: []string{"B"}})
+	bus.Publish(Event{Type: EventTxMempool, TxID: "02", Addresses: []string{"B", "A"}})
+
+	for _, expected := range []string{"", "01", "02"} {
+		if e := receiveTestEvent(t, all); e.TxID != expected {
+			t.Fatalf("the unfiltered subscriber received %q, expected %q", e.TxID, expected)
+		}
+	}
+	for _, expected := range []string{"", "02"} {
+		if e := receiveTestEvent(t, watched); e.TxID != expected {
+			t.Fatalf("the filtered subscriber received %q, expected %q", e.TxID, expected)
+		}
+	}
+	expectNoTestEvent(t, watched)
+
+	// 取消订阅后通道关闭，不再收到事件，重复取消不会出错
+	// After unsubscribing the channel is closed and receives nothing, unsubscribing twice is harmless
+	bus.Unsubscribe(watched)
+	bus.Unsubscribe(watched)
+	bus.Publish(Event{Type: EventTxMempool, TxID: "03", Addresses: []string{"A"}})
+	if _, ok := <-watched.Events; ok {
+		t.Fatal("an event was received after unsubscribing")
+	}
+	if e := receiveTestEvent(t, all); e.TxID != "03" {
+		t.Fatalf("the remaining subscriber received %q", e.TxID)
+	}
+	bus.Unsubscribe(all)
+	if bus.HasSubscribers() {
+		t.Fatal("the bus still has subscribers")
+	}
+}
+
+// 缓冲满时丢弃新事件而不是阻塞发布者
+// When the buffer is full new events are dropped instead of blocking the publisher
+func TestEventBusDropsEventsOfSlowSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe(nil)
+	for i := 0; i < eventBufferSize+10; i++ {
+		bus.Publish(Event{Type: EventBlockConnected, Height: i})
+	}
+	if len(sub.Events) != eventBufferSize {
+		t.Fatalf("%d events buffered, expected %d", len(sub.Events), eventBufferSize)
+	}
+}
+
+// 交易进入交易池时发布事件，事件带有付款方和收款方的地址，被拒绝的交易不发布事件
+// An event is published when a transaction enters the mempool, carrying the addresses of the
+// payer and the payee, and a rejected transaction publishes nothing
+func TestMempoolPublishesTxEvent(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	mp := NewMempool(bc)
+	to := NewWallet().GetAddress()
+	payer := bc.events.Subscribe([]string{wallet.GetAddress()})
+	other := bc.events.Subscribe([]string{NewWallet().GetAddress()})
+
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{to, 3}}, TxOptions{}, nil)
+	if err := mp.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	e := receiveTestEvent(t, payer)
+	if e.Type != EventTxMempool || e.TxID != hex.EncodeToString(tx.ID) {
+		t.Fatalf("received %s event for %s", e.Type, e.TxID)
+	}
+	if len(e.Addresses) != 2 || !containsString(e.Addresses, to) || !containsString(e.Addresses, wallet.GetAddress()) {
+		t.Fatalf("the event carries the addresses %v", e.Addresses)
+	}
+	expectNoTestEvent(t, other)
+
+	if err := mp.Add(tx); err == nil {
+		t.Fatal("the same transaction was added twice")
+	}
+	expectNoTestEvent(t, payer)
+	if mp.Count() != 1 {
+		t.Fatalf("%d transactions in the mempool", mp.Count())
+	}
+}
+
+// /events以Server-Sent Events推送交易池事件
+// /events pushes the mempool events as Server-Sent Events
+func TestRESTEventsStream(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	s := NewRESTServer(bc)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	if resp, err := http.Get(server.URL + "/events?address=invalid"); err != nil {
+		t.Fatal(err)
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("invalid address: status %d", resp.StatusCode)
+		}
+	}
+
+	to := NewWallet().GetAddress()
+	resp, err := http.Get(server.URL + "/events?address=" + to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %s", ct)
+	}
+
+	// 响应头返回时已经订阅，之后加入的交易一定会被推送
+	// The subscription exists once the headers are returned, so a transaction added afterwards is pushed
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{to, 3}}, TxOptions{}, nil)
+	if err := s.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在后台读取第一个事件，避免流没有数据时测试卡住
+	// Read the first event in the background so the test cannot hang on a silent stream
+	received := make(chan Event, 1)
+	go func() {
+		var eventType string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "event: ") {
+				eventType = strings.TrimPrefix(line, "event: ")
+			}
+			if strings.HasPrefix(line, "data: ") {
+				var e Event
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e)
+				e.Type = eventType
+				received <- e
+				return
+			}
+		}
+		close(received)
+	}()
+	select {
+	case e, ok := <-received:
+		if !ok {
+			t.Fatal("the stream ended")
+		}
+		if e.Type != EventTxMempool || e.TxID != hex.EncodeToString(tx.ID) {
+			t.Fatalf("received %s event for %s", e.Type, e.TxID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+}
@@ -0,0 +1,349 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 首页显示的最新区块数量
+// Number of latest blocks shown on the home page
+const explorerLatestBlocks = 20
+
+// 区块浏览器：通过网页查看区块、交易和地址
+// Block explorer: view blocks, transactions and addresses in a web browser
+type Explorer struct {
+	bc *BlockChain
+}
+
+func NewExplorer(bc *BlockChain) *Explorer {
+	return &Explorer{bc}
+}
+
+// 浏览器的所有页面
+// All pages of the explorer
+func (e *Explorer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", e.handleIndex)
+	mux.HandleFunc("/block/", e.handleBlock)
+	mux.HandleFunc("/tx/", e.handleTransaction)
+	mux.HandleFunc("/address/", e.handleAddress)
+	mux.HandleFunc("/search", e.handleSearch)
+
+	return mux
+}
+
+// 在给定地址上启动浏览器
+// Start the explorer on the given address
+func (e *Explorer) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, e.Handler())
+}
+
+// 根据高度查找区块
+// Find a block by its height
+func (bc *BlockChain) GetBlockByHeight(height int) (*Block, error) {
+	if height < 0 || height > bc.GetBestHeight() {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	if height < bc.PruneHeight() {
+		return nil, fmt.Errorf("block at height %d has been %w", height, errBlockPruned)
+	}
+
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		if block.Height == height {
+			return block, nil
+		}
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("no block at height %d", height)
+}
+
+// 从最新区块开始最多n个区块
+// Up to n blocks, starting from the latest one
+func (bc *BlockChain) latestBlocks(n int) []*Block {
+	var blocks []*Block
+	pruned := bc.PruneHeight()
+	bci := bc.Iterator()
+
+	for len(blocks) < n {
+		block := bci.Next()
+		blocks = append(blocks, block)
+		if len(block.PrevBlockHash) == 0 || block.Height <= pruned {
+			break
+		}
+	}
+
+	return blocks
+}
+
+var explorerFuncs = template.FuncMap{
+	"hex": func(b []byte) string {
+		return hex.EncodeToString(b)
+	},
+	"time": func(unix int64) string {
+		return time.Unix(unix, 0).Format("2006-01-02 15:04:05")
+	},
+	"blocktime": func(b *Block) string {
+		return time.Unix(b.Time(), 0).Format("2006-01-02 15:04:05")
+	},
+	"disasm": DisasmString,
+}
+
+var explorerTemplates = template.Must(template.New("explorer").Funcs(explorerFuncs).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}} - Block Explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 4px 10px; border-bottom: 1px solid #ddd; text-align: left; }
+.mono { font-family: monospace; }
+</style>
+</head>
+<body>
+<p><a href="/">Latest blocks</a></p>
+<form action="/search"><input name="q" size="70" placeholder="Block hash, txid, height or address"> <button>Search</button></form>
+<h1>{{.}}</h1>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" "Latest blocks"}}
+<table>
+<tr><th>Height</th><th>Hash</th><th>Time</th><th>Transactions</th></tr>
+{{range .}}<tr><td>{{.Height}}</td><td class="mono"><a href="/block/{{hex .Hash}}">{{hex .Hash}}</a></td><td>{{blocktime .}}</td><td>{{len .Transactions}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "block"}}{{template "header" (printf "Block %d" .Height)}}
+<table>
+<tr><th>Hash</th><td class="mono">{{hex .Hash}}</td></tr>
+<tr><th>Previous block</th><td class="mono">{{if .PrevBlockHash}}<a href="/block/{{hex .PrevBlockHash}}">{{hex .PrevBlockHash}}</a>{{else}}none (genesis){{end}}</td></tr>
+<tr><th>Time</th><td>{{blocktime .}}</td></tr>
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+<tr><th>Merkle root</th><td class="mono">{{hex .MerkleRoot}}</td></tr>
+<tr><th>Difficulty bits</th><td>{{.Bits}}</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+</table>
+<h2>Transactions</h2>
+<ul>
+{{range .Transactions}}<li class="mono"><a href="/tx/{{hex .ID}}">{{hex .ID}}</a>{{if .IsCoinbase}} (coinbase){{end}}</li>
+{{end}}</ul>
+{{template "footer"}}{{end}}
+
+{{define "tx"}}{{template "header" "Transaction"}}
+<table>
+<tr><th>ID</th><td class="mono">{{hex .Tx.ID}}</td></tr>
+<tr><th>Block</th><td class="mono"><a href="/block/{{hex .Block.Hash}}">{{.Block.Height}}</a> ({{.Confirmations}} confirmations)</td></tr>
+{{if .Tx.LockTime}}<tr><th>Lock time</th><td>{{.Tx.LockTime}}</td></tr>{{end}}
+</table>
+<h2>Inputs</h2>
+{{if .Tx.IsCoinbase}}<p>Coinbase</p>{{else}}<table>
+<tr><th>#</th><th>Spends</th><th>Value</th><th>From</th><th>ScriptSig</th></tr>
+{{range .Inputs}}<tr><td>{{.Index}}</td><td class="mono"><a href="/tx/{{hex .Txid}}">{{hex .Txid}}</a>:{{.Vout}}</td><td>{{.Value}}</td>
+<td class="mono">{{if .Address}}<a href="/address/{{.Address}}">{{.Address}}</a>{{end}}</td><td class="mono">{{disasm .ScriptSig}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Outputs</h2>
+<table>
+<tr><th>#</th><th>Value</th><th>To</th><th>Script</th><th>Status</th></tr>
+{{range .Outputs}}<tr><td>{{.Index}}</td><td>{{.Value}}</td>
+<td class="mono">{{if .Address}}<a href="/address/{{.Address}}">{{.Address}}</a>{{end}}</td><td class="mono">{{disasm .Script}}</td>
+<td class="mono">{{if .SpentBy}}spent by <a href="/tx/{{hex .SpentBy}}">{{hex .SpentBy}}</a>{{else}}unspent{{end}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "address"}}{{template "header" (printf "Address %s" .Address)}}
+<table>
+<tr><th>Balance</th><td>{{.Balance.Total}}</td></tr>
+<tr><th>Confirmed</th><td>{{.Balance.Confirmed}}</td></tr>
+<tr><th>Immature</th><td>{{.Balance.Immature}}</td></tr>
+<tr><th>Locked</th><td>{{.Balance.Locked}}</td></tr>
+</table>
+<h2>History</h2>
+{{if .HistoryError}}<p>{{.HistoryError}}</p>{{end}}
+<table>
+<tr><th>Height</th><th>Time</th><th>Transaction</th><th>Direction</th><th>Counterparties</th><th>Amount</th><th>Balance</th></tr>
+{{range .History}}<tr><td>{{.Height}}</td><td>{{time .Timestamp}}</td><td class="mono"><a href="/tx/{{.TxID}}">{{.TxID}}</a></td><td>{{.Direction}}</td>
+<td class="mono">{{range .Counterparties}}<a href="/address/{{.}}">{{.}}</a><br>{{end}}</td><td>{{.Amount}}</td><td>{{.Balance}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "error"}}{{template "header" "Not found"}}
+<p>{{.}}</p>
+{{template "footer"}}{{end}}
+`))
+
+// 交易页面的输入
+// An input on the transaction page
+type explorerInput struct {
+	Index     int
+	Txid      []byte
+	Vout      int
+	Value     int
+	Address   string
+	ScriptSig []byte
+}
+
+// 交易页面的输出
+// An output on the transaction page
+type explorerOutput struct {
+	Index   int
+	Value   int
+	Address string
+	Script  []byte
+	SpentBy []byte
+}
+
+func (e *Explorer) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := explorerTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Println("explorer:", err)
+	}
+}
+
+func (e *Explorer) notFound(w http.ResponseWriter, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	e.render(w, "error", fmt.Sprintf(format, args...))
+}
+
+func (e *Explorer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		e.notFound(w, "page %s not found", r.URL.Path)
+		return
+	}
+
+	e.render(w, "index", e.bc.latestBlocks(explorerLatestBlocks))
+}
+
+func (e *Explorer) handleBlock(w http.ResponseWriter, r *http.Request) {
+	hash, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/block/"))
+	if err != nil {
+		e.notFound(w, "invalid block hash")
+		return
+	}
+	block, err := e.bc.GetBlock(hash)
+	if err != nil {
+		e.notFound(w, "%v", err)
+		return
+	}
+
+	e.render(w, "block", block)
+}
+
+func (e *Explorer) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	txID, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/tx/"))
+	if err != nil {
+		e.notFound(w, "invalid transaction ID")
+		return
+	}
+	block, err := e.bc.findTransactionBlock(txID)
+	if err != nil {
+		e.notFound(w, "%v", err)
+		return
+	}
+
+	var tx *Transaction
+	for _, t := range block.Transactions {
+		if bytes.Equal(t.ID, txID) {
+			tx = t
+		}
+	}
+
+	var inputs []explorerInput
+	if !tx.IsCoinbase() {
+		for i, in := range tx.Vin {
+			input := explorerInput{Index: i, Txid: in.Txid, Vout: in.Vout, ScriptSig: in.ScriptSig}
+			if prevTx, _, err := e.bc.FindTransaction(in.Txid); err == nil && in.Vout < len(prevTx.Vout) {
+				input.Value = prevTx.Vout[in.Vout].Value
+				input.Address, _ = ExtractAddress(prevTx.Vout[in.Vout].ScriptPubKey)
+			}
+			inputs = append(inputs, input)
+		}
+	}
+
+	var outputs []explorerOutput
+	spenders := e.bc.FindSpendingTransactions(tx.ID)
+	for i, out := range tx.Vout {
+		address, _ := ExtractAddress(out.ScriptPubKey)
+		outputs = append(outputs, explorerOutput{i, out.Value, address, out.ScriptPubKey, spenders[i]})
+	}
+
+	e.render(w, "tx", struct {
+		Tx            *Transaction
+		Block         *Block
+		Confirmations int
+		Inputs        []explorerInput
+		Outputs       []explorerOutput
+	}{tx, block, e.bc.GetBestHeight() - block.Height + 1, inputs, outputs})
+}
+
+func (e *Explorer) handleAddress(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/address/")
+	if !ValidateAddress(address) {
+		e.notFound(w, "invalid address '%s'", address)
+		return
+	}
+
+	// 修剪后没有交易历史，但余额仍然可以显示
+	// There is no history after pruning, but the balance can still be shown
+	history, err := e.bc.GetTransactionHistory(address)
+	historyError := ""
+	if err != nil {
+		historyError = err.Error()
+	}
+
+	e.render(w, "address", struct {
+		Address      string
+		Balance      Balance
+		History      []TxHistoryEntry
+		HistoryError string
+	}{address, e.bc.GetBalance(address), history, historyError})
+}
+
+// 搜索：高度、地址、区块哈希或交易ID
+// Search: a height, an address, a block hash or a txid
+func (e *Explorer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if height, err := strconv.Atoi(q); err == nil {
+		block, err := e.bc.GetBlockByHeight(height)
+		if err != nil {
+			e.notFound(w, "%v", err)
+			return
+		}
+		http.Redirect(w, r, "/block/"+hex.EncodeToString(block.Hash), http.StatusFound)
+		return
+	}
+	if ValidateAddress(q) {
+		http.Redirect(w, r, "/address/"+q, http.StatusFound)
+		return
+	}
+	if hash, err := hex.DecodeString(q); err == nil && len(hash) > 0 {
+		if _, err := e.bc.GetBlock(hash); err == nil {
+			http.Redirect(w, r, "/block/"+q, http.StatusFound)
+			return
+		}
+		if _, err := e.bc.findTransactionBlock(hash); err == nil {
+			http.Redirect(w, r, "/tx/"+q, http.StatusFound)
+			return
+		}
+	}
+
+	e.notFound(w, "nothing found for '%s'", q)
+}
@@ -0,0 +1,377 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// 索引的故障点，后接索引名称：该索引已更新
+// Fault points of the indexes, followed by the index name: the index is updated
+const (
+	faultConnectIndex    = "connect:index:"
+	faultDisconnectIndex = "disconnect:index:"
+)
+
+// 注入的写入错误
+// Injected write error
+var errInjectedFault = errors.New("injected fault")
+
+// 注入的崩溃：在故障点panic，模拟进程在写入过程中被杀死
+// Injected crash: panics at the fault point, simulating the process being killed while writing
+type injectedCrash struct {
+	point string
+}
+
+func (c injectedCrash) Error() string {
+	return fmt.Sprintf("injected crash at %s", c.point)
+}
+
+// 在一个故障点注入写入错误或崩溃，并记录经过的所有故障点。point为空时不注入故障
+// Injects a write error or a crash at one fault point and records every fault point passed.
+// No fault is injected when point is empty
+type faultInjector struct {
+	point  string
+	crash  bool
+	passed []string
+}
+
+func (f *faultInjector) fault(point string) error {
+	f.passed = append(f.passed, point)
+	if point != f.point {
+		return nil
+	}
+	if f.crash {
+		panic(injectedCrash{point})
+	}
+
+	return errInjectedFault
+}
+
+// 更新索引之后经过故障点的索引
+// An index passing a fault point after it is updated
+type faultyIndexer struct {
+	blockIndexer
+	faults *faultInjector
+}
+
+func (i faultyIndexer) ConnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	if err := i.blockIndexer.ConnectBlock(dbTx, block, prevOuts); err != nil {
+		return err
+	}
+
+	return i.faults.fault(faultConnectIndex + i.Name())
+}
+
+func (i faultyIndexer) DisconnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	if err := i.blockIndexer.DisconnectBlock(dbTx, block, prevOuts); err != nil {
+		return err
+	}
+
+	return i.faults.fault(faultDisconnectIndex + i.Name())
+}
+
+// 在测试期间让所有索引经过f的故障点
+// Make every index pass the fault points of f for the rest of the test
+func useFaultyIndexers(t *testing.T, f *faultInjector) {
+	saved := blockIndexers
+	blockIndexers = make([]blockIndexer, len(saved))
+	for i, indexer := range saved {
+		blockIndexers[i] = faultyIndexer{indexer, f}
+	}
+	t.Cleanup(func() { blockIndexers = saved })
+}
+
+// 执行op，把注入的崩溃转换为错误
+// Run op, turning an injected crash into an error
+func runWithFaults(op func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			crash, ok := r.(injectedCrash)
+			if !ok {
+				panic(r)
+			}
+			err = crash
+		}
+	}()
+
+	return op()
+}
+
+// 递归读取bucket中的所有键值，嵌套bucket的键以"/"分隔
+// Read all key/values of the bucket recursively, keys of nested buckets are separated by "/"
+func bucketContents(b *bolt.Bucket, prefix string, contents map[string]string) error {
+	return b.ForEach(func(k, v []byte) error {
+		key := prefix + hex.EncodeToString(k)
+		if v == nil {
+			return bucketContents(b.Bucket(k), key+"/", contents)
+		}
+		contents[key] = hex.EncodeToString(v)
+
+		return nil
+	})
+}
+
+// 检查数据库是否一致：链末端指向一条完整的链，每个区块都有区块头，每个启用的索引与从头重建的结果相同
+// Check that the database is consistent: the tip leads to a complete chain, every block has
+// its header and every enabled index equals the result of rebuilding it from scratch
+func (bc *BlockChain) verifyConsistency() error {
+	var blocks []*Block
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		tip := chainTip(tx)
+		if !bytes.Equal(tip, bc.tip) {
+			return fmt.Errorf("stored tip %x differs from the tip %x in memory", tip, bc.tip)
+		}
+		if version := schemaVersion(tx); version != currentSchemaVersion {
+			return fmt.Errorf("schema version is %d, expected %d", version, currentSchemaVersion)
+		}
+
+		var err error
+		if blocks, err = readMainChain(tx); err != nil {
+			return err
+		}
+
+		headers := tx.Bucket([]byte(headersBucket))
+		for _, block := range blocks {
+			if !bytes.Equal(headers.Get(block.Hash), block.Header().Serialize()) {
+				return fmt.Errorf("header of block %x is missing or wrong", block.Hash)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for height, block := range blocks {
+		if block.Height != height {
+			return fmt.Errorf("block %x has height %d, expected %d", block.Hash, block.Height, height)
+		}
+		if height == 0 && len(block.PrevBlockHash) != 0 {
+			return fmt.Errorf("the chain does not start with a genesis block")
+		}
+	}
+
+	for _, indexer := range blockIndexers {
+		// 在回滚的事务中重建索引，与原内容比较
+		// Rebuild the index in a transaction that is rolled back and compare it with the stored one
+		err := bc.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(indexer.Bucket())
+			if b == nil {
+				return errDryRun
+			}
+			stored := make(map[string]string)
+			if err := bucketContents(b, "", stored); err != nil {
+				return err
+			}
+
+			if err := rebuildIndex(tx, indexer, blocks); err != nil {
+				return err
+			}
+			rebuilt := make(map[string]string)
+			if err := bucketContents(tx.Bucket(indexer.Bucket()), "", rebuilt); err != nil {
+				return err
+			}
+
+			if len(stored) != len(rebuilt) {
+				return fmt.Errorf("%s has %d entries, expected %d", indexer.Name(), len(stored), len(rebuilt))
+			}
+			for k, v := range rebuilt {
+				if stored[k] != v {
+					return fmt.Errorf("%s entry %s is '%s', expected '%s'", indexer.Name(), k, stored[k], v)
+				}
+			}
+
+			return errDryRun
+		})
+		if err != errDryRun {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 故障注入用的链：启用所有索引，包含创世区块和一个奖励区块。
+// 返回数据库文件的内容，以及一个花费奖励、尚未连接的区块
+// The chain used for fault injection: every index is enabled and it holds the genesis block
+// and a reward block. Returns the content of the database file and a block spending the
+// reward that is not connected yet
+func newFaultFixture(t *testing.T) ([]byte, *Block) {
+	t.Helper()
+
+	wallet := NewWallet()
+	address := wallet.GetAddress()
+	path := filepath.Join(t.TempDir(), "blockchain.db")
+	genesis := solveTestBlock([]*Transaction{NewCoinbaseTransaction(address, "")}, []byte{}, 0)
+	bc, err := createBlockchainDB(path, genesis, testChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, indexer := range blockIndexers {
+		if err := bc.Reindex(indexer.Name()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tip := mineTestBlock(t, bc, address)
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{NewWallet().GetAddress(), 3}}, TxOptions{}, nil)
+	block := newTestBlock(tip, address, tx)
+	bc.DbClose()
+
+	base, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base, block
+}
+
+// 从fixture的内容打开一条新的链，connected为true时先连接区块
+// Open a new chain from the fixture content, connecting the block first when connected is true
+func openFaultChain(t *testing.T, base []byte, block *Block, connected bool) (*BlockChain, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "blockchain.db")
+	if err := ioutil.WriteFile(path, base, 0600); err != nil {
+		t.Fatal(err)
+	}
+	bc, err := openBlockChain(path, testChainParams(), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connected {
+		if err := bc.AddBlock(block); err != nil {
+			bc.DbClose()
+			t.Fatal(err)
+		}
+	}
+
+	return bc, path
+}
+
+func faultOperation(point string, block *Block) func(bc *BlockChain) error {
+	if strings.HasPrefix(point, "disconnect:") {
+		return func(bc *BlockChain) error {
+			_, err := bc.DisconnectTip()
+			return err
+		}
+	}
+
+	return func(bc *BlockChain) error {
+		return bc.AddBlock(block)
+	}
+}
+
+// 在连接和移除区块的每一个写入步骤分别注入写入错误和崩溃，然后重新打开数据库，检查它是否一致、
+// 链末端是否正确，以及未提交的操作能否重新完成
+// Injects a write error and a crash at every write step of connecting and disconnecting a block,
+// then reopens the database and checks that it is consistent, that the tip is right and that an
+// operation that was not committed can be completed again
+func TestFaultInjection(t *testing.T) {
+	base, block := newFaultFixture(t)
+
+	// 先不注入故障执行一次，记录经过的所有故障点
+	// Run once without faults first, recording every fault point passed
+	recorder := &faultInjector{}
+	useFaultyIndexers(t, recorder)
+	bc, _ := openFaultChain(t, base, block, false)
+	bc.faults = recorder.fault
+	err := bc.AddBlock(block)
+	if err == nil {
+		_, err = bc.DisconnectTip()
+	}
+	bc.DbClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := recorder.passed
+	for _, point := range []string{faultConnectBlock, faultConnectTip, faultConnectCommitted, faultDisconnectTip, faultDisconnectCommitted} {
+		if !containsString(points, point) {
+			t.Fatalf("fault point %s was not passed, passed %v", point, points)
+		}
+	}
+
+	for _, point := range points {
+		for _, crash := range []bool{false, true} {
+			mode := "error"
+			if crash {
+				mode = "crash"
+			}
+			t.Run(point+"/"+mode, func(t *testing.T) {
+				testFaultCase(t, base, block, &faultInjector{point: point, crash: crash})
+			})
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 执行一个故障注入场景
+// Run a fault injection case
+func testFaultCase(t *testing.T, base []byte, block *Block, f *faultInjector) {
+	disconnect := strings.HasPrefix(f.point, "disconnect:")
+	committed := f.point == faultConnectCommitted || f.point == faultDisconnectCommitted
+	op := faultOperation(f.point, block)
+
+	useFaultyIndexers(t, f)
+	bc, path := openFaultChain(t, base, block, disconnect)
+
+	// 故障发生前后的链末端
+	// The tip before and after the fault
+	expectedTip := bc.tip
+	if committed {
+		expectedTip = block.Hash
+		if disconnect {
+			expectedTip = block.PrevBlockHash
+		}
+	}
+
+	bc.faults = f.fault
+	err := runWithFaults(func() error { return op(bc) })
+	f.point = ""
+	bc.DbClose()
+	if err == nil {
+		t.Fatal("the fault was not triggered")
+	}
+
+	// 重新打开数据库，就像进程重启一样
+	// Reopen the database, as if the process restarted
+	bc, err = openBlockChain(path, testChainParams(), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer bc.DbClose()
+	if err := bc.verifyConsistency(); err != nil {
+		t.Fatalf("after the fault: %v", err)
+	}
+	if !bytes.Equal(bc.tip, expectedTip) {
+		t.Fatalf("tip is %x after the fault, expected %x", bc.tip, expectedTip)
+	}
+
+	// 未提交的操作应该可以重新完成
+	// An operation that was not committed can be completed again
+	if !committed {
+		if err := op(bc); err != nil {
+			t.Fatalf("retrying: %v", err)
+		}
+		if err := bc.verifyConsistency(); err != nil {
+			t.Fatalf("after retrying: %v", err)
+		}
+	}
+}
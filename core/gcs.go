@@ -0,0 +1,227 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// Golomb编码集合(GCS)的参数，与BIP158基本过滤器相同：余数为gcsP位，误报率约为1/gcsM
+// Parameters of the Golomb coded set (GCS), the same as for the BIP158 basic filter:
+// remainders take gcsP bits and the false positive rate is about 1/gcsM
+const (
+	gcsP = 19
+	gcsM = 784931
+)
+
+var errGCSTruncated = errors.New("truncated compact filter")
+
+// Golomb编码集合：每个元素用SipHash映射到[0, N*M)，排序后对相邻差值做Golomb-Rice编码。
+// 编码结果为 元素数N(4字节大端) | 比特流
+// Golomb coded set: every element is mapped to [0, N*M) with SipHash, the sorted values are
+// delta encoded with Golomb-Rice coding. The encoding is
+// number of elements N(4 bytes big endian) | bit stream
+func buildGCSFilter(key [16]byte, elements [][]byte) []byte {
+	// 重复的元素只保留一个
+	// Duplicate elements are kept once
+	unique := make(map[string]bool)
+	for _, element := range elements {
+		unique[string(element)] = true
+	}
+
+	n := uint64(len(unique))
+	values := make([]uint64, 0, n)
+	for element := range unique {
+		values = append(values, gcsHash(key, []byte(element), n*gcsM))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	filter := make([]byte, 4)
+	binary.BigEndian.PutUint32(filter, uint32(n))
+	w := bitWriter{data: filter}
+	var last uint64
+	for _, value := range values {
+		w.writeGolombRice(value - last)
+		last = value
+	}
+
+	return w.data
+}
+
+// 过滤器是否可能包含任意一个查询元素。误报的概率约为1/gcsM，不会漏报
+// Whether the filter may contain any of the queried elements. False positives happen with
+// a probability of about 1/gcsM, there are no false negatives
+func gcsMatchAny(filter []byte, key [16]byte, queries [][]byte) (bool, error) {
+	if len(filter) < 4 {
+		return false, errGCSTruncated
+	}
+	n := uint64(binary.BigEndian.Uint32(filter))
+	if n == 0 || len(queries) == 0 {
+		return false, nil
+	}
+
+	wanted := make([]uint64, len(queries))
+	for i, query := range queries {
+		wanted[i] = gcsHash(key, query, n*gcsM)
+	}
+	sort.Slice(wanted, func(i, j int) bool { return wanted[i] < wanted[j] })
+
+	// 同时遍历过滤器和查询的有序值
+	// Walk the sorted values of the filter and the queries together
+	r := bitReader{data: filter[4:]}
+	var value uint64
+	for i := uint64(0); i < n; i++ {
+		delta, err := r.readGolombRice()
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		for len(wanted) > 0 && wanted[0] < value {
+			wanted = wanted[1:]
+		}
+		if len(wanted) == 0 {
+			return false, nil
+		}
+		if wanted[0] == value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// 把元素映射到[0, max)：SipHash的64位结果乘以max后取高64位，比取模更均匀也更快
+// Map an element to [0, max): the high 64 bits of the 64 bit SipHash times max, which is
+// more uniform and faster than a modulo
+func gcsHash(key [16]byte, element []byte, max uint64) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[:8])
+	k1 := binary.LittleEndian.Uint64(key[8:])
+	hi, _ := bits.Mul64(sipHash24(k0, k1, element), max)
+
+	return hi
+}
+
+// SipHash-2-4
+func sipHash24(k0, k1 uint64, p []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	last := uint64(len(p)) << 56
+	for ; len(p) >= 8; p = p[8:] {
+		m := binary.LittleEndian.Uint64(p)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+	for i, c := range p {
+		last |= uint64(c) << (8 * uint(i))
+	}
+	v3 ^= last
+	round()
+	round()
+	v0 ^= last
+
+	v2 ^= 0xff
+	for i := 0; i < 4; i++ {
+		round()
+	}
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+// 按位写入，高位在前
+// Writes bits, the most significant bit first
+type bitWriter struct {
+	data []byte
+	used uint // 最后一个字节已使用的位数 bits used of the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.used == 0 {
+		w.data = append(w.data, 0)
+		w.used = 8
+	}
+	w.used--
+	if bit {
+		w.data[len(w.data)-1] |= 1 << w.used
+	}
+}
+
+func (w *bitWriter) writeBits(value uint64, count uint) {
+	for i := count; i > 0; i-- {
+		w.writeBit(value&(1<<(i-1)) != 0)
+	}
+}
+
+// Golomb-Rice编码：商用一元编码(q个1和一个0)，余数用gcsP位
+// Golomb-Rice coding: the quotient in unary (q ones and a zero), the remainder in gcsP bits
+func (w *bitWriter) writeGolombRice(value uint64) {
+	for q := value >> gcsP; q > 0; q-- {
+		w.writeBit(true)
+	}
+	w.writeBit(false)
+	w.writeBits(value, gcsP)
+}
+
+type bitReader struct {
+	data []byte
+	pos  uint // 已读取的位数 bits read
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.data))*8 {
+		return false, errGCSTruncated
+	}
+	bit := r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+
+	return bit, nil
+}
+
+func (r *bitReader) readGolombRice() (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		q++
+	}
+
+	value := q << gcsP
+	for i := gcsP - 1; i >= 0; i-- {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit {
+			value |= 1 << uint(i)
+		}
+	}
+
+	return value, nil
+}
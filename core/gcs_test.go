@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// SipHash论文附录中的参考值：密钥为00..0f，消息为00..(n-1)
+// Reference values from the appendix of the SipHash paper: the key is 00..0f and the message
+// is 00..(n-1)
+func TestSipHash24ReferenceVectors(t *testing.T) {
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	k0 := binary.LittleEndian.Uint64(key[:8])
+	k1 := binary.LittleEndian.Uint64(key[8:])
+
+	tests := []struct {
+		length   int
+		expected uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{1, 0x74f839c593dc67fd},
+		{7, 0xab0200f58b01d137},
+		{8, 0x93f5f5799a932462},
+		{15, 0xa129ca6149be45e5},
+	}
+	for _, test := range tests {
+		message := make([]byte, test.length)
+		for i := range message {
+			message[i] = byte(i)
+		}
+		if hash := sipHash24(k0, k1, message); hash != test.expected {
+			t.Errorf("message of %d bytes: hash is %016x, expected %016x", test.length, hash, test.expected)
+		}
+	}
+}
+
+// BIP158参考实现(btcutil/gcs)在P=19、M=784931下生成的比特流。
+// 我们的编码以4字节大端的N开头，而不是BIP158的CompactSize，所以只比较其后的比特流
+// Bit streams produced by the BIP158 reference implementation (btcutil/gcs) with P=19 and
+// M=784931. Our encoding starts with N as 4 bytes big endian instead of the CompactSize of
+// BIP158, so only the bit stream after it is compared
+func TestGCSFilterReferenceVectors(t *testing.T) {
+	key := [16]byte{0x4c, 0xb1, 0xab, 0x12, 0x57, 0x62, 0x1e, 0x41, 0x3b, 0x8b, 0x0e, 0x26, 0x64, 0x8d, 0x4a, 0x15}
+	names := [][]byte{}
+	for _, name := range []string{"Alex", "Bob", "Charlie", "Dick", "Ed", "Frank", "George", "Harry", "Ilya",
+		"John", "Kevin", "Larry", "Michael", "Nate", "Owen", "Paul", "Quentin"} {
+		names = append(names, []byte(name))
+	}
+
+	tests := []struct {
+		name     string
+		elements [][]byte
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"one element", [][]byte{[]byte("coin")}, "83ca68"},
+		{"names", names, "056ff79e6c2994ba5d91402f327f807097c5c571f8d212511a8237f005331346102b41967f35ef488406c38a88"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := buildGCSFilter(key, test.elements)
+			if n := binary.BigEndian.Uint32(filter[:4]); n != uint32(len(test.elements)) {
+				t.Fatalf("filter has %d elements, expected %d", n, len(test.elements))
+			}
+			if stream := hex.EncodeToString(filter[4:]); stream != test.expected {
+				t.Fatalf("bit stream is %s, expected %s", stream, test.expected)
+			}
+
+			for _, element := range test.elements {
+				match, err := gcsMatchAny(filter, key, [][]byte{element})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !match {
+					t.Fatalf("%s does not match", element)
+				}
+			}
+		})
+	}
+}
+
+// btcutil/gcs的测试向量：在这个密钥和N=13下，4字节大端的16060032映射到0，
+// 即编码的第一个差值为0时仍能匹配
+// Test vector of btcutil/gcs: with this key and N=13 the 4 bytes big endian value 16060032
+// maps to 0, so it still matches when the first encoded delta is 0
+func TestGCSMatchZeroHash(t *testing.T) {
+	key := [16]byte{0x25, 0x28, 0x0d, 0x25, 0x26, 0xe1, 0xd3, 0xc7, 0xa5, 0x71, 0x85, 0x34, 0x92, 0xa5, 0x7e, 0x68}
+	uint32Bytes := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return b
+	}
+	target := uint32Bytes(16060032)
+	if hash := gcsHash(key, target, 13*gcsM); hash != 0 {
+		t.Fatalf("target hashes to %d, expected 0", hash)
+	}
+
+	for _, included := range []bool{true, false} {
+		elements := [][]byte{}
+		for i := uint32(0); i < 12; i++ {
+			elements = append(elements, uint32Bytes(i))
+		}
+		if included {
+			elements = append(elements, target)
+		} else {
+			elements = append(elements, uint32Bytes(12))
+		}
+
+		match, err := gcsMatchAny(buildGCSFilter(key, elements), key, [][]byte{target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != included {
+			t.Fatalf("target included %v, matched %v", included, match)
+		}
+	}
+}
+
+// 不在集合中的元素的匹配率应接近1/gcsM
+// The match rate of elements that are not in the set is close to 1/gcsM
+func TestGCSFalsePositiveRate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the false positive rate test in short mode")
+	}
+
+	key := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	elements := make([][]byte, 1000)
+	for i := range elements {
+		elements[i] = []byte(fmt.Sprintf("member %d", i))
+	}
+	filter := buildGCSFilter(key, elements)
+
+	// 每批查询1000个非成员元素，一批中出现两次误报的概率可以忽略，匹配的批数即误报次数。
+	// 每个查询的误报概率约为1/gcsM，共查询20*gcsM个元素，期望约20次误报
+	// Query non-members in batches of 1000, two false positives in one batch are unlikely
+	// enough that the number of matching batches is the number of false positives. Each query
+	// is a false positive with a probability of about 1/gcsM, 20*gcsM elements are queried so
+	// about 20 false positives are expected
+	const batchSize = 1000
+	batches := 20 * gcsM / batchSize
+	matches := 0
+	for i := 0; i < batches; i++ {
+		queries := make([][]byte, batchSize)
+		for j := range queries {
+			queries[j] = make([]byte, 8)
+			binary.BigEndian.PutUint64(queries[j], uint64(i*batchSize+j))
+		}
+		match, err := gcsMatchAny(filter, key, queries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match {
+			matches++
+		}
+	}
+	if matches < 5 || matches > 60 {
+		t.Fatalf("%d false positives in %d queries, expected about 20", matches, batches*batchSize)
+	}
+
+	// 对空过滤器没有任何匹配
+	// Nothing matches an empty filter
+	match, err := gcsMatchAny(buildGCSFilter(key, nil), key, [][]byte{[]byte("member 0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Fatal("an empty filter matched")
+	}
+	if !bytes.Equal(buildGCSFilter(key, nil), []byte{0, 0, 0, 0}) {
+		t.Fatal("an empty filter is not only its element count")
+	}
+}
@@ -0,0 +1,461 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// 元数据中最佳区块头的键。区块头先于区块下载，最佳区块头可以高于链末端
+// Key of the best header in the metadata. Headers are downloaded before the blocks,
+// so the best header can be ahead of the tip
+const bestHeaderKey = "bestheader"
+
+// 中位时间(median time past)使用的区块数：区块时间戳必须晚于之前这么多个区块时间戳的中位数，
+// 时间锁定也按中位时间判断，矿工无法通过把区块时间设得更晚来提前解锁
+// Number of blocks of the median time past: a block timestamp must be after the median of the
+// timestamps of this many blocks before it, and time locks are evaluated against the median
+// time, so a miner cannot unlock them early by setting a later block time
+const medianTimeBlocks = 11
+
+// 区块时间戳最多可以超前本地时间多少
+// How far a block timestamp can be ahead of the local time
+const maxFutureBlockTime = 2 * time.Hour
+
+// 区块头的父区块头未知，用于错误信息"... does not connect to a known header"
+// The parent of a header is unknown, used in error messages "... does not connect to a known header"
+var errUnknownParent = errors.New("does not connect to a known header")
+
+// 区块头无效，例如工作量证明错误
+// The header is invalid, for example because of a bad proof of work
+var errInvalidHeader = errors.New("is invalid")
+
+// 在事务中读取最佳区块头，即已知工作量最大的区块头。所有区块难度相同，所以就是最高的区块头
+// Read the best header within the transaction, the known header with the most work.
+// Every block has the same difficulty, so it is the highest header
+func readBestHeader(tx *bolt.Tx) (*ChainHeader, error) {
+	headers := tx.Bucket([]byte(headersBucket))
+	if meta := tx.Bucket([]byte(metaBucket)); meta != nil {
+		if hash := meta.Get([]byte(bestHeaderKey)); hash != nil {
+			return readBlockHeader(headers, hash)
+		}
+	}
+
+	return readBlockHeader(headers, chainTip(tx))
+}
+
+func putBestHeader(tx *bolt.Tx, hash []byte) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+
+	return meta.Put([]byte(bestHeaderKey), hash)
+}
+
+// 区块头比最佳区块头更高时成为新的最佳区块头
+// The header becomes the best header when it is higher than the current one
+func updateBestHeader(tx *bolt.Tx, header *ChainHeader) error {
+	best, err := readBestHeader(tx)
+	if err != nil {
+		return err
+	}
+	if header.Height <= best.Height {
+		return nil
+	}
+
+	return putBestHeader(tx, header.Hash)
+}
+
+// 最佳区块头
+// The best header
+func (bc *BlockChain) BestHeader() (*ChainHeader, error) {
+	var best *ChainHeader
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		best, err = readBestHeader(tx)
+
+		return err
+	})
+
+	return best, err
+}
+
+// 区块头是否已知
+// Whether the header is known
+func (bc *BlockChain) HasHeader(hash []byte) bool {
+	known := false
+	bc.db.View(func(tx *bolt.Tx) error {
+		known = tx.Bucket([]byte(headersBucket)).Get(hash) != nil
+		return nil
+	})
+
+	return known
+}
+
+// 最佳区块头的区块无效时，让链末端重新成为最佳区块头
+// Make the tip the best header again when the block of the best header turned out invalid
+func (bc *BlockChain) resetBestHeader() error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		return putBestHeader(tx, chainTip(tx))
+	})
+}
+
+// 验证并保存从其他节点收到的区块头：它们只根据区块头验证工作量证明，第一个区块头的父区块头
+// 必须已知，之后每个区块头都要接在前一个之后。返回最后一个区块头
+// Validate and store headers received from another node: their proof of work is checked from
+// the headers alone, the parent of the first one must be known and every following header
+// must extend the previous one. Returns the last header
+func (bc *BlockChain) AddHeaders(headers []BlockHeader) (*ChainHeader, error) {
+	var last *ChainHeader
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		last, err = addHeaders(tx, headers)
+
+		return err
+	})
+
+	return last, err
+}
+
+// 以hash为最后一个区块的最多medianTimeBlocks个区块时间戳的中位数，单位与Timestamp相同
+// The median of the timestamps of up to medianTimeBlocks blocks ending with hash, in the unit of Timestamp
+func medianTimePast(headers *bolt.Bucket, hash []byte) (int64, error) {
+	var timestamps []int64
+	for len(hash) > 0 && len(timestamps) < medianTimeBlocks {
+		header, err := readBlockHeader(headers, hash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, header.Timestamp)
+		hash = header.PrevBlockHash
+	}
+	if len(timestamps) == 0 {
+		return 0, nil
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2], nil
+}
+
+// 以hash为最后一个区块的中位时间，单位为秒
+// The median time past ending with the block hash, in seconds
+func (bc *BlockChain) medianTimePast(hash []byte) (int64, error) {
+	var median int64
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		median, err = medianTimePast(tx.Bucket([]byte(headersBucket)), hash)
+
+		return err
+	})
+
+	return median / int64(time.Second), err
+}
+
+// 主链上高度height处的中位时间，单位为秒。height小于0时使用创世区块
+// The median time past at height on the main chain, in seconds. The genesis block is used
+// when height is below 0
+func (bc *BlockChain) medianTimeAtHeight(height int) (int64, error) {
+	var median int64
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		headers := tx.Bucket([]byte(headersBucket))
+		header, err := readBlockHeader(headers, chainTip(tx))
+		for err == nil && header.Height > height && header.Height > 0 {
+			header, err = readBlockHeader(headers, header.PrevBlockHash)
+		}
+		if err != nil {
+			return err
+		}
+		median, err = medianTimePast(headers, header.Hash)
+
+		return err
+	})
+
+	return median / int64(time.Second), err
+}
+
+// 下一个区块中的交易的时间锁定按链末端的中位时间判断，单位为秒
+// The time locks of transactions in the next block are evaluated against the median time
+// past of the tip, in seconds
+func (bc *BlockChain) nextBlockLockTime() (int64, error) {
+	return bc.medianTimePast(bc.tip)
+}
+
+// 检查区块头的时间戳：必须晚于父区块的中位时间medianTime，并且不能超前本地时间now超过
+// maxFutureBlockTime。超前的区块头以后可能变得有效，所以它不是共识错误
+// Check the timestamp of a header: it must be after the median time past medianTime of the
+// parent and no more than maxFutureBlockTime ahead of the local time now. A header ahead of
+// time may become valid later, so that is not a consensus error
+func (h *BlockHeader) checkTimestamp(medianTime int64, now time.Time) error {
+	if h.Timestamp <= medianTime {
+		return consensusErrorf("timestamp %s is not after the median time past %s",
+			time.Unix(0, h.Timestamp).UTC(), time.Unix(0, medianTime).UTC())
+	}
+	if limit := now.Add(maxFutureBlockTime); h.Timestamp > limit.UnixNano() {
+		return fmt.Errorf("timestamp %s is more than %v ahead of the local time",
+			time.Unix(0, h.Timestamp).UTC(), maxFutureBlockTime)
+	}
+
+	return nil
+}
+
+// 在事务中验证并保存区块头，轻节点也使用它
+// Validate and store headers within the transaction, light clients use it too
+func addHeaders(tx *bolt.Tx, headers []BlockHeader) (*ChainHeader, error) {
+	var last *ChainHeader
+
+	bucket := tx.Bucket([]byte(headersBucket))
+	for i := range headers {
+		header := &headers[i]
+		hash := header.BlockHash()
+		if last != nil && !bytes.Equal(header.PrevBlockHash, last.Hash) {
+			return nil, fmt.Errorf("header %x %w: it does not extend the previous header", hash, errInvalidHeader)
+		}
+		if data := bucket.Get(hash); data != nil {
+			var err error
+			if last, err = decodeBlockHeader(data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		parent := last
+		if parent == nil {
+			data := bucket.Get(header.PrevBlockHash)
+			if data == nil {
+				return nil, fmt.Errorf("header %x %w", hash, errUnknownParent)
+			}
+			var err error
+			if parent, err = decodeBlockHeader(data); err != nil {
+				return nil, err
+			}
+		}
+		if err := header.validate(); err != nil {
+			return nil, fmt.Errorf("header %x %w: %v", hash, errInvalidHeader, err)
+		}
+		medianTime, err := medianTimePast(bucket, parent.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := header.checkTimestamp(medianTime, time.Now()); err != nil {
+			if isConsensusError(err) {
+				return nil, fmt.Errorf("header %x %w: %v", hash, errInvalidHeader, err)
+			}
+			return nil, fmt.Errorf("header %x: %w", hash, err)
+		}
+
+		entry := &ChainHeader{*header, hash, parent.Height + 1}
+		if err := bucket.Put(hash, entry.Serialize()); err != nil {
+			return nil, err
+		}
+		if err := updateBestHeader(tx, entry); err != nil {
+			return nil, err
+		}
+		last = entry
+	}
+
+	return last, nil
+}
+
+// 在事务中读取主链(链末端所在的链)的所有区块头，下标为区块高度
+// Read every header of the main chain (the chain of the tip) within the transaction, indexed by height
+func readMainChainHeaders(tx *bolt.Tx) ([]*ChainHeader, error) {
+	bucket := tx.Bucket([]byte(headersBucket))
+	tip, err := readBlockHeader(bucket, chainTip(tx))
+	if err != nil {
+		return nil, err
+	}
+
+	return readHeaderChain(bucket, tip)
+}
+
+// 从区块头tip回到创世区块的所有区块头，下标为区块高度
+// Every header from tip back to the genesis block, indexed by height
+func readHeaderChain(bucket *bolt.Bucket, tip *ChainHeader) ([]*ChainHeader, error) {
+	var err error
+	chain := make([]*ChainHeader, tip.Height+1)
+	for header := tip; ; {
+		chain[header.Height] = header
+		if header.Height == 0 {
+			break
+		}
+		if header, err = readBlockHeader(bucket, header.PrevBlockHash); err != nil {
+			return nil, err
+		}
+	}
+
+	return chain, nil
+}
+
+func onChain(chain []*ChainHeader, header *ChainHeader) bool {
+	return header.Height < len(chain) && bytes.Equal(chain[header.Height].Hash, header.Hash)
+}
+
+// 主链上ancestor之后所有区块的总工作量，ancestor不在主链上时返回错误
+// The total work of the main chain blocks after ancestor, an error when ancestor is not on the main chain
+func (bc *BlockChain) chainWorkAfter(ancestor []byte) (*big.Int, error) {
+	work := new(big.Int)
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		chain, err := readMainChainHeaders(tx)
+		if err != nil {
+			return err
+		}
+		header, err := readBlockHeader(tx.Bucket([]byte(headersBucket)), ancestor)
+		if err != nil {
+			return err
+		}
+		if !onChain(chain, header) {
+			return fmt.Errorf("block %x is not on the main chain", ancestor)
+		}
+		for _, h := range chain[header.Height+1:] {
+			work.Add(work, h.work())
+		}
+
+		return nil
+	})
+
+	return work, err
+}
+
+// 区块定位符：从区块头from开始(为nil时从最佳区块头开始)，先是最近的10个区块头，之后间隔加倍，
+// 最后是创世区块。对方用它找出两条链分叉的位置
+// Block locator: starting with the header from (the best header when nil), the last 10 headers,
+// then doubling the step, ending with the genesis block. The other side uses it to find where
+// the chains fork
+func (bc *BlockChain) HeaderLocator(from []byte) ([][]byte, error) {
+	var locator [][]byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		locator, err = headerLocator(tx, from)
+
+		return err
+	})
+
+	return locator, err
+}
+
+func headerLocator(tx *bolt.Tx, from []byte) ([][]byte, error) {
+	var locator [][]byte
+
+	bucket := tx.Bucket([]byte(headersBucket))
+	header, err := readBestHeader(tx)
+	if from != nil {
+		header, err = readBlockHeader(bucket, from)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	step := 1
+	for {
+		locator = append(locator, header.Hash)
+		if header.Height == 0 {
+			return locator, nil
+		}
+		if len(locator) >= 10 {
+			step *= 2
+		}
+		for i := 0; i < step && header.Height > 0; i++ {
+			if header, err = readBlockHeader(bucket, header.PrevBlockHash); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// 返回主链上定位符中第一个已知区块之后的区块头，最多max个，遇到stop为止
+// Return the headers of the main chain after the first locator entry that is on it,
+// at most max of them and up to stop
+func (bc *BlockChain) HeadersAfter(locator [][]byte, stop []byte, max int) ([]BlockHeader, error) {
+	var headers []BlockHeader
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		chain, err := readMainChainHeaders(tx)
+		if err != nil {
+			return err
+		}
+
+		start := 1
+		bucket := tx.Bucket([]byte(headersBucket))
+		for _, hash := range locator {
+			data := bucket.Get(hash)
+			if data == nil {
+				continue
+			}
+			header, err := decodeBlockHeader(data)
+			if err != nil {
+				return err
+			}
+			if onChain(chain, header) {
+				start = header.Height + 1
+				break
+			}
+		}
+
+		for height := start; height < len(chain) && len(headers) < max; height++ {
+			headers = append(headers, chain[height].BlockHeader)
+			if bytes.Equal(chain[height].Hash, stop) {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return headers, err
+}
+
+// 最佳区块头所在的链上还没有连接的区块头，从与主链分叉处开始按高度排列
+// The headers of the best header chain that are not connected yet, in height order starting
+// where it forks from the main chain
+func (bc *BlockChain) MissingBlocks() ([]*ChainHeader, error) {
+	var missing []*ChainHeader
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		chain, err := readMainChainHeaders(tx)
+		if err != nil {
+			return err
+		}
+		header, err := readBestHeader(tx)
+		if err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket([]byte(headersBucket))
+		for !onChain(chain, header) {
+			missing = append([]*ChainHeader{header}, missing...)
+			if header, err = readBlockHeader(bucket, header.PrevBlockHash); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return missing, err
+}
+
+// 创世区块的哈希，连接的节点必须有相同的创世区块
+// Hash of the genesis block, connected nodes must have the same genesis block
+func (bc *BlockChain) GenesisHash() ([]byte, error) {
+	var hash []byte
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		chain, err := readMainChainHeaders(tx)
+		if err != nil {
+			return err
+		}
+		hash = chain[0].Hash
+
+		return nil
+	})
+
+	return hash, err
+}
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 交易对地址余额的影响方向
+// Direction of a transaction relative to an address
+const (
+	DirectionReceive = "receive" // 收到其他地址的付款 // payment received from other addresses
+	DirectionSend    = "send"    // 向其他地址付款 // payment sent to other addresses
+	DirectionSelf    = "self"    // 只在自己的地址之间转移 // moved between the address and itself only
+	DirectionMined   = "mined"   // 挖矿奖励 // mining reward
+)
+
+// 地址交易历史中的一条记录
+// One entry of the transaction history of an address
+type TxHistoryEntry struct {
+	Height         int      `json:"height"`
+	Timestamp      int64    `json:"timestamp"`
+	TxID           string   `json:"txid"`
+	Direction      string   `json:"direction"`
+	Counterparties []string `json:"counterparties"`
+	Amount         int      `json:"amount"`
+	Balance        int      `json:"balance"`
+}
+
+// 从创世区块开始按顺序返回链上所有区块
+// All blocks of the chain in order, starting with the genesis block
+func (bc *BlockChain) chainBlocks() []*Block {
+	var blocks []*Block
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+		blocks = append(blocks, block)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+
+	return blocks
+}
+
+// 按时间顺序返回与address有关的所有交易，Amount为地址余额的变化，Balance为交易后的余额
+// All transactions involving address in chronological order, Amount is the change of the
+// address balance and Balance is the balance after the transaction
+func (bc *BlockChain) GetTransactionHistory(address string) ([]TxHistoryEntry, error) {
+	// 余额是从创世区块开始累计的，需要整条链
+	// The balance accumulates from the genesis block, so the whole chain is needed
+	if err := bc.requireFullChain("the transaction history"); err != nil {
+		return nil, err
+	}
+	if bc.indexEnabled(addrIndexer{}) {
+		return bc.getTransactionHistoryIndexed(address)
+	}
+
+	var history []TxHistoryEntry
+	outputs := make(map[string]TXOutput)
+	balance := 0
+
+	for _, block := range bc.chainBlocks() {
+		for _, tx := range block.Transactions {
+			entry, ok := historyEntry(tx, address, outputs)
+			for i, out := range tx.Vout {
+				outputs[outpointKey(tx.ID, i)] = out
+			}
+			if !ok {
+				continue
+			}
+
+			balance += entry.Amount
+			entry.Height = block.Height
+			entry.Timestamp = block.Time()
+			entry.Balance = balance
+			history = append(history, entry)
+		}
+	}
+
+	return history, nil
+}
+
+// 通过地址索引得到交易历史，只需要查找相关交易花费的输出
+// Build the transaction history from the address index, only the outputs spent
+// by the relevant transactions have to be looked up
+func (bc *BlockChain) getTransactionHistoryIndexed(address string) ([]TxHistoryEntry, error) {
+	var history []TxHistoryEntry
+	balance := 0
+
+	blocks, txs, err := bc.findAddressTransactionsIndexed(address)
+	if err != nil {
+		return nil, err
+	}
+	for i, tx := range txs {
+		outputs := make(map[string]TXOutput)
+		if !tx.IsCoinbase() {
+			prevTXs, err := bc.findPrevTransactions(tx)
+			if err != nil {
+				return nil, err
+			}
+			for _, in := range tx.Vin {
+				prevTx := prevTXs[hex.EncodeToString(in.Txid)]
+				if in.Vout >= 0 && in.Vout < len(prevTx.Vout) {
+					outputs[outpointKey(in.Txid, in.Vout)] = prevTx.Vout[in.Vout]
+				}
+			}
+		}
+
+		entry, ok := historyEntry(tx, address, outputs)
+		if !ok {
+			continue
+		}
+		balance += entry.Amount
+		entry.Height = blocks[i].Height
+		entry.Timestamp = blocks[i].Time()
+		entry.Balance = balance
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// 计算交易对address的影响，outputs为之前所有交易的输出
+// Work out how the transaction affects address, outputs holds the outputs of all earlier transactions
+func historyEntry(tx *Transaction, address string, outputs map[string]TXOutput) (TxHistoryEntry, bool) {
+	sent, received := 0, 0
+	involved := false
+	var senders, receivers []string
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Vin {
+			out, ok := outputs[outpointKey(in.Txid, in.Vout)]
+			if !ok {
+				continue
+			}
+			if out.CanBeUnlockedWith(address) {
+				sent += out.Value
+				involved = true
+			} else if from, ok := ExtractAddress(out.ScriptPubKey); ok {
+				senders = appendUnique(senders, from)
+			}
+		}
+	}
+	for _, out := range tx.Vout {
+		if out.CanBeUnlockedWith(address) {
+			received += out.Value
+			involved = true
+		} else if to, ok := ExtractAddress(out.ScriptPubKey); ok {
+			receivers = appendUnique(receivers, to)
+		}
+	}
+	if !involved {
+		return TxHistoryEntry{}, false
+	}
+
+	entry := TxHistoryEntry{
+		TxID:           hex.EncodeToString(tx.ID),
+		Counterparties: []string{},
+		Amount:         received - sent,
+	}
+	switch {
+	case tx.IsCoinbase():
+		entry.Direction = DirectionMined
+	case sent == 0:
+		entry.Direction = DirectionReceive
+		entry.Counterparties = senders
+	case len(receivers) == 0:
+		entry.Direction = DirectionSelf
+	default:
+		entry.Direction = DirectionSend
+		entry.Counterparties = receivers
+	}
+
+	return entry, true
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
+
+// 交易历史的导出格式
+// Export formats of the transaction history
+var historyWriters = map[string]func(w io.Writer, history []TxHistoryEntry) error{
+	"text": WriteHistoryText,
+	"json": WriteHistoryJSON,
+	"csv":  WriteHistoryCSV,
+}
+
+// 以可读的文本格式输出交易历史，每笔交易一行，对方地址在下一行。时间与CSV一样使用UTC
+// Write the transaction history as readable text, one line per transaction with the
+// counterparties on the next line. Times are in UTC like in the CSV export
+func WriteHistoryText(w io.Writer, history []TxHistoryEntry) error {
+	for _, entry := range history {
+		_, err := fmt.Fprintf(w, "%6d  %s  %s  %-7s  %+6d  balance %d\n", entry.Height,
+			time.Unix(entry.Timestamp, 0).UTC().Format("2006-01-02 15:04:05 MST"), entry.TxID,
+			entry.Direction, entry.Amount, entry.Balance)
+		if err != nil {
+			return err
+		}
+		if len(entry.Counterparties) > 0 {
+			if _, err := fmt.Fprintf(w, "        %s\n", strings.Join(entry.Counterparties, ", ")); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// 以JSON数组格式导出交易历史
+// Export the transaction history as a JSON array
+func WriteHistoryJSON(w io.Writer, history []TxHistoryEntry) error {
+	if history == nil {
+		history = []TxHistoryEntry{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(history)
+}
+
+// 以CSV格式导出交易历史，多个对方地址以分号分隔
+// Export the transaction history as CSV, multiple counterparties are separated by semicolons
+func WriteHistoryCSV(w io.Writer, history []TxHistoryEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"height", "time", "txid", "direction", "counterparties", "amount", "balance"})
+	for _, entry := range history {
+		writer.Write([]string{
+			strconv.Itoa(entry.Height),
+			time.Unix(entry.Timestamp, 0).UTC().Format(time.RFC3339),
+			entry.TxID,
+			entry.Direction,
+			strings.Join(entry.Counterparties, ";"),
+			strconv.Itoa(entry.Amount),
+			strconv.Itoa(entry.Balance),
+		})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A挖出创世区块和第一个区块，并付款给B；B付回一部分给A；A再转给自己
+// A mines the genesis and the first block and pays B; B pays part of it back to A; A then
+// sends to itself
+func newHistoryTestChain(t *testing.T) (*BlockChain, *Wallet, *Wallet, []*Transaction) {
+	t.Helper()
+
+	bc, a := newTestChain(t, testChainParams())
+	b := NewWallet()
+	miner := NewWallet().GetAddress()
+
+	toB := newTestTransaction(t, bc, a, []Recipient{{b.GetAddress(), 3}}, TxOptions{}, nil)
+	mineTestBlock(t, bc, a.GetAddress(), toB)
+	toA := newTestTransaction(t, bc, b, []Recipient{{a.GetAddress(), 1}}, TxOptions{}, nil)
+	mineTestBlock(t, bc, miner, toA)
+	toSelf := newTestTransaction(t, bc, a, []Recipient{{a.GetAddress(), 2}}, TxOptions{}, nil)
+	mineTestBlock(t, bc, miner, toSelf)
+
+	return bc, a, b, []*Transaction{toB, toA, toSelf}
+}
+
+func TestTransactionHistory(t *testing.T) {
+	bc, a, b, txs := newHistoryTestChain(t)
+	toB, toA, toSelf := hex.EncodeToString(txs[0].ID), hex.EncodeToString(txs[1].ID), hex.EncodeToString(txs[2].ID)
+
+	tests := []struct {
+		name     string
+		address  string
+		expected []TxHistoryEntry
+	}{
+		{"payer", a.GetAddress(), []TxHistoryEntry{
+			{Height: 0, Direction: DirectionMined, Counterparties: []string{}, Amount: subsidy, Balance: subsidy},
+			{Height: 1, Direction: DirectionMined, Counterparties: []string{}, Amount: subsidy, Balance: 2 * subsidy},
+			{Height: 1, TxID: toB, Direction: DirectionSend, Counterparties: []string{b.GetAddress()}, Amount: -3, Balance: 2*subsidy - 3},
+			{Height: 2, TxID: toA, Direction: DirectionReceive, Counterparties: []string{b.GetAddress()}, Amount: 1, Balance: 2*subsidy - 2},
+			{Height: 3, TxID: toSelf, Direction: DirectionSelf, Counterparties: []string{}, Amount: 0, Balance: 2*subsidy - 2},
+		}},
+		{"payee", b.GetAddress(), []TxHistoryEntry{
+			{Height: 1, TxID: toB, Direction: DirectionReceive, Counterparties: []string{a.GetAddress()}, Amount: 3, Balance: 3},
+			{Height: 2, TxID: toA, Direction: DirectionSend, Counterparties: []string{a.GetAddress()}, Amount: -1, Balance: 2},
+		}},
+		{"unknown", NewWallet().GetAddress(), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history, err := bc.GetTransactionHistory(test.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != len(test.expected) {
+				t.Fatalf("%d entries, expected %d", len(history), len(test.expected))
+			}
+			for i, entry := range history {
+				expected := test.expected[i]
+				// 挖矿奖励交易的ID和所有区块时间不在预期中比较
+				// The IDs of coinbase transactions and the block times are not compared
+				if expected.TxID == "" {
+					expected.TxID = entry.TxID
+				}
+				expected.Timestamp = entry.Timestamp
+				if !reflect.DeepEqual(entry, expected) {
+					t.Fatalf("entry %d is %+v, expected %+v", i, entry, expected)
+				}
+			}
+		})
+	}
+}
+
+// 使用地址索引和扫描整条链得到同样的历史
+// The address index and a scan of the whole chain give the same history
+func TestTransactionHistoryIndexedMatchesScan(t *testing.T) {
+	bc, a, b, _ := newHistoryTestChain(t)
+	addresses := []string{a.GetAddress(), b.GetAddress(), NewWallet().GetAddress()}
+
+	scanned := make(map[string][]TxHistoryEntry)
+	for _, address := range addresses {
+		history, err := bc.GetTransactionHistory(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanned[address] = history
+	}
+
+	if err := bc.Reindex(addrIndexer{}.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.indexEnabled(addrIndexer{}) {
+		t.Fatal("the address index is not enabled")
+	}
+	for _, address := range addresses {
+		history, err := bc.GetTransactionHistory(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(history, scanned[address]) {
+			t.Fatalf("%s: the indexed history\n%+v\ndiffers from the scanned one\n%+v", address, history, scanned[address])
+		}
+	}
+}
+
+// 文本和CSV都以UTC输出时间
+// Both text and CSV write the times in UTC
+func TestHistoryExportUsesUTC(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC).Unix()
+	history := []TxHistoryEntry{{Height: 7, Timestamp: timestamp, TxID: "ab", Direction: DirectionMined, Counterparties: []string{}, Amount: 10, Balance: 10}}
+
+	var text, csv bytes.Buffer
+	if err := WriteHistoryText(&text, history); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteHistoryCSV(&csv, history); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "2024-03-01 23:30:00 UTC") {
+		t.Fatalf("text export: %q", text.String())
+	}
+	if !strings.Contains(csv.String(), "2024-03-01T23:30:00Z") {
+		t.Fatalf("CSV export: %q", csv.String())
+	}
+}
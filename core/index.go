@@ -0,0 +1,226 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 可选的区块索引，每个索引使用自己的bucket，bucket存在即表示索引已启用。
+// 区块连接到链上或从链上移除时，启用的索引都会在同一个数据库事务中更新
+// Optional block index, each index has its own bucket and is enabled when the bucket exists.
+// Enabled indexes are updated in the same database transaction that connects a block to,
+// or disconnects it from, the chain
+type blockIndexer interface {
+	// 索引的名称和bucket
+	// Name and bucket of the index
+	Name() string
+	Bucket() []byte
+
+	// prevOuts为区块中交易输入花费的输出，以outpointKey为键
+	// prevOuts holds the outputs spent by the inputs of the block, keyed by outpointKey
+	ConnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error
+	DisconnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error
+}
+
+// 所有可用的索引
+// All available indexes
+var blockIndexers = []blockIndexer{
+	addrIndexer{},
+	txIndexer{},
+	utxoIndexer{},
+	cfIndexer{},
+}
+
+// 根据名称查找索引
+// Look up an index by name
+func findIndexer(name string) (blockIndexer, error) {
+	for _, indexer := range blockIndexers {
+		if indexer.Name() == name {
+			return indexer, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown index '%s'", name)
+}
+
+// 索引是否已启用
+// Whether the index is enabled
+func (bc *BlockChain) indexEnabled(indexer blockIndexer) bool {
+	enabled := false
+	bc.db.View(func(tx *bolt.Tx) error {
+		enabled = tx.Bucket(indexer.Bucket()) != nil
+
+		return nil
+	})
+
+	return enabled
+}
+
+// 是否有任何索引已启用
+// Whether any index is enabled
+func (bc *BlockChain) anyIndexEnabled() bool {
+	for _, indexer := range blockIndexers {
+		if bc.indexEnabled(indexer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 查找区块中交易输入花费的所有输出，同一区块内前面交易的输出也包括在内
+// Find all outputs spent by the inputs of the block, including the outputs
+// of earlier transactions in the same block
+func (bc *BlockChain) blockPrevOutputs(block *Block) (map[string]TXOutput, error) {
+	prevOuts := make(map[string]TXOutput)
+	inBlock := make(map[string]TXOutput)
+	// 已连接的区块花费的输出保存在撤销数据中，其余的在未花费输出集合中，
+	// 两者都没有时才需要读取交易，修剪后的链只能使用前两者
+	// The outputs spent by a connected block are in its undo data, the others are in the
+	// UTXO set. Only when neither has them the transaction is read, a pruned chain can
+	// only use the first two
+	undo := bc.blockSpentOutputs(block.Hash)
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				key := outpointKey(in.Txid, in.Vout)
+				if out, ok := inBlock[key]; ok {
+					prevOuts[key] = out
+					continue
+				}
+				if out, ok := undo[key]; ok {
+					prevOuts[key] = out
+					continue
+				}
+				entry, _, err := bc.lookupUTXOSet(in.Txid, in.Vout)
+				if err != nil {
+					return nil, err
+				}
+				if entry != nil {
+					prevOuts[key] = entry.Output
+					continue
+				}
+				prevTx, _, err := bc.FindTransaction(in.Txid)
+				if err != nil {
+					return nil, err
+				}
+				if in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+					return nil, fmt.Errorf("output %s does not exist", key)
+				}
+				prevOuts[key] = prevTx.Vout[in.Vout]
+			}
+		}
+		for i, out := range tx.Vout {
+			inBlock[outpointKey(tx.ID, i)] = out
+		}
+	}
+
+	return prevOuts, nil
+}
+
+// 区块连接到链上时更新所有启用的索引
+// Update all enabled indexes when a block is connected to the chain
+func connectBlockIndexes(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	for _, indexer := range blockIndexers {
+		if dbTx.Bucket(indexer.Bucket()) == nil {
+			continue
+		}
+		if err := indexer.ConnectBlock(dbTx, block, prevOuts); err != nil {
+			return fmt.Errorf("%s: %v", indexer.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// 区块从链上移除时更新所有启用的索引
+// Update all enabled indexes when a block is disconnected from the chain
+func disconnectBlockIndexes(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	for _, indexer := range blockIndexers {
+		if dbTx.Bucket(indexer.Bucket()) == nil {
+			continue
+		}
+		if err := indexer.DisconnectBlock(dbTx, block, prevOuts); err != nil {
+			return fmt.Errorf("%s: %v", indexer.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// 从创世区块开始重建索引，索引不存在时会被创建(启用)
+// Rebuild the index from the genesis block, the index is created (enabled) when it does not exist
+func (bc *BlockChain) Reindex(name string) error {
+	indexer, err := findIndexer(name)
+	if err != nil {
+		return err
+	}
+	if err := bc.requireFullChain("rebuilding an index"); err != nil {
+		return err
+	}
+	blocks := bc.chainBlocks()
+
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		return rebuildIndex(tx, indexer, blocks)
+	})
+}
+
+// 在事务中删除并重新建立索引，blocks为从创世区块开始的主链区块
+// Drop and rebuild the index within the transaction, blocks are the main chain blocks starting with the genesis block
+func rebuildIndex(tx *bolt.Tx, indexer blockIndexer, blocks []*Block) error {
+	if tx.Bucket(indexer.Bucket()) != nil {
+		if err := tx.DeleteBucket(indexer.Bucket()); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.CreateBucket(indexer.Bucket()); err != nil {
+		return err
+	}
+
+	// 按顺序处理区块，已处理区块的所有输出都保存在内存中，不需要再查找
+	// Blocks are processed in order and the outputs of processed blocks are kept
+	// in memory, so they do not have to be looked up
+	outputs := make(map[string]TXOutput)
+	for _, block := range blocks {
+		prevOuts := make(map[string]TXOutput)
+		for _, t := range block.Transactions {
+			if !t.IsCoinbase() {
+				for _, in := range t.Vin {
+					key := outpointKey(in.Txid, in.Vout)
+					prevOuts[key] = outputs[key]
+				}
+			}
+			for i, out := range t.Vout {
+				outputs[outpointKey(t.ID, i)] = out
+			}
+		}
+
+		if err := indexer.ConnectBlock(tx, block, prevOuts); err != nil {
+			return fmt.Errorf("%s: block %x: %v", indexer.Name(), block.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// 删除索引(停用)
+// Drop the index (disable it)
+func (bc *BlockChain) DropIndex(name string) error {
+	indexer, err := findIndexer(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := indexer.(utxoIndexer); ok && (bc.GetPruneConfig().Enabled() || bc.PruneHeight() > 0) {
+		return fmt.Errorf("the UTXO set cannot be dropped from a pruned chain")
+	}
+
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(indexer.Bucket()) == nil {
+			return nil
+		}
+
+		return tx.DeleteBucket(indexer.Bucket())
+	})
+}
@@ -0,0 +1,688 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// 脚本执行的资源限制，防止恶意脚本耗尽节点资源
+// Resource limits for script execution, so a malicious script cannot exhaust the node
+const (
+	maxScriptSize         = 10000 // 单个脚本的最大字节数 max bytes of a single script
+	maxScriptElementSize  = 520   // 单个栈元素的最大字节数 max bytes of a single stack element
+	maxOpsPerScript       = 201   // 单个脚本最多执行的非压栈操作数 max non-push ops per script
+	maxStackSize          = 1000  // 栈的最大深度 max depth of the stack
+	maxPubKeysPerMultiSig = 20    // 多重签名最多公钥数 max public keys in a multisig
+	maxScriptNumLen       = 4     // 算术操作数的最大字节数 max bytes of an arithmetic operand
+)
+
+var (
+	ErrScriptFailed      = errors.New("script: evaluated to false")
+	errEmptyStack        = errors.New("script: stack is empty")
+	errVerifyFailed      = errors.New("script: OP_VERIFY failed")
+	errEqualVerifyFailed = errors.New("script: OP_EQUALVERIFY failed")
+	errEarlyReturn       = errors.New("script: OP_RETURN executed")
+	errUnbalancedCond    = errors.New("script: unbalanced conditional")
+	errSigScriptNotPush  = errors.New("script: signature script is not push only")
+)
+
+// 脚本中的整数，采用小端符号位编码，与比特币一致
+// Integer on the script stack, encoded little endian with a sign bit like Bitcoin
+type scriptNum int64
+
+// 把整数编码为最短的字节数组
+// Encode the number into its minimal byte representation
+func (n scriptNum) Bytes() []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	negative := n < 0
+	abs := int64(n)
+	if negative {
+		abs = -abs
+	}
+
+	var result []byte
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	// 最高位被占用时需要额外一个字节存放符号位
+	// An extra byte is needed for the sign bit when the high bit is used
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// 把栈元素解码为整数
+// Decode a stack element into a number
+func makeScriptNum(v []byte, maxLen int) (scriptNum, error) {
+	if len(v) > maxLen {
+		return 0, fmt.Errorf("script: numeric value of %d bytes exceeds %d", len(v), maxLen)
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range v {
+		result |= int64(b) << uint(8*i)
+	}
+
+	// 最高字节的最高位是符号位
+	// The high bit of the last byte is the sign bit
+	if v[len(v)-1]&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(v)-1)))
+		result = -result
+	}
+
+	return scriptNum(result), nil
+}
+
+// 栈元素转为布尔值：全零(包括负零)为false
+// Convert a stack element to a bool: all zeros (including negative zero) are false
+func asBool(v []byte) bool {
+	for i, b := range v {
+		if b != 0 {
+			if i == len(v)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+func fromBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+
+	return []byte{}
+}
+
+// 条件分支的执行状态
+// Execution state of a conditional branch
+const (
+	condFalse = iota
+	condTrue
+	condSkip // 外层分支不执行时，内层分支整体跳过 the whole branch is skipped when the outer one is not executed
+)
+
+// 脚本执行引擎
+// Script execution engine
+type Engine struct {
+	tx        *Transaction // 正在验证的交易 the transaction being verified
+	txIdx     int          // 正在验证的输入序号 the index of the input being verified
+	subScript []byte       // 用于计算签名哈希的脚本 the script committed to by signatures
+	stack     [][]byte
+	condStack []int
+	numOps    int
+}
+
+func NewEngine(tx *Transaction, txIdx int, subScript []byte) *Engine {
+	return &Engine{tx: tx, txIdx: txIdx, subScript: subScript}
+}
+
+// 执行解锁脚本和锁定脚本，判断输入是否能够解锁输出
+// Execute the unlocking and the locking script to check whether the input can spend the output
+func VerifyScript(sigScript, pkScript []byte, tx *Transaction, txIdx int) error {
+	sigOps, err := parseScript(sigScript)
+	if err != nil {
+		return err
+	}
+	if !isPushOnly(sigOps) {
+		return errSigScriptNotPush
+	}
+
+	vm := NewEngine(tx, txIdx, pkScript)
+	if err := vm.Execute(sigScript); err != nil {
+		return err
+	}
+	sigStack := append([][]byte{}, vm.stack...)
+
+	if err := vm.Execute(pkScript); err != nil {
+		return err
+	}
+	if err := vm.checkSuccess(); err != nil {
+		return err
+	}
+
+	if ClassifyScript(pkScript) != ScriptHashTy {
+		return nil
+	}
+
+	// P2SH: 解锁脚本最后压入的是赎回脚本，哈希匹配后还要用剩余的栈执行赎回脚本
+	// P2SH: the last push of the unlocking script is the redeem script; once its hash
+	// matched, the redeem script is executed against the rest of the stack
+	if len(sigStack) == 0 {
+		return errEmptyStack
+	}
+	redeemScript := sigStack[len(sigStack)-1]
+	vm = NewEngine(tx, txIdx, redeemScript)
+	vm.stack = sigStack[:len(sigStack)-1]
+	if err := vm.Execute(redeemScript); err != nil {
+		return err
+	}
+
+	return vm.checkSuccess()
+}
+
+// 执行结束后栈顶必须为true
+// The top of the stack must be true when execution finishes
+func (vm *Engine) checkSuccess() error {
+	if len(vm.stack) == 0 {
+		return ErrScriptFailed
+	}
+	if !asBool(vm.stack[len(vm.stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+// 在当前栈上执行一个脚本
+// Execute a script on top of the current stack
+func (vm *Engine) Execute(script []byte) error {
+	if len(script) > maxScriptSize {
+		return fmt.Errorf("script: size %d exceeds %d", len(script), maxScriptSize)
+	}
+
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	vm.numOps = 0
+	vm.condStack = nil
+	for _, op := range ops {
+		if err := vm.step(op); err != nil {
+			return err
+		}
+		if len(vm.stack) > maxStackSize {
+			return fmt.Errorf("script: stack size exceeds %d", maxStackSize)
+		}
+	}
+	if len(vm.condStack) != 0 {
+		return errUnbalancedCond
+	}
+
+	return nil
+}
+
+// 当前分支是否需要执行
+// Whether the current branch is being executed
+func (vm *Engine) executing() bool {
+	return len(vm.condStack) == 0 || vm.condStack[len(vm.condStack)-1] == condTrue
+}
+
+func (vm *Engine) push(v []byte) {
+	vm.stack = append(vm.stack, v)
+}
+
+func (vm *Engine) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, errEmptyStack
+	}
+	v := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+
+	return v, nil
+}
+
+func (vm *Engine) peek(depth int) ([]byte, error) {
+	if depth >= len(vm.stack) {
+		return nil, errEmptyStack
+	}
+
+	return vm.stack[len(vm.stack)-1-depth], nil
+}
+
+func (vm *Engine) popNum() (scriptNum, error) {
+	v, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return makeScriptNum(v, maxScriptNumLen)
+}
+
+func (vm *Engine) popBool() (bool, error) {
+	v, err := vm.pop()
+	if err != nil {
+		return false, err
+	}
+
+	return asBool(v), nil
+}
+
+// 执行一条指令
+// Execute a single instruction
+func (vm *Engine) step(op parsedOp) error {
+	if len(op.data) > maxScriptElementSize {
+		return fmt.Errorf("script: element size %d exceeds %d", len(op.data), maxScriptElementSize)
+	}
+	if !isPushOpcode(op.opcode) {
+		vm.numOps++
+		if vm.numOps > maxOpsPerScript {
+			return fmt.Errorf("script: op count exceeds %d", maxOpsPerScript)
+		}
+	}
+
+	// 条件分支指令即使在不执行的分支里也要处理，以维持嵌套关系
+	// Conditionals are handled even in unexecuted branches to keep the nesting intact
+	switch op.opcode {
+	case OpIf, OpNotIf:
+		cond := condSkip
+		if vm.executing() {
+			ok, err := vm.popBool()
+			if err != nil {
+				return err
+			}
+			if op.opcode == OpNotIf {
+				ok = !ok
+			}
+			cond = condFalse
+			if ok {
+				cond = condTrue
+			}
+		}
+		vm.condStack = append(vm.condStack, cond)
+		return nil
+
+	case OpElse:
+		if len(vm.condStack) == 0 {
+			return errUnbalancedCond
+		}
+		top := len(vm.condStack) - 1
+		switch vm.condStack[top] {
+		case condTrue:
+			vm.condStack[top] = condFalse
+		case condFalse:
+			vm.condStack[top] = condTrue
+		}
+		return nil
+
+	case OpEndIf:
+		if len(vm.condStack) == 0 {
+			return errUnbalancedCond
+		}
+		vm.condStack = vm.condStack[:len(vm.condStack)-1]
+		return nil
+	}
+
+	if !vm.executing() {
+		return nil
+	}
+
+	switch {
+	case op.opcode == Op0:
+		vm.push([]byte{})
+		return nil
+	case op.opcode <= OpPushData2:
+		vm.push(op.data)
+		return nil
+	case op.opcode == Op1Negate:
+		vm.push(scriptNum(-1).Bytes())
+		return nil
+	case op.opcode >= Op1 && op.opcode <= Op16:
+		vm.push(scriptNum(op.opcode - Op1 + 1).Bytes())
+		return nil
+	}
+
+	switch op.opcode {
+	case OpNop:
+		return nil
+
+	case OpVerify:
+		ok, err := vm.popBool()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errVerifyFailed
+		}
+
+	case OpReturn:
+		return errEarlyReturn
+
+	case OpDrop:
+		_, err := vm.pop()
+		return err
+
+	case OpDup:
+		v, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		vm.push(v)
+
+	case OpOver:
+		v, err := vm.peek(1)
+		if err != nil {
+			return err
+		}
+		vm.push(v)
+
+	case OpSwap:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(a)
+		vm.push(b)
+
+	case OpEqual, OpEqualVerify:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if op.opcode == OpEqualVerify {
+			if !equal {
+				return errEqualVerifyFailed
+			}
+			return nil
+		}
+		vm.push(fromBool(equal))
+
+	case Op1Add, Op1Sub, OpNegate, OpAbs, OpNot:
+		n, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		switch op.opcode {
+		case Op1Add:
+			n++
+		case Op1Sub:
+			n--
+		case OpNegate:
+			n = -n
+		case OpAbs:
+			if n < 0 {
+				n = -n
+			}
+		case OpNot:
+			if n == 0 {
+				n = 1
+			} else {
+				n = 0
+			}
+		}
+		vm.push(n.Bytes())
+
+	case OpAdd, OpSub, OpBoolAnd, OpBoolOr, OpNumEqual, OpNumEqualVerify,
+		OpLessThan, OpGreaterThan, OpLessThanOrEqual, OpGreaterThanOrEqual, OpMin, OpMax:
+		b, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		return vm.binaryNumOp(op.opcode, a, b)
+
+	case OpWithin:
+		max, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		min, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		x, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		vm.push(fromBool(min <= x && x < max))
+
+	case OpSHA256, OpHash160, OpHash256:
+		v, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		switch op.opcode {
+		case OpSHA256:
+			hash := sha256.Sum256(v)
+			vm.push(hash[:])
+		case OpHash160:
+			vm.push(Hash160(v))
+		case OpHash256:
+			vm.push(doubleSHA256(v))
+		}
+
+	case OpCheckSig, OpCheckSigVerify:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		valid := vm.checkSig(sig, pubKey)
+		if op.opcode == OpCheckSigVerify {
+			if !valid {
+				return errVerifyFailed
+			}
+			return nil
+		}
+		vm.push(fromBool(valid))
+
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		valid, err := vm.checkMultiSig()
+		if err != nil {
+			return err
+		}
+		if op.opcode == OpCheckMultiSigVerify {
+			if !valid {
+				return errVerifyFailed
+			}
+			return nil
+		}
+		vm.push(fromBool(valid))
+
+	case OpCheckLockTimeVerify:
+		return vm.checkLockTimeVerify()
+
+	case OpCheckSequenceVerify:
+		return vm.checkSequenceVerify()
+
+	default:
+		return fmt.Errorf("script: unknown or disabled opcode 0x%02x", op.opcode)
+	}
+
+	return nil
+}
+
+// 执行二元算术操作
+// Execute a binary arithmetic operation
+func (vm *Engine) binaryNumOp(opcode byte, a, b scriptNum) error {
+	switch opcode {
+	case OpAdd:
+		vm.push((a + b).Bytes())
+	case OpSub:
+		vm.push((a - b).Bytes())
+	case OpBoolAnd:
+		vm.push(fromBool(a != 0 && b != 0))
+	case OpBoolOr:
+		vm.push(fromBool(a != 0 || b != 0))
+	case OpNumEqual:
+		vm.push(fromBool(a == b))
+	case OpNumEqualVerify:
+		if a != b {
+			return errVerifyFailed
+		}
+	case OpLessThan:
+		vm.push(fromBool(a < b))
+	case OpGreaterThan:
+		vm.push(fromBool(a > b))
+	case OpLessThanOrEqual:
+		vm.push(fromBool(a <= b))
+	case OpGreaterThanOrEqual:
+		vm.push(fromBool(a >= b))
+	case OpMin:
+		if b < a {
+			a = b
+		}
+		vm.push(a.Bytes())
+	case OpMax:
+		if b > a {
+			a = b
+		}
+		vm.push(a.Bytes())
+	}
+
+	return nil
+}
+
+// 校验签名是否由公钥对应的私钥对交易签出
+// Check that the signature was made over the transaction by the key of pubKey
+func (vm *Engine) checkSig(sig, pubKey []byte) bool {
+	if vm.tx == nil || len(sig) == 0 {
+		return false
+	}
+	hash := vm.tx.signatureHash(vm.txIdx, vm.subScript)
+
+	return verifySignature(pubKey, sig, hash)
+}
+
+// 栈顶的锁定时间不能晚于交易的锁定时间，并且输入不能禁用锁定时间
+// 栈顶元素保留在栈上，通常后面跟着OP_DROP
+// The lock time on top of the stack must not be later than the transaction's lock time,
+// and the input must not disable the lock time. The element is left on the stack,
+// it is usually followed by OP_DROP
+func (vm *Engine) checkLockTimeVerify() error {
+	if vm.tx == nil {
+		return errors.New("script: OP_CHECKLOCKTIMEVERIFY needs a transaction")
+	}
+	v, err := vm.peek(0)
+	if err != nil {
+		return err
+	}
+	lockTime, err := makeScriptNum(v, 5)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return fmt.Errorf("script: negative lock time %d", lockTime)
+	}
+
+	if err := verifyLockTime(int64(vm.tx.LockTime), LockTimeThreshold, int64(lockTime)); err != nil {
+		return err
+	}
+	if vm.tx.Vin[vm.txIdx].Sequence == MaxTxInSequenceNum {
+		return errors.New("script: transaction input is final")
+	}
+
+	return nil
+}
+
+// 栈顶的相对锁定不能大于输入序列号中的相对锁定
+// The relative lock on top of the stack must not exceed the one in the input's sequence
+func (vm *Engine) checkSequenceVerify() error {
+	if vm.tx == nil {
+		return errors.New("script: OP_CHECKSEQUENCEVERIFY needs a transaction")
+	}
+	v, err := vm.peek(0)
+	if err != nil {
+		return err
+	}
+	sequence, err := makeScriptNum(v, 5)
+	if err != nil {
+		return err
+	}
+	if sequence < 0 {
+		return fmt.Errorf("script: negative sequence %d", sequence)
+	}
+
+	// 脚本中禁用了相对锁定时相当于OP_NOP
+	// Behaves as OP_NOP when the script disables the relative lock
+	if uint32(sequence)&SequenceLockTimeDisabled != 0 {
+		return nil
+	}
+
+	txSequence := vm.tx.Vin[vm.txIdx].Sequence
+	if txSequence&SequenceLockTimeDisabled != 0 {
+		return errors.New("script: transaction input sequence disables relative locks")
+	}
+
+	mask := SequenceLockTimeIsSeconds | SequenceLockTimeMask
+	return verifyLockTime(int64(txSequence&mask), int64(SequenceLockTimeIsSeconds), int64(uint32(sequence)&mask))
+}
+
+// 校验M-of-N多重签名，栈上依次为: <sig1>...<sigM> M <pubKey1>...<pubKeyN> N
+// 签名必须按照公钥的顺序排列
+// Check an M-of-N multisig, the stack holds: <sig1>...<sigM> M <pubKey1>...<pubKeyN> N
+// Signatures must be in the same order as the public keys
+func (vm *Engine) checkMultiSig() (bool, error) {
+	n, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > maxPubKeysPerMultiSig {
+		return false, fmt.Errorf("script: invalid pubkey count %d", n)
+	}
+	vm.numOps += int(n)
+	if vm.numOps > maxOpsPerScript {
+		return false, fmt.Errorf("script: op count exceeds %d", maxOpsPerScript)
+	}
+
+	pubKeys := make([][]byte, n)
+	for i := int(n) - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("script: invalid signature count %d", m)
+	}
+
+	sigs := make([][]byte, m)
+	for i := int(m) - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	for s, k := 0, 0; s < len(sigs); k++ {
+		// 剩余公钥不足以匹配剩余签名
+		// Not enough public keys left to match the remaining signatures
+		if len(sigs)-s > len(pubKeys)-k {
+			return false, nil
+		}
+		if vm.checkSig(sigs[s], pubKeys[k]) {
+			s++
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// 用操作码和数据拼出脚本，[]byte按最短编码压栈，byte作为操作码
+// Assemble a script from opcodes and data, a []byte is pushed with the shortest encoding
+// and a byte is added as an opcode
+func testScript(t *testing.T, parts ...interface{}) []byte {
+	t.Helper()
+
+	b := NewScriptBuilder()
+	for _, part := range parts {
+		switch p := part.(type) {
+		case byte:
+			b.AddOp(p)
+		case []byte:
+			b.AddData(p)
+		default:
+			t.Fatalf("unexpected script part %T", part)
+		}
+	}
+	script, err := b.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return script
+}
+
+// 不带交易执行脚本并检查栈顶
+// Execute a script without a transaction and check the top of the stack
+func runTestScript(script []byte) error {
+	vm := NewEngine(nil, 0, nil)
+	if err := vm.Execute(script); err != nil {
+		return err
+	}
+
+	return vm.checkSuccess()
+}
+
+func TestScriptConditionals(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+		err    error
+	}{
+		{"if", testScript(t, Op1, OpIf, Op1, OpEndIf), nil},
+		{"else", testScript(t, Op0, OpIf, Op0, OpElse, Op1, OpEndIf), nil},
+		{"notif", testScript(t, Op0, OpNotIf, Op1, OpEndIf), nil},
+		{"nested", testScript(t, Op1, Op1, OpIf, OpIf, Op1, OpElse, Op0, OpEndIf, OpElse, Op0, OpEndIf), nil},
+		{"nested else", testScript(t, Op0, Op1, OpIf, OpIf, Op0, OpElse, Op1, OpEndIf, OpElse, Op0, OpEndIf), nil},
+		// 外层分支不执行时内层分支不弹出条件，其中的OP_RETURN也不执行
+		// When the outer branch is not executed the inner one pops no condition and its
+		// OP_RETURN does not run either
+		{"skipped inner branch", testScript(t, Op0, OpIf, OpReturn, OpIf, OpEndIf, OpElse, Op1, OpEndIf), nil},
+		{"false branch result", testScript(t, Op1, OpIf, Op0, OpElse, Op1, OpEndIf), ErrScriptFailed},
+		{"missing endif", testScript(t, Op1, OpIf, Op1), errUnbalancedCond},
+		{"nested missing endif", testScript(t, Op1, Op1, OpIf, OpIf, Op1, OpEndIf), errUnbalancedCond},
+		{"endif without if", testScript(t, Op1, OpEndIf), errUnbalancedCond},
+		{"else without if", testScript(t, Op1, OpElse), errUnbalancedCond},
+		{"if on empty stack", testScript(t, OpIf, Op1, OpEndIf), errEmptyStack},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := runTestScript(test.script); !errors.Is(err, test.err) {
+				t.Fatalf("got %v, expected %v", err, test.err)
+			}
+		})
+	}
+}
+
+// Op1之后的数字操作码
+// The number opcodes following Op1
+const (
+	op2 = Op1 + 1
+	op3 = Op1 + 2
+)
+
+func TestScriptArithmetic(t *testing.T) {
+	maxNum := []byte{0xff, 0xff, 0xff, 0x7f}
+	minNum := []byte{0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		name   string
+		script []byte
+		err    string
+	}{
+		{"add", testScript(t, Op1, op2, OpAdd, op3, OpNumEqual), ""},
+		{"sub", testScript(t, op3, op2, OpSub, Op1, OpNumEqual), ""},
+		{"negate", testScript(t, Op1, OpNegate, Op1Negate, OpNumEqual), ""},
+		{"abs", testScript(t, Op1Negate, OpAbs, Op1, OpNumEqual), ""},
+		{"not", testScript(t, Op0, OpNot), ""},
+		{"min max", testScript(t, Op1, op2, OpMin, Op1, OpNumEqualVerify, Op1, op2, OpMax, op2, OpNumEqual), ""},
+		{"within", testScript(t, op2, Op1, op3, OpWithin), ""},
+		{"outside", testScript(t, op3, Op1, op3, OpWithin), ErrScriptFailed.Error()},
+		{"negative zero is false", testScript(t, []byte{0x80}), ErrScriptFailed.Error()},
+		{"numequalverify", testScript(t, Op1, op2, OpNumEqualVerify, Op1), errVerifyFailed.Error()},
+		// 4字节的操作数是允许的最大值，结果可以超过4字节但不能再作为操作数
+		// 4 bytes operands are the largest allowed, a result may exceed 4 bytes but cannot be an operand again
+		{"largest operand", testScript(t, maxNum, Op1, OpAdd), ""},
+		{"smallest operand", testScript(t, minNum, Op1Negate, OpAdd), ""},
+		{"5 bytes operand", testScript(t, []byte{0, 0, 0, 0, 1}, Op1, OpAdd), "exceeds 4"},
+		{"overflowed result as operand", testScript(t, maxNum, Op1Add, Op1Add), "exceeds 4"},
+		{"missing operand", testScript(t, Op1, OpAdd), errEmptyStack.Error()},
+		{"within missing operand", testScript(t, Op1, op2, OpWithin), errEmptyStack.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := runTestScript(test.script)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got %v, expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestScriptReturnAndDisabledOpcodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+		err    string
+	}{
+		{"op_return", testScript(t, Op1, OpReturn), errEarlyReturn.Error()},
+		{"op_return with data", testScript(t, OpReturn, []byte("data")), errEarlyReturn.Error()},
+		{"skipped op_return", testScript(t, Op0, OpIf, OpReturn, OpEndIf, Op1), ""},
+		// OP_CAT、OP_MUL等在比特币中被禁用，这里也没有实现
+		// OP_CAT, OP_MUL and the like are disabled in Bitcoin and not implemented here
+		{"op_cat", []byte{Op1, Op1, 0x7e}, "unknown or disabled opcode 0x7e"},
+		{"op_mul", []byte{Op1, Op1, 0x95}, "unknown or disabled opcode 0x95"},
+		{"op_reserved", []byte{Op1, 0x50}, "unknown or disabled opcode 0x50"},
+		{"op_pushdata4", []byte{Op1, 0x4e}, "unknown or disabled opcode 0x4e"},
+		{"unassigned", []byte{Op1, 0xff}, "unknown or disabled opcode 0xff"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := runTestScript(test.script)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got %v, expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	ops := func(op byte, count int, suffix ...byte) []byte {
+		return append(bytes.Repeat([]byte{op}, count), suffix...)
+	}
+	element := func(size int) []byte {
+		return append([]byte{OpPushData2, byte(size), byte(size >> 8)}, bytes.Repeat([]byte{1}, size)...)
+	}
+
+	tests := []struct {
+		name   string
+		script []byte
+		err    string
+	}{
+		{"max ops", ops(OpNop, maxOpsPerScript, Op1), ""},
+		{"too many ops", ops(OpNop, maxOpsPerScript+1, Op1), "op count exceeds"},
+		// 压栈操作不计入操作数
+		// Pushes do not count towards the op limit
+		{"pushes are not ops", ops(Op1, maxOpsPerScript+1), ""},
+		// 多重签名的每个公钥都计入操作数
+		// Every public key of a multisig counts towards the op limit
+		{"multisig keys count as ops", append(ops(OpNop, maxOpsPerScript-1, Op0, Op0), Op1, OpCheckMultiSig), "op count exceeds"},
+		{"max stack", ops(Op1, maxStackSize), ""},
+		{"stack too large", ops(Op1, maxStackSize+1), "stack size exceeds"},
+		{"stack grows too large", append(ops(Op1, maxStackSize), OpDup), "stack size exceeds"},
+		{"max element", element(maxScriptElementSize), ""},
+		{"element too large", element(maxScriptElementSize + 1), "element size"},
+		{"script too large", ops(Op1, maxScriptSize+1), "size 10001 exceeds"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := runTestScript(test.script)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got %v, expected %q", err, test.err)
+			}
+		})
+	}
+
+	if _, err := NewScriptBuilder().AddData(make([]byte, maxScriptElementSize+1)).Script(); err == nil {
+		t.Fatal("the builder pushed an element that is too large")
+	}
+}
+
+// 创建一笔花费P2PKH输出的交易，返回交易和被花费的锁定脚本
+// Create a transaction spending a P2PKH output, returns it with the spent locking script
+func newP2PKHTestTransaction(wallet *Wallet) (*Transaction, []byte) {
+	pkScript := PayToPubKeyHashScript(HashPubKey(wallet.PublicKey))
+	tx := &Transaction{
+		Vin:  []TXInput{{sha256Bytes([]byte("prev")), 0, nil, MaxTxInSequenceNum}},
+		Vout: []TXOutput{{5, PayToPubKeyHashScript(HashPubKey(NewWallet().PublicKey))}},
+	}
+	sig := wallet.Sign(tx.signatureHash(0, pkScript))
+	tx.Vin[0].ScriptSig = PayToPubKeyHashSigScript(sig, wallet.PublicKey)
+
+	return tx, pkScript
+}
+
+func TestVerifyPayToPubKeyHash(t *testing.T) {
+	wallet := NewWallet()
+	other := NewWallet()
+
+	tests := []struct {
+		name string
+		edit func(tx *Transaction, pkScript []byte) []byte
+		err  string
+	}{
+		{"valid", func(tx *Transaction, pkScript []byte) []byte { return pkScript }, ""},
+		{"other key", func(tx *Transaction, pkScript []byte) []byte {
+			sig := other.Sign(tx.signatureHash(0, pkScript))
+			tx.Vin[0].ScriptSig = PayToPubKeyHashSigScript(sig, other.PublicKey)
+			return pkScript
+		}, errEqualVerifyFailed.Error()},
+		{"other output", func(tx *Transaction, pkScript []byte) []byte {
+			return PayToPubKeyHashScript(HashPubKey(other.PublicKey))
+		}, errEqualVerifyFailed.Error()},
+		{"changed transaction", func(tx *Transaction, pkScript []byte) []byte {
+			tx.Vout[0].Value++
+			return pkScript
+		}, ErrScriptFailed.Error()},
+		{"tampered signature", func(tx *Transaction, pkScript []byte) []byte {
+			ops, _ := parseScript(tx.Vin[0].ScriptSig)
+			sig := append([]byte{}, ops[0].data...)
+			sig[len(sig)-1] ^= 1
+			tx.Vin[0].ScriptSig = PayToPubKeyHashSigScript(sig, wallet.PublicKey)
+			return pkScript
+		}, ErrScriptFailed.Error()},
+		{"empty signature script", func(tx *Transaction, pkScript []byte) []byte {
+			tx.Vin[0].ScriptSig = nil
+			return pkScript
+		}, errEmptyStack.Error()},
+		{"signature script not push only", func(tx *Transaction, pkScript []byte) []byte {
+			tx.Vin[0].ScriptSig = append(append([]byte{}, tx.Vin[0].ScriptSig...), OpDup)
+			return pkScript
+		}, errSigScriptNotPush.Error()},
+		{"invalid public key", func(tx *Transaction, pkScript []byte) []byte {
+			badKey := []byte{2, 1, 2, 3}
+			tx.Vin[0].ScriptSig = PayToPubKeyHashSigScript([]byte{1}, badKey)
+			return PayToPubKeyHashScript(HashPubKey(badKey))
+		}, ErrScriptFailed.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx, pkScript := newP2PKHTestTransaction(wallet)
+			pkScript = test.edit(tx, pkScript)
+			err := VerifyScript(tx.Vin[0].ScriptSig, pkScript, tx, 0)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got %v, expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+// 随机脚本只能返回错误，不能让节点崩溃
+// Random scripts can only return errors, they must not crash the node
+func TestRandomScriptsDoNotPanic(t *testing.T) {
+	wallet := NewWallet()
+	tx, pkScript := newP2PKHTestTransaction(wallet)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		script := make([]byte, r.Intn(64))
+		r.Read(script)
+		// 一半的脚本只使用已实现的操作码，让执行走得更远
+		// Half of the scripts only use implemented opcodes so execution gets further
+		if i%2 == 0 {
+			for j := range script {
+				if _, ok := opcodeNames[script[j]]; !ok && script[j] > Op16 {
+					script[j] = Op1 + script[j]%16
+				}
+			}
+		}
+
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					t.Fatalf("script %x panicked: %v", script, p)
+				}
+			}()
+			VerifyScript(script, pkScript, tx, 0)
+			VerifyScript(tx.Vin[0].ScriptSig, script, tx, 0)
+			NewEngine(tx, 0, script).Execute(script)
+			DisasmString(script)
+			ClassifyScript(script)
+		}()
+	}
+}
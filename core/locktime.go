@@ -0,0 +1,204 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// 锁定时间相关常量，与比特币的nLockTime和BIP68相对锁定保持一致
+// Lock time constants, following Bitcoin's nLockTime and BIP68 relative locks
+const (
+	// 小于该值的锁定时间表示区块高度，否则表示Unix时间戳(秒)
+	// Lock times below this value are block heights, otherwise unix timestamps (seconds)
+	LockTimeThreshold = 500000000
+
+	// 输入序列号为该值时不启用任何锁定
+	// An input with this sequence number disables all locks
+	MaxTxInSequenceNum uint32 = 0xffffffff
+
+	// 序列号设置了该位时不启用相对锁定
+	// Relative locks are disabled when this bit of the sequence is set
+	SequenceLockTimeDisabled uint32 = 1 << 31
+
+	// 序列号设置了该位时相对锁定以512秒为单位，否则以区块为单位
+	// Relative locks are in units of 512 seconds when this bit is set, otherwise in blocks
+	SequenceLockTimeIsSeconds uint32 = 1 << 22
+
+	// 序列号中表示相对锁定值的部分
+	// The part of the sequence holding the relative lock value
+	SequenceLockTimeMask uint32 = 0x0000ffff
+
+	// 以秒为单位的相对锁定值需要左移的位数(512秒)
+	// Shift applied to relative locks in seconds (512 seconds)
+	SequenceLockTimeGranularity = 9
+)
+
+// 判断锁定时间在给定高度和时间时是否已过
+// Check whether the lock time has passed at the given height and time
+func lockTimeReached(lockTime int64, height int, blockTime int64) bool {
+	if lockTime < LockTimeThreshold {
+		return lockTime < int64(height)
+	}
+
+	return lockTime < blockTime
+}
+
+// 判断交易在给定高度和时间的区块中是否已最终确定(可以被打包)
+// Check whether the transaction is final (can be mined) in a block at the given height and time
+func IsFinalTransaction(tx *Transaction, height int, blockTime int64) bool {
+	if tx.LockTime == 0 || lockTimeReached(int64(tx.LockTime), height, blockTime) {
+		return true
+	}
+
+	// 所有输入的序列号都为最大值时忽略锁定时间
+	// The lock time is ignored when all inputs have the max sequence
+	for _, in := range tx.Vin {
+		if in.Sequence != MaxTxInSequenceNum {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 检查脚本中的锁定时间是否被交易满足，两者必须同为高度或同为时间
+// Check that the lock time from a script is satisfied by the transaction,
+// both must be heights or both must be timestamps
+func verifyLockTime(txLockTime, threshold, lockTime int64) error {
+	if !((txLockTime < threshold && lockTime < threshold) ||
+		(txLockTime >= threshold && lockTime >= threshold)) {
+		return fmt.Errorf("script: mismatched lock time types, tx %d, script %d", txLockTime, lockTime)
+	}
+	if lockTime > txLockTime {
+		return fmt.Errorf("script: lock time %d not reached, tx lock time is %d", lockTime, txLockTime)
+	}
+
+	return nil
+}
+
+// 带CHECKLOCKTIMEVERIFY的P2PKH锁定脚本:
+// <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+// P2PKH locking script guarded by CHECKLOCKTIMEVERIFY:
+// <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func LockTimePubKeyHashScript(lockTime uint32, pubKeyHash []byte) []byte {
+	prefix, err := NewScriptBuilder().
+		AddInt64(int64(lockTime)).AddOp(OpCheckLockTimeVerify).AddOp(OpDrop).Script()
+	HandleErr(err)
+
+	return append(prefix, PayToPubKeyHashScript(pubKeyHash)...)
+}
+
+func isLockTimePubKeyHash(ops []parsedOp) bool {
+	return len(ops) == 8 &&
+		isPushOpcode(ops[0].opcode) &&
+		ops[1].opcode == OpCheckLockTimeVerify &&
+		ops[2].opcode == OpDrop &&
+		isPubKeyHash(ops[3:])
+}
+
+// 提取锁定脚本中CHECKLOCKTIMEVERIFY的锁定时间
+// Extract the CHECKLOCKTIMEVERIFY lock time of a locking script
+func extractLockTime(script []byte) (int64, bool) {
+	ops, err := parseScript(script)
+	if err != nil || !isLockTimePubKeyHash(ops) {
+		return 0, false
+	}
+
+	var lockTime scriptNum
+	switch {
+	case ops[0].opcode >= Op1 && ops[0].opcode <= Op16:
+		lockTime = scriptNum(ops[0].opcode - Op1 + 1)
+	default:
+		if lockTime, err = makeScriptNum(ops[0].data, 5); err != nil {
+			return 0, false
+		}
+	}
+
+	return int64(lockTime), true
+}
+
+// 检查交易输入的相对锁定：被花费的输出所在区块之后需要经过足够的区块或时间
+// Check the relative locks of the inputs: enough blocks or time must have passed
+// since the block containing the spent output
+func (bc *BlockChain) checkSequenceLocks(tx *Transaction, height int, blockTime int64) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for _, in := range tx.Vin {
+		if in.Sequence&SequenceLockTimeDisabled != 0 {
+			continue
+		}
+
+		prevHeight, err := bc.outputHeight(in.Txid, in.Vout)
+		if err != nil {
+			return err
+		}
+
+		value := int64(in.Sequence & SequenceLockTimeMask)
+		if in.Sequence&SequenceLockTimeIsSeconds != 0 {
+			// 与BIP68相同，从输出所在区块之前的区块的中位时间开始计算
+			// As in BIP68 the time counts from the median time past of the block before the
+			// one containing the output
+			prevTime, err := bc.medianTimeAtHeight(prevHeight - 1)
+			if err != nil {
+				return err
+			}
+			unlockTime := prevTime + value<<SequenceLockTimeGranularity
+			if blockTime < unlockTime {
+				return consensusErrorf("input %x:%d is locked until %s", in.Txid, in.Vout, time.Unix(unlockTime, 0))
+			}
+		} else if int64(height) < int64(prevHeight)+value {
+			return consensusErrorf("input %x:%d is locked until height %d", in.Txid, in.Vout, int64(prevHeight)+value)
+		}
+	}
+
+	return nil
+}
+
+// 检查交易在给定高度和时间的区块中是否满足所有锁定条件
+// Check that the transaction satisfies all its locks in a block at the given height and time
+func (bc *BlockChain) CheckTransactionLocks(tx *Transaction, height int, blockTime int64) error {
+	if !IsFinalTransaction(tx, height, blockTime) {
+		if tx.LockTime < LockTimeThreshold {
+			return consensusErrorf("transaction %x is locked until height %d", tx.ID, tx.LockTime+1)
+		}
+		return consensusErrorf("transaction %x is locked until %s", tx.ID, time.Unix(int64(tx.LockTime), 0))
+	}
+
+	return bc.checkSequenceLocks(tx, height, blockTime)
+}
+
+// 根据被花费输出上的CHECKLOCKTIMEVERIFY条件调整交易的锁定时间，spent[i]为第i个输入花费的输出。
+// 交易只有一个锁定时间，所以不能同时满足按高度和按时间锁定的条件
+// Raise the lock time of the transaction to satisfy CHECKLOCKTIMEVERIFY on the spent outputs,
+// spent[i] is the output spent by input i. A transaction has a single lock time, so it cannot
+// satisfy a height lock and a time lock at once
+func applyOutputLockTimes(tx *Transaction, spent []UTXO) error {
+	for i, utxo := range spent {
+		lockTime, ok := extractLockTime(utxo.Output.ScriptPubKey)
+		if !ok {
+			continue
+		}
+		if tx.LockTime != 0 && (int64(tx.LockTime) < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+			return fmt.Errorf("output %x:%d is locked by %s but the transaction lock time %d is a %s, they cannot be mixed",
+				utxo.TxID, utxo.Index, lockTimeKind(lockTime), tx.LockTime, lockTimeKind(int64(tx.LockTime)))
+		}
+		if uint32(lockTime) > tx.LockTime {
+			tx.LockTime = uint32(lockTime)
+		}
+		if tx.Vin[i].Sequence == MaxTxInSequenceNum {
+			tx.Vin[i].Sequence = MaxTxInSequenceNum - 1
+		}
+	}
+
+	return nil
+}
+
+func lockTimeKind(lockTime int64) string {
+	if lockTime < LockTimeThreshold {
+		return "block height"
+	}
+
+	return "time"
+}
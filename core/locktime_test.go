@@ -0,0 +1,199 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestLockOutputRejectsScriptHashAddress(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	to := encodeAddress(scriptHashAddrVersion, Hash160([]byte("redeem script")))
+
+	_, err := newUnsignedTransaction(wallet.GetAddress(), []Recipient{{to, 3}}, TxOptions{OutputLockTime: 10}, bc)
+	if err == nil {
+		t.Fatal("locked a payment to a script hash address")
+	}
+}
+
+func TestApplyOutputLockTimes(t *testing.T) {
+	pubKeyHash := Hash160([]byte("public key"))
+	locked := func(lockTime uint32) UTXO {
+		return UTXO{TxID: []byte{byte(lockTime)}, Output: TXOutput{1, LockTimePubKeyHashScript(lockTime, pubKeyHash)}}
+	}
+	newTx := func(lockTime uint32, inputs int) *Transaction {
+		tx := &Transaction{LockTime: lockTime}
+		for i := 0; i < inputs; i++ {
+			tx.Vin = append(tx.Vin, TXInput{Sequence: MaxTxInSequenceNum})
+		}
+		return tx
+	}
+
+	tests := []struct {
+		name     string
+		lockTime uint32
+		spent    []UTXO
+		expected uint32 // 0表示应该被拒绝 0 when it must be rejected
+	}{
+		{"heights", 0, []UTXO{locked(100), locked(200)}, 200},
+		{"times", 0, []UTXO{locked(LockTimeThreshold + 100), locked(LockTimeThreshold)}, LockTimeThreshold + 100},
+		{"transaction height", 300, []UTXO{locked(100)}, 300},
+		{"mixed outputs", 0, []UTXO{locked(100), locked(LockTimeThreshold + 100)}, 0},
+		{"time output, height transaction", 300, []UTXO{locked(LockTimeThreshold + 100)}, 0},
+		{"height output, time transaction", LockTimeThreshold + 300, []UTXO{locked(100)}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := newTx(test.lockTime, len(test.spent))
+			err := applyOutputLockTimes(tx, test.spent)
+			if test.expected == 0 {
+				if err == nil {
+					t.Fatalf("mixed lock times accepted, lock time %d", tx.LockTime)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.LockTime != test.expected {
+				t.Fatalf("lock time is %d, expected %d", tx.LockTime, test.expected)
+			}
+			for i, in := range tx.Vin {
+				if in.Sequence == MaxTxInSequenceNum {
+					t.Fatalf("input %d keeps the final sequence, the lock time would be ignored", i)
+				}
+			}
+		})
+	}
+}
+
+// 在parent之后挖出一个时间戳为timestamp的区块，不连接到链上
+// Mine a block with the given timestamp after parent, without connecting it
+func newTestBlockAt(parent *Block, timestamp int64, to string, txs ...*Transaction) *Block {
+	txs = append([]*Transaction{NewCoinbaseTransaction(to, "")}, txs...)
+	block := newBlockTemplate(txs, parent.Hash, parent.Height+1)
+	block.Timestamp = timestamp
+	block.Nonce, block.Hash, _ = NewProofOfWork(block).solve(nil)
+
+	return block
+}
+
+// 有4个区块的链，返回链末端区块和它的中位时间(纳秒)
+// A chain of 4 blocks, returns the tip block and its median time past in nanoseconds
+func newMedianTimeTestChain(t *testing.T) (*BlockChain, *Wallet, *Block, int64) {
+	t.Helper()
+
+	bc, wallet := newTestChain(t, testChainParams())
+	var tip *Block
+	for i := 0; i < 3; i++ {
+		tip = mineTestBlock(t, bc, wallet.GetAddress())
+	}
+	var median int64
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		median, err = medianTimePast(tx.Bucket([]byte(headersBucket)), tip.Hash)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bc, wallet, tip, median
+}
+
+func TestMedianTimePast(t *testing.T) {
+	bc, _, tip, median := newMedianTimeTestChain(t)
+
+	// 4个区块的中位数是按时间排序后的第3个，即高度2的区块
+	// The median of 4 blocks is the 3rd by time, the block at height 2
+	second, err := bc.GetBlockByHeight(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if median != second.Timestamp {
+		t.Fatalf("median time past is %d, expected %d", median, second.Timestamp)
+	}
+	if median >= tip.Timestamp {
+		t.Fatal("the median time past is not before the tip")
+	}
+}
+
+// 时间戳不晚于中位时间的区块头和区块被拒绝，并且是共识错误
+// Headers and blocks with a timestamp that is not after the median time past are rejected
+// with a consensus error
+func TestBlockTimestampMustBeAfterMedianTimePast(t *testing.T) {
+	bc, wallet, tip, median := newMedianTimeTestChain(t)
+	address := wallet.GetAddress()
+
+	early := newTestBlockAt(tip, median, address)
+	if _, err := bc.AddHeaders([]BlockHeader{early.BlockHeader}); !errors.Is(err, errInvalidHeader) {
+		t.Fatalf("header at the median time past: expected an invalid header, got %v", err)
+	}
+	if err := bc.AddBlock(early); !isConsensusError(err) {
+		t.Fatalf("block at the median time past: expected a consensus error, got %v", err)
+	}
+
+	// 早于父区块但晚于中位时间的区块是有效的
+	// A block before its parent but after the median time past is valid
+	if err := bc.AddBlock(newTestBlockAt(tip, median+1, address)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 超前本地时间2小时以上的区块被拒绝，但不是共识错误，以后可能变得有效
+// Blocks more than 2 hours ahead of the local time are rejected, but not with a consensus
+// error, they can become valid later
+func TestBlockTimestampTooFarInTheFuture(t *testing.T) {
+	bc, wallet, tip, _ := newMedianTimeTestChain(t)
+	address := wallet.GetAddress()
+
+	future := newTestBlockAt(tip, time.Now().Add(maxFutureBlockTime+time.Hour).UnixNano(), address)
+	if _, err := bc.AddHeaders([]BlockHeader{future.BlockHeader}); err == nil || errors.Is(err, errInvalidHeader) {
+		t.Fatalf("header in the future: expected an error that is not an invalid header, got %v", err)
+	}
+	if err := bc.AddBlock(future); err == nil || isConsensusError(err) {
+		t.Fatalf("block in the future: expected an error that is not a consensus error, got %v", err)
+	}
+
+	if err := bc.AddBlock(newTestBlockAt(tip, time.Now().Add(time.Hour).UnixNano(), address)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 把区块时间设得更晚不能提前解锁时间锁定：交易锁定时间和相对时间锁定都按中位时间判断
+// A later block time cannot unlock time locks early: both the transaction lock time and the
+// relative time locks are evaluated against the median time past
+func TestTimeLocksUseMedianTimePast(t *testing.T) {
+	unlock := uint32(time.Now().Add(30 * time.Minute).Unix())
+
+	tests := []struct {
+		name string
+		opts TxOptions
+	}{
+		{"lock time", TxOptions{LockTime: unlock}},
+		// 512秒的相对锁定
+		// A relative lock of 512 seconds
+		{"relative lock", TxOptions{Sequence: SequenceLockTimeIsSeconds | 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bc, wallet, tip, _ := newMedianTimeTestChain(t)
+			address := wallet.GetAddress()
+			tx := newTestTransaction(t, bc, wallet, []Recipient{{NewWallet().GetAddress(), 3}}, test.opts, nil)
+
+			// 区块时间在锁定时间之后，但中位时间还没有到
+			// The block time is past the lock but the median time past is not
+			block := newTestBlockAt(tip, time.Now().Add(time.Hour).UnixNano(), address, tx)
+			err := bc.AddBlock(block)
+			if !isConsensusError(err) || !strings.Contains(err.Error(), "locked until") {
+				t.Fatalf("expected the lock to hold, got %v", err)
+			}
+			if _, err := bc.MineBlock([]*Transaction{NewCoinbaseTransaction(address, ""), tx}); err == nil {
+				t.Fatal("mined a locked transaction")
+			}
+		})
+	}
+}
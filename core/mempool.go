@@ -0,0 +1,316 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 交易池的上限，池满时移除交易费率最低的交易
+// Limits of the mempool, the transactions with the lowest fee rate are evicted when it is full
+const (
+	maxMempoolTxs   = 5000     // 最多保存的交易数 max transactions kept
+	maxMempoolBytes = 16 << 20 // 所有交易的总大小上限 upper bound of the total size of the transactions
+)
+
+// 交易池中的交易和它的交易费与大小
+// A transaction of the mempool with its fee and size
+type mempoolEntry struct {
+	tx   *Transaction
+	fee  int
+	size int
+}
+
+// 交易费率低于other
+// The fee rate is lower than the one of other
+func (e *mempoolEntry) cheaperThan(other *mempoolEntry) bool {
+	return e.fee*other.size < other.fee*e.size
+}
+
+// 交易池：已验证、等待被打包的交易
+// Mempool: validated transactions waiting to be mined
+type Mempool struct {
+	mu    sync.Mutex
+	bc    *BlockChain
+	txs   map[string]*mempoolEntry
+	order []string          // 交易进入交易池的顺序 order in which the transactions entered the mempool
+	spent map[string]string // 池中交易花费的输出和花费它的交易 outputs spent by the pool and the transaction spending them
+	size  int
+
+	maxTxs   int
+	maxBytes int
+}
+
+func NewMempool(bc *BlockChain) *Mempool {
+	return &Mempool{
+		bc:       bc,
+		txs:      make(map[string]*mempoolEntry),
+		spent:    make(map[string]string),
+		maxTxs:   maxMempoolTxs,
+		maxBytes: maxMempoolBytes,
+	}
+}
+
+// 验证交易并加入交易池，交易不能与池中已有交易花费同一输出。
+// 只验证新交易本身，池中交易花费的输出视为已被花费
+// Validate the transaction and add it to the mempool, it must not spend an output already
+// spent by a transaction in the pool. Only the new transaction is validated, with the
+// outputs spent by the pool counting as spent
+func (mp *Mempool) Add(tx *Transaction) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	id := hex.EncodeToString(tx.ID)
+	if _, ok := mp.txs[id]; ok {
+		return fmt.Errorf("transaction %s is already in the mempool", id)
+	}
+	if tx.IsCoinbase() {
+		return fmt.Errorf("coinbase transaction %s cannot enter the mempool", id)
+	}
+	for _, in := range tx.Vin {
+		key := outpointKey(in.Txid, in.Vout)
+		if owner, ok := mp.spent[key]; ok {
+			return fmt.Errorf("output %s is already spent by transaction %s in the mempool", key, owner)
+		}
+	}
+
+	lockTime, err := mp.bc.nextBlockLockTime()
+	if err != nil {
+		return err
+	}
+	fee, err := mp.bc.validateTransaction(tx, mp.bc.GetBestHeight()+1, lockTime, mp.bc.chainSpentOutputs())
+	if err != nil {
+		return err
+	}
+	// 在交易进入交易池之前准备事件，进入之后Add不能再失败
+	// Prepare the event before the transaction enters the pool, Add cannot fail once it has
+	var event *Event
+	if mp.bc.events.HasSubscribers() {
+		prevTXs, err := mp.bc.findPrevTransactions(tx)
+		if err != nil {
+			return err
+		}
+		prevOuts := make(map[string]TXOutput)
+		for _, in := range tx.Vin {
+			key := outpointKey(in.Txid, in.Vout)
+			prevTx, ok := prevTXs[hex.EncodeToString(in.Txid)]
+			if !ok || in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+				return fmt.Errorf("transaction %s: output %s does not exist", id, key)
+			}
+			prevOuts[key] = prevTx.Vout[in.Vout]
+		}
+		event = &Event{
+			Type:      EventTxMempool,
+			Height:    mp.bc.GetBestHeight(),
+			TxID:      id,
+			Addresses: transactionAddresses(tx, prevOuts),
+		}
+	}
+
+	data, err := gobEncode(tx)
+	if err != nil {
+		return err
+	}
+	entry := &mempoolEntry{tx, fee, len(data)}
+	if err := mp.makeRoom(entry); err != nil {
+		return fmt.Errorf("transaction %s: %v", id, err)
+	}
+	mp.insert(id, entry)
+
+	if event != nil {
+		mp.bc.events.Publish(*event)
+	}
+
+	return nil
+}
+
+// 池满时按交易费率从低到高移除交易，直到能放下entry。
+// 只能移除费率低于entry的交易，否则拒绝entry并且不移除任何交易
+// When the pool is full, evict transactions from the lowest fee rate up until entry fits.
+// Only transactions with a lower fee rate than entry can be evicted, otherwise entry is
+// rejected and nothing is evicted
+func (mp *Mempool) makeRoom(entry *mempoolEntry) error {
+	if entry.size > mp.maxBytes {
+		return fmt.Errorf("%d bytes is too large for the mempool", entry.size)
+	}
+
+	entries := make([]*mempoolEntry, 0, len(mp.txs))
+	for _, e := range mp.txs {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].cheaperThan(entries[j]) })
+
+	count, size := len(mp.txs), mp.size
+	var evict []*mempoolEntry
+	for count >= mp.maxTxs || size+entry.size > mp.maxBytes {
+		cheapest := entries[len(evict)]
+		if !cheapest.cheaperThan(entry) {
+			return fmt.Errorf("the mempool is full and the fee rate is too low")
+		}
+		evict = append(evict, cheapest)
+		count--
+		size -= cheapest.size
+	}
+
+	for _, e := range evict {
+		mp.remove(hex.EncodeToString(e.tx.ID))
+	}
+	if len(evict) > 0 {
+		mp.compact()
+	}
+
+	return nil
+}
+
+func (mp *Mempool) insert(id string, entry *mempoolEntry) {
+	mp.txs[id] = entry
+	mp.order = append(mp.order, id)
+	mp.size += entry.size
+	for _, in := range entry.tx.Vin {
+		mp.spent[outpointKey(in.Txid, in.Vout)] = id
+	}
+}
+
+// 移除交易，之后需要调用compact更新顺序
+// Remove a transaction, compact has to be called afterwards to update the order
+func (mp *Mempool) remove(id string) {
+	entry, ok := mp.txs[id]
+	if !ok {
+		return
+	}
+	delete(mp.txs, id)
+	mp.size -= entry.size
+	for _, in := range entry.tx.Vin {
+		delete(mp.spent, outpointKey(in.Txid, in.Vout))
+	}
+}
+
+// 从顺序中去掉已移除的交易
+// Drop the removed transactions from the order
+func (mp *Mempool) compact() {
+	var order []string
+	for _, id := range mp.order {
+		if _, ok := mp.txs[id]; ok {
+			order = append(order, id)
+		}
+	}
+	mp.order = order
+}
+
+func (mp *Mempool) transactions() []*Transaction {
+	var txs []*Transaction
+	for _, id := range mp.order {
+		txs = append(txs, mp.txs[id].tx)
+	}
+
+	return txs
+}
+
+// 按进入顺序返回池中的所有交易
+// All transactions of the pool in the order they entered it
+func (mp *Mempool) Transactions() []*Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return mp.transactions()
+}
+
+// 池中ID为id的交易，不存在时返回nil
+// The transaction with ID id in the pool, nil when there is none
+func (mp *Mempool) Get(id []byte) *Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if entry, ok := mp.txs[hex.EncodeToString(id)]; ok {
+		return entry.tx
+	}
+
+	return nil
+}
+
+// 池中交易已经花费的输出
+// The outputs already spent by the transactions of the pool
+func (mp *Mempool) SpentOutpoints() []Outpoint {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var spent []Outpoint
+	for _, id := range mp.order {
+		for _, in := range mp.txs[id].tx.Vin {
+			spent = append(spent, Outpoint{in.Txid, in.Vout})
+		}
+	}
+
+	return spent
+}
+
+// 池中交易的数量
+// Number of transactions in the pool
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return len(mp.order)
+}
+
+// 移除已被区块打包的交易
+// Remove the transactions mined by the block
+func (mp *Mempool) RemoveBlock(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		mp.remove(hex.EncodeToString(tx.ID))
+	}
+	mp.compact()
+}
+
+// 按顺序重新验证池中的交易，移除因为链的变化而失效的交易，例如输出已被区块中的交易花费。
+// 返回被移除的交易数
+// Validate the transactions of the pool again in order, removing those that became invalid
+// because the chain changed, like when a block spent their outputs. Returns the number removed
+func (mp *Mempool) Revalidate() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	height := mp.bc.GetBestHeight() + 1
+	lockTime, err := mp.bc.nextBlockLockTime()
+	if err != nil {
+		// 读不出链时保留交易池不变
+		// The pool is kept as it is when the chain cannot be read
+		return 0
+	}
+	spent := mp.bc.chainSpentOutputs()
+
+	// 每笔交易只验证一次，保留的交易的输入留在spent中，之后花费同一输出的交易会被移除
+	// Each transaction is validated once, the inputs of the kept ones stay in spent so
+	// later transactions spending the same outputs are removed
+	removed := 0
+	for _, id := range mp.order {
+		if _, err := mp.bc.validateTransaction(mp.txs[id].tx, height, lockTime, spent); err != nil {
+			mp.remove(id)
+			removed++
+		}
+	}
+	mp.compact()
+
+	return removed
+}
+
+// 把池中所有交易打包进一个新区块
+// Mine all transactions of the pool into a new block
+func (mp *Mempool) Mine() (*Block, error) {
+	txs := mp.Transactions()
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("the mempool is empty")
+	}
+
+	block, err := mp.bc.MineBlock(txs)
+	if err != nil {
+		return nil, err
+	}
+	mp.RemoveBlock(block)
+
+	return block, nil
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+// 创建一笔花费一个未被交易池花费的输出、交易费为fee的交易，找零成为交易费
+// Create a transaction with fee spending one output not spent by the mempool, the change becomes the fee
+func newMempoolTestTransaction(t *testing.T, mp *Mempool, wallet *Wallet, fee int) *Transaction {
+	t.Helper()
+
+	to := NewWallet().GetAddress()
+	return newTestTransaction(t, mp.bc, wallet, []Recipient{{to, subsidy - fee}}, TxOptions{Exclude: mp.SpentOutpoints()}, dropChange)
+}
+
+func TestMempoolRejectsConflicts(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	mp := NewMempool(bc)
+
+	first := newMempoolTestTransaction(t, mp, wallet, 1)
+	if err := mp.Add(first); err != nil {
+		t.Fatal(err)
+	}
+	conflict := newMempoolTestTransaction(t, NewMempool(bc), wallet, 2)
+	err := mp.Add(conflict)
+	if err == nil || !strings.Contains(err.Error(), "already spent by transaction") {
+		t.Fatalf("conflicting transaction: got %v", err)
+	}
+	if mp.Count() != 1 {
+		t.Fatalf("%d transactions in the mempool", mp.Count())
+	}
+}
+
+func TestMempoolRejectsInvalidValues(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	mp := NewMempool(bc)
+	to := NewWallet().GetAddress()
+
+	inflated := newTestTransaction(t, bc, wallet, []Recipient{{to, 5}}, TxOptions{}, func(tx *Transaction) {
+		tx.Vout[0].Value = subsidy * 2
+	})
+	if err := mp.Add(inflated); err == nil {
+		t.Fatal("transaction spending more than its inputs was accepted")
+	}
+	negative := newTestTransaction(t, bc, wallet, []Recipient{{to, 5}}, TxOptions{}, func(tx *Transaction) {
+		tx.Vout[1].Value = -1
+	})
+	if err := mp.Add(negative); err == nil {
+		t.Fatal("transaction with a negative output was accepted")
+	}
+	if mp.Count() != 0 {
+		t.Fatalf("%d transactions in the mempool", mp.Count())
+	}
+}
+
+func TestMempoolEvictsLowestFeeRate(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	for i := 0; i < 3; i++ {
+		mineTestBlock(t, bc, wallet.GetAddress())
+	}
+	mp := NewMempool(bc)
+	mp.maxTxs = 2
+
+	var pooled []*Transaction
+	for _, fee := range []int{1, 4} {
+		tx := newMempoolTestTransaction(t, mp, wallet, fee)
+		if err := mp.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		pooled = append(pooled, tx)
+	}
+	low, high := pooled[0], pooled[1]
+
+	// 交易费更高的交易替换交易费最低的交易
+	// A transaction with a higher fee replaces the one with the lowest fee
+	middle := newMempoolTestTransaction(t, mp, wallet, 2)
+	if err := mp.Add(middle); err != nil {
+		t.Fatal(err)
+	}
+	if mp.Get(low.ID) != nil || mp.Get(high.ID) == nil || mp.Get(middle.ID) == nil {
+		t.Fatal("the lowest fee transaction was not the one evicted")
+	}
+	if n := len(mp.SpentOutpoints()); n != 2 {
+		t.Fatalf("%d spent outputs after the eviction", n)
+	}
+
+	// 交易费不高于池中最低交易费的交易被拒绝
+	// A transaction whose fee does not beat the lowest in the pool is rejected
+	cheap := newMempoolTestTransaction(t, mp, wallet, 1)
+	err := mp.Add(cheap)
+	if err == nil || !strings.Contains(err.Error(), "mempool is full") {
+		t.Fatalf("low fee transaction in a full mempool: got %v", err)
+	}
+	if mp.Count() != 2 {
+		t.Fatalf("%d transactions in the mempool", mp.Count())
+	}
+}
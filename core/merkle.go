@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// 计算Merkle树根：相邻两个节点拼接后做哈希得到上一层，某一层的节点数为奇数时复制最后一个节点
+// Compute the Merkle root: every two neighbouring nodes are concatenated and hashed into
+// the next level, the last node is duplicated when a level has an odd number of nodes
+func merkleRoot(hashes [][]byte) []byte {
+	if len(hashes) == 0 {
+		return make([]byte, sha256.Size)
+	}
+
+	level := hashes
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+
+	return level[0]
+}
+
+// Merkle树的上一层
+// The next level of the Merkle tree
+func merkleParents(level [][]byte) [][]byte {
+	var parents [][]byte
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		parents = append(parents, merkleHash(level[i], right))
+	}
+
+	return parents
+}
+
+func merkleHash(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+
+	return hash[:]
+}
+
+// 第index个叶子节点的Merkle分支：从叶子到根每一层的兄弟节点。没有兄弟节点时(奇数层的最后一个)
+// 兄弟节点就是它自己
+// The Merkle branch of leaf index: the sibling at every level from the leaf up to the root.
+// A node without a sibling (the last one of an odd level) is its own sibling
+func merkleBranch(hashes [][]byte, index int) [][]byte {
+	var branch [][]byte
+
+	level := hashes
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		branch = append(branch, level[sibling])
+		level = merkleParents(level)
+		index /= 2
+	}
+
+	return branch
+}
+
+// 验证叶子leaf是count个叶子的Merkle树中的第index个，根为root。按count检查每一层的位置，
+// 防止用复制的节点伪造不存在的位置
+// Verify that leaf is leaf index of a Merkle tree of count leaves with the given root. The
+// position is checked against count at every level, so duplicated nodes cannot prove a
+// position that does not exist
+func verifyMerkleBranch(leaf []byte, index, count int, branch [][]byte, root []byte) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+
+	hash := leaf
+	for size := count; size > 1; size = (size + 1) / 2 {
+		if len(branch) == 0 {
+			return false
+		}
+		sibling := branch[0]
+		branch = branch[1:]
+
+		switch {
+		case index%2 == 1:
+			hash = merkleHash(sibling, hash)
+		case index+1 < size:
+			hash = merkleHash(hash, sibling)
+		case bytes.Equal(sibling, hash):
+			hash = merkleHash(hash, hash)
+		default:
+			return false
+		}
+		index /= 2
+	}
+
+	return len(branch) == 0 && bytes.Equal(hash, root)
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func newTestLeaves(count int) [][]byte {
+	leaves := make([][]byte, count)
+	for i := range leaves {
+		leaves[i] = sha256Bytes([]byte(fmt.Sprintf("tx %d", i)))
+	}
+
+	return leaves
+}
+
+func TestMerkleRoot(t *testing.T) {
+	leaves := newTestLeaves(3)
+	a, b, c := leaves[0], leaves[1], leaves[2]
+
+	tests := []struct {
+		name     string
+		leaves   [][]byte
+		expected []byte
+	}{
+		// 只有一笔交易时树根就是它的ID
+		// With a single transaction the root is its ID
+		{"single", [][]byte{a}, a},
+		{"two", [][]byte{a, b}, merkleHash(a, b)},
+		// 奇数层复制最后一个节点
+		// The last node of an odd level is duplicated
+		{"three", [][]byte{a, b, c}, merkleHash(merkleHash(a, b), merkleHash(c, c))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if root := merkleRoot(test.leaves); !bytes.Equal(root, test.expected) {
+				t.Fatalf("root is %x, expected %x", root, test.expected)
+			}
+		})
+	}
+}
+
+// 每个叶子的分支都能验证，包括奇数层中没有兄弟节点的叶子
+// The branch of every leaf verifies, including leaves without a sibling on an odd level
+func TestMerkleBranchVerifies(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 5, 6, 7, 11} {
+		leaves := newTestLeaves(count)
+		root := merkleRoot(leaves)
+		for index, leaf := range leaves {
+			branch := merkleBranch(leaves, index)
+			if !verifyMerkleBranch(leaf, index, count, branch, root) {
+				t.Fatalf("%d leaves: the branch of leaf %d does not verify", count, index)
+			}
+		}
+	}
+
+	// 单笔交易的分支为空
+	// The branch of a single transaction is empty
+	leaf := newTestLeaves(1)[0]
+	if branch := merkleBranch([][]byte{leaf}, 0); len(branch) != 0 {
+		t.Fatalf("the branch of a single leaf has %d nodes", len(branch))
+	}
+	if verifyMerkleBranch(leaf, 0, 1, [][]byte{leaf}, leaf) {
+		t.Fatal("a single leaf verified with an extra node")
+	}
+}
+
+func TestMerkleBranchRejectsTampering(t *testing.T) {
+	leaves := newTestLeaves(5)
+	root := merkleRoot(leaves)
+	index := 2
+	branch := merkleBranch(leaves, index)
+
+	copyBranch := func() [][]byte {
+		c := make([][]byte, len(branch))
+		for i, node := range branch {
+			c[i] = append([]byte{}, node...)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		leaf   []byte
+		index  int
+		count  int
+		branch [][]byte
+	}{
+		{"changed sibling", leaves[index], index, 5, func() [][]byte {
+			b := copyBranch()
+			b[1][0] ^= 1
+			return b
+		}()},
+		{"changed leaf", leaves[3], index, 5, branch},
+		{"wrong index", leaves[index], 3, 5, branch},
+		{"index out of range", leaves[index], 5, 5, branch},
+		{"wrong count", leaves[index], index, 3, branch},
+		{"missing node", leaves[index], index, 5, branch[:len(branch)-1]},
+		{"extra node", leaves[index], index, 5, append(copyBranch(), root)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if verifyMerkleBranch(test.leaf, test.index, test.count, test.branch, root) {
+				t.Fatal("a tampered branch verified")
+			}
+		})
+	}
+
+	// 奇数层的最后一个节点只能与自己配对：5个叶子的树根等于第5个叶子被复制成6个叶子的树根，
+	// 但按5个叶子验证时复制的位置不存在，最后一个叶子也不能换用别的兄弟节点
+	// The last node of an odd level can only be paired with itself: the root of 5 leaves equals
+	// the one of 6 leaves where the 5th is duplicated, but with 5 leaves the duplicated position
+	// does not exist and the last leaf cannot use another sibling
+	padded := append(append([][]byte{}, leaves...), leaves[4])
+	if !bytes.Equal(merkleRoot(padded), root) {
+		t.Fatal("the padded tree has a different root")
+	}
+	if verifyMerkleBranch(leaves[4], 5, 5, merkleBranch(padded, 5), root) {
+		t.Fatal("the duplicated leaf proved position 5 of 5 leaves")
+	}
+	last := merkleBranch(leaves, 4)
+	last[0] = leaves[3]
+	if verifyMerkleBranch(leaves[4], 4, 5, last, root) {
+		t.Fatal("the last leaf verified with another sibling")
+	}
+}
+
+// 区块的交易证明与区块头的Merkle树根一致
+// The transaction proofs of a block agree with the Merkle root of its header
+func TestBlockTxProof(t *testing.T) {
+	address := NewWallet().GetAddress()
+	var txs []*Transaction
+	for i := 0; i < 2; i++ {
+		txs = append(txs, NewCoinbaseTransaction(address, fmt.Sprintf("tx %d", i)))
+	}
+	block := newTestBlock(&Block{Hash: sha256Bytes([]byte("parent")), Height: 0}, address, txs...)
+	header := block.Header()
+	count := len(block.Transactions)
+
+	for index, tx := range block.Transactions {
+		if !header.VerifyTxProof(tx.ID, index, count, block.TxProof(index)) {
+			t.Fatalf("the proof of transaction %d does not verify", index)
+		}
+	}
+	if header.VerifyTxProof(sha256Bytes([]byte("other")), 0, count, block.TxProof(0)) {
+		t.Fatal("a transaction that is not in the block verified")
+	}
+}
@@ -0,0 +1,411 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/boltdb/bolt"
+)
+
+// 数据库结构的迁移：把旧版本程序创建的数据库升级到当前版本
+// A database schema migration: upgrades a database created by an older binary to the current version
+type Migration struct {
+	Version     int // 迁移完成后的版本 version after the migration
+	Description string
+	Migrate     func(tx *bolt.Tx) error
+}
+
+// 按版本排列的所有迁移，新的迁移只能追加在末尾
+// All migrations ordered by version, new migrations can only be appended
+var migrations = []Migration{
+	{1, "backfill block heights", migrateBlockHeights},
+	{2, "build the transaction index", migrateTxIndex},
+	{3, "store block headers", migrateBlockHeaders},
+	{4, "build the UTXO set", migrateUTXOSet},
+	{5, "split block headers out of blocks", migrateSplitHeaders},
+	{6, "move the chain tip to the metadata", migrateChainTip},
+}
+
+// 当前程序支持的数据库版本
+// Database schema version supported by this binary
+var currentSchemaVersion = migrations[len(migrations)-1].Version
+
+// 元数据中保存版本的键
+// Key of the schema version in the metadata
+const schemaVersionKey = "version"
+
+// 版本6之前blocks bucket中保存链末端哈希的键
+// Key of the tip hash in the blocks bucket before version 6
+const legacyTipKey = "l"
+
+// 演练模式下用于回滚事务的错误
+// Error used to roll back the transaction in dry-run mode
+var errDryRun = errors.New("dry run")
+
+// 第一版程序写入的数据库：交易没有脚本，输入和输出用任意字符串解锁和锁定，无法转换为当前的交易格式
+// A database written by the first release: transactions have no scripts, inputs and outputs are
+// unlocked and locked with arbitrary strings, which cannot be converted to the current transaction format
+var errLegacyDatabase = errors.New("unsupported legacy database written by the first release, its transactions have no scripts; create a new blockchain")
+
+// 第一版程序写入的区块和交易，ScriptSig和ScriptPubKey是字符串
+// Blocks and transactions written by the first release, ScriptSig and ScriptPubKey are strings
+type v0Block struct {
+	Timestamp     int64
+	Transactions  []*v0Transaction
+	PrevBlockHash []byte
+	Hash          []byte
+	Nonce         int
+}
+
+type v0Transaction struct {
+	ID   []byte
+	Vin  []v0TXInput
+	Vout []v0TXOutput
+}
+
+type v0TXInput struct {
+	Txid      []byte
+	Vout      int
+	ScriptSig string
+}
+
+type v0TXOutput struct {
+	Value        int
+	ScriptPubKey string
+}
+
+// 检查数据库中是否有第一版格式的区块，有时返回errLegacyDatabase。
+// 无法解码的其他区块留给迁移报告
+// Check whether the database holds blocks in the format of the first release, returning
+// errLegacyDatabase when it does. Other blocks that cannot be decoded are left to the migrations to report
+func checkLegacyBlocks(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(blocksBucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(func(k, v []byte) error {
+		if bytes.Equal(k, []byte(legacyTipKey)) {
+			return nil
+		}
+		if _, err := DeserializeBlock(v); err == nil {
+			return nil
+		}
+		var old v0Block
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&old); err == nil {
+			return fmt.Errorf("block %x: %w", k, errLegacyDatabase)
+		}
+
+		return nil
+	})
+}
+
+// 读取元数据中的整数，不存在时为0
+// Read an integer from the metadata, 0 when it does not exist
+func metaInt(tx *bolt.Tx, key string) int {
+	b := tx.Bucket([]byte(metaBucket))
+	if b == nil {
+		return 0
+	}
+	v := b.Get([]byte(key))
+	if len(v) != 4 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint32(v))
+}
+
+func putMetaInt(tx *bolt.Tx, key string, value int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, uint32(value))
+
+	return b.Put([]byte(key), v)
+}
+
+// 读取数据库版本，没有元数据的数据库是版本0
+// Read the schema version, a database without metadata is version 0
+func schemaVersion(tx *bolt.Tx) int {
+	return metaInt(tx, schemaVersionKey)
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	return putMetaInt(tx, schemaVersionKey, version)
+}
+
+// 尚未执行的迁移
+// Migrations that have not run yet
+func pendingMigrations(version int) []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// 把数据库升级到当前版本，每个迁移在自己的事务中执行并记录版本。
+// dryRun为true时所有迁移在同一个事务中执行后回滚，只检查它们能否成功
+// Upgrade the database to the current version, every migration runs in its own transaction
+// that also records the version. With dryRun all migrations run in a single transaction
+// that is rolled back, only checking that they succeed
+func migrateDB(db *bolt.DB, dryRun bool, log io.Writer) error {
+	var version int
+	db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+
+		return nil
+	})
+	if version > currentSchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d), please upgrade", version, currentSchemaVersion)
+	}
+
+	if version == 0 {
+		if err := db.View(checkLegacyBlocks); err != nil {
+			return err
+		}
+	}
+
+	pending := pendingMigrations(version)
+	if dryRun {
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, m := range pending {
+				fmt.Fprintf(log, "Would migrate database to version %d: %s\n", m.Version, m.Description)
+				if err := m.Migrate(tx); err != nil {
+					return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+				}
+			}
+
+			return errDryRun
+		})
+		if err != errDryRun {
+			return err
+		}
+		return nil
+	}
+
+	for _, m := range pending {
+		fmt.Fprintf(log, "Migrating database to version %d: %s\n", m.Version, m.Description)
+		err := db.Update(func(tx *bolt.Tx) error {
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+
+			return setSchemaVersion(tx, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+	}
+
+	return nil
+}
+
+// 升级区块链数据库，dryRun为true时只检查待执行的迁移能否成功，不做修改
+// Upgrade the blockchain database, with dryRun the pending migrations are only checked, nothing is changed
+func MigrateDatabase(dryRun bool, log io.Writer) error {
+	if !dbExists() {
+		return fmt.Errorf("no existing blockchain found")
+	}
+	db, err := bolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var version int
+	db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+
+		return nil
+	})
+	fmt.Fprintf(log, "Database schema version %d, this binary supports version %d\n", version, currentSchemaVersion)
+
+	return migrateDB(db, dryRun, log)
+}
+
+// 在事务中从链末端读取主链上的所有区块，按从创世区块开始的顺序返回
+// Read all blocks of the main chain within the transaction, returned in order starting with the genesis block
+func readMainChain(tx *bolt.Tx) ([]*Block, error) {
+	b := tx.Bucket([]byte(blocksBucket))
+	var blocks []*Block
+
+	hash := chainTip(tx)
+	for len(hash) > 0 {
+		data := b.Get(hash)
+		if data == nil {
+			return nil, fmt.Errorf("block %x is missing", hash)
+		}
+		block, err := DeserializeBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("block %x: %v", hash, err)
+		}
+		blocks = append(blocks, block)
+		hash = block.PrevBlockHash
+	}
+
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+
+	return blocks, nil
+}
+
+// 版本1：旧的数据库中区块没有高度，根据在主链上的位置补上
+// Version 1: blocks of old databases have no height, fill it in from their position on the main chain
+func migrateBlockHeights(tx *bolt.Tx) error {
+	blocks, err := readMainChain(tx)
+	if err != nil {
+		return err
+	}
+
+	b := tx.Bucket([]byte(blocksBucket))
+	for height, block := range blocks {
+		if block.Height == height {
+			continue
+		}
+		block.Height = height
+		if err := b.Put(block.Hash, block.Serialize()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 版本2：新的区块链默认启用交易索引，为旧的数据库建立交易索引
+// Version 2: new blockchains have the transaction index enabled by default, build it for old databases
+func migrateTxIndex(tx *bolt.Tx) error {
+	if tx.Bucket([]byte(txIndexBucket)) != nil {
+		return nil
+	}
+	if _, err := tx.CreateBucket([]byte(txIndexBucket)); err != nil {
+		return err
+	}
+
+	blocks, err := readMainChain(tx)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err := (txIndexer{}).ConnectBlock(tx, block, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 版本3：修剪后的区块只保留区块头，为所有已有区块保存区块头
+// Version 3: only the header of a pruned block is kept, store the headers of all existing blocks
+func migrateBlockHeaders(tx *bolt.Tx) error {
+	headers, err := tx.CreateBucketIfNotExists([]byte(headersBucket))
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(blocksBucket)).ForEach(func(k, v []byte) error {
+		if bytes.Equal(k, []byte(legacyTipKey)) {
+			return nil
+		}
+		block, err := DeserializeBlock(v)
+		if err != nil {
+			return fmt.Errorf("block %x: %v", k, err)
+		}
+
+		return headers.Put(block.Hash, block.Header().Serialize())
+	})
+}
+
+// 版本4：验证交易和修剪区块使用未花费输出集合，为旧的数据库建立它
+// Version 4: validation and pruning use the UTXO set, build it for old databases
+func migrateUTXOSet(tx *bolt.Tx) error {
+	if tx.Bucket([]byte(utxoSetBucket)) != nil {
+		return nil
+	}
+	blocks, err := readMainChain(tx)
+	if err != nil {
+		return err
+	}
+
+	return rebuildIndex(tx, utxoIndexer{}, blocks)
+}
+
+// 版本5：区块头成为区块中单独的结构，并增加了版本、Merkle树根和难度值。
+// 读取时旧格式的区块和区块头会被转换，这里把它们按新格式重新写入
+// Version 5: the header became a separate struct inside the block, with a version, a Merkle root
+// and the difficulty added. Blocks and headers in the old format are converted when read,
+// here they are written again in the new format
+func migrateSplitHeaders(tx *bolt.Tx) error {
+	blocks := tx.Bucket([]byte(blocksBucket))
+	headers := tx.Bucket([]byte(headersBucket))
+
+	updates := make(map[string][]byte)
+	err := blocks.ForEach(func(k, v []byte) error {
+		if bytes.Equal(k, []byte(legacyTipKey)) {
+			return nil
+		}
+		block, err := DeserializeBlock(v)
+		if err != nil {
+			return fmt.Errorf("block %x: %v", k, err)
+		}
+		updates[string(k)] = block.Serialize()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range updates {
+		if err := blocks.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	updates = make(map[string][]byte)
+	err = headers.ForEach(func(k, v []byte) error {
+		header, err := decodeBlockHeader(v)
+		if err != nil {
+			return fmt.Errorf("header %x: %v", k, err)
+		}
+		updates[string(k)] = header.Serialize()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range updates {
+		if err := headers.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 版本6：链末端的哈希保存在blocks bucket的"l"键中，十六进制为6c的哈希前缀会查到它而不是区块，
+// 把它移到元数据中
+// Version 6: the tip hash was kept under the "l" key of the blocks bucket, where the hash prefix
+// 6c in hex finds it instead of a block, move it to the metadata
+func migrateChainTip(tx *bolt.Tx) error {
+	blocks := tx.Bucket([]byte(blocksBucket))
+	tip := blocks.Get([]byte(legacyTipKey))
+	if tip == nil {
+		return nil
+	}
+	if err := putChainTip(tx, append([]byte{}, tip...)); err != nil {
+		return err
+	}
+
+	return blocks.Delete([]byte(legacyTipKey))
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func mustGobEncode(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	data, err := gobEncode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// 在临时目录中创建只有blocks bucket的数据库，就像没有元数据的旧程序写入的那样，blocks按从创世区块开始的顺序
+// Create a database with only the blocks bucket in a temporary directory, like the ones written by
+// old binaries without metadata, blocks are in order starting with the genesis block
+func newLegacyTestDB(t *testing.T, hashes [][]byte, blocks [][]byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "blockchain.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+		for i, data := range blocks {
+			if err := b.Put(hashes[i], data); err != nil {
+				return err
+			}
+		}
+
+		return b.Put([]byte(legacyTipKey), hashes[len(hashes)-1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// 第一版程序格式的链：创世区块把奖励给Ivan，下一个区块中Ivan支付给Pedro
+// A chain in the format of the first release: the genesis block rewards Ivan and Ivan pays
+// Pedro in the next block
+func newV0TestDB(t *testing.T) string {
+	t.Helper()
+
+	coinbase := &v0Transaction{
+		Vin:  []v0TXInput{{[]byte{}, -1, genesisCoinbaseData}},
+		Vout: []v0TXOutput{{subsidy, "Ivan"}},
+	}
+	coinbase.ID = sha256Bytes(mustGobEncode(t, coinbase))
+	payment := &v0Transaction{
+		Vin:  []v0TXInput{{coinbase.ID, 0, "Ivan"}},
+		Vout: []v0TXOutput{{4, "Pedro"}, {subsidy - 4, "Ivan"}},
+	}
+	payment.ID = sha256Bytes(mustGobEncode(t, payment))
+
+	genesis := &v0Block{time.Now().UnixNano(), []*v0Transaction{coinbase}, []byte{}, nil, 0}
+	genesis.Hash = sha256Bytes(mustGobEncode(t, genesis))
+	next := &v0Block{time.Now().UnixNano(), []*v0Transaction{payment}, genesis.Hash, nil, 0}
+	next.Hash = sha256Bytes(mustGobEncode(t, next))
+
+	return newLegacyTestDB(t, [][]byte{genesis.Hash, next.Hash}, [][]byte{mustGobEncode(t, genesis), mustGobEncode(t, next)})
+}
+
+func sha256Bytes(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+func TestMigrateRejectsFirstReleaseDatabase(t *testing.T) {
+	path := newV0TestDB(t)
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, dryRun := range []bool{true, false} {
+		if err := migrateDB(db, dryRun, ioutil.Discard); !errors.Is(err, errLegacyDatabase) {
+			t.Fatalf("dry run %v: expected the legacy database error, got %v", dryRun, err)
+		}
+	}
+
+	// 数据库没有被修改
+	// The database was not changed
+	err = db.View(func(tx *bolt.Tx) error {
+		if version := schemaVersion(tx); version != 0 {
+			t.Errorf("schema version is %d, expected 0", version)
+		}
+		if tx.Bucket([]byte(headersBucket)) != nil || tx.Bucket([]byte(txIndexBucket)) != nil {
+			t.Error("a migration ran on the legacy database")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenFirstReleaseDatabaseFails(t *testing.T) {
+	path := newV0TestDB(t)
+
+	bc, err := openBlockChain(path, testChainParams(), ioutil.Discard)
+	if err == nil {
+		bc.DbClose()
+		t.Fatal("opened a database written by the first release")
+	}
+	if !errors.Is(err, errLegacyDatabase) {
+		t.Fatalf("expected the legacy database error, got %v", err)
+	}
+}
+
+// 没有元数据的数据库：区块头在区块中，区块没有高度，也没有区块头、索引和未花费输出集合
+// A database without metadata: the header is part of the block, blocks have no height and there
+// are no headers, indexes or UTXO set
+func TestMigrateDatabaseWithoutMetadata(t *testing.T) {
+	wallet := NewWallet()
+	address := wallet.GetAddress()
+
+	var hashes, blocks [][]byte
+	prev := []byte{}
+	for height := 0; height < 3; height++ {
+		block := newBlockTemplate([]*Transaction{NewCoinbaseTransaction(address, "")}, prev, height)
+		block.Version = legacyBlockVersion
+		block.MerkleRoot = block.computeMerkleRoot()
+		block.Nonce, block.Hash, _ = NewProofOfWork(block).solve(nil)
+
+		old := legacyBlock{block.Timestamp, block.Transactions, block.PrevBlockHash, block.Hash, block.Nonce, 0}
+		hashes = append(hashes, block.Hash)
+		blocks = append(blocks, mustGobEncode(t, old))
+		prev = block.Hash
+	}
+	path := newLegacyTestDB(t, hashes, blocks)
+
+	bc, err := openBlockChain(path, testChainParams(), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.DbClose()
+	if err := bc.verifyConsistency(); err != nil {
+		t.Fatal(err)
+	}
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.Height != 2 || !bytes.Equal(tip.Hash, hashes[2]) {
+		t.Fatalf("tip is %x at height %d, expected %x at height 2", tip.Hash, tip.Height, hashes[2])
+	}
+	if balance := bc.GetBalance(address).Total; balance != 3*subsidy {
+		t.Fatalf("balance is %d after the migration, expected %d", balance, 3*subsidy)
+	}
+
+	// 链末端移到了元数据中，blocks bucket中只剩下区块
+	// The tip moved to the metadata, only blocks are left in the blocks bucket
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(blocksBucket)).Get([]byte("l")) != nil {
+			t.Error("the legacy tip key is still in the blocks bucket")
+		}
+		if tip := tx.Bucket([]byte(metaBucket)).Get([]byte(tipKey)); !bytes.Equal(tip, hashes[2]) {
+			t.Errorf("tip in the metadata is %x, expected %x", tip, hashes[2])
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
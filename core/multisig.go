@@ -0,0 +1,258 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+// 创建M-of-N多重签名赎回脚本: OP_M <pubKey1> ... <pubKeyN> OP_N OP_CHECKMULTISIG
+// Create an M-of-N multisig redeem script: OP_M <pubKey1> ... <pubKeyN> OP_N OP_CHECKMULTISIG
+func MultiSigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if n == 0 || n > 16 || m < 1 || m > n {
+		return nil, fmt.Errorf("invalid multisig %d-of-%d", m, n)
+	}
+
+	// 重复的公钥会让一个签名者的签名计算多次
+	// A duplicate public key would let the signature of one signer count more than once
+	seen := make(map[string]bool)
+	builder := NewScriptBuilder().AddInt64(int64(m))
+	for _, pubKey := range pubKeys {
+		if !verifyPubKey(pubKey) {
+			return nil, fmt.Errorf("invalid public key %x", pubKey)
+		}
+		if seen[string(pubKey)] {
+			return nil, fmt.Errorf("duplicate public key %x", pubKey)
+		}
+		seen[string(pubKey)] = true
+		builder.AddData(pubKey)
+	}
+	builder.AddInt64(int64(n)).AddOp(OpCheckMultiSig)
+
+	return builder.Script()
+}
+
+// 解析多重签名脚本，返回所需签名数和公钥列表
+// Parse a multisig script into the required signature count and the public keys
+func parseMultiSig(ops []parsedOp) (int, [][]byte, bool) {
+	if len(ops) < 4 || ops[len(ops)-1].opcode != OpCheckMultiSig {
+		return 0, nil, false
+	}
+
+	first, last := ops[0].opcode, ops[len(ops)-2].opcode
+	if first < Op1 || first > Op16 || last < Op1 || last > Op16 {
+		return 0, nil, false
+	}
+	m, n := int(first-Op1+1), int(last-Op1+1)
+
+	pubKeyOps := ops[1 : len(ops)-2]
+	if len(pubKeyOps) != n || m > n {
+		return 0, nil, false
+	}
+
+	var pubKeys [][]byte
+	for _, op := range pubKeyOps {
+		if len(op.data) == 0 {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, op.data)
+	}
+
+	return m, pubKeys, true
+}
+
+// 赎回脚本对应的P2SH地址
+// The P2SH address of a redeem script
+func ScriptHashAddress(redeemScript []byte) string {
+	return encodeAddress(scriptHashAddrVersion, Hash160(redeemScript))
+}
+
+// 部分签名的交易，在多个签名者之间通过文件传递，签名数量达到要求后才能广播
+// Partially signed transaction, passed between signers as a file; it can only be
+// broadcast once enough signatures were collected
+type PartialTransaction struct {
+	Tx     Transaction
+	Inputs []PartialInput
+}
+
+// 部分签名交易的一个输入
+// An input of a partially signed transaction
+type PartialInput struct {
+	RedeemScript []byte            // 被花费输出的赎回脚本 redeem script of the spent output
+	Signatures   map[string][]byte // 公钥(hex) -> 签名 public key (hex) -> signature
+}
+
+// 创建从多重签名地址转出的未签名交易
+// Create an unsigned transaction spending from a multisig address
+func NewPartialTransaction(from string, recipients []Recipient, opts TxOptions, bc *BlockChain) (*PartialTransaction, error) {
+	wallets, err := NewWallets()
+	if err != nil {
+		return nil, err
+	}
+	redeemScript, ok := wallets.GetRedeemScript(from)
+	if !ok {
+		return nil, fmt.Errorf("no redeem script for address '%s' in %s", from, walletFile)
+	}
+
+	tx, err := newUnsignedTransaction(from, recipients, opts, bc)
+	if err != nil {
+		return nil, err
+	}
+	pt := &PartialTransaction{Tx: *tx}
+	for range tx.Vin {
+		pt.Inputs = append(pt.Inputs, PartialInput{redeemScript, make(map[string][]byte)})
+	}
+
+	return pt, nil
+}
+
+// 使用钱包为所有包含其公钥的输入添加签名，返回签名的输入数
+// Add signatures for every input whose redeem script contains the wallet's key,
+// returns the number of inputs signed
+func (pt *PartialTransaction) Sign(wallet *Wallet) (int, error) {
+	signed := 0
+
+	for idx, in := range pt.Inputs {
+		ops, err := parseScript(in.RedeemScript)
+		if err != nil {
+			return signed, err
+		}
+		_, pubKeys, ok := parseMultiSig(ops)
+		if !ok {
+			return signed, fmt.Errorf("input %d: redeem script is not multisig", idx)
+		}
+
+		for _, pubKey := range pubKeys {
+			if bytes.Equal(pubKey, wallet.PublicKey) {
+				// gob不会编码空的map，从文件加载后可能为nil
+				// gob does not encode empty maps, so it may be nil after loading from a file
+				if in.Signatures == nil {
+					pt.Inputs[idx].Signatures = make(map[string][]byte)
+				}
+				sig := wallet.Sign(pt.Tx.signatureHash(idx, in.RedeemScript))
+				pt.Inputs[idx].Signatures[hex.EncodeToString(pubKey)] = sig
+				signed++
+				break
+			}
+		}
+	}
+
+	return signed, nil
+}
+
+// 按公钥顺序返回输入上的有效签名，以及所需的签名数
+// Return the valid signatures of an input in public key order, and the required count
+func (pt *PartialTransaction) validSignatures(idx int) ([][]byte, int) {
+	in := pt.Inputs[idx]
+	ops, err := parseScript(in.RedeemScript)
+	if err != nil {
+		return nil, 0
+	}
+	m, pubKeys, ok := parseMultiSig(ops)
+	if !ok {
+		return nil, 0
+	}
+
+	var sigs [][]byte
+	hash := pt.Tx.signatureHash(idx, in.RedeemScript)
+	for _, pubKey := range pubKeys {
+		sig, ok := in.Signatures[hex.EncodeToString(pubKey)]
+		if ok && verifySignature(pubKey, sig, hash) {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	return sigs, m
+}
+
+// 所有输入中最少的有效签名数，以及所需的签名数
+// The lowest number of valid signatures over all inputs, and the required count
+func (pt *PartialTransaction) SignatureCount() (int, int) {
+	have, need := -1, 0
+
+	for idx := range pt.Inputs {
+		sigs, m := pt.validSignatures(idx)
+		if have < 0 || len(sigs) < have {
+			have = len(sigs)
+		}
+		if m > need {
+			need = m
+		}
+	}
+	if have < 0 {
+		have = 0
+	}
+
+	return have, need
+}
+
+// 有效签名数是否已满足要求
+// Whether enough valid signatures were collected
+func (pt *PartialTransaction) IsComplete() bool {
+	for idx := range pt.Inputs {
+		sigs, m := pt.validSignatures(idx)
+		if m == 0 || len(sigs) < m {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 签名数满足要求后生成最终的解锁脚本: <sig1> ... <sigM> <redeemScript>
+// Build the final unlocking scripts once the threshold is met: <sig1> ... <sigM> <redeemScript>
+func (pt *PartialTransaction) Finalize() (*Transaction, error) {
+	if !pt.IsComplete() {
+		have, need := pt.SignatureCount()
+		return nil, fmt.Errorf("transaction has %d of %d required signatures", have, need)
+	}
+
+	tx := pt.Tx
+	tx.Vin = append([]TXInput{}, pt.Tx.Vin...)
+	for idx, in := range pt.Inputs {
+		sigs, m := pt.validSignatures(idx)
+
+		builder := NewScriptBuilder()
+		for _, sig := range sigs[:m] {
+			builder.AddData(sig)
+		}
+		script, err := builder.AddData(in.RedeemScript).Script()
+		if err != nil {
+			return nil, err
+		}
+		tx.Vin[idx].ScriptSig = script
+	}
+
+	return &tx, nil
+}
+
+// 把部分签名交易保存到文件
+// Save the partially signed transaction to a file
+func (pt *PartialTransaction) SaveToFile(file string) error {
+	var content bytes.Buffer
+
+	if err := gob.NewEncoder(&content).Encode(pt); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, content.Bytes(), 0644)
+}
+
+// 从文件加载部分签名交易
+// Load a partially signed transaction from a file
+func LoadPartialTransaction(file string) (*PartialTransaction, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var pt PartialTransaction
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&pt); err != nil {
+		return nil, err
+	}
+
+	return &pt, nil
+}
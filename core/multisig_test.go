@@ -0,0 +1,165 @@
+package core
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 创建一笔花费2-of-3多重签名P2SH输出的部分签名交易，返回签名者的钱包和被花费的锁定脚本
+// Create a partially signed transaction spending a 2-of-3 multisig P2SH output, returns the
+// wallets of the signers and the spent locking script
+func newMultiSigTestTransaction(t *testing.T) (*PartialTransaction, []*Wallet, []byte) {
+	t.Helper()
+
+	var wallets []*Wallet
+	var pubKeys [][]byte
+	for i := 0; i < 3; i++ {
+		wallet := NewWallet()
+		wallets = append(wallets, wallet)
+		pubKeys = append(pubKeys, wallet.PublicKey)
+	}
+	redeemScript, err := MultiSigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := Transaction{
+		Vin:  []TXInput{{sha256Bytes([]byte("prev")), 0, nil, MaxTxInSequenceNum}},
+		Vout: []TXOutput{{5, PayToPubKeyHashScript(HashPubKey(NewWallet().PublicKey))}},
+	}
+	pt := &PartialTransaction{Tx: tx, Inputs: []PartialInput{{redeemScript, make(map[string][]byte)}}}
+
+	return pt, wallets, PayToScriptHashScript(Hash160(redeemScript))
+}
+
+// 签名并保存到文件，再加载出来交给下一个签名者
+// Sign and save to a file, then load it for the next signer
+func signAndExportTestTransaction(t *testing.T, pt *PartialTransaction, wallet *Wallet) *PartialTransaction {
+	t.Helper()
+
+	if signed, err := pt.Sign(wallet); err != nil || signed != 1 {
+		t.Fatalf("signed %d inputs: %v", signed, err)
+	}
+	file := filepath.Join(t.TempDir(), "tx.partial")
+	if err := pt.SaveToFile(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPartialTransaction(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loaded
+}
+
+func TestMultiSigSignAcrossExport(t *testing.T) {
+	pt, wallets, pkScript := newMultiSigTestTransaction(t)
+
+	// 空的签名表经过gob编码后变为nil，加载后仍然可以签名
+	// An empty signature map becomes nil through gob, signing still works after loading
+	file := filepath.Join(t.TempDir(), "tx.partial")
+	if err := pt.SaveToFile(file); err != nil {
+		t.Fatal(err)
+	}
+	pt, err := LoadPartialTransaction(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pt = signAndExportTestTransaction(t, pt, wallets[0])
+	if have, need := pt.SignatureCount(); have != 1 || need != 2 {
+		t.Fatalf("%d of %d signatures after the first signer", have, need)
+	}
+	if _, err := pt.Finalize(); err == nil || !strings.Contains(err.Error(), "1 of 2 required signatures") {
+		t.Fatalf("finalized below the threshold: %v", err)
+	}
+
+	pt = signAndExportTestTransaction(t, pt, wallets[2])
+	if !pt.IsComplete() {
+		t.Fatal("the transaction is not complete with 2 of 3 signatures")
+	}
+	tx, err := pt.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyScript(tx.Vin[0].ScriptSig, pkScript, tx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiSigRejectsWrongAndDuplicateKeys(t *testing.T) {
+	pt, wallets, _ := newMultiSigTestTransaction(t)
+
+	// 不在赎回脚本中的钱包不能签名
+	// A wallet that is not in the redeem script cannot sign
+	if signed, err := pt.Sign(NewWallet()); err != nil || signed != 0 {
+		t.Fatalf("a wallet outside the redeem script signed %d inputs: %v", signed, err)
+	}
+
+	// 同一个签名者签两次只算一个签名
+	// The same signer signing twice counts once
+	for i := 0; i < 2; i++ {
+		if _, err := pt.Sign(wallets[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if have, _ := pt.SignatureCount(); have != 1 {
+		t.Fatalf("%d signatures after the same signer signed twice", have)
+	}
+
+	// 把签名放在另一个公钥下不能冒充另一个签名者
+	// Filing a signature under another public key does not impersonate that signer
+	sig := pt.Inputs[0].Signatures[hex.EncodeToString(wallets[0].PublicKey)]
+	for _, wallet := range wallets[1:] {
+		pt.Inputs[0].Signatures[hex.EncodeToString(wallet.PublicKey)] = sig
+	}
+	if have, _ := pt.SignatureCount(); have != 1 {
+		t.Fatalf("%d valid signatures after copying one signature to other keys", have)
+	}
+	if _, err := pt.Finalize(); err == nil {
+		t.Fatal("finalized with a single signer")
+	}
+
+	// 赎回脚本中不能有重复的公钥，否则一个签名者就能满足2-of-2
+	// The redeem script cannot repeat a public key, otherwise one signer would satisfy a 2-of-2
+	if _, err := MultiSigScript(2, [][]byte{wallets[0].PublicKey, wallets[0].PublicKey}); err == nil {
+		t.Fatal("a redeem script with a duplicate public key was created")
+	}
+	if _, err := MultiSigScript(1, [][]byte{{2, 1, 2, 3}}); err == nil {
+		t.Fatal("a redeem script with an invalid public key was created")
+	}
+}
+
+// 赎回脚本与P2SH输出的哈希不符时不能花费，即使签名足够
+// A redeem script that does not match the hash of the P2SH output cannot spend it, even with
+// enough signatures
+func TestMultiSigMismatchedRedeemScript(t *testing.T) {
+	pt, wallets, _ := newMultiSigTestTransaction(t)
+	other, _, otherPkScript := newMultiSigTestTransaction(t)
+
+	for _, wallet := range wallets[:2] {
+		if _, err := pt.Sign(wallet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx, err := pt.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyScript(tx.Vin[0].ScriptSig, otherPkScript, tx, 0); err != ErrScriptFailed {
+		t.Fatalf("spending another P2SH output: got %v, expected %v", err, ErrScriptFailed)
+	}
+
+	// 换成输出对应的赎回脚本后，对原赎回脚本做的签名不再有效
+	// After switching to the redeem script of the output, the signatures made over the
+	// original redeem script are no longer valid
+	pt.Inputs[0].RedeemScript = other.Inputs[0].RedeemScript
+	if pt.IsComplete() {
+		t.Fatal("signatures of other keys count")
+	}
+	if _, err := pt.Finalize(); err == nil {
+		t.Fatal("finalized with signatures of other keys")
+	}
+}
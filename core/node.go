@@ -0,0 +1,1782 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 节点的参数
+// Parameters of the node
+const (
+	peerSendQueue            = 256              // 每个连接等待发送的消息数 messages waiting to be sent per connection
+	peerWriteTimeout         = 30 * time.Second // 发送一条消息的超时 timeout for sending a message
+	dialTimeout              = 10 * time.Second
+	maxBlocksInFlightPerPeer = 16               // 每个节点同时下载的区块数 blocks downloaded at the same time from one peer
+	blockDownloadWindow      = 1024             // 只请求最近要连接的这些区块，限制内存中等待的区块 only these next blocks are requested, bounding the blocks waiting in memory
+	blockRequestTimeout      = 20 * time.Second // 区块请求的超时，超时后改从其他节点下载 after this a block is requested from another peer
+	maxUnconnectingHeaders   = 10               // 连续收到无法连接的区块头的次数上限 max consecutive header messages that do not connect
+	defaultMaxOutbound       = 8                // 默认的出站连接数 default number of outbound connections
+	connectInterval          = time.Second      // 检查出站连接的间隔 interval between checks of the outbound connections
+	addrSaveInterval         = 5 * time.Minute  // 保存地址的间隔 interval between saves of the addresses
+	maxAddrRelay             = 10               // 只转发地址不多于这个数的addr消息 only addr messages with at most this many addresses are relayed
+	addrRelayMaxAge          = 10 * time.Minute // 只转发最近见到的地址 only recently seen addresses are relayed
+	addrRelayPeers           = 2                // 地址转发给几个节点 number of peers an address is relayed to
+	txRequestTimeout         = time.Minute      // 交易请求的超时，超时后可以向其他节点请求 after this a transaction can be requested from another peer
+	recentInvExpiry          = 10 * time.Minute // 记住最近见到的交易的时长 how long recently seen transactions are remembered
+	maxKnownInventory        = 10000            // 每个连接记住的对方已知清单数 inventory known to a peer remembered per connection
+	minerInterval            = time.Second      // 矿工检查交易池的间隔 interval between checks of the mempool by the miner
+)
+
+// 连接的另一个节点
+// Another node we are connected to
+type Peer struct {
+	// 统计数据，原子访问
+	// Statistics, accessed atomically
+	bytesSent uint64
+	bytesRecv uint64
+	lastSend  int64 // Unix时间 Unix time
+	lastRecv  int64
+
+	conn     net.Conn
+	addr     string // 出站连接为拨号的地址 the dialed address for outbound connections
+	inbound  bool
+	connTime time.Time
+
+	out       chan []byte
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	// 以下字段由Node.mu保护
+	// The fields below are guarded by Node.mu
+	handshake    bool
+	services     uint64
+	startHeight  int
+	bestHeight   int
+	listenAddr   string               // 入站节点接受连接的地址 the address an inbound peer accepts connections on
+	sentAddr     bool                 // 已回复getaddr has answered getaddr
+	knownAddrs   map[string]bool      // 对方已知的地址，不再转发给它 addresses the peer knows, not relayed to it again
+	knownInv     map[string]bool      // 对方已有的交易，不再通知它 transactions the peer has, not announced to it again
+	sentMempool  bool                 // 已回复mempool has answered mempool
+	askedMempool bool                 // 已发送mempool has been sent mempool
+	inFlight     map[string]time.Time // 向该节点请求的区块 blocks requested from this peer
+	txInFlight   map[string]time.Time // 向该节点请求的交易 transactions requested from this peer
+	missing      map[string]bool      // 该节点没有的区块 blocks this peer does not have
+	unconnecting int
+	banScore     int            // 不当行为的累计分数 accumulated misbehavior score
+	filter       *addressFilter // 轻节点设置的过滤器 the filter set by a light client
+}
+
+func (p *Peer) String() string {
+	return p.addr
+}
+
+// 把消息放入发送队列，队列已满说明对方太慢，断开连接
+// Queue a message for sending, a full queue means the peer is too slow and it is disconnected
+func (p *Peer) send(command string, payload interface{}) {
+	msg, err := encodeMessage(command, payload)
+	if err != nil {
+		p.close()
+		return
+	}
+	select {
+	case p.out <- msg:
+	case <-p.quit:
+	default:
+		p.close()
+	}
+}
+
+func (p *Peer) close() {
+	p.closeOnce.Do(func() {
+		close(p.quit)
+		p.conn.Close()
+	})
+}
+
+func (p *Peer) writeLoop() {
+	for {
+		select {
+		case msg := <-p.out:
+			p.conn.SetWriteDeadline(time.Now().Add(peerWriteTimeout))
+			if _, err := p.conn.Write(msg); err != nil {
+				p.close()
+				return
+			}
+			atomic.AddUint64(&p.bytesSent, uint64(len(msg)))
+			atomic.StoreInt64(&p.lastSend, time.Now().Unix())
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// 节点：与其他节点交换区块头和区块。同步时先下载区块头，只根据区块头验证工作量证明，
+// 确定最佳区块头链之后再从多个节点并行下载区块，并按顺序验证和连接
+// Node: exchanges headers and blocks with other nodes. Syncing downloads the headers first,
+// checking the proof of work from the headers alone. Once the best header chain is known the
+// blocks are downloaded from several peers in parallel, then validated and connected in order
+type Node struct {
+	bc       *BlockChain
+	log      io.Writer
+	genesis  []byte
+	services uint64
+	nonce    uint64
+	addrman  *AddrManager
+	banlist  *BanList
+
+	// 目标出站连接数和挖矿奖励的地址(为空时不挖矿)，在Start之前设置
+	// Target number of outbound connections and the address of the mining rewards
+	// (no mining when empty), set before Start
+	MaxOutbound   int
+	MiningAddress string
+
+	// 建立出站连接和监听入站连接的方式，默认使用TCP，模拟网络替换为内存中的连接，在Start之前设置
+	// How outbound connections are dialed and inbound ones listened for, TCP by default.
+	// The simulated network replaces them with in-memory connections. Set before Start
+	Dial   func(addr string) (net.Conn, error)
+	Listen func(addr string) (net.Listener, error)
+
+	mu         sync.Mutex
+	peers      map[*Peer]bool
+	listener   net.Listener
+	listenPort int
+	quit       chan struct{}
+
+	// 出站连接，由mu保护
+	// Outbound connections, guarded by mu
+	seeds      []string                 // 没有其他地址时使用的种子节点 seed nodes used when no other address is available
+	persistent map[string]*KnownAddress // 一直保持连接的节点 nodes we always stay connected to
+	dialing    map[string]bool          // 正在连接的地址 addresses being dialed
+
+	// 交易转发，由mu保护
+	// Transaction relay, guarded by mu
+	mempool     *Mempool
+	txRequested map[string]*Peer     // 已请求的交易和请求的节点 requested transactions and the peer they were requested from
+	recentInv   map[string]time.Time // 最近见到的交易，包括被拒绝的，不再请求 recently seen transactions, including rejected ones, not requested again
+
+	// 区块下载，由mu保护
+	// Block download, guarded by mu
+	queue     []*ChainHeader    // 最佳区块头链上待连接的区块 blocks of the best header chain waiting to be connected
+	requested map[string]*Peer  // 已请求的区块和请求的节点 requested blocks and the peer they were requested from
+	received  map[string]*Block // 已收到但还不能连接的区块 received blocks that cannot be connected yet
+	source    map[string]*Peer  // 收到的区块来自哪个节点 which peer a received block came from
+	invalid   map[string]bool   // 验证失败的区块 blocks that failed validation
+	orphans   *orphanPool       // 父区块未知的区块 blocks whose parent is unknown
+}
+
+func NewNode(bc *BlockChain, log io.Writer) (*Node, error) {
+	// 无效快照上的链不能提供给其他节点
+	// A chain on an invalid snapshot cannot be served to other nodes
+	if err := bc.checkSnapshot(); err != nil {
+		return nil, err
+	}
+	genesis, err := bc.GenesisHash()
+	if err != nil {
+		return nil, err
+	}
+
+	services := uint64(serviceNetwork)
+	if bc.indexEnabled(cfIndexer{}) {
+		services |= serviceCompactFilters
+	}
+
+	addrman, err := loadAddrManager(bc.db)
+	if err != nil {
+		return nil, err
+	}
+	banlist, err := loadBanList(bc.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Node{
+		bc:          bc,
+		log:         log,
+		genesis:     genesis,
+		services:    services,
+		nonce:       rand.Uint64(),
+		addrman:     addrman,
+		banlist:     banlist,
+		MaxOutbound: defaultMaxOutbound,
+		Dial: func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, dialTimeout)
+		},
+		Listen: func(addr string) (net.Listener, error) {
+			return net.Listen("tcp", addr)
+		},
+		peers:       make(map[*Peer]bool),
+		quit:        make(chan struct{}),
+		persistent:  make(map[string]*KnownAddress),
+		dialing:     make(map[string]bool),
+		mempool:     NewMempool(bc),
+		txRequested: make(map[string]*Peer),
+		recentInv:   make(map[string]time.Time),
+		requested:   make(map[string]*Peer),
+		received:    make(map[string]*Block),
+		source:      make(map[string]*Peer),
+		invalid:     make(map[string]bool),
+		orphans:     newOrphanPool(),
+	}, nil
+}
+
+func (n *Node) logf(format string, args ...interface{}) {
+	fmt.Fprintf(n.log, format+"\n", args...)
+}
+
+// 启动节点，listen不为空时在该地址上接受其他节点的连接
+// Start the node, with a non-empty listen address other nodes can connect to it there
+func (n *Node) Start(listen string) error {
+	if listen != "" {
+		listener, err := n.Listen(listen)
+		if err != nil {
+			return err
+		}
+		_, port, err := net.SplitHostPort(listener.Addr().String())
+		if err == nil {
+			n.listenPort, err = strconv.Atoi(port)
+		}
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("listening address %s: %v", listener.Addr(), err)
+		}
+		n.listener = listener
+		go n.acceptLoop()
+	}
+
+	// 链末端改变时通知其他节点
+	// Announce new tips to the other nodes
+	sub := n.bc.events.Subscribe(nil)
+	go func() {
+		for {
+			select {
+			case e, ok := <-sub.Events:
+				if !ok {
+					return
+				}
+				switch e.Type {
+				case EventBlockConnected:
+					n.announceTip()
+					n.updateMempool(e.BlockHash, false)
+				case EventBlockDisconnected:
+					n.updateMempool(e.BlockHash, true)
+				}
+			case <-n.quit:
+				n.bc.events.Unsubscribe(sub)
+				return
+			}
+		}
+	}()
+
+	go n.timeoutLoop()
+	go n.connectLoop()
+	go n.saveAddrsLoop()
+	if n.MiningAddress != "" {
+		go n.mineLoop()
+	}
+
+	return nil
+}
+
+// 停止节点并断开所有连接
+// Stop the node and close every connection
+func (n *Node) Stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped() {
+		return
+	}
+	close(n.quit)
+	if n.listener != nil {
+		n.listener.Close()
+	}
+	for p := range n.peers {
+		p.close()
+	}
+	if err := n.saveAddrs(); err != nil {
+		n.logf("Saving the peer addresses: %v", err)
+	}
+}
+
+// 节点是否已停止，停止后区块链数据库会被关闭
+// Whether the node has stopped, the blockchain database is closed after that
+func (n *Node) stopped() bool {
+	select {
+	case <-n.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (n *Node) acceptLoop() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			if n.stopped() {
+				return
+			}
+			n.logf("accept: %v", err)
+			continue
+		}
+		if n.banlist.IsBanned(addrIP(conn.RemoteAddr().String())) {
+			conn.Close()
+			continue
+		}
+		n.addPeer(conn, conn.RemoteAddr().String(), true)
+	}
+}
+
+// 连接到另一个节点，断开后按退避间隔重新连接
+// Connect to another node and reconnect with backoff after it disconnects
+func (n *Node) AddPersistentPeer(addr string) error {
+	if err := validateNodeAddress(addr); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.persistent[addr] = &KnownAddress{Addr: addr, Source: "manual"}
+	n.addrman.Add(addr, "manual", time.Now())
+
+	return nil
+}
+
+// 种子节点：没有其他可用地址时连接它们，从它们那里得到更多地址
+// Seed nodes: they are connected to when no other address is available, to learn more addresses from them
+func (n *Node) AddSeeds(seeds []string) error {
+	for _, seed := range seeds {
+		if err := validateNodeAddress(seed); err != nil {
+			return err
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.seeds = append(n.seeds, seeds...)
+	n.addSeeds()
+
+	return nil
+}
+
+func (n *Node) addSeeds() {
+	for _, seed := range n.seeds {
+		n.addrman.Add(seed, "seed", time.Now())
+	}
+}
+
+func (n *Node) addPeer(conn net.Conn, addr string, inbound bool) {
+	p := &Peer{
+		conn:       conn,
+		addr:       addr,
+		inbound:    inbound,
+		connTime:   time.Now(),
+		out:        make(chan []byte, peerSendQueue),
+		quit:       make(chan struct{}),
+		knownAddrs: make(map[string]bool),
+		knownInv:   make(map[string]bool),
+		inFlight:   make(map[string]time.Time),
+		txInFlight: make(map[string]time.Time),
+		missing:    make(map[string]bool),
+	}
+
+	n.mu.Lock()
+	n.peers[p] = true
+	height := n.bc.GetBestHeight()
+	n.mu.Unlock()
+
+	go p.writeLoop()
+	go n.readLoop(p)
+
+	p.send(cmdVersion, versionMsg{protocolVersion, n.genesis, height, n.services, n.nonce, n.listenPort})
+}
+
+func (n *Node) readLoop(p *Peer) {
+	defer n.removePeer(p)
+
+	for {
+		command, payload, err := readMessage(p.conn)
+		if err != nil {
+			select {
+			case <-p.quit:
+			default:
+				if err != io.EOF {
+					n.logf("peer %s: %v", p, err)
+				}
+			}
+			return
+		}
+		atomic.AddUint64(&p.bytesRecv, uint64(commandLength+4+len(payload)))
+		atomic.StoreInt64(&p.lastRecv, time.Now().Unix())
+
+		n.mu.Lock()
+		if n.stopped() {
+			n.mu.Unlock()
+			return
+		}
+		err = n.handleMessage(p, command, payload)
+		var m *misbehavior
+		if errors.As(err, &m) {
+			n.misbehaving(p, m.score, fmt.Sprintf("%s: %v", command, m.err))
+			err = nil
+		}
+		n.mu.Unlock()
+		if err != nil {
+			n.logf("peer %s: %s: %v, disconnecting", p, command, err)
+			return
+		}
+	}
+}
+
+func (n *Node) removePeer(p *Peer) {
+	p.close()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.peers, p)
+	for key, peer := range n.requested {
+		if peer == p {
+			delete(n.requested, key)
+		}
+	}
+	for key, peer := range n.source {
+		if peer == p {
+			delete(n.source, key)
+		}
+	}
+	// 请求的交易可以在其他节点再次通知时请求
+	// The requested transactions can be requested again when another peer announces them
+	for key, peer := range n.txRequested {
+		if peer == p {
+			delete(n.txRequested, key)
+		}
+	}
+	n.requestBlocks()
+}
+
+// 处理一条消息，返回错误时断开连接。调用时持有n.mu
+// Handle a message, the connection is closed when an error is returned. Called with n.mu held
+func (n *Node) handleMessage(p *Peer, command string, payload []byte) error {
+	if !p.handshake && command != cmdVersion {
+		return fmt.Errorf("message before the handshake")
+	}
+
+	switch command {
+	case cmdVersion:
+		var msg versionMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		return n.handleVersion(p, &msg)
+
+	case cmdVerack:
+		return nil
+
+	case cmdGetHeaders:
+		var msg getHeadersMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		headers, err := n.bc.HeadersAfter(msg.Locator, msg.Stop, maxHeadersPerMessage)
+		if err != nil {
+			return err
+		}
+		p.send(cmdHeaders, headersMsg{headers})
+		return nil
+
+	case cmdHeaders:
+		var msg headersMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		return n.handleHeaders(p, msg.Headers)
+
+	case cmdGetData:
+		var msg getDataMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		return n.handleGetData(p, msg.Items)
+
+	case cmdBlock:
+		var msg blockMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		block, err := DeserializeBlock(msg.Block)
+		if err != nil {
+			return misbehaviorf(banScoreMalformed, "malformed block: %v", err)
+		}
+		return n.handleBlock(p, block)
+
+	case cmdFilterLoad:
+		var msg filterLoadMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		if len(msg.Addresses)+len(msg.Outpoints) > maxFilterItems {
+			return misbehaviorf(banScoreProtocol, "filter of %d items", len(msg.Addresses)+len(msg.Outpoints))
+		}
+		p.filter = newAddressFilter(msg.Addresses, msg.Outpoints)
+		return nil
+
+	case cmdGetCFilters:
+		var msg getCFiltersMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		filters, err := n.bc.GetCFilters(msg.StartHeight, msg.StopHash, maxCFiltersPerQuery)
+		if err != nil {
+			return err
+		}
+		for _, filter := range filters {
+			p.send(cmdCFilter, cfilterMsg{filter.BlockHash, filter.Filter})
+		}
+		return nil
+
+	case cmdGetAddr:
+		// 每个连接只回复一次，避免对方反复读取整个地址表
+		// Answered once per connection, so a peer cannot read the whole address table repeatedly
+		if p.sentAddr {
+			return nil
+		}
+		p.sentAddr = true
+		var addrs []netAddress
+		for _, ka := range n.addrman.Sample(maxAddrPerMessage) {
+			addrs = append(addrs, netAddress{ka.Addr, ka.LastSeen.Unix()})
+			p.knownAddrs[ka.Addr] = true
+		}
+		p.send(cmdAddr, addrMsg{addrs})
+		return nil
+
+	case cmdAddr:
+		var msg addrMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		return n.handleAddr(p, msg.Addresses)
+
+	case cmdInv:
+		var msg invMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		return n.handleInv(p, msg.Items)
+
+	case cmdTx:
+		var msg txMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		return n.handleTx(p, &msg.Tx)
+
+	case cmdMempool:
+		// 每个连接只回复一次
+		// Answered once per connection
+		if p.sentMempool {
+			return nil
+		}
+		p.sentMempool = true
+		var items []invVect
+		for _, tx := range n.mempool.Transactions() {
+			items = append(items, invVect{invTx, tx.ID})
+		}
+		n.sendInv(p, items)
+		return nil
+
+	case cmdNotFound:
+		var msg notFoundMsg
+		if err := decodePeerPayload(payload, &msg); err != nil {
+			return err
+		}
+		for _, item := range msg.Items {
+			key := string(item.Hash)
+			if item.Type == invTx {
+				if n.txRequested[key] == p {
+					delete(n.txRequested, key)
+				}
+				delete(p.txInFlight, key)
+				continue
+			}
+			p.missing[key] = true
+			if n.requested[key] == p {
+				delete(n.requested, key)
+				delete(p.inFlight, key)
+			}
+		}
+		n.requestBlocks()
+		return nil
+	}
+
+	// 忽略未知的命令，以便以后扩展协议
+	// Unknown commands are ignored so the protocol can be extended later
+	return nil
+}
+
+func (n *Node) handleVersion(p *Peer, msg *versionMsg) error {
+	if p.handshake {
+		return fmt.Errorf("duplicate version message")
+	}
+	if msg.Version != protocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", msg.Version)
+	}
+	if !bytes.Equal(msg.Genesis, n.genesis) {
+		return fmt.Errorf("peer is on another chain with genesis block %x", msg.Genesis)
+	}
+	if msg.Nonce == n.nonce {
+		// 地址是自己的，以后不再连接
+		// The address is our own, it is not connected to again
+		if !p.inbound {
+			n.addrman.Remove(p.addr)
+			delete(n.persistent, p.addr)
+		}
+		return fmt.Errorf("connected to ourselves")
+	}
+	p.handshake = true
+	p.services = msg.Services
+	p.startHeight = msg.BestHeight
+	p.bestHeight = msg.BestHeight
+	p.send(cmdVerack, nil)
+	n.logf("Connected to %s, best height %d", p, msg.BestHeight)
+
+	if !p.inbound {
+		// 出站连接成功，向对方请求更多地址
+		// The outbound connection works, ask the peer for more addresses
+		n.addrman.Good(p.addr)
+		if ka := n.persistent[p.addr]; ka != nil {
+			ka.Attempts = 0
+		}
+		p.send(cmdGetAddr, nil)
+	}
+	if p.inbound && msg.ListenPort > 0 {
+		// 入站节点也接受连接，记住它的地址并告诉其他节点
+		// The inbound peer accepts connections too, remember its address and tell other peers about it
+		host, _, err := net.SplitHostPort(p.addr)
+		if err != nil {
+			return err
+		}
+		p.listenAddr = net.JoinHostPort(host, strconv.Itoa(msg.ListenPort))
+		p.knownAddrs[p.listenAddr] = true
+		now := time.Now()
+		n.addrman.Add(p.listenAddr, p.addr, now)
+		n.relayAddrs(p, []netAddress{{p.listenAddr, now.Unix()}})
+	}
+
+	best, err := n.bc.BestHeader()
+	if err != nil {
+		return err
+	}
+	if msg.BestHeight > best.Height {
+		return n.requestHeaders(p, nil)
+	}
+	if len(n.queue) == 0 {
+		n.requestMempool(p)
+	}
+
+	// 之前收到的区块头可能还有区块没有下载
+	// Blocks of headers received earlier may still be missing
+	return n.updateDownloads()
+}
+
+// 向节点请求区块头，from为nil时从最佳区块头开始
+// Ask the peer for headers, starting from the best header when from is nil
+func (n *Node) requestHeaders(p *Peer, from []byte) error {
+	locator, err := n.bc.HeaderLocator(from)
+	if err != nil {
+		return err
+	}
+	p.send(cmdGetHeaders, getHeadersMsg{Locator: locator})
+
+	return nil
+}
+
+func (n *Node) handleHeaders(p *Peer, headers []BlockHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	if len(headers) > maxHeadersPerMessage {
+		return misbehaviorf(banScoreProtocol, "%d headers in one message", len(headers))
+	}
+
+	last, err := n.bc.AddHeaders(headers)
+	if errors.Is(err, errUnknownParent) {
+		// 通知的新区块接在我们还没有的区块之后，先请求缺少的区块头
+		// An announced block extends blocks we do not have yet, ask for the missing headers first
+		if p.unconnecting++; p.unconnecting > maxUnconnectingHeaders {
+			return misbehaviorf(banScoreProtocol, "too many headers that do not connect")
+		}
+		return n.requestHeaders(p, nil)
+	}
+	if errors.Is(err, errInvalidHeader) {
+		return misbehaviorf(banScoreInvalid, "%v", err)
+	}
+	if err != nil {
+		return err
+	}
+	p.unconnecting = 0
+	if last.Height > p.bestHeight {
+		p.bestHeight = last.Height
+	}
+
+	// 一条消息装满时对方还有更多区块头
+	// The peer has more headers when a message is full
+	if len(headers) == maxHeadersPerMessage {
+		if err := n.requestHeaders(p, last.Hash); err != nil {
+			return err
+		}
+	}
+
+	best, err := n.bc.BestHeader()
+	if err != nil {
+		return err
+	}
+	if len(headers) > 1 {
+		n.logf("Received %d headers from %s, best header at height %d", len(headers), p, best.Height)
+	}
+
+	return n.updateDownloads()
+}
+
+func (n *Node) handleGetData(p *Peer, items []invVect) error {
+	if len(items) > maxInvPerMessage {
+		return misbehaviorf(banScoreProtocol, "%d items in one getdata message", len(items))
+	}
+
+	var notFound []invVect
+	for _, item := range items {
+		if item.Type == invTx {
+			if tx := n.mempool.Get(item.Hash); tx != nil {
+				p.send(cmdTx, txMsg{*tx})
+			} else {
+				notFound = append(notFound, item)
+			}
+			continue
+		}
+		if item.Type != invBlock && item.Type != invFilteredBlock {
+			notFound = append(notFound, item)
+			continue
+		}
+		if item.Type == invFilteredBlock && p.filter == nil {
+			return misbehaviorf(banScoreProtocol, "filtered block requested without a filter")
+		}
+		// 修剪或从快照启动的节点没有较早的区块
+		// Pruned nodes and nodes started from a snapshot do not have the older blocks
+		block, err := n.bc.GetBlock(item.Hash)
+		if err != nil {
+			notFound = append(notFound, item)
+			continue
+		}
+		if item.Type == invFilteredBlock {
+			p.send(cmdMerkleBlock, p.filter.filterBlock(block))
+			continue
+		}
+		p.send(cmdBlock, blockMsg{block.Serialize()})
+	}
+	if len(notFound) > 0 {
+		p.send(cmdNotFound, notFoundMsg{notFound})
+	}
+
+	return nil
+}
+
+func (n *Node) handleBlock(p *Peer, block *Block) error {
+	// 先检查工作量证明，没有工作量的区块不值得进一步处理
+	// Check the proof of work first, blocks without work are not worth processing further
+	if !NewProofOfWork(block).Validate() {
+		return misbehaviorf(banScoreInvalid, "block %x has an invalid proof of work", block.BlockHash())
+	}
+
+	key := string(block.BlockHash())
+	if owner := n.requested[key]; owner != nil {
+		delete(n.requested, key)
+		delete(owner.inFlight, key)
+	} else {
+		// 没有请求过的区块，接在链末端之后时当作新区块的通知，父区块未知时放入孤块池。
+		// 接在其他已知区块之后的区块通过区块头通知处理
+		// A block that was not requested, taken as the announcement of a new block when it extends
+		// the tip and put in the orphan pool when its parent is unknown. Blocks extending other
+		// known blocks are handled through header announcements
+		if n.received[key] != nil || n.orphans.has(block.BlockHash()) {
+			return nil
+		}
+		if !bytes.Equal(block.PrevBlockHash, n.bc.tip) {
+			if n.bc.HasHeader(block.PrevBlockHash) {
+				return nil
+			}
+			return n.addOrphan(p, block)
+		}
+		if _, err := n.bc.AddHeaders([]BlockHeader{block.BlockHeader}); errors.Is(err, errInvalidHeader) {
+			return misbehaviorf(banScoreInvalid, "%v", err)
+		} else if err != nil {
+			return err
+		}
+		if err := n.updateDownloads(); err != nil {
+			return err
+		}
+	}
+
+	n.received[key] = block
+	n.source[key] = p
+	if n.adoptOrphans(block.BlockHash()) {
+		return n.updateDownloads()
+	}
+	n.connectBlocks()
+	n.requestBlocks()
+
+	return nil
+}
+
+// 把父区块未知的区块放入孤块池，向发送它的节点请求缺少的祖先：先请求区块头，
+// 收到后像同步一样下载区块，孤块本身不再下载
+// Put a block whose parent is unknown in the orphan pool and ask the peer that sent it for
+// the missing ancestors: the headers are requested first and the blocks are then downloaded
+// as when syncing, except the orphans themselves
+func (n *Node) addOrphan(p *Peer, block *Block) error {
+	// 孤块的父区块未知，无法完整验证，先检查区块头和工作量证明，避免孤块池被无效区块占满
+	// An orphan cannot be fully validated without its parent, check its header and proof of work
+	// first so the orphan pool cannot be filled with invalid blocks
+	if err := block.checkHeader(); err != nil {
+		return misbehaviorf(banScoreInvalid, "orphan %v", err)
+	}
+	if err := n.orphans.add(block, p, time.Now()); err != nil {
+		n.logf("Ignoring block from %s: %v", p, err)
+		return nil
+	}
+	n.logf("Orphan block %x from %s, %d in the orphan pool", block.BlockHash(), p, n.orphans.Len())
+
+	return n.requestHeaders(p, nil)
+}
+
+// 父区块到达后取出等待它的孤块，递归取出孤块的孤块，保存它们的区块头，交给下载队列连接。
+// 返回是否取出了孤块
+// Once a parent arrives take out the orphans waiting for it, recursively the orphans of those,
+// store their headers and hand them to the download queue to be connected. Returns whether any
+// orphan was taken out
+func (n *Node) adoptOrphans(parent []byte) bool {
+	adopted := false
+	for _, orphan := range n.orphans.removeChildren(parent) {
+		if _, err := n.bc.AddHeaders([]BlockHeader{orphan.block.BlockHeader}); err != nil {
+			if errors.Is(err, errInvalidHeader) {
+				n.misbehaving(orphan.from, banScoreInvalid, err.Error())
+			}
+			n.logf("Dropping orphan block %x: %v", orphan.block.BlockHash(), err)
+			continue
+		}
+		key := string(orphan.block.BlockHash())
+		n.received[key] = orphan.block
+		n.source[key] = orphan.from
+		n.adoptOrphans(orphan.block.BlockHash())
+		adopted = true
+	}
+
+	return adopted
+}
+
+// 根据最佳区块头重新计算需要连接的区块，然后连接已有的区块并请求缺少的区块
+// Recompute the blocks to connect from the best header, then connect the blocks at hand
+// and request the missing ones
+func (n *Node) updateDownloads() error {
+	missing, err := n.bc.MissingBlocks()
+	if err != nil {
+		return err
+	}
+	for i, header := range missing {
+		if n.invalid[string(header.Hash)] || n.invalid[string(header.PrevBlockHash)] {
+			missing = missing[:i]
+			break
+		}
+	}
+	n.queue = missing
+
+	// 孤块池中的区块的区块头已知后不需要再下载
+	// Blocks in the orphan pool need not be downloaded once their headers are known
+	for _, header := range missing {
+		if orphan := n.orphans.remove(header.Hash); orphan != nil {
+			n.received[string(header.Hash)] = orphan.block
+			n.source[string(header.Hash)] = orphan.from
+		}
+	}
+
+	n.connectBlocks()
+	n.requestBlocks()
+
+	return nil
+}
+
+// 把队列中的区块分配给有这些区块、并且请求数未满的节点，每次选择请求最少的节点
+// Assign the queued blocks to peers that have them and room for more requests,
+// picking the peer with the fewest requests each time
+func (n *Node) requestBlocks() {
+	batches := make(map[*Peer][]invVect)
+	window := n.queue
+	if len(window) > blockDownloadWindow {
+		window = window[:blockDownloadWindow]
+	}
+
+	for _, header := range window {
+		key := string(header.Hash)
+		if n.requested[key] != nil || n.received[key] != nil {
+			continue
+		}
+
+		var best *Peer
+		for p := range n.peers {
+			if !p.handshake || p.services&serviceNetwork == 0 || p.bestHeight < header.Height || p.missing[key] || len(p.inFlight) >= maxBlocksInFlightPerPeer {
+				continue
+			}
+			if best == nil || len(p.inFlight) < len(best.inFlight) {
+				best = p
+			}
+		}
+		if best == nil {
+			continue
+		}
+		n.requested[key] = best
+		best.inFlight[key] = time.Now()
+		batches[best] = append(batches[best], invVect{invBlock, header.Hash})
+	}
+
+	for p, items := range batches {
+		p.send(cmdGetData, getDataMsg{items})
+	}
+}
+
+// 已经收到的区块，区块可能已在数据库中，例如之前被移除的区块。还没有收到时返回nil
+// A received block, it may already be in the database, for example after it was disconnected.
+// Returns nil when it was not received yet
+func (n *Node) receivedBlock(header *ChainHeader) *Block {
+	if block := n.received[string(header.Hash)]; block != nil {
+		return block
+	}
+	block, err := n.bc.GetBlock(header.Hash)
+	if err != nil {
+		return nil
+	}
+
+	return block
+}
+
+// 按顺序连接队列开头已经收到的区块，最佳区块头链在分叉处时先重组到分叉链
+// Connect the received blocks at the start of the queue in order, reorganizing to the fork
+// first when the best header chain forks from the main chain
+func (n *Node) connectBlocks() {
+	for len(n.queue) > 0 {
+		header := n.queue[0]
+		if !bytes.Equal(n.bc.tip, header.PrevBlockHash) {
+			if !n.reorganize() {
+				return
+			}
+			continue
+		}
+
+		key := string(header.Hash)
+		block := n.receivedBlock(header)
+		if block == nil {
+			return
+		}
+
+		source := n.source[key]
+		delete(n.received, key)
+		delete(n.source, key)
+		if err := n.bc.AddBlock(block); err != nil {
+			n.rejectBlock(header, source, err)
+			return
+		}
+		n.queue = n.queue[1:]
+
+		if len(n.queue) == 0 || header.Height%100 == 0 {
+			n.logf("Connected block %x at height %d", header.Hash, header.Height)
+		}
+	}
+}
+
+// 队列开头的区块从主链较早的区块分出。收到的分叉区块的工作量超过要替换的主链区块后一起重组，
+// 失败时链末端保持不变。返回是否重组成功
+// The blocks at the start of the queue fork from an earlier main chain block. Once the received
+// fork blocks have more work than the main chain blocks they replace they are reorganized to
+// together, the tip stays unchanged on failure. Returns whether the reorganization succeeded
+func (n *Node) reorganize() bool {
+	fork := n.queue[0].PrevBlockHash
+	mainWork, err := n.bc.chainWorkAfter(fork)
+	if err != nil {
+		n.logf("Cannot reorganize to block %x: %v", n.queue[0].Hash, err)
+		return false
+	}
+
+	var branch []*Block
+	work := new(big.Int)
+	for _, header := range n.queue {
+		if work.Cmp(mainWork) > 0 {
+			break
+		}
+		block := n.receivedBlock(header)
+		if block == nil {
+			// 等待更多的分叉区块
+			// Wait for more fork blocks
+			return false
+		}
+		branch = append(branch, block)
+		work.Add(work, header.work())
+	}
+	if work.Cmp(mainWork) <= 0 {
+		return false
+	}
+
+	oldTip := n.bc.tip
+	invalid, err := n.bc.Reorganize(branch)
+	sources := make(map[string]*Peer)
+	for _, block := range branch {
+		key := string(block.Hash)
+		sources[key] = n.source[key]
+		delete(n.received, key)
+		delete(n.source, key)
+	}
+	if err != nil {
+		if invalid == nil {
+			n.logf("Cannot reorganize to block %x: %v", branch[len(branch)-1].Hash, err)
+			return false
+		}
+		for _, header := range n.queue {
+			if bytes.Equal(header.Hash, invalid.Hash) {
+				n.rejectBlock(header, sources[string(invalid.Hash)], err)
+				break
+			}
+		}
+		n.logf("Kept the tip %x after the failed reorganization", oldTip)
+		return false
+	}
+	n.queue = n.queue[len(branch):]
+	last := branch[len(branch)-1]
+	n.logf("Reorganized from %x to block %x at height %d", oldTip, last.Hash, last.Height)
+
+	return true
+}
+
+// 区块连接失败。违反共识规则时记住它，放弃以它为祖先的区块头，封禁发送它的节点。
+// 其他错误(例如数据库错误)不是区块的问题，只停止这次下载，之后重试
+// A block failed to connect. When it breaks a consensus rule remember it, give up on the headers
+// descending from it and ban the peer that sent it. Other errors, like database errors, are not
+// about the block, the download only stops and is retried later
+func (n *Node) rejectBlock(header *ChainHeader, source *Peer, err error) {
+	n.queue = nil
+	if !isConsensusError(err) {
+		n.logf("Cannot connect block %x at height %d: %v", header.Hash, header.Height, err)
+		return
+	}
+	n.logf("Invalid block %x at height %d: %v", header.Hash, header.Height, err)
+	n.invalid[string(header.Hash)] = true
+	if source != nil {
+		n.misbehaving(source, banScoreInvalid, err.Error())
+	}
+	if err := n.bc.resetBestHeader(); err != nil {
+		n.logf("Resetting the best header: %v", err)
+	}
+}
+
+// 已同步到最佳区块头时，把新的链末端通知给所有节点
+// Announce the new tip to every peer once synced to the best header
+func (n *Node) announceTip() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped() || len(n.queue) > 0 {
+		return
+	}
+	block, err := n.bc.GetBlock(n.bc.tip)
+	if err != nil {
+		return
+	}
+	for p := range n.peers {
+		if p.handshake {
+			p.send(cmdHeaders, headersMsg{[]BlockHeader{block.BlockHeader}})
+			n.requestMempool(p)
+		}
+	}
+}
+
+// 请求对方交易池中的交易，每个连接一次。同步完成前不请求，否则交易花费的输出可能还不在链上
+// Ask for the transactions in the mempool of the peer, once per connection. Not done before
+// the chain is synced, otherwise the outputs the transactions spend may not be on it yet
+func (n *Node) requestMempool(p *Peer) {
+	if p.askedMempool || p.services&serviceNetwork == 0 {
+		return
+	}
+	p.askedMempool = true
+	p.send(cmdMempool, nil)
+}
+
+// 超时的区块请求改从其他节点下载
+// Requests that timed out are sent to other peers
+func (n *Node) timeoutLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.quit:
+			return
+		}
+
+		n.mu.Lock()
+		now := time.Now()
+		for key, p := range n.requested {
+			if now.Sub(p.inFlight[key]) > blockRequestTimeout {
+				n.logf("Block %x from %s timed out", key, p)
+				delete(n.requested, key)
+				delete(p.inFlight, key)
+				p.missing[key] = true
+			}
+		}
+		for key, p := range n.txRequested {
+			if now.Sub(p.txInFlight[key]) > txRequestTimeout {
+				delete(n.txRequested, key)
+				delete(p.txInFlight, key)
+			}
+		}
+		for key, seen := range n.recentInv {
+			if now.Sub(seen) > recentInvExpiry {
+				delete(n.recentInv, key)
+			}
+		}
+		if expired := n.orphans.expire(now); expired > 0 {
+			n.logf("Removed %d expired orphan blocks", expired)
+		}
+		n.requestBlocks()
+		n.mu.Unlock()
+	}
+}
+
+// 处理收到的地址：记住有效的地址，把少量最近见到的地址转发给其他节点
+// Handle received addresses: remember the valid ones and relay a few recently seen ones to other peers
+func (n *Node) handleAddr(p *Peer, addrs []netAddress) error {
+	if len(addrs) > maxAddrPerMessage {
+		return misbehaviorf(banScoreProtocol, "%d addresses in one addr message", len(addrs))
+	}
+
+	now := time.Now()
+	var relay []netAddress
+	for _, a := range addrs {
+		if validateNodeAddress(a.Addr) != nil {
+			continue
+		}
+		if len(p.knownAddrs) < maxKnownAddresses {
+			p.knownAddrs[a.Addr] = true
+		}
+		// 不相信未来的时间
+		// Times in the future are not trusted
+		seen := time.Unix(a.LastSeen, 0)
+		if seen.After(now) {
+			seen = now
+		}
+		n.addrman.Add(a.Addr, p.addr, seen)
+		if len(addrs) <= maxAddrRelay && now.Sub(seen) < addrRelayMaxAge {
+			relay = append(relay, netAddress{a.Addr, seen.Unix()})
+		}
+	}
+	if len(relay) > 0 {
+		n.relayAddrs(p, relay)
+	}
+
+	return nil
+}
+
+// 把地址转发给几个随机选择的节点，跳过来源节点和已经知道这些地址的节点
+// Relay addresses to a few randomly chosen peers, skipping the source and peers that know them already
+func (n *Node) relayAddrs(from *Peer, addrs []netAddress) {
+	var peers []*Peer
+	for p := range n.peers {
+		if p != from && p.handshake {
+			peers = append(peers, p)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	if len(peers) > addrRelayPeers {
+		peers = peers[:addrRelayPeers]
+	}
+
+	for _, p := range peers {
+		var unknown []netAddress
+		for _, a := range addrs {
+			if !p.knownAddrs[a.Addr] {
+				unknown = append(unknown, a)
+				p.knownAddrs[a.Addr] = true
+			}
+		}
+		if len(unknown) > 0 {
+			p.send(cmdAddr, addrMsg{unknown})
+		}
+	}
+}
+
+// 定期补足出站连接
+// Fill up the outbound connections periodically
+func (n *Node) connectLoop() {
+	ticker := time.NewTicker(connectInterval)
+	defer ticker.Stop()
+
+	for {
+		n.connectPeers()
+		select {
+		case <-ticker.C:
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+// 重新连接断开的手动指定节点，再从地址管理器中选择地址，直到出站连接达到目标数
+// Reconnect the manually added nodes that disconnected, then pick addresses from the address
+// manager until the outbound connections reach the target
+func (n *Node) connectPeers() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped() {
+		return
+	}
+
+	connected := make(map[string]bool)
+	outbound := len(n.dialing)
+	for p := range n.peers {
+		connected[p.addr] = true
+		if p.listenAddr != "" {
+			connected[p.listenAddr] = true
+		}
+		if !p.inbound {
+			outbound++
+		}
+	}
+
+	now := time.Now()
+	for addr, ka := range n.persistent {
+		if !connected[addr] && !n.dialing[addr] && !now.Before(ka.nextAttempt()) && !n.banlist.IsBanned(addrIP(addr)) {
+			n.dial(addr)
+			outbound++
+		}
+	}
+
+	for outbound < n.MaxOutbound {
+		addr := n.addrman.Pick(func(addr string) bool {
+			return connected[addr] || n.dialing[addr] || n.persistent[addr] != nil || n.banlist.IsBanned(addrIP(addr))
+		})
+		if addr == "" {
+			break
+		}
+		n.dial(addr)
+		outbound++
+	}
+
+	// 没有任何连接时重新加入种子节点，它们可能因为失败太多次被丢弃了
+	// Add the seeds again without any connection, they may have been dropped after too many failures
+	if outbound == 0 && len(n.peers) == 0 {
+		n.addSeeds()
+	}
+}
+
+// 在后台连接地址。调用时持有n.mu
+// Dial an address in the background. Called with n.mu held
+func (n *Node) dial(addr string) {
+	n.dialing[addr] = true
+	n.addrman.Attempt(addr)
+	if ka := n.persistent[addr]; ka != nil {
+		ka.LastAttempt = time.Now()
+		ka.Attempts++
+	}
+
+	go func() {
+		conn, err := n.Dial(addr)
+
+		n.mu.Lock()
+		delete(n.dialing, addr)
+		stopped := n.stopped()
+		if err != nil && !stopped {
+			if ka := n.persistent[addr]; ka != nil {
+				n.logf("Cannot connect to %s: %v, retrying in %s", addr, err, retryDelay(ka.Attempts))
+			}
+		}
+		n.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+		if stopped {
+			conn.Close()
+			return
+		}
+		n.addPeer(conn, addr, false)
+	}()
+}
+
+// 定期保存地址，节点意外退出时不会丢失太多
+// Save the addresses periodically, so not much is lost when the node exits unexpectedly
+func (n *Node) saveAddrsLoop() {
+	ticker := time.NewTicker(addrSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.quit:
+			return
+		}
+
+		n.mu.Lock()
+		if !n.stopped() {
+			if err := n.saveAddrs(); err != nil {
+				n.logf("Saving the peer addresses: %v", err)
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+// 更新已连接节点的最后见到时间，然后保存地址。调用时持有n.mu
+// Update when the connected peers were last seen, then save the addresses. Called with n.mu held
+func (n *Node) saveAddrs() error {
+	now := time.Now()
+	for p := range n.peers {
+		if !p.handshake {
+			continue
+		}
+		if !p.inbound {
+			n.addrman.Add(p.addr, "", now)
+		} else if p.listenAddr != "" {
+			n.addrman.Add(p.listenAddr, "", now)
+		}
+	}
+
+	return n.addrman.save(n.bc.db)
+}
+
+// 已连接节点的状态
+// State of a connected peer
+type PeerInfo struct {
+	Addr           string `json:"addr"`
+	Inbound        bool   `json:"inbound"`
+	State          string `json:"state"`
+	Services       uint64 `json:"services"`
+	StartHeight    int    `json:"startHeight"`
+	BestHeight     int    `json:"bestHeight"`
+	BlocksInFlight int    `json:"blocksInFlight"`
+	BytesSent      uint64 `json:"bytesSent"`
+	BytesRecv      uint64 `json:"bytesRecv"`
+	ConnTime       int64  `json:"connTime"`
+	LastSend       int64  `json:"lastSend"`
+	LastRecv       int64  `json:"lastRecv"`
+}
+
+// 所有连接的状态，按连接时间排列
+// The state of every connection, in the order they were made
+func (n *Node) PeerInfo() []PeerInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	infos := make([]PeerInfo, 0, len(n.peers))
+	for p := range n.peers {
+		state := "active"
+		switch {
+		case !p.handshake:
+			state = "handshake"
+		case p.services&serviceNetwork == 0:
+			state = "light"
+		case len(p.inFlight) > 0:
+			state = "downloading"
+		}
+		infos = append(infos, PeerInfo{
+			Addr:           p.addr,
+			Inbound:        p.inbound,
+			State:          state,
+			Services:       p.services,
+			StartHeight:    p.startHeight,
+			BestHeight:     p.bestHeight,
+			BlocksInFlight: len(p.inFlight),
+			BytesSent:      atomic.LoadUint64(&p.bytesSent),
+			BytesRecv:      atomic.LoadUint64(&p.bytesRecv),
+			ConnTime:       p.connTime.Unix(),
+			LastSend:       atomic.LoadInt64(&p.lastSend),
+			LastRecv:       atomic.LoadInt64(&p.lastRecv),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnTime < infos[j].ConnTime })
+
+	return infos
+}
+
+// 解码节点发来的消息内容，无法解码是不当行为
+// Decode the payload of a message from a peer, failing to decode it is misbehavior
+func decodePeerPayload(payload []byte, v interface{}) error {
+	if err := decodePayload(payload, v); err != nil {
+		return misbehaviorf(banScoreMalformed, "malformed payload: %v", err)
+	}
+
+	return nil
+}
+
+// 增加节点的不当行为分数，达到banThreshold时封禁它的IP。调用时持有n.mu
+// Add to the misbehavior score of a peer, its IP is banned once the score reaches banThreshold.
+// Called with n.mu held
+func (n *Node) misbehaving(p *Peer, score int, reason string) {
+	p.banScore += score
+	n.logf("Peer %s misbehaving, score %d: %s", p, p.banScore, reason)
+	if p.banScore < banThreshold {
+		return
+	}
+
+	ip := addrIP(p.conn.RemoteAddr().String())
+	if ip == nil {
+		p.close()
+		return
+	}
+	if err := n.banlist.Ban(ipSubnet(ip), time.Now().Add(defaultBanDuration), reason); err != nil {
+		n.logf("Banning %s: %v", ip, err)
+	}
+	n.logf("Banned %s for %s", ip, defaultBanDuration)
+	n.disconnectBanned()
+}
+
+// 断开所有来自被封禁IP的连接。调用时持有n.mu
+// Close every connection from a banned IP. Called with n.mu held
+func (n *Node) disconnectBanned() {
+	for p := range n.peers {
+		if n.banlist.IsBanned(addrIP(p.conn.RemoteAddr().String())) {
+			p.close()
+		}
+	}
+}
+
+// 手动封禁子网并断开来自它的连接
+// Ban a subnet manually and close the connections from it
+func (n *Node) Ban(subnet *net.IPNet, duration time.Duration, reason string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.banlist.Ban(subnet, time.Now().Add(duration), reason); err != nil {
+		return err
+	}
+	n.disconnectBanned()
+
+	return nil
+}
+
+func (n *Node) Unban(subnet *net.IPNet) error {
+	return n.banlist.Unban(subnet)
+}
+
+func (n *Node) ClearBanned() error {
+	return n.banlist.Clear()
+}
+
+func (n *Node) Banned() []BanEntry {
+	return n.banlist.List()
+}
+
+// 处理清单：请求还没有见过的交易
+// Handle an inventory: request the transactions not seen yet
+func (n *Node) handleInv(p *Peer, items []invVect) error {
+	if len(items) > maxInvPerMessage {
+		return misbehaviorf(banScoreProtocol, "%d items in one inv message", len(items))
+	}
+
+	var request []invVect
+	for _, item := range items {
+		// 同步中忽略交易，同步完成后通过mempool消息获取
+		// Transactions are ignored while syncing, they are fetched with a mempool message afterwards
+		if item.Type != invTx || len(n.queue) > 0 {
+			continue
+		}
+		key := string(item.Hash)
+		n.addKnownInv(p, key)
+		if n.haveTx(key) {
+			continue
+		}
+		n.txRequested[key] = p
+		p.txInFlight[key] = time.Now()
+		request = append(request, item)
+	}
+	if len(request) > 0 {
+		p.send(cmdGetData, getDataMsg{request})
+	}
+
+	return nil
+}
+
+// 交易已在交易池中、最近见过或正在请求
+// The transaction is in the mempool, was seen recently or is being requested
+func (n *Node) haveTx(key string) bool {
+	if _, ok := n.recentInv[key]; ok {
+		return true
+	}
+	if _, ok := n.txRequested[key]; ok {
+		return true
+	}
+
+	return n.mempool.Get([]byte(key)) != nil
+}
+
+func (n *Node) addKnownInv(p *Peer, key string) {
+	// 已知清单太多时清空，最多导致重复通知
+	// Cleared when it grows too large, which at most leads to repeated announcements
+	if len(p.knownInv) >= maxKnownInventory {
+		p.knownInv = make(map[string]bool)
+	}
+	p.knownInv[key] = true
+}
+
+// 处理收到的交易：按交易池的规则验证，接受后通知其他节点。签名无效的交易是不当行为，
+// 其他原因的拒绝不是，例如交易已被打包或与池中的交易冲突
+// Handle a received transaction: it is validated with the mempool rules and announced to
+// the other peers once accepted. A transaction with an invalid signature is misbehavior,
+// other rejections are not, like when it was mined already or conflicts with the pool
+func (n *Node) handleTx(p *Peer, tx *Transaction) error {
+	if !bytes.Equal(tx.Hash(), tx.ID) {
+		return misbehaviorf(banScoreMalformed, "transaction %x does not match its ID", tx.ID)
+	}
+	if tx.IsCoinbase() {
+		return misbehaviorf(banScoreInvalid, "coinbase transaction %x relayed outside a block", tx.ID)
+	}
+	if err := tx.checkSanity(); err != nil {
+		return misbehaviorf(banScoreInvalid, "%v", err)
+	}
+
+	key := string(tx.ID)
+	if owner := n.txRequested[key]; owner != nil {
+		delete(n.txRequested, key)
+		delete(owner.txInFlight, key)
+	}
+	n.addKnownInv(p, key)
+	if _, ok := n.recentInv[key]; ok || n.mempool.Get(tx.ID) != nil {
+		return nil
+	}
+	n.recentInv[key] = time.Now()
+
+	if err := n.mempool.Add(tx); err != nil {
+		if errors.Is(err, ErrScriptFailed) || errors.Is(err, errEqualVerifyFailed) || errors.Is(err, errVerifyFailed) {
+			return misbehaviorf(banScoreInvalid, "transaction %x: %v", tx.ID, err)
+		}
+		n.logf("Rejected transaction %x from %s: %v", tx.ID, p, err)
+		return nil
+	}
+	n.logf("Accepted transaction %x from %s, %d in the mempool", tx.ID, p, n.mempool.Count())
+	n.relayTx(tx, p)
+
+	return nil
+}
+
+// 把交易通知给除from之外还不知道它的节点
+// Announce a transaction to the peers other than from that do not know it
+func (n *Node) relayTx(tx *Transaction, from *Peer) {
+	key := string(tx.ID)
+	for p := range n.peers {
+		if p == from || !p.handshake || p.services&serviceNetwork == 0 || p.knownInv[key] {
+			continue
+		}
+		n.addKnownInv(p, key)
+		p.send(cmdInv, invMsg{[]invVect{{invTx, tx.ID}}})
+	}
+}
+
+// 分批发送清单并记住对方已知
+// Send an inventory in batches and remember that the peer knows it
+func (n *Node) sendInv(p *Peer, items []invVect) {
+	for len(items) > 0 {
+		batch := items
+		if len(batch) > maxInvPerMessage {
+			batch = batch[:maxInvPerMessage]
+		}
+		items = items[len(batch):]
+		for _, item := range batch {
+			n.addKnownInv(p, string(item.Hash))
+		}
+		p.send(cmdInv, invMsg{batch})
+	}
+}
+
+// 区块连接后移除交易池中已被打包或失效的交易；区块被移除后把它的交易放回交易池
+// After a block is connected the mined and invalidated transactions leave the mempool;
+// after a block is disconnected its transactions go back into the mempool
+func (n *Node) updateMempool(blockHash string, disconnected bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped() {
+		return
+	}
+	hash, err := hex.DecodeString(blockHash)
+	if err != nil {
+		return
+	}
+	block, err := n.bc.GetBlock(hash)
+	if err != nil {
+		return
+	}
+
+	if disconnected {
+		for _, tx := range block.Transactions {
+			if !tx.IsCoinbase() {
+				n.mempool.Add(tx)
+			}
+		}
+		return
+	}
+	n.mempool.RemoveBlock(block)
+	if removed := n.mempool.Revalidate(); removed > 0 {
+		n.logf("Removed %d invalidated transactions from the mempool", removed)
+	}
+}
+
+// 把本地创建的交易加入交易池并通知所有节点
+// Add a locally created transaction to the mempool and announce it to every peer
+func (n *Node) SubmitTransaction(tx *Transaction) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.submitTransaction(tx)
+}
+
+func (n *Node) submitTransaction(tx *Transaction) error {
+	if err := n.mempool.Add(tx); err != nil {
+		return err
+	}
+	n.recentInv[string(tx.ID)] = time.Now()
+	n.logf("Accepted transaction %x, %d in the mempool", tx.ID, n.mempool.Count())
+	n.relayTx(tx, nil)
+
+	return nil
+}
+
+// 用钱包中from的密钥创建交易并提交，不使用交易池中的交易已花费的输出
+// Create a transaction with the key of from in the wallet and submit it, without spending
+// the outputs already spent by mempool transactions
+func (n *Node) Send(from string, recipients []Recipient, opts TxOptions) (*Transaction, error) {
+	wallets, err := NewWallets()
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.SendFrom(wallet, recipients, opts)
+}
+
+// 用给定钱包的密钥创建交易并提交
+// Create a transaction with the key of the given wallet and submit it
+func (n *Node) SendFrom(wallet *Wallet, recipients []Recipient, opts TxOptions) (*Transaction, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// 交易池中的交易已经花费的输出不能再使用
+	// The outputs already spent by mempool transactions cannot be used again
+	opts.Exclude = append(append([]Outpoint{}, opts.Exclude...), n.mempool.SpentOutpoints()...)
+	tx, err := newUnsignedTransaction(wallet.GetAddress(), recipients, opts, n.bc)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.bc.SignTransaction(tx, wallet); err != nil {
+		return nil, err
+	}
+	if err := n.submitTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// 交易池中的所有交易
+// Every transaction in the mempool
+func (n *Node) MempoolTransactions() []*Transaction {
+	return n.mempool.Transactions()
+}
+
+// 同步完成后把交易池中的交易挖进新区块，奖励发给MiningAddress
+// Once synced, mine the transactions of the mempool into new blocks with the reward going to MiningAddress
+func (n *Node) mineLoop() {
+	ticker := time.NewTicker(minerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.quit:
+			return
+		}
+		if err := n.mineBlock(); err != nil {
+			n.logf("Mining: %v", err)
+		}
+	}
+}
+
+func (n *Node) mineBlock() error {
+	n.mu.Lock()
+	idle := n.mempool.Count() == 0
+	n.mu.Unlock()
+	if idle {
+		return nil
+	}
+
+	_, err := n.GenerateBlock(n.MiningAddress, false)
+	return err
+}
+
+// 把交易池中的交易挖进一个新区块，奖励发给address，empty为true时交易池为空也挖矿。
+// 工作量证明在不持有n.mu时计算，期间链末端改变时放弃这个区块。同步中、节点停止、
+// 链末端改变或没有交易可挖时返回nil区块
+// Mine the transactions of the mempool into a new block with the reward going to address,
+// with empty set a block is mined even when the mempool is empty. The proof of work is computed
+// without holding n.mu, the block is dropped when the tip changed in the meantime. Returns
+// a nil block while syncing, after the node stopped, when the tip changed or with nothing to mine
+func (n *Node) GenerateBlock(address string, empty bool) (*Block, error) {
+	n.mu.Lock()
+	if n.stopped() || len(n.queue) > 0 {
+		n.mu.Unlock()
+		return nil, nil
+	}
+	tip, err := n.bc.GetBlock(n.bc.tip)
+	if err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	n.mempool.Revalidate()
+	txs := append([]*Transaction{NewCoinbaseTransaction(address, "")}, n.mempool.Transactions()...)
+	n.mu.Unlock()
+	if len(txs) == 1 && !empty {
+		return nil, nil
+	}
+
+	block := newBlockTemplate(txs, tip.Hash, tip.Height+1)
+	nonce, hash, ok := NewProofOfWork(block).solve(n.quit)
+	if !ok {
+		return nil, nil
+	}
+	block.Nonce = nonce
+	block.Hash = hash
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped() || !bytes.Equal(n.bc.tip, tip.Hash) {
+		return nil, nil
+	}
+	if err := n.bc.AddBlock(block); err != nil {
+		return nil, err
+	}
+	n.logf("Mined block %x at height %d with %d transactions", block.Hash, block.Height, len(txs)-1)
+
+	return block, nil
+}
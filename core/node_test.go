@@ -0,0 +1,117 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func newTestNode(t *testing.T) (*Node, *BlockChain, *Wallet) {
+	t.Helper()
+
+	bc, wallet := newTestChain(t, testChainParams())
+	n, err := NewNode(bc, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n, bc, wallet
+}
+
+// 区块头无效的孤块不进入孤块池，发送它的节点被记为不当行为
+// An orphan with an invalid header stays out of the orphan pool and its sender is marked misbehaving
+func TestInvalidOrphanIsRejected(t *testing.T) {
+	n, _, wallet := newTestNode(t)
+	address := wallet.GetAddress()
+	unknownParent := &Block{Hash: sha256Bytes([]byte("unknown parent")), Height: 5}
+
+	tests := []struct {
+		name   string
+		tamper func(b *Block)
+	}{
+		// 工作量证明仍然有效，但Merkle树根与交易不符
+		// The proof of work still holds but the Merkle root does not match the transactions
+		{"merkle root", func(b *Block) {
+			b.Transactions = append(b.Transactions, NewCoinbaseTransaction(address, "extra"))
+		}},
+		{"hash", func(b *Block) {
+			b.Hash = sha256Bytes(b.Hash)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := newTestBlock(unknownParent, address)
+			test.tamper(block)
+
+			err := n.handleBlock(&Peer{}, block)
+			var m *misbehavior
+			if !errors.As(err, &m) || m.score != banScoreInvalid {
+				t.Fatalf("expected misbehavior with score %d, got %v", banScoreInvalid, err)
+			}
+			if n.orphans.Len() != 0 {
+				t.Fatalf("%d blocks in the orphan pool, expected none", n.orphans.Len())
+			}
+		})
+	}
+}
+
+func TestAddBlockErrorsAreTyped(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	address := wallet.GetAddress()
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 挖矿奖励超过区块奖励，违反共识规则
+	// The coinbase claims more than the subsidy, breaking a consensus rule
+	coinbase := NewCoinbaseTransaction(address, "")
+	coinbase.Vout[0].Value = subsidy + 1
+	coinbase.ID = coinbase.Hash()
+	invalid := solveTestBlock([]*Transaction{coinbase}, tip.Hash, tip.Height+1)
+	if err := bc.AddBlock(invalid); !isConsensusError(err) {
+		t.Fatalf("expected a consensus error, got %v", err)
+	}
+
+	// 不接在链末端之后的区块不是区块本身的问题
+	// A block that does not extend the tip is not a problem of the block itself
+	stale := newTestBlock(tip, address)
+	mineTestBlock(t, bc, address)
+	if err := bc.AddBlock(stale); err == nil || isConsensusError(err) {
+		t.Fatalf("expected an error that is not a consensus error, got %v", err)
+	}
+}
+
+func TestRejectBlockBansOnlyForConsensusErrors(t *testing.T) {
+	n, bc, _ := newTestNode(t)
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		banned bool
+	}{
+		{"database error", errors.New("database not open"), false},
+		{"consensus error", consensusErrorf("block %x: no transactions", tip.Hash), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, other := net.Pipe()
+			defer other.Close()
+			p := &Peer{conn: conn, quit: make(chan struct{})}
+			header := &ChainHeader{tip.BlockHeader, sha256Bytes([]byte(test.name)), tip.Height + 1}
+
+			n.rejectBlock(header, p, test.err)
+			if banned := p.banScore >= banThreshold; banned != test.banned {
+				t.Fatalf("peer banned %v with score %d, expected %v", banned, p.banScore, test.banned)
+			}
+			if n.invalid[string(header.Hash)] != test.banned {
+				t.Fatalf("block marked invalid %v, expected %v", n.invalid[string(header.Hash)], test.banned)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package core
+
+// 脚本操作码，取值与比特币脚本保持一致
+// Script opcodes, the values follow the Bitcoin script encoding
+const (
+	Op0         byte = 0x00 // 压入空字节数组 push an empty byte array
+	OpFalse     byte = 0x00
+	OpData1     byte = 0x01 // 0x01-0x4b: 压入接下来的N个字节 push the next N bytes
+	OpData75    byte = 0x4b
+	OpPushData1 byte = 0x4c // 下一个字节表示数据长度 the next byte is the data length
+	OpPushData2 byte = 0x4d // 下两个字节(小端)表示数据长度 the next two bytes (little endian) are the data length
+	Op1Negate   byte = 0x4f
+	Op1         byte = 0x51 // 0x51-0x60: 压入数字1-16 push the number 1-16
+	OpTrue      byte = 0x51
+	Op16        byte = 0x60
+
+	// 流程控制 flow control
+	OpNop    byte = 0x61
+	OpIf     byte = 0x63
+	OpNotIf  byte = 0x64
+	OpElse   byte = 0x67
+	OpEndIf  byte = 0x68
+	OpVerify byte = 0x69
+	OpReturn byte = 0x6a
+
+	// 栈操作 stack operations
+	OpDrop byte = 0x75
+	OpDup  byte = 0x76
+	OpOver byte = 0x78
+	OpSwap byte = 0x7c
+
+	// 比较 comparison
+	OpEqual       byte = 0x87
+	OpEqualVerify byte = 0x88
+
+	// 算术 arithmetic
+	Op1Add               byte = 0x8b
+	Op1Sub               byte = 0x8c
+	OpNegate             byte = 0x8f
+	OpAbs                byte = 0x90
+	OpNot                byte = 0x91
+	OpAdd                byte = 0x93
+	OpSub                byte = 0x94
+	OpBoolAnd            byte = 0x9a
+	OpBoolOr             byte = 0x9b
+	OpNumEqual           byte = 0x9c
+	OpNumEqualVerify     byte = 0x9d
+	OpLessThan           byte = 0x9f
+	OpGreaterThan        byte = 0xa0
+	OpLessThanOrEqual    byte = 0xa1
+	OpGreaterThanOrEqual byte = 0xa2
+	OpMin                byte = 0xa3
+	OpMax                byte = 0xa4
+	OpWithin             byte = 0xa5
+
+	// 密码学 crypto
+	OpSHA256              byte = 0xa8
+	OpHash160             byte = 0xa9
+	OpHash256             byte = 0xaa
+	OpCheckSig            byte = 0xac
+	OpCheckSigVerify      byte = 0xad
+	OpCheckMultiSig       byte = 0xae
+	OpCheckMultiSigVerify byte = 0xaf
+
+	// 锁定时间 lock time
+	OpCheckLockTimeVerify byte = 0xb1
+	OpCheckSequenceVerify byte = 0xb2
+)
+
+// 操作码名称，用于反汇编脚本
+// Opcode names, used when disassembling scripts
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	Op1Negate:             "OP_1NEGATE",
+	OpNop:                 "OP_NOP",
+	OpIf:                  "OP_IF",
+	OpNotIf:               "OP_NOTIF",
+	OpElse:                "OP_ELSE",
+	OpEndIf:               "OP_ENDIF",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpOver:                "OP_OVER",
+	OpSwap:                "OP_SWAP",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	Op1Add:                "OP_1ADD",
+	Op1Sub:                "OP_1SUB",
+	OpNegate:              "OP_NEGATE",
+	OpAbs:                 "OP_ABS",
+	OpNot:                 "OP_NOT",
+	OpAdd:                 "OP_ADD",
+	OpSub:                 "OP_SUB",
+	OpBoolAnd:             "OP_BOOLAND",
+	OpBoolOr:              "OP_BOOLOR",
+	OpNumEqual:            "OP_NUMEQUAL",
+	OpNumEqualVerify:      "OP_NUMEQUALVERIFY",
+	OpLessThan:            "OP_LESSTHAN",
+	OpGreaterThan:         "OP_GREATERTHAN",
+	OpLessThanOrEqual:     "OP_LESSTHANOREQUAL",
+	OpGreaterThanOrEqual:  "OP_GREATERTHANOREQUAL",
+	OpMin:                 "OP_MIN",
+	OpMax:                 "OP_MAX",
+	OpWithin:              "OP_WITHIN",
+	OpSHA256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpHash256:             "OP_HASH256",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
+// 判断操作码是否为数据压栈操作(不计入操作数限制)
+// Check whether the opcode pushes data (pushes do not count towards the op limit)
+func isPushOpcode(op byte) bool {
+	return op <= Op16 && op != 0x50
+}
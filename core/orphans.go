@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// 孤块池的参数
+// Parameters of the orphan pool
+const (
+	maxOrphanBlocks = 100              // 最多保存的孤块数 max orphan blocks kept
+	maxOrphanBytes  = 64 << 20         // 所有孤块的总大小上限 upper bound of the total size of the orphan blocks
+	orphanExpiry    = 20 * time.Minute // 孤块保存的时长 how long orphan blocks are kept
+)
+
+// 孤块和收到它的节点
+// An orphan block and the peer it came from
+type orphanBlock struct {
+	block   *Block
+	from    *Peer
+	size    int
+	expires time.Time
+}
+
+// 孤块池：父区块未知的区块，按区块哈希和父区块哈希索引。父区块到达后孤块被取出连接。
+// 由Node.mu保护
+// Orphan pool: blocks whose parent is unknown, indexed by block hash and parent hash. Orphans
+// are taken out and connected once their parent arrives. Guarded by Node.mu
+type orphanPool struct {
+	blocks   map[string]*orphanBlock
+	byParent map[string][]*orphanBlock
+	size     int
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks:   make(map[string]*orphanBlock),
+		byParent: make(map[string][]*orphanBlock),
+	}
+}
+
+func (op *orphanPool) has(hash []byte) bool {
+	return op.blocks[string(hash)] != nil
+}
+
+func (op *orphanPool) Len() int {
+	return len(op.blocks)
+}
+
+// 加入孤块，池已满时先移除最早到期的孤块
+// Add an orphan block, removing the orphans that expire first when the pool is full
+func (op *orphanPool) add(block *Block, from *Peer, now time.Time) error {
+	size := len(block.Serialize())
+	if size > maxOrphanBytes {
+		return fmt.Errorf("orphan block %x of %d bytes is too large", block.BlockHash(), size)
+	}
+	for len(op.blocks) >= maxOrphanBlocks || op.size+size > maxOrphanBytes {
+		var oldest *orphanBlock
+		for _, orphan := range op.blocks {
+			if oldest == nil || orphan.expires.Before(oldest.expires) {
+				oldest = orphan
+			}
+		}
+		op.remove(oldest.block.BlockHash())
+	}
+
+	orphan := &orphanBlock{block, from, size, now.Add(orphanExpiry)}
+	parent := string(block.PrevBlockHash)
+	op.blocks[string(block.BlockHash())] = orphan
+	op.byParent[parent] = append(op.byParent[parent], orphan)
+	op.size += size
+
+	return nil
+}
+
+// 移除孤块，不在池中时返回nil
+// Remove an orphan block, returns nil when it is not in the pool
+func (op *orphanPool) remove(hash []byte) *orphanBlock {
+	key := string(hash)
+	orphan := op.blocks[key]
+	if orphan == nil {
+		return nil
+	}
+	delete(op.blocks, key)
+	op.size -= orphan.size
+
+	parent := string(orphan.block.PrevBlockHash)
+	siblings := op.byParent[parent]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(op.byParent, parent)
+	} else {
+		op.byParent[parent] = siblings
+	}
+
+	return orphan
+}
+
+// 取出父区块为parent的所有孤块
+// Take out every orphan block whose parent is parent
+func (op *orphanPool) removeChildren(parent []byte) []*orphanBlock {
+	children := append([]*orphanBlock{}, op.byParent[string(parent)]...)
+	for _, child := range children {
+		op.remove(child.block.BlockHash())
+	}
+
+	return children
+}
+
+// 移除已到期的孤块，返回移除的数量
+// Remove the expired orphan blocks, returns how many were removed
+func (op *orphanPool) expire(now time.Time) int {
+	var expired [][]byte
+	for _, orphan := range op.blocks {
+		if now.After(orphan.expires) {
+			expired = append(expired, orphan.block.BlockHash())
+		}
+	}
+	for _, hash := range expired {
+		op.remove(hash)
+	}
+
+	return len(expired)
+}
@@ -18,6 +18,14 @@ type ProofOfWork struct {
 }
 
 func NewProofOfWork(b *Block) *ProofOfWork {
+	pow := &ProofOfWork{b, powTarget(b.Bits)}
+
+	return pow
+}
+
+// 难度值对应的目标
+// The target of the difficulty bits
+func powTarget(bits int) *big.Int {
 	// 我们将 big.Int 初始化为 1，然后左移 256 - targetBits 位。
 	// 256 是一个 SHA-256 哈希的位数，我们将要使用的是 SHA-256 哈希算法
 	// target（目标） 的 16 进制形式为：
@@ -28,25 +36,34 @@ func NewProofOfWork(b *Block) *ProofOfWork {
 	   0x10000000000000000000000000000000000000000000000000000000000
 	*/
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
-
-	pow := &ProofOfWork{b, target}
+	target.Lsh(target, uint(256-bits))
 
-	return pow
+	return target
 }
 
 // 准备数据进行哈希运算 nonce: Hashcash计数器
 // Preparing data for hashing nonce: Hashcash counter
 func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join([][]byte{
-		pow.block.PrevBlockHash,
-		pow.block.HashTransaction(),
-		IntToHex(pow.block.Timestamp),
-		IntToHex(int64(targetBits)),
+	return powData(&pow.block.BlockHeader, nonce)
+}
+
+// 参与哈希运算的数据只依赖区块头，所以只有区块头时也能验证工作量证明。
+// 版本1的区块头不包含版本，保持旧区块的哈希值不变
+// The hashed data only depends on the header, so the proof of work can be checked from the
+// header alone. Version 1 headers leave out the version, keeping the hashes of old blocks
+func powData(h *BlockHeader, nonce int) []byte {
+	fields := [][]byte{
+		h.PrevBlockHash,
+		h.MerkleRoot,
+		IntToHex(h.Timestamp),
+		IntToHex(int64(h.Bits)),
 		IntToHex(int64(nonce)),
-	}, []byte{})
+	}
+	if h.Version != legacyBlockVersion {
+		fields = append([][]byte{IntToHex(int64(h.Version))}, fields...)
+	}
 
-	return data
+	return bytes.Join(fields, []byte{})
 }
 
 // 运行工作量证明得出新的区块哈希值以及Nonce
@@ -75,6 +92,28 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	return nonce, hash[:]
 }
 
+// 不打印进度地运行工作量证明，stop关闭时放弃并返回false
+// Run the proof of work without printing progress, giving up and returning false once stop is closed
+func (pow *ProofOfWork) solve(stop <-chan struct{}) (int, []byte, bool) {
+	var hashInt big.Int
+	for nonce := 0; nonce < maxNonce; nonce++ {
+		if nonce%(1<<16) == 0 {
+			select {
+			case <-stop:
+				return 0, nil, false
+			default:
+			}
+		}
+		hash := sha256.Sum256(pow.prepareData(nonce))
+		hashInt.SetBytes(hash[:])
+		if hashInt.Cmp(pow.target) == -1 {
+			return nonce, hash[:], true
+		}
+	}
+
+	return 0, nil, false
+}
+
 // 工作量生成的区块哈希值验证是否是有效的
 // Verify whether the block hash value generated by the workload is valid
 func (pow *ProofOfWork) Validate() bool {
@@ -86,3 +125,39 @@ func (pow *ProofOfWork) Validate() bool {
 
 	return isValid
 }
+
+// 区块头的哈希值，即区块的哈希值
+// Hash of the header, which is the hash of the block
+func (h *BlockHeader) BlockHash() []byte {
+	hash := sha256.Sum256(powData(h, h.Nonce))
+
+	return hash[:]
+}
+
+// 区块头代表的工作量：找到满足目标的哈希值平均需要的尝试次数
+// The work a header represents: the expected number of tries to find a hash meeting its target
+func (h *BlockHeader) work() *big.Int {
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, new(big.Int).Add(powTarget(h.Bits), big.NewInt(1)))
+}
+
+// 只根据区块头验证：版本和难度值有效，并且哈希值满足工作量证明
+// Validate from the header alone: the version and the difficulty are valid and the hash
+// satisfies the proof of work
+func (h *BlockHeader) validate() error {
+	if h.Version != legacyBlockVersion && h.Version != blockVersion {
+		return fmt.Errorf("unknown block version %d", h.Version)
+	}
+	if h.Bits != targetBits {
+		return fmt.Errorf("difficulty %d differs from %d", h.Bits, targetBits)
+	}
+
+	var hashInt big.Int
+	hashInt.SetBytes(h.BlockHash())
+	if hashInt.Cmp(powTarget(h.Bits)) != -1 {
+		return fmt.Errorf("invalid proof of work")
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// 节点协议：节点之间通过TCP长连接交换消息，每条消息为
+// 命令(12字节，不足补0) | 长度(4字节大端) | gob编码的消息内容
+// Node protocol: nodes exchange messages over long lived TCP connections, every message is
+// command(12 bytes, zero padded) | length(4 bytes big endian) | gob encoded payload
+const (
+	protocolVersion = 1
+	commandLength   = 12
+
+	// 消息的最大长度，最大的消息是区块
+	// Max size of a message, the largest message is a block
+	maxMessageSize = maxChainFileBlockSize + 1<<10
+
+	maxHeadersPerMessage = 2000 // 一条headers消息中的最大区块头数 max headers in a headers message
+	maxInvPerMessage     = 1000 // 一条inv、getdata或notfound消息中的最大条目数 max items in an inv, getdata or notfound message
+	maxFilterItems       = 5000 // 过滤器中的最大地址和输出数 max addresses and outputs in a filter
+	maxCFiltersPerQuery  = 1000 // 一条getcfilters消息请求的最大过滤器数 max filters asked for by a getcfilters message
+)
+
+// 消息命令
+// Message commands
+const (
+	cmdVersion     = "version"     // 握手，交换版本、创世区块和高度 handshake, exchanges the version, genesis block and height
+	cmdVerack      = "verack"      // 确认握手 acknowledges the handshake
+	cmdGetHeaders  = "getheaders"  // 请求定位符之后的区块头 asks for the headers after a locator
+	cmdHeaders     = "headers"     // 区块头，也用来通知新区块 headers, also used to announce new blocks
+	cmdGetData     = "getdata"     // 按哈希请求数据 asks for data by hash
+	cmdBlock       = "block"       // 完整区块 a full block
+	cmdNotFound    = "notfound"    // 请求的数据不存在 the requested data does not exist
+	cmdFilterLoad  = "filterload"  // 轻节点设置要匹配的地址 a light client sets the addresses to match
+	cmdMerkleBlock = "merkleblock" // 区块头、匹配的交易和它们的Merkle分支 a header, the matching transactions and their Merkle branches
+	cmdGetCFilters = "getcfilters" // 请求一段区块的紧凑过滤器 asks for the compact filters of a range of blocks
+	cmdCFilter     = "cfilter"     // 一个区块的紧凑过滤器 the compact filter of a block
+	cmdGetAddr     = "getaddr"     // 请求已知的节点地址 asks for known node addresses
+	cmdAddr        = "addr"        // 节点地址 node addresses
+	cmdInv         = "inv"         // 通知有新的数据 announces new data
+	cmdTx          = "tx"          // 一笔交易 a transaction
+	cmdMempool     = "mempool"     // 请求交易池中所有交易的清单 asks for the inventory of the whole mempool
+)
+
+// 清单条目的类型
+// Types of inventory items
+const (
+	invBlock         = "block"
+	invTx            = "tx"
+	invFilteredBlock = "filteredblock" // 按连接的过滤器过滤的区块，回复merkleblock a block filtered with the filter of the connection, answered with merkleblock
+)
+
+// 节点提供的服务
+// Services offered by a node
+const (
+	serviceNetwork        = 1 << iota // 保存并提供完整区块，轻节点没有 stores and serves full blocks, light clients do not
+	serviceCompactFilters             // 提供紧凑区块过滤器 serves compact block filters
+)
+
+type versionMsg struct {
+	Version    int
+	Genesis    []byte
+	BestHeight int
+	Services   uint64
+	Nonce      uint64 // 每个节点随机生成，用来发现连接到了自己 random per node, detects connections to ourselves
+	ListenPort int    // 接受连接的端口，0表示不接受连接 the port accepting connections, 0 when not listening
+}
+
+// 节点地址和最后一次见到它在线的时间(Unix时间)
+// A node address and the last time it was seen online (Unix time)
+type netAddress struct {
+	Addr     string
+	LastSeen int64
+}
+
+type addrMsg struct {
+	Addresses []netAddress
+}
+
+type getHeadersMsg struct {
+	Locator [][]byte
+	Stop    []byte // 为空时返回尽可能多的区块头 as many headers as possible when empty
+}
+
+type headersMsg struct {
+	Headers []BlockHeader
+}
+
+// 清单条目：数据的类型和哈希
+// Inventory item: the type and the hash of some data
+type invVect struct {
+	Type string
+	Hash []byte
+}
+
+type invMsg struct {
+	Items []invVect
+}
+
+type getDataMsg struct {
+	Items []invVect
+}
+
+type notFoundMsg struct {
+	Items []invVect
+}
+
+type blockMsg struct {
+	Block []byte // 序列化的区块 serialized block
+}
+
+type txMsg struct {
+	Tx Transaction
+}
+
+// 轻节点的过滤器：支付到这些地址或花费这些输出的交易匹配
+// Filter of a light client: transactions paying to these addresses or spending these outputs match
+type filterLoadMsg struct {
+	Addresses []string
+	Outpoints []Outpoint
+}
+
+// 匹配的交易和它包含在区块中的证明
+// A matching transaction and the proof that the block includes it
+type txProof struct {
+	Tx    Transaction
+	Index int
+	Proof [][]byte
+}
+
+// 请求从高度StartHeight到区块StopHash的过滤器
+// Asks for the filters from height StartHeight up to block StopHash
+type getCFiltersMsg struct {
+	StartHeight int
+	StopHash    []byte
+}
+
+type cfilterMsg struct {
+	BlockHash []byte
+	Filter    []byte
+}
+
+type merkleBlockMsg struct {
+	Header  BlockHeader
+	TxCount int
+	Matches []txProof
+}
+
+// 把消息编码为 命令 | 长度 | 内容，payload为nil时内容为空
+// Encode a message as command | length | payload, the payload is empty when it is nil
+func encodeMessage(command string, payload interface{}) ([]byte, error) {
+	if len(command) > commandLength {
+		return nil, fmt.Errorf("command %s is too long", command)
+	}
+
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = gobEncode(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := make([]byte, commandLength+4, commandLength+4+len(data))
+	copy(msg, command)
+	binary.BigEndian.PutUint32(msg[commandLength:], uint32(len(data)))
+
+	return append(msg, data...), nil
+}
+
+// 读取下一条消息，返回命令和未解码的内容
+// Read the next message, returns the command and the undecoded payload
+func readMessage(r io.Reader) (string, []byte, error) {
+	header := make([]byte, commandLength+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", nil, err
+	}
+	command := string(bytes.TrimRight(header[:commandLength], "\x00"))
+	size := binary.BigEndian.Uint32(header[commandLength:])
+	if size > maxMessageSize {
+		return "", nil, fmt.Errorf("%s message of %d bytes is too large", command, size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+
+	return command, payload, nil
+}
+
+func decodePayload(payload []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(v)
+}
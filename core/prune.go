@@ -0,0 +1,216 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 修剪模式下至少保留的完整区块数，这样较浅的链重组仍然可以移除区块
+// Minimum number of full blocks kept in pruned mode, so shallow reorgs can still disconnect blocks
+const minPruneBlocks = 6
+
+// 元数据中修剪设置和修剪高度的键
+// Keys of the prune settings and the prune height in the metadata
+const (
+	pruneBlocksKey = "pruneblocks"
+	pruneSizeKey   = "prunesize"
+	pruneHeightKey = "pruneheight" // 保留完整区块的最低高度 lowest height whose full block is kept
+)
+
+// 需要的区块已被修剪，用于错误信息"... has been pruned"
+// The needed block has been pruned, used in error messages "... has been pruned"
+var errBlockPruned = errors.New("pruned")
+
+// 修剪设置：只保留最近Blocks个区块，或者完整区块总共不超过SizeMB，两者都设置时取保留较少的一个。
+// 更早的区块只保留区块头，它们的输出保存在未花费输出集合中
+// Prune settings: only the last Blocks blocks are kept, or as many full blocks as fit in
+// SizeMB, whichever keeps fewer when both are set. Older blocks only keep their headers,
+// their outputs live on in the UTXO set
+type PruneConfig struct {
+	Blocks int
+	SizeMB int
+}
+
+func (cfg PruneConfig) Enabled() bool {
+	return cfg.Blocks > 0 || cfg.SizeMB > 0
+}
+
+func (cfg PruneConfig) String() string {
+	switch {
+	case cfg.Blocks > 0 && cfg.SizeMB > 0:
+		return fmt.Sprintf("keep the last %d blocks, at most %d MB", cfg.Blocks, cfg.SizeMB)
+	case cfg.Blocks > 0:
+		return fmt.Sprintf("keep the last %d blocks", cfg.Blocks)
+	case cfg.SizeMB > 0:
+		return fmt.Sprintf("keep at most %d MB of blocks", cfg.SizeMB)
+	}
+
+	return "off"
+}
+
+func readPruneConfig(tx *bolt.Tx) PruneConfig {
+	return PruneConfig{metaInt(tx, pruneBlocksKey), metaInt(tx, pruneSizeKey)}
+}
+
+// 当前的修剪设置
+// The current prune settings
+func (bc *BlockChain) GetPruneConfig() PruneConfig {
+	var cfg PruneConfig
+	bc.db.View(func(tx *bolt.Tx) error {
+		cfg = readPruneConfig(tx)
+
+		return nil
+	})
+
+	return cfg
+}
+
+// 保留完整区块的最低高度，没有修剪过时为0
+// Lowest height whose full block is kept, 0 when nothing has been pruned
+func (bc *BlockChain) PruneHeight() int {
+	height := 0
+	bc.db.View(func(tx *bolt.Tx) error {
+		height = metaInt(tx, pruneHeightKey)
+
+		return nil
+	})
+
+	return height
+}
+
+// 需要整条链的操作在修剪后返回错误
+// Operations needing the whole chain fail once blocks have been pruned
+func (bc *BlockChain) requireFullChain(operation string) error {
+	if height := bc.PruneHeight(); height > 0 {
+		return fmt.Errorf("%s needs every block, but the blocks below height %d have been %w", operation, height, errBlockPruned)
+	}
+
+	return nil
+}
+
+// 修改修剪设置并立即按新设置修剪。修剪需要未花费输出集合，没有时先建立
+// Change the prune settings and prune right away. Pruning needs the UTXO set,
+// it is built first when missing
+func (bc *BlockChain) SetPruneConfig(cfg PruneConfig) error {
+	if cfg.Blocks < 0 || cfg.SizeMB < 0 {
+		return fmt.Errorf("prune settings cannot be negative")
+	}
+	if cfg.Blocks > 0 && cfg.Blocks < minPruneBlocks {
+		return fmt.Errorf("at least %d blocks must be kept", minPruneBlocks)
+	}
+
+	var blocks []*Block
+	if cfg.Enabled() && !bc.indexEnabled(utxoIndexer{}) {
+		if err := bc.requireFullChain("building the UTXO set"); err != nil {
+			return err
+		}
+		blocks = bc.chainBlocks()
+	}
+
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		if blocks != nil {
+			if err := rebuildIndex(tx, utxoIndexer{}, blocks); err != nil {
+				return err
+			}
+		}
+		if err := putMetaInt(tx, pruneBlocksKey, cfg.Blocks); err != nil {
+			return err
+		}
+		if err := putMetaInt(tx, pruneSizeKey, cfg.SizeMB); err != nil {
+			return err
+		}
+
+		return pruneBlocks(tx)
+	})
+}
+
+func readBlockHeader(headers *bolt.Bucket, hash []byte) (*ChainHeader, error) {
+	data := headers.Get(hash)
+	if data == nil {
+		return nil, fmt.Errorf("header of block %x is missing", hash)
+	}
+
+	return decodeBlockHeader(data)
+}
+
+// 在事务中按修剪设置删除超出保留范围的完整区块和它们的撤销数据，区块头保留。
+// 数据库文件不会变小，但释放的空间会被新区块重复使用
+// Delete the full blocks outside the kept range, and their undo data, within the transaction
+// according to the prune settings. Headers are kept. The database file does not shrink,
+// but the freed space is reused by new blocks
+func pruneBlocks(tx *bolt.Tx) error {
+	cfg := readPruneConfig(tx)
+	if !cfg.Enabled() {
+		return nil
+	}
+	if tx.Bucket([]byte(utxoSetBucket)) == nil {
+		return fmt.Errorf("pruning needs the UTXO set")
+	}
+	blocks := tx.Bucket([]byte(blocksBucket))
+	headers := tx.Bucket([]byte(headersBucket))
+
+	tip, err := readBlockHeader(headers, chainTip(tx))
+	if err != nil {
+		return err
+	}
+
+	// 找出需要保留完整区块的最低高度
+	// Find the lowest height whose full block must be kept
+	keepFrom := 0
+	if cfg.Blocks > 0 {
+		keepFrom = tip.Height - cfg.Blocks + 1
+	}
+	if cfg.SizeMB > 0 {
+		budget, size := cfg.SizeMB<<20, 0
+		for header := tip; ; {
+			data := blocks.Get(header.Hash)
+			if data == nil {
+				break
+			}
+			if size += len(data); size > budget {
+				if header.Height+1 > keepFrom {
+					keepFrom = header.Height + 1
+				}
+				break
+			}
+			if header.Height == 0 {
+				break
+			}
+			if header, err = readBlockHeader(headers, header.PrevBlockHash); err != nil {
+				return err
+			}
+		}
+	}
+	if limit := tip.Height - minPruneBlocks + 1; keepFrom > limit {
+		keepFrom = limit
+	}
+
+	pruned := metaInt(tx, pruneHeightKey)
+	if keepFrom <= pruned {
+		return nil
+	}
+
+	undo := tx.Bucket([]byte(utxoSetBucket)).Bucket([]byte(undoSubBucket))
+	for header := tip; header.Height >= pruned; {
+		if header.Height < keepFrom {
+			if err := blocks.Delete(header.Hash); err != nil {
+				return err
+			}
+			if undo != nil {
+				if err := undo.Delete(header.Hash); err != nil {
+					return err
+				}
+			}
+		}
+		if header.Height == 0 {
+			break
+		}
+		if header, err = readBlockHeader(headers, header.PrevBlockHash); err != nil {
+			return err
+		}
+	}
+
+	return putMetaInt(tx, pruneHeightKey, keepFrom)
+}
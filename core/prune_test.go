@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 挖出10个区块后只保留最后6个，返回每个高度的区块
+// Mine 10 blocks and only keep the last 6, returns the block of every height
+func newPrunedTestChain(t *testing.T) (*BlockChain, *Wallet, []*Block) {
+	t.Helper()
+
+	bc, wallet := newTestChain(t, testChainParams())
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*Block{genesis}
+	for i := 0; i < 10; i++ {
+		blocks = append(blocks, mineTestBlock(t, bc, wallet.GetAddress()))
+	}
+	if err := bc.SetPruneConfig(PruneConfig{Blocks: minPruneBlocks}); err != nil {
+		t.Fatal(err)
+	}
+
+	return bc, wallet, blocks
+}
+
+func TestPruneDeletesOldBlocks(t *testing.T) {
+	bc, wallet, blocks := newPrunedTestChain(t)
+
+	keepFrom := len(blocks) - minPruneBlocks
+	if height := bc.PruneHeight(); height != keepFrom {
+		t.Fatalf("prune height %d, expected %d", height, keepFrom)
+	}
+	for _, block := range blocks {
+		_, err := bc.GetBlock(block.Hash)
+		if block.Height < keepFrom && !errors.Is(err, errBlockPruned) {
+			t.Fatalf("block at height %d: got %v, expected it pruned", block.Height, err)
+		}
+		if block.Height >= keepFrom && err != nil {
+			t.Fatalf("block at height %d: %v", block.Height, err)
+		}
+	}
+	if _, err := bc.GetBlockByHeight(1); !errors.Is(err, errBlockPruned) {
+		t.Fatalf("block at height 1: got %v, expected it pruned", err)
+	}
+	if _, err := bc.findTransactionBlock(blocks[1].Transactions[0].ID); !errors.Is(err, errBlockPruned) {
+		t.Fatalf("transaction in a pruned block: got %v, expected it pruned", err)
+	}
+
+	// 被修剪区块的输出仍然在未花费输出集合中
+	// The outputs of the pruned blocks are still in the UTXO set
+	if balance := bc.GetBalance(wallet.GetAddress()).Total; balance != len(blocks)*subsidy {
+		t.Fatalf("balance %d after pruning, expected %d", balance, len(blocks)*subsidy)
+	}
+
+	// 新区块连接后继续修剪
+	// Pruning continues as new blocks are connected
+	mineTestBlock(t, bc, wallet.GetAddress())
+	if height := bc.PruneHeight(); height != keepFrom+1 {
+		t.Fatalf("prune height %d after a new block, expected %d", height, keepFrom+1)
+	}
+}
+
+func TestPruneConfigValidation(t *testing.T) {
+	bc, _ := newTestChain(t, testChainParams())
+
+	for _, cfg := range []PruneConfig{{Blocks: -1}, {SizeMB: -1}, {Blocks: minPruneBlocks - 1}} {
+		if err := bc.SetPruneConfig(cfg); err == nil {
+			t.Errorf("prune config %+v was accepted", cfg)
+		}
+	}
+	if bc.GetPruneConfig().Enabled() {
+		t.Fatal("an invalid prune config was stored")
+	}
+}
+
+// 需要整条链的操作在修剪后被拒绝
+// Operations needing the whole chain are refused after pruning
+func TestPrunedNodeRefusesHistory(t *testing.T) {
+	bc, wallet, _ := newPrunedTestChain(t)
+
+	if _, err := bc.GetTransactionHistory(wallet.GetAddress()); !errors.Is(err, errBlockPruned) {
+		t.Fatalf("history on a pruned node: got %v, expected it refused", err)
+	}
+	if err := bc.Reindex(addrIndexer{}.Name()); err == nil {
+		t.Fatal("the address index was built on a pruned node")
+	}
+}
+
+// REST接口对修剪掉的区块和交易返回410，对不存在的返回404
+// The REST API answers 410 for pruned blocks and transactions and 404 for unknown ones
+func TestRESTPrunedBlocksAreGone(t *testing.T) {
+	bc, _, blocks := newPrunedTestChain(t)
+	rest := httptest.NewServer(NewRESTServer(bc).Handler())
+	t.Cleanup(rest.Close)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/blocks/" + hex.EncodeToString(blocks[1].Hash), http.StatusGone},
+		{"/blocks/height/1", http.StatusGone},
+		{"/tx/" + hex.EncodeToString(blocks[1].Transactions[0].ID), http.StatusGone},
+		{"/blocks/" + hex.EncodeToString(blocks[len(blocks)-1].Hash), http.StatusOK},
+		{"/tx/" + hex.EncodeToString(blocks[len(blocks)-1].Transactions[0].ID), http.StatusOK},
+		{"/blocks/" + hex.EncodeToString(sha256Bytes([]byte("unknown"))), http.StatusNotFound},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(rest.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s: status %d, expected %d", test.path, resp.StatusCode, test.status)
+		}
+	}
+}
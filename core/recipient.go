@@ -0,0 +1,142 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 转账的收款方
+// Recipient of a payment
+type Recipient struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// 所有收款方的总金额
+// Total amount paid to the recipients
+func totalAmount(recipients []Recipient) int {
+	total := 0
+	for _, r := range recipients {
+		total += r.Amount
+	}
+
+	return total
+}
+
+// 检查收款方的地址和金额是否有效
+// Check that the addresses and amounts of the recipients are valid
+func ValidateRecipients(recipients []Recipient) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	seen := make(map[string]bool)
+	total := 0
+	for _, r := range recipients {
+		if !ValidateAddress(r.Address) {
+			return fmt.Errorf("address '%s' is not valid", r.Address)
+		}
+		if r.Amount <= 0 {
+			return fmt.Errorf("amount for '%s' must be positive, got %d", r.Address, r.Amount)
+		}
+		// 同一地址出现多次多半是列表写错了，要求合并成一行
+		// An address listed twice is most likely a mistake in the list, it has to be merged into one entry
+		if seen[r.Address] {
+			return fmt.Errorf("address '%s' is listed more than once", r.Address)
+		}
+		seen[r.Address] = true
+		if total+r.Amount < total {
+			return fmt.Errorf("the total amount overflows")
+		}
+		total += r.Amount
+	}
+
+	return nil
+}
+
+// 解析"address:amount,address:amount"格式的收款方列表
+// Parse a recipient list in the "address:amount,address:amount" format
+func ParseRecipients(s string) ([]Recipient, error) {
+	var recipients []Recipient
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid recipient '%s', expected address:amount", pair)
+		}
+		recipient, err := newRecipient(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+func newRecipient(address, amount string) (Recipient, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(amount))
+	if err != nil {
+		return Recipient{}, fmt.Errorf("invalid amount '%s' for '%s'", amount, address)
+	}
+
+	return Recipient{strings.TrimSpace(address), value}, nil
+}
+
+// 从文件加载收款方列表：.json文件为[{"address": ..., "amount": ...}]数组，
+// 其他文件按CSV解析，每行为address,amount，可以有表头
+// Load a recipient list from a file: .json files hold a [{"address": ..., "amount": ...}] array,
+// anything else is read as CSV with address,amount rows and an optional header
+func LoadRecipientsFile(file string) ([]Recipient, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		var recipients []Recipient
+		if err := json.NewDecoder(f).Decode(&recipients); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		return recipients, nil
+	}
+
+	return readRecipientsCSV(f)
+}
+
+func readRecipientsCSV(r io.Reader) ([]Recipient, error) {
+	var recipients []Recipient
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+		recipient, err := newRecipient(record[0], record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
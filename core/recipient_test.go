@@ -0,0 +1,127 @@
+package core
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRecipients(t *testing.T) {
+	a := NewWallet().GetAddress()
+	b := NewWallet().GetAddress()
+
+	tests := []struct {
+		name       string
+		recipients []Recipient
+		err        string
+	}{
+		{"valid", []Recipient{{a, 1}, {b, 2}}, ""},
+		{"no recipients", nil, "no recipients"},
+		{"zero amount", []Recipient{{a, 0}}, "must be positive"},
+		{"negative amount", []Recipient{{a, 1}, {b, -5}}, "must be positive"},
+		{"invalid address", []Recipient{{"1nvalid", 1}}, "is not valid"},
+		{"empty address", []Recipient{{"", 1}}, "is not valid"},
+		{"duplicate address", []Recipient{{a, 1}, {b, 2}, {a, 3}}, "listed more than once"},
+		// 溢出后的总额可能变为负数或很小的值，从而绕过余额检查
+		// An overflowed total could become negative or small and get past the balance check
+		{"overflow", []Recipient{{a, math.MaxInt64}, {b, 2}}, "overflows"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateRecipients(test.recipients)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got %v, expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseRecipients(t *testing.T) {
+	a := NewWallet().GetAddress()
+	b := NewWallet().GetAddress()
+
+	recipients, err := ParseRecipients(" " + a + ":5 , " + b + ": 7,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 2 || recipients[0] != (Recipient{a, 5}) || recipients[1] != (Recipient{b, 7}) {
+		t.Fatalf("parsed %v", recipients)
+	}
+
+	for _, s := range []string{a, a + ":", a + ":five", a + ":1:2", a + ":1.5"} {
+		if _, err := ParseRecipients(s); err == nil {
+			t.Errorf("%q was parsed", s)
+		}
+	}
+	if recipients, err := ParseRecipients(""); err != nil || ValidateRecipients(recipients) == nil {
+		t.Fatalf("an empty list parsed to %v: %v", recipients, err)
+	}
+}
+
+func TestLoadRecipientsFile(t *testing.T) {
+	a := NewWallet().GetAddress()
+	b := NewWallet().GetAddress()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		expected []Recipient
+		err      string
+	}{
+		{"csv", write("pay.csv", a+",5\n"+b+",7\n"), []Recipient{{a, 5}, {b, 7}}, ""},
+		{"csv with header", write("header.csv", "address,amount\n"+a+", 5\n"), []Recipient{{a, 5}}, ""},
+		{"json", write("pay.json", `[{"address":"`+a+`","amount":5},{"address":"`+b+`","amount":7}]`), []Recipient{{a, 5}, {b, 7}}, ""},
+		{"empty csv", write("empty.csv", ""), nil, ""},
+		{"empty json array", write("empty.json", "[]"), nil, ""},
+		{"empty json file", write("blank.json", ""), nil, "EOF"},
+		{"csv with a missing field", write("short.csv", a+",5\n"+b+"\n"), nil, "wrong number of fields"},
+		{"csv with an invalid amount", write("amount.csv", a+",five\n"), nil, "line 1: invalid amount"},
+		{"invalid json", write("invalid.json", `{"address":"`+a+`"}`), nil, "invalid.json"},
+		{"missing file", filepath.Join(dir, "missing.csv"), nil, "no such file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recipients, err := LoadRecipientsFile(test.file)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, expected %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recipients) != len(test.expected) {
+				t.Fatalf("loaded %v, expected %v", recipients, test.expected)
+			}
+			for i := range recipients {
+				if recipients[i] != test.expected[i] {
+					t.Fatalf("loaded %v, expected %v", recipients, test.expected)
+				}
+			}
+		})
+	}
+
+	// 空文件能加载，但不能用来转账
+	// An empty file loads but cannot be used to send
+	recipients, err := LoadRecipientsFile(filepath.Join(dir, "empty.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateRecipients(recipients); err == nil {
+		t.Fatal("an empty recipient file was accepted")
+	}
+}
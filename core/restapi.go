@@ -0,0 +1,660 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分页参数的默认值和上限
+// Default and max page size
+const (
+	restDefaultLimit = 50
+	restMaxLimit     = 500
+)
+
+// 提交交易请求体的最大长度
+// Max size of a submitted transaction request body
+const restMaxBodySize = 1 << 20
+
+// REST接口：以JSON格式提供区块、交易和地址数据，并接收已签名的交易。
+// POST请求需要cookie文件中的口令
+// REST API: serves blocks, transactions and addresses as JSON and accepts signed transactions.
+// POST requests need the secret of the cookie file
+type RESTServer struct {
+	bc      *BlockChain
+	mempool *Mempool
+	mu      sync.RWMutex // 挖矿与读请求互斥 mining is exclusive with reads
+	cookie  *authCookie
+
+	validator *SnapshotValidator // 在后台验证快照，可以为nil validates the snapshot in the background, may be nil
+}
+
+func NewRESTServer(bc *BlockChain) *RESTServer {
+	return &RESTServer{bc: bc, mempool: NewMempool(bc)}
+}
+
+// REST接口的所有路径
+// All paths of the REST API
+func (s *RESTServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocks/", s.requireValidChain(s.handleBlocks))
+	mux.HandleFunc("/tx", s.cookie.require(s.requireValidChain(s.handleSubmitTransaction)))
+	mux.HandleFunc("/mempool", s.requireValidChain(s.handleMempool))
+	mux.HandleFunc("/mine", s.cookie.require(s.requireValidChain(s.handleMine)))
+	mux.HandleFunc("/tx/", s.requireValidChain(s.handleTransaction))
+	mux.HandleFunc("/address/", s.requireValidChain(s.handleAddress))
+	mux.HandleFunc("/events", s.requireValidChain(s.handleEvents))
+	mux.HandleFunc("/snapshot", s.handleSnapshot)
+	mux.HandleFunc("/cfilter/", s.requireValidChain(s.handleCFilter))
+
+	return mux
+}
+
+// 在给定地址上启动REST接口并写入cookie文件，返回的监听器关闭后停止并删除cookie文件
+// Start the REST API on the given address and write the cookie file, it stops and removes
+// the cookie file when the returned listener is closed
+func (s *RESTServer) Listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if s.cookie, err = newAuthCookie(cookieFileName(port)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	listener = &cookieListener{listener, s.cookie}
+	go http.Serve(listener, s.Handler())
+
+	return listener, nil
+}
+
+// 区块的JSON格式，交易ID列表分页返回
+// JSON form of a block, the list of transaction IDs is paginated
+type BlockJSON struct {
+	Hash          string   `json:"hash"`
+	Version       int      `json:"version"`
+	PrevBlockHash string   `json:"prevBlockHash"`
+	MerkleRoot    string   `json:"merkleRoot"`
+	Height        int      `json:"height"`
+	Time          int64    `json:"time"`
+	Bits          int      `json:"bits"`
+	Nonce         int      `json:"nonce"`
+	TxCount       int      `json:"txCount"`
+	Transactions  []string `json:"tx"`
+	Offset        int      `json:"offset"`
+	Limit         int      `json:"limit"`
+}
+
+// 交易输入的JSON格式
+// JSON form of a transaction input
+type TXInputJSON struct {
+	Txid      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	ScriptSig string `json:"scriptSig"`
+	Sequence  uint32 `json:"sequence"`
+}
+
+// 交易输出的JSON格式
+// JSON form of a transaction output
+type TXOutputJSON struct {
+	Value        int    `json:"value"`
+	ScriptPubKey string `json:"scriptPubKey"`
+	Address      string `json:"address,omitempty"`
+	SpentBy      string `json:"spentBy,omitempty"`
+}
+
+// 交易的JSON格式，提交交易时只需要ID、输入、输出和锁定时间
+// JSON form of a transaction, only the ID, inputs, outputs and lock time are needed to submit one
+type TransactionJSON struct {
+	ID            string         `json:"txid"`
+	Vin           []TXInputJSON  `json:"vin"`
+	Vout          []TXOutputJSON `json:"vout"`
+	LockTime      uint32         `json:"lockTime"`
+	BlockHash     string         `json:"blockHash,omitempty"`
+	Height        int            `json:"height,omitempty"`
+	Confirmations int            `json:"confirmations,omitempty"`
+}
+
+// 未花费输出的JSON格式
+// JSON form of an unspent output
+type UTXOJSON struct {
+	Txid         string `json:"txid"`
+	Vout         int    `json:"vout"`
+	Value        int    `json:"value"`
+	ScriptPubKey string `json:"scriptPubKey"`
+	Height       int    `json:"height"`
+	Coinbase     bool   `json:"coinbase"`
+	Spendable    bool   `json:"spendable"`
+}
+
+// 交易转换为JSON格式
+// Convert a transaction into its JSON form
+func NewTransactionJSON(tx *Transaction) TransactionJSON {
+	j := TransactionJSON{ID: hex.EncodeToString(tx.ID), LockTime: tx.LockTime}
+	for _, in := range tx.Vin {
+		j.Vin = append(j.Vin, TXInputJSON{hex.EncodeToString(in.Txid), in.Vout, hex.EncodeToString(in.ScriptSig), in.Sequence})
+	}
+	for _, out := range tx.Vout {
+		address, _ := ExtractAddress(out.ScriptPubKey)
+		j.Vout = append(j.Vout, TXOutputJSON{Value: out.Value, ScriptPubKey: hex.EncodeToString(out.ScriptPubKey), Address: address})
+	}
+
+	return j
+}
+
+// 把JSON格式转换回交易，并检查交易ID与内容一致
+// Convert the JSON form back into a transaction and check that the ID matches its content
+func (j TransactionJSON) Transaction() (*Transaction, error) {
+	var err error
+	tx := &Transaction{LockTime: j.LockTime}
+
+	if tx.ID, err = hex.DecodeString(j.ID); err != nil {
+		return nil, fmt.Errorf("invalid txid: %v", err)
+	}
+	for i, in := range j.Vin {
+		input := TXInput{Vout: in.Vout, Sequence: in.Sequence}
+		if input.Txid, err = hex.DecodeString(in.Txid); err != nil {
+			return nil, fmt.Errorf("input %d: invalid txid: %v", i, err)
+		}
+		if input.ScriptSig, err = hex.DecodeString(in.ScriptSig); err != nil {
+			return nil, fmt.Errorf("input %d: invalid scriptSig: %v", i, err)
+		}
+		tx.Vin = append(tx.Vin, input)
+	}
+	for i, out := range j.Vout {
+		output := TXOutput{Value: out.Value}
+		if output.ScriptPubKey, err = hex.DecodeString(out.ScriptPubKey); err != nil {
+			return nil, fmt.Errorf("output %d: invalid scriptPubKey: %v", i, err)
+		}
+		tx.Vout = append(tx.Vout, output)
+	}
+
+	if hash := tx.Hash(); !bytes.Equal(hash, tx.ID) {
+		return nil, fmt.Errorf("txid %x does not match the transaction, expected %x", tx.ID, hash)
+	}
+
+	return tx, nil
+}
+
+// 带HTTP状态码的错误
+// An error carrying an HTTP status code
+type restError struct {
+	status int
+	err    error
+}
+
+func (e *restError) Error() string {
+	return e.err.Error()
+}
+
+func restErrorf(status int, format string, args ...interface{}) *restError {
+	return &restError{status, fmt.Errorf(format, args...)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeRESTError(w http.ResponseWriter, err *restError) {
+	writeJSON(w, err.status, map[string]string{"error": err.Error()})
+}
+
+// 解析分页参数offset和limit
+// Parse the offset and limit pagination parameters
+func parsePage(r *http.Request) (int, int, *restError) {
+	offset, limit := 0, restDefaultLimit
+	var err error
+
+	if s := r.URL.Query().Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, restErrorf(http.StatusBadRequest, "invalid offset '%s'", s)
+		}
+	}
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > restMaxLimit {
+			return 0, 0, restErrorf(http.StatusBadRequest, "invalid limit '%s', it must be between 1 and %d", s, restMaxLimit)
+		}
+	}
+
+	return offset, limit, nil
+}
+
+// 分页后的[start, end)范围
+// The [start, end) range of the page
+func pageBounds(total, offset, limit int) (int, int) {
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return offset, end
+}
+
+func requireGet(r *http.Request) *restError {
+	if r.Method != http.MethodGet {
+		return restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+
+	return nil
+}
+
+// 查找失败：数据已被修剪时为410，否则为404
+// A failed lookup: 410 when the data has been pruned, 404 otherwise
+func lookupError(err error) *restError {
+	if errors.Is(err, errBlockPruned) {
+		return &restError{http.StatusGone, err}
+	}
+
+	return &restError{http.StatusNotFound, err}
+}
+
+// GET /blocks/tip, /blocks/{hash}, /blocks/height/{n}
+func (s *RESTServer) handleBlocks(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	offset, limit, rerr := parsePage(r)
+	if rerr != nil {
+		writeRESTError(w, rerr)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/blocks/")
+	var block *Block
+	var err error
+	switch {
+	case path == "tip":
+		block, err = s.bc.GetBlock(s.bc.tip)
+	case strings.HasPrefix(path, "height/"):
+		height, convErr := strconv.Atoi(strings.TrimPrefix(path, "height/"))
+		if convErr != nil {
+			writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid height '%s'", strings.TrimPrefix(path, "height/")))
+			return
+		}
+		block, err = s.bc.GetBlockByHeight(height)
+	default:
+		hash, decErr := hex.DecodeString(path)
+		if decErr != nil || len(hash) == 0 {
+			writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid block hash '%s'", path))
+			return
+		}
+		block, err = s.bc.GetBlock(hash)
+	}
+	if err != nil {
+		writeRESTError(w, lookupError(err))
+		return
+	}
+
+	j := BlockJSON{
+		Hash:          hex.EncodeToString(block.Hash),
+		Version:       block.Version,
+		PrevBlockHash: hex.EncodeToString(block.PrevBlockHash),
+		MerkleRoot:    hex.EncodeToString(block.MerkleRoot),
+		Height:        block.Height,
+		Time:          block.Time(),
+		Bits:          block.Bits,
+		Nonce:         block.Nonce,
+		TxCount:       len(block.Transactions),
+		Transactions:  []string{},
+		Offset:        offset,
+		Limit:         limit,
+	}
+	start, end := pageBounds(len(block.Transactions), offset, limit)
+	for _, tx := range block.Transactions[start:end] {
+		j.Transactions = append(j.Transactions, hex.EncodeToString(tx.ID))
+	}
+
+	writeJSON(w, http.StatusOK, j)
+}
+
+// GET /tx/{id}
+func (s *RESTServer) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/tx/")
+	txID, err := hex.DecodeString(id)
+	if err != nil || len(txID) == 0 {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid transaction ID '%s'", id))
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	block, err := s.bc.findTransactionBlock(txID)
+	if err != nil {
+		writeRESTError(w, lookupError(err))
+		return
+	}
+	var j TransactionJSON
+	for _, tx := range block.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			j = NewTransactionJSON(tx)
+		}
+	}
+	spenders := s.bc.FindSpendingTransactions(txID)
+	for i := range j.Vout {
+		if spender, ok := spenders[i]; ok {
+			j.Vout[i].SpentBy = hex.EncodeToString(spender)
+		}
+	}
+	bestHeight, err := s.bc.bestHeight()
+	if err != nil {
+		writeRESTError(w, &restError{http.StatusInternalServerError, err})
+		return
+	}
+	j.BlockHash = hex.EncodeToString(block.Hash)
+	j.Height = block.Height
+	j.Confirmations = bestHeight - block.Height + 1
+
+	writeJSON(w, http.StatusOK, j)
+}
+
+// GET /address/{addr}/utxo, /address/{addr}/balance
+func (s *RESTServer) handleAddress(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/address/"), "/")
+	if len(parts) != 2 {
+		writeRESTError(w, restErrorf(http.StatusNotFound, "path %s not found", r.URL.Path))
+		return
+	}
+	address := parts[0]
+	if !ValidateAddress(address) {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid address '%s'", address))
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch parts[1] {
+	case "balance":
+		writeJSON(w, http.StatusOK, s.bc.GetBalance(address))
+
+	case "utxo":
+		offset, limit, rerr := parsePage(r)
+		if rerr != nil {
+			writeRESTError(w, rerr)
+			return
+		}
+		bestHeight, err := s.bc.bestHeight()
+		if err != nil {
+			writeRESTError(w, &restError{http.StatusInternalServerError, err})
+			return
+		}
+		utxos := s.bc.FindUTXOs(address)
+		nextHeight := bestHeight + 1
+		now := time.Now().Unix()
+		items := []UTXOJSON{}
+		start, end := pageBounds(len(utxos), offset, limit)
+		for _, utxo := range utxos[start:end] {
+			items = append(items, UTXOJSON{
+				Txid:         hex.EncodeToString(utxo.TxID),
+				Vout:         utxo.Index,
+				Value:        utxo.Output.Value,
+				ScriptPubKey: hex.EncodeToString(utxo.Output.ScriptPubKey),
+				Height:       utxo.Height,
+				Coinbase:     utxo.Coinbase,
+				Spendable:    utxo.IsSpendable(nextHeight, now, s.bc.params),
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"address": address,
+			"total":   len(utxos),
+			"offset":  offset,
+			"limit":   limit,
+			"utxo":    items,
+		})
+
+	default:
+		writeRESTError(w, restErrorf(http.StatusNotFound, "path %s not found", r.URL.Path))
+	}
+}
+
+// POST /tx：验证已签名的交易并放入交易池，交易在POST /mine时被打包
+// POST /tx: validate a signed transaction and add it to the mempool, it is mined by POST /mine
+func (s *RESTServer) handleSubmitTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	if err := requireJSON(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	var j TransactionJSON
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, restMaxBodySize)).Decode(&j); err != nil {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid transaction: %v", err))
+		return
+	}
+	tx, err := j.Transaction()
+	if err != nil {
+		writeRESTError(w, &restError{http.StatusBadRequest, err})
+		return
+	}
+	if tx.IsCoinbase() {
+		writeRESTError(w, restErrorf(http.StatusUnprocessableEntity, "coinbase transactions cannot be submitted"))
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.mempool.Add(tx); err != nil {
+		writeRESTError(w, &restError{http.StatusUnprocessableEntity, err})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"txid": hex.EncodeToString(tx.ID)})
+}
+
+// GET /mempool：交易池中等待打包的交易ID
+// GET /mempool: the IDs of the mempool transactions waiting to be mined
+func (s *RESTServer) handleMempool(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	ids := []string{}
+	for _, tx := range s.mempool.Transactions() {
+		ids = append(ids, hex.EncodeToString(tx.ID))
+	}
+	writeJSON(w, http.StatusOK, ids)
+}
+
+// POST /mine：把交易池中仍然有效的交易打包进新区块
+// POST /mine: mine the transactions of the mempool that are still valid into a new block
+func (s *RESTServer) handleMine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mempool.Revalidate()
+	if s.mempool.Count() == 0 {
+		writeRESTError(w, restErrorf(http.StatusUnprocessableEntity, "the mempool is empty"))
+		return
+	}
+	block, err := s.mempool.Mine()
+	if err != nil {
+		writeRESTError(w, &restError{http.StatusInternalServerError, err})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"blockHash": hex.EncodeToString(block.Hash),
+		"height":    block.Height,
+		"txCount":   len(block.Transactions),
+	})
+}
+
+// 没有事件时发送心跳注释的间隔，避免代理关闭空闲连接
+// Interval of the keep-alive comments sent while there are no events,
+// so proxies do not close the idle connection
+const eventKeepAlive = 15 * time.Second
+
+// GET /events?address=A&address=B：以Server-Sent Events推送区块和交易事件
+// GET /events?address=A&address=B: push block and transaction events as Server-Sent Events
+func (s *RESTServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeRESTError(w, restErrorf(http.StatusInternalServerError, "streaming is not supported"))
+		return
+	}
+	addresses := r.URL.Query()["address"]
+	for _, address := range addresses {
+		if !ValidateAddress(address) {
+			writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid address '%s'", address))
+			return
+		}
+	}
+
+	sub := s.bc.events.Subscribe(addresses)
+	defer s.bc.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e := <-sub.Events:
+			data, err := json.Marshal(e)
+			HandleErr(err)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// 快照没有通过验证时拒绝请求，只有快照的验证状态仍然可以查询
+// Refuse requests while the snapshot failed validation, only its validation state can still be queried
+func (s *RESTServer) requireValidChain(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		err := s.bc.checkSnapshot()
+		s.mu.RUnlock()
+		if err != nil {
+			writeRESTError(w, restErrorf(http.StatusServiceUnavailable, "%v", err))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// 在后台验证快照。快照无效时在独占区块链期间切换到验证过的链，并重新验证交易池
+// Validate the snapshot in the background. When it is invalid the server switches to the
+// validated chain with exclusive use of the blockchain and revalidates the mempool
+func (s *RESTServer) ValidateSnapshot(v *SnapshotValidator) {
+	s.validator = v
+	v.exclusive = func(fallBack func() error) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err := fallBack(); err != nil {
+			return err
+		}
+		s.mempool.Revalidate()
+
+		return nil
+	}
+	v.Start()
+}
+
+// GET /snapshot：从快照启动的节点中快照的验证状态
+// GET /snapshot: validation state of the snapshot of a node started from a snapshot
+func (s *RESTServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	if s.validator != nil {
+		writeJSON(w, http.StatusOK, s.validator.Status())
+		return
+	}
+
+	status, ok := s.bc.SnapshotStatus()
+	if !ok {
+		writeRESTError(w, restErrorf(http.StatusNotFound, "the blockchain was not loaded from a snapshot"))
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// 区块的紧凑过滤器
+// Compact filter of a block
+type CFilterJSON struct {
+	BlockHash string `json:"blockHash"`
+	Elements  uint32 `json:"elements"`
+	Filter    string `json:"filter"`
+}
+
+// GET /cfilter/{hash}
+func (s *RESTServer) handleCFilter(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/cfilter/")
+	hash, err := hex.DecodeString(id)
+	if err != nil || len(hash) == 0 {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid block hash '%s'", id))
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filter, err := s.bc.GetCFilter(hash)
+	if err != nil {
+		writeRESTError(w, lookupError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, CFilterJSON{
+		BlockHash: hex.EncodeToString(hash),
+		Elements:  binary.BigEndian.Uint32(filter),
+		Filter:    hex.EncodeToString(filter),
+	})
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// 发送JSON请求，secret不为空时带上cookie的口令
+// Send a JSON request, with the cookie secret when secret is not empty
+func restTestRequest(t *testing.T, method, url, secret string, body interface{}) int {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.SetBasicAuth(cookieUser, secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestRESTSubmitTransactionDoesNotMine(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	cookie, err := newAuthCookie(filepath.Join(t.TempDir(), cookieFileName(8081)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRESTServer(bc)
+	s.cookie = cookie
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{NewWallet().GetAddress(), 3}}, TxOptions{}, nil)
+	body := NewTransactionJSON(tx)
+
+	if status := restTestRequest(t, http.MethodPost, server.URL+"/tx", "", body); status != http.StatusUnauthorized {
+		t.Fatalf("submit without the cookie: status %d", status)
+	}
+	if status := restTestRequest(t, http.MethodPost, server.URL+"/mine", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("mine without the cookie: status %d", status)
+	}
+
+	if status := restTestRequest(t, http.MethodPost, server.URL+"/tx", cookie.secret, body); status != http.StatusAccepted {
+		t.Fatalf("submit: status %d", status)
+	}
+	if bc.GetBestHeight() != 0 || s.mempool.Get(tx.ID) == nil {
+		t.Fatalf("after submitting: height %d, in the mempool %v", bc.GetBestHeight(), s.mempool.Get(tx.ID) != nil)
+	}
+
+	if status := restTestRequest(t, http.MethodPost, server.URL+"/mine", cookie.secret, nil); status != http.StatusCreated {
+		t.Fatalf("mine: status %d", status)
+	}
+	if bc.GetBestHeight() != 1 || s.mempool.Count() != 0 {
+		t.Fatalf("after mining: height %d, %d in the mempool", bc.GetBestHeight(), s.mempool.Count())
+	}
+}
+
+// 0x6c就是字母"l"，以前是blocks bucket中链末端的键，按哈希查找不能查到链末端的记录
+// 0x6c is the letter "l", which used to be the key of the tip in the blocks bucket, a lookup
+// by hash cannot find the tip record
+func TestBlockLookupDoesNotFindTheTipKey(t *testing.T) {
+	bc, _ := newTestChain(t, testChainParams())
+	rest := httptest.NewServer(NewRESTServer(bc).Handler())
+	t.Cleanup(rest.Close)
+	explorer := httptest.NewServer(NewExplorer(bc).Handler())
+	t.Cleanup(explorer.Close)
+
+	for _, url := range []string{rest.URL + "/blocks/6c", explorer.URL + "/block/6c"} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, expected %d", url, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+}
+
+// 读不出最新区块时返回500，而不是让处理函数崩溃
+// A tip block that cannot be read gives a 500 instead of crashing the handler
+func TestRESTUnreadableTipIsInternalError(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	mineTestBlock(t, bc, wallet.GetAddress())
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(blocksBucket)).Put(bc.tip, []byte("corrupt"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := httptest.NewServer(NewRESTServer(bc).Handler())
+	t.Cleanup(rest.Close)
+
+	resp, err := http.Get(rest.URL + "/address/" + wallet.GetAddress() + "/utxo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status %d, expected %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
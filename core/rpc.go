@@ -0,0 +1,300 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 节点控制接口的参数
+// Parameters of the node control interface
+const (
+	defaultNodeRPCPort = 8332             // 默认端口 default port
+	nodeRPCTimeout     = 10 * time.Second // 命令行请求的超时 timeout of command line requests
+)
+
+// 节点控制接口：只在本机上监听，命令行通过它查询和控制运行中的节点。
+// 所有请求都需要cookie文件中的口令
+// Node control interface: listens on localhost only, the command line queries and controls
+// the running node through it. Every request needs the secret of the cookie file
+type NodeRPCServer struct {
+	node   *Node
+	cookie *authCookie
+}
+
+func NewNodeRPCServer(node *Node) *NodeRPCServer {
+	return &NodeRPCServer{node: node}
+}
+
+// 控制接口的所有路径
+// All paths of the control interface
+func (s *NodeRPCServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/peers", s.cookie.require(s.handlePeers))
+	mux.HandleFunc("/banned", s.cookie.require(s.handleBanned))
+	mux.HandleFunc("/clearbanned", s.cookie.require(s.handleClearBanned))
+	mux.HandleFunc("/mempool", s.cookie.require(s.handleMempool))
+	mux.HandleFunc("/tx", s.cookie.require(s.handleSubmitTransaction))
+	mux.HandleFunc("/send", s.cookie.require(s.handleSend))
+
+	return mux
+}
+
+// 在本机的端口上启动控制接口并写入cookie文件，返回的监听器关闭后停止并删除cookie文件
+// Start the control interface on a localhost port and write the cookie file, it stops and
+// removes the cookie file when the returned listener is closed
+func (s *NodeRPCServer) Listen(port int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+	if s.cookie, err = newAuthCookie(cookieFileName(port)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	listener = &cookieListener{listener, s.cookie}
+	go http.Serve(listener, s.Handler())
+
+	return listener, nil
+}
+
+// GET /peers
+func (s *NodeRPCServer) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.node.PeerInfo())
+}
+
+// GET /banned 列出封禁 lists the bans
+// POST /banned?subnet=SUBNET&duration=SECONDS 封禁子网 bans a subnet
+// DELETE /banned?subnet=SUBNET 解除封禁 lifts a ban
+func (s *NodeRPCServer) handleBanned(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.node.Banned())
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+
+	subnet, err := parseBanSubnet(r.URL.Query().Get("subnet"))
+	if err != nil {
+		writeRESTError(w, &restError{http.StatusBadRequest, err})
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if err := s.node.Unban(subnet); err != nil {
+			writeRESTError(w, &restError{http.StatusNotFound, err})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"unbanned": subnet.String()})
+		return
+	}
+
+	duration := defaultBanDuration
+	if d := r.URL.Query().Get("duration"); d != "" {
+		seconds, err := strconv.Atoi(d)
+		if err != nil || seconds <= 0 {
+			writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid duration '%s'", d))
+			return
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+	if err := s.node.Ban(subnet, duration, "banned manually"); err != nil {
+		writeRESTError(w, &restError{http.StatusInternalServerError, err})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"banned": subnet.String()})
+}
+
+// POST /clearbanned
+func (s *NodeRPCServer) handleClearBanned(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	if err := s.node.ClearBanned(); err != nil {
+		writeRESTError(w, &restError{http.StatusInternalServerError, err})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"cleared": "all"})
+}
+
+// GET /mempool 交易池中的交易ID the IDs of the mempool transactions
+func (s *NodeRPCServer) handleMempool(w http.ResponseWriter, r *http.Request) {
+	if err := requireGet(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	ids := []string{}
+	for _, tx := range s.node.MempoolTransactions() {
+		ids = append(ids, hex.EncodeToString(tx.ID))
+	}
+	writeJSON(w, http.StatusOK, ids)
+}
+
+// POST /tx 提交已签名的交易，格式与REST接口相同 submits a signed transaction, in the same form as for the REST API
+func (s *NodeRPCServer) handleSubmitTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	if err := requireJSON(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	var j TransactionJSON
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, restMaxBodySize)).Decode(&j); err != nil {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid transaction: %v", err))
+		return
+	}
+	tx, err := j.Transaction()
+	if err != nil {
+		writeRESTError(w, &restError{http.StatusBadRequest, err})
+		return
+	}
+	if err := s.node.SubmitTransaction(tx); err != nil {
+		writeRESTError(w, restErrorf(http.StatusUnprocessableEntity, "transaction rejected: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"txid": hex.EncodeToString(tx.ID)})
+}
+
+// 通过节点转账的请求
+// A request to send coins through the node
+type SendRequest struct {
+	From       string      `json:"from"`
+	Recipients []Recipient `json:"recipients"`
+	Options    SendOptions `json:"options"`
+}
+
+// 可以用JSON传递的交易选项，对应send的参数。选币策略用名称表示，输出用"txid:vout"表示
+// Transaction options that can be passed as JSON, matching the flags of send. The coin
+// selection strategy is given by name and outputs as "txid:vout"
+type SendOptions struct {
+	LockTime       uint32   `json:"locktime,omitempty"`
+	Sequence       uint32   `json:"sequence,omitempty"`
+	OutputLockTime uint32   `json:"lockoutput,omitempty"`
+	CoinSelector   string   `json:"coinselect,omitempty"`
+	Inputs         []string `json:"inputs,omitempty"`
+}
+
+// 转换为交易选项，检查选项是否有效
+// Convert into transaction options, checking that the options are valid
+func (o SendOptions) TxOptions() (TxOptions, error) {
+	if o.Sequence > SequenceLockTimeMask {
+		return TxOptions{}, fmt.Errorf("sequence must not exceed %d blocks", SequenceLockTimeMask)
+	}
+	selector, err := NewCoinSelector(o.CoinSelector)
+	if err != nil {
+		return TxOptions{}, err
+	}
+
+	opts := TxOptions{
+		LockTime:       o.LockTime,
+		Sequence:       o.Sequence,
+		OutputLockTime: o.OutputLockTime,
+		CoinSelector:   selector,
+	}
+	for _, s := range o.Inputs {
+		outpoint, err := ParseOutpoint(s)
+		if err != nil {
+			return TxOptions{}, err
+		}
+		opts.Inputs = append(opts.Inputs, outpoint)
+	}
+
+	return opts, nil
+}
+
+// POST /send 用节点的钱包创建交易并转发 creates a transaction with the wallet of the node and relays it
+func (s *NodeRPCServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	if err := requireJSON(r); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	var req SendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, restMaxBodySize)).Decode(&req); err != nil {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid request: %v", err))
+		return
+	}
+	opts, err := req.Options.TxOptions()
+	if err != nil {
+		writeRESTError(w, restErrorf(http.StatusBadRequest, "invalid options: %v", err))
+		return
+	}
+	tx, err := s.node.Send(req.From, req.Recipients, opts)
+	if err != nil {
+		writeRESTError(w, restErrorf(http.StatusUnprocessableEntity, "cannot send: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"txid": hex.EncodeToString(tx.ID)})
+}
+
+// 请求本机上运行的节点的控制接口，口令从当前目录的cookie文件读取。
+// body不为nil时以JSON格式发送，把JSON结果解码到v中
+// Call the control interface of the node running on this machine, the secret is read from the
+// cookie file in the current directory. body is sent as JSON when it is not nil and the JSON
+// result is decoded into v
+func nodeRPCCall(port int, method, path string, body, v interface{}) error {
+	user, secret, err := readAuthCookie(cookieFileName(port))
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", port, path), reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(user, secret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := http.Client{Timeout: nodeRPCTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach the node on port %d, is it running? %v", port, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("the node answered %s", resp.Status)
+		}
+		return fmt.Errorf("%s", e.Error)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 启动使用临时cookie文件的控制接口
+// Start a control interface with a temporary cookie file
+func newTestRPCServer(t *testing.T) (*httptest.Server, *authCookie) {
+	t.Helper()
+
+	bc, _ := newTestChain(t, testChainParams())
+	node, err := NewNode(bc, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie, err := newAuthCookie(filepath.Join(t.TempDir(), cookieFileName(defaultNodeRPCPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer((&NodeRPCServer{node, cookie}).Handler())
+	t.Cleanup(server.Close)
+
+	return server, cookie
+}
+
+func TestAuthCookieFile(t *testing.T) {
+	_, cookie := newTestRPCServer(t)
+
+	info, err := os.Stat(cookie.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("cookie file mode %v", info.Mode().Perm())
+	}
+	user, secret, err := readAuthCookie(cookie.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != cookieUser || secret != cookie.secret {
+		t.Fatalf("read %s:%s from the cookie file", user, secret)
+	}
+}
+
+func TestNodeRPCRequiresCookie(t *testing.T) {
+	server, cookie := newTestRPCServer(t)
+
+	for _, tc := range []struct {
+		name         string
+		user, secret string
+		status       int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong secret", cookieUser, "wrong", http.StatusUnauthorized},
+		{"cookie", cookieUser, cookie.secret, http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/mempool", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.user != "" {
+			req.SetBasicAuth(tc.user, tc.secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestNodeRPCSendRequiresJSON(t *testing.T) {
+	server, cookie := newTestRPCServer(t)
+
+	for _, tc := range []struct {
+		contentType string
+		status      int
+	}{
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"application/json; charset=utf-8", http.StatusUnprocessableEntity},
+	} {
+		body := strings.NewReader(`{"from":"","recipients":[]}`)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/send", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(cookieUser, cookie.secret)
+		req.Header.Set("Content-Type", tc.contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.contentType, resp.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestSendOptionsValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts SendOptions
+	}{
+		{"sequence", SendOptions{Sequence: SequenceLockTimeMask + 1}},
+		{"coin selector", SendOptions{CoinSelector: "unknown"}},
+		{"input", SendOptions{Inputs: []string{"not an outpoint"}}},
+	} {
+		if _, err := tc.opts.TxOptions(); err == nil {
+			t.Errorf("%s: invalid options were accepted", tc.name)
+		}
+	}
+
+	server, cookie := newTestRPCServer(t)
+	body := strings.NewReader(`{"from":"","recipients":[],"options":{"coinselect":"unknown"}}`)
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/send", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(cookieUser, cookie.secret)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// 通过节点转账时交易选项生效，交易池中的交易已花费的输出仍然被排除
+// The transaction options apply when sending through the node, and the outputs spent by
+// mempool transactions are still excluded
+func TestNodeSendUsesOptions(t *testing.T) {
+	n, bc, wallet := newTestNode(t)
+	for i := 0; i < 2; i++ {
+		mineTestBlock(t, bc, wallet.GetAddress())
+	}
+	to := NewWallet().GetAddress()
+	pinned := bc.FindUTXOs(wallet.GetAddress())[1]
+
+	sendOpts := SendOptions{
+		LockTime: 1,
+		Sequence: 1,
+		Inputs:   []string{Outpoint{pinned.TxID, pinned.Index}.String()},
+	}
+	opts, err := sendOpts.TxOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := n.SendFrom(wallet, []Recipient{{to, 5}}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.LockTime != 1 {
+		t.Fatalf("lock time %d, want 1", tx.LockTime)
+	}
+	if len(tx.Vin) != 1 || !bytes.Equal(tx.Vin[0].Txid, pinned.TxID) || tx.Vin[0].Vout != pinned.Index {
+		t.Fatalf("the transaction does not spend the pinned output %x:%d", pinned.TxID, pinned.Index)
+	}
+	if tx.Vin[0].Sequence != 1 {
+		t.Fatalf("sequence %d, want 1", tx.Vin[0].Sequence)
+	}
+
+	// 同一个输出已被交易池中的交易花费，不能再指定
+	// The same output is now spent by a mempool transaction and cannot be pinned again
+	if _, err := n.SendFrom(wallet, []Recipient{{to, 5}}, opts); err == nil {
+		t.Fatal("an output spent by the mempool was pinned again")
+	}
+	second, err := n.SendFrom(wallet, []Recipient{{to, 5}}, TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range second.Vin {
+		if bytes.Equal(in.Txid, pinned.TxID) && in.Vout == pinned.Index {
+			t.Fatal("the second transaction spends the output spent by the first")
+		}
+	}
+}
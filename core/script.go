@@ -0,0 +1,318 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 脚本类型
+// Standard script classes
+type ScriptClass int
+
+const (
+	NonStandardTy        ScriptClass = iota // 非标准脚本 non-standard script
+	PubKeyHashTy                            // 支付到公钥哈希(P2PKH) pay to pubkey hash
+	NullDataTy                              // OP_RETURN数据输出，不可花费 OP_RETURN data output, unspendable
+	MultiSigTy                              // 裸多重签名 bare multisig
+	ScriptHashTy                            // 支付到脚本哈希(P2SH) pay to script hash
+	LockTimePubKeyHashTy                    // 带锁定时间的P2PKH P2PKH guarded by a lock time
+)
+
+var scriptClassNames = map[ScriptClass]string{
+	NonStandardTy:        "nonstandard",
+	PubKeyHashTy:         "pubkeyhash",
+	NullDataTy:           "nulldata",
+	MultiSigTy:           "multisig",
+	ScriptHashTy:         "scripthash",
+	LockTimePubKeyHashTy: "locktimepubkeyhash",
+}
+
+func (c ScriptClass) String() string {
+	return scriptClassNames[c]
+}
+
+var errMalformedPush = errors.New("script: malformed data push")
+
+// 解析后的一条脚本指令
+// A single parsed script instruction
+type parsedOp struct {
+	opcode byte
+	data   []byte
+}
+
+// 把脚本字节解析为指令列表
+// Parse the raw script bytes into a list of instructions
+func parseScript(script []byte) ([]parsedOp, error) {
+	var ops []parsedOp
+
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+
+		var n int
+		switch {
+		case op >= OpData1 && op <= OpData75:
+			n = int(op)
+		case op == OpPushData1:
+			if i+1 > len(script) {
+				return nil, errMalformedPush
+			}
+			n = int(script[i])
+			i++
+		case op == OpPushData2:
+			if i+2 > len(script) {
+				return nil, errMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			ops = append(ops, parsedOp{opcode: op})
+			continue
+		}
+
+		if i+n > len(script) {
+			return nil, errMalformedPush
+		}
+		ops = append(ops, parsedOp{opcode: op, data: script[i : i+n]})
+		i += n
+	}
+
+	return ops, nil
+}
+
+// 判断脚本是否只包含数据压栈操作
+// Check whether the script only contains data pushes
+func isPushOnly(ops []parsedOp) bool {
+	for _, op := range ops {
+		if !isPushOpcode(op.opcode) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 脚本构建器
+// ScriptBuilder builds a script from opcodes and data pushes
+type ScriptBuilder struct {
+	script []byte
+	err    error
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+// 添加一个操作码
+// Add an opcode to the script
+func (b *ScriptBuilder) AddOp(op byte) *ScriptBuilder {
+	b.script = append(b.script, op)
+
+	return b
+}
+
+// 使用最短的编码方式压入数据
+// Push data onto the script using the shortest encoding
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	n := len(data)
+	switch {
+	case n > maxScriptElementSize:
+		b.err = fmt.Errorf("script: data push of %d bytes exceeds %d", n, maxScriptElementSize)
+		return b
+	case n == 0:
+		b.script = append(b.script, Op0)
+		return b
+	case n == 1 && data[0] >= 1 && data[0] <= 16:
+		// 数字操作码本身就是数据，后面不再跟数据
+		// The number opcode is the data itself, nothing follows it
+		b.script = append(b.script, Op1-1+data[0])
+		return b
+	case n <= int(OpData75):
+		b.script = append(b.script, byte(n))
+	case n <= 0xff:
+		b.script = append(b.script, OpPushData1, byte(n))
+	default:
+		b.script = append(b.script, OpPushData2, byte(n), byte(n>>8))
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+// 压入一个整数
+// Push an integer onto the script
+func (b *ScriptBuilder) AddInt64(n int64) *ScriptBuilder {
+	switch {
+	case n == 0:
+		b.script = append(b.script, Op0)
+	case n == -1:
+		b.script = append(b.script, Op1Negate)
+	case n >= 1 && n <= 16:
+		b.script = append(b.script, Op1-1+byte(n))
+	default:
+		b.AddData(scriptNum(n).Bytes())
+	}
+
+	return b
+}
+
+// 返回构建好的脚本
+// Return the built script
+func (b *ScriptBuilder) Script() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.script) > maxScriptSize {
+		return nil, fmt.Errorf("script: size %d exceeds %d", len(b.script), maxScriptSize)
+	}
+
+	return b.script, nil
+}
+
+// 把脚本反汇编为可读的字符串
+// Disassemble the script into a human readable string
+func DisasmString(script []byte) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return "[error: " + err.Error() + "]"
+	}
+
+	var parts []string
+	for _, op := range ops {
+		switch {
+		case op.data != nil:
+			parts = append(parts, hex.EncodeToString(op.data))
+		case op.opcode >= Op1 && op.opcode <= Op16:
+			parts = append(parts, fmt.Sprintf("OP_%d", op.opcode-Op1+1))
+		case opcodeNames[op.opcode] != "":
+			parts = append(parts, opcodeNames[op.opcode])
+		default:
+			parts = append(parts, fmt.Sprintf("OP_UNKNOWN%d", op.opcode))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// P2PKH锁定脚本: OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+// P2PKH locking script: OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHashScript(pubKeyHash []byte) []byte {
+	script, err := NewScriptBuilder().
+		AddOp(OpDup).AddOp(OpHash160).AddData(pubKeyHash).
+		AddOp(OpEqualVerify).AddOp(OpCheckSig).Script()
+	HandleErr(err)
+
+	return script
+}
+
+// P2PKH解锁脚本: <signature> <pubKey>
+// P2PKH unlocking script: <signature> <pubKey>
+func PayToPubKeyHashSigScript(signature, pubKey []byte) []byte {
+	script, err := NewScriptBuilder().AddData(signature).AddData(pubKey).Script()
+	HandleErr(err)
+
+	return script
+}
+
+// P2SH锁定脚本: OP_HASH160 <scriptHash> OP_EQUAL
+// P2SH locking script: OP_HASH160 <scriptHash> OP_EQUAL
+func PayToScriptHashScript(scriptHash []byte) []byte {
+	script, err := NewScriptBuilder().
+		AddOp(OpHash160).AddData(scriptHash).AddOp(OpEqual).Script()
+	HandleErr(err)
+
+	return script
+}
+
+// 不可花费的数据输出: OP_RETURN <data>
+// Unspendable data carrier output: OP_RETURN <data>
+func NullDataScript(data []byte) ([]byte, error) {
+	return NewScriptBuilder().AddOp(OpReturn).AddData(data).Script()
+}
+
+// 根据地址生成对应的标准锁定脚本
+// Build the standard locking script paying to the address
+func PayToAddrScript(address string) ([]byte, error) {
+	version, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case addressVersion:
+		return PayToPubKeyHashScript(hash), nil
+	case scriptHashAddrVersion:
+		return PayToScriptHashScript(hash), nil
+	}
+
+	return nil, fmt.Errorf("unsupported address version %d", version)
+}
+
+// 识别锁定脚本的类型
+// Classify a locking script
+func ClassifyScript(script []byte) ScriptClass {
+	ops, err := parseScript(script)
+	if err != nil {
+		return NonStandardTy
+	}
+
+	switch {
+	case isPubKeyHash(ops):
+		return PubKeyHashTy
+	case isScriptHash(ops):
+		return ScriptHashTy
+	case isLockTimePubKeyHash(ops):
+		return LockTimePubKeyHashTy
+	case isMultiSig(ops):
+		return MultiSigTy
+	case len(ops) > 0 && ops[0].opcode == OpReturn:
+		return NullDataTy
+	}
+
+	return NonStandardTy
+}
+
+func isPubKeyHash(ops []parsedOp) bool {
+	return len(ops) == 5 &&
+		ops[0].opcode == OpDup &&
+		ops[1].opcode == OpHash160 &&
+		len(ops[2].data) == pubKeyHashLen &&
+		ops[3].opcode == OpEqualVerify &&
+		ops[4].opcode == OpCheckSig
+}
+
+func isScriptHash(ops []parsedOp) bool {
+	return len(ops) == 3 &&
+		ops[0].opcode == OpHash160 &&
+		len(ops[1].data) == pubKeyHashLen &&
+		ops[2].opcode == OpEqual
+}
+
+func isMultiSig(ops []parsedOp) bool {
+	_, _, ok := parseMultiSig(ops)
+
+	return ok
+}
+
+// 从标准锁定脚本中提取地址
+// Extract the address from a standard locking script
+func ExtractAddress(script []byte) (string, bool) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return "", false
+	}
+
+	switch {
+	case isPubKeyHash(ops):
+		return encodeAddress(addressVersion, ops[2].data), true
+	case isScriptHash(ops):
+		return encodeAddress(scriptHashAddrVersion, ops[1].data), true
+	case isLockTimePubKeyHash(ops):
+		return encodeAddress(addressVersion, ops[5].data), true
+	}
+
+	return "", false
+}
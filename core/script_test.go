@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 压栈数据的长度超过脚本剩余的字节时解析失败，而不是越界读取
+// Parsing fails when a push claims more bytes than the script has left, instead of reading out of bounds
+func TestParseScriptRejectsTruncatedPushes(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+	}{
+		{"direct push", []byte{0x05, 1, 2}},
+		{"pushdata1 without length", []byte{OpPushData1}},
+		{"pushdata1 without data", []byte{OpPushData1, 0x05, 1}},
+		{"pushdata2 with half a length", []byte{OpPushData2, 0x01}},
+		{"pushdata2 without data", []byte{OpPushData2, 0x00, 0x01, 1, 2, 3}},
+		{"truncated after valid ops", []byte{Op1, OpDup, 0x02, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseScript(test.script); err != errMalformedPush {
+				t.Fatalf("got %v, expected %v", err, errMalformedPush)
+			}
+			if err := runTestScript(test.script); err != errMalformedPush {
+				t.Fatalf("execution: got %v, expected %v", err, errMalformedPush)
+			}
+			if ClassifyScript(test.script) != NonStandardTy {
+				t.Fatal("a malformed script was classified as standard")
+			}
+			if _, ok := ExtractAddress(test.script); ok {
+				t.Fatal("an address was extracted from a malformed script")
+			}
+		})
+	}
+}
+
+// 构建器使用最短编码，解析后得到同样的数据
+// The builder uses the shortest encoding and parsing returns the same data
+func TestScriptBuilderPushesRoundTrip(t *testing.T) {
+	tests := []struct {
+		size   int
+		opcode byte
+	}{
+		{1, OpData1},
+		{int(OpData75), OpData75},
+		{int(OpData75) + 1, OpPushData1},
+		{0xff, OpPushData1},
+		{0x100, OpPushData2},
+		{maxScriptElementSize, OpPushData2},
+	}
+	for _, test := range tests {
+		data := bytes.Repeat([]byte{0x20}, test.size)
+		script, err := NewScriptBuilder().AddData(data).Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops, err := parseScript(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ops) != 1 || ops[0].opcode != test.opcode || !bytes.Equal(ops[0].data, data) {
+			t.Fatalf("%d bytes: parsed %d ops, opcode 0x%02x", test.size, len(ops), ops[0].opcode)
+		}
+	}
+
+	// 空数据和1到16的单字节数据压入数字操作码，执行后栈上是同样的数据
+	// Empty data and single bytes from 1 to 16 push a number opcode, which leaves the same data on the stack
+	for _, data := range [][]byte{{}, {1}, {16}, {17}, {0}} {
+		script, err := NewScriptBuilder().AddData(data).Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm := NewEngine(nil, 0, nil)
+		if err := vm.Execute(script); err != nil {
+			t.Fatalf("%x: %v", data, err)
+		}
+		if len(vm.stack) != 1 || !bytes.Equal(vm.stack[0], data) {
+			t.Fatalf("%x: the stack holds %x", data, vm.stack)
+		}
+	}
+}
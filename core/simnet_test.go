@@ -0,0 +1,851 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// 模拟网络的参数
+// Parameters of the simulated network
+const (
+	simListenPort         = 8333                  // 模拟节点监听的端口 port the simulated nodes listen on
+	simFirstEphemeralPort = 49152                 // 出站连接的第一个本地端口 first local port of outbound connections
+	simPollInterval       = 50 * time.Millisecond // 等待条件时的检查间隔 interval between checks while waiting for a condition
+	simStepTimeout        = 2 * time.Minute       // 测试中每一步的超时 timeout of every step of a test
+	simAcceptBacklog      = 16                    // 等待接受的连接数 connections waiting to be accepted
+	simPaymentAmount      = 3                     // 测试中每笔转账的金额 amount of every payment of the tests
+	simDefaultLatency     = 20 * time.Millisecond // 默认的单向延迟 default one-way latency
+	simDefaultJitter      = 10 * time.Millisecond // 默认的延迟抖动 default latency jitter
+)
+
+var (
+	errSimUnreachable = errors.New("network is unreachable")
+	errSimRefused     = errors.New("connection refused")
+	errSimReset       = errors.New("connection reset")
+)
+
+// 模拟网络中的地址
+// An address in the simulated network
+type simAddr string
+
+func (a simAddr) Network() string {
+	return "sim"
+}
+
+func (a simAddr) String() string {
+	return string(a)
+}
+
+// 在路上的一段数据和它到达的时间
+// Data on the way and when it arrives
+type simPacket struct {
+	at   time.Time
+	data []byte
+}
+
+// 连接的一个方向：数据按发送顺序在延迟后到达
+// One direction of a connection: data arrives in the order it was sent, after the latency
+type simPipe struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []simPacket  // 还在路上的数据 data still on the way
+	buf     bytes.Buffer // 已到达、等待读取的数据 data that arrived and waits to be read
+	closed  bool
+}
+
+func newSimPipe() *simPipe {
+	p := &simPipe{}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// 发送数据，它在delay之后、且不早于之前发送的数据到达
+// Send data, it arrives after delay and not before the data sent earlier
+func (p *simPipe) push(data []byte, delay time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return io.ErrClosedPipe
+	}
+	at := time.Now().Add(delay)
+	if n := len(p.pending); n > 0 && at.Before(p.pending[n-1].at) {
+		at = p.pending[n-1].at
+	}
+	p.pending = append(p.pending, simPacket{at, append([]byte{}, data...)})
+	p.cond.Broadcast()
+
+	return nil
+}
+
+func (p *simPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.closed {
+			return 0, io.EOF
+		}
+		now := time.Now()
+		for len(p.pending) > 0 && !p.pending[0].at.After(now) {
+			p.buf.Write(p.pending[0].data)
+			p.pending = p.pending[1:]
+		}
+		if p.buf.Len() > 0 {
+			return p.buf.Read(b)
+		}
+
+		if len(p.pending) == 0 {
+			p.cond.Wait()
+			continue
+		}
+		// 等待下一段数据到达，延迟很短，不需要被关闭唤醒
+		// Wait for the next data to arrive, the latency is short so closing need not wake us up
+		wait := p.pending[0].at.Sub(now)
+		p.mu.Unlock()
+		time.Sleep(wait)
+		p.mu.Lock()
+	}
+}
+
+// 关闭后还在路上的数据被丢弃，就像连接被重置一样
+// Data still on the way is discarded after closing, as if the connection was reset
+func (p *simPipe) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.pending = nil
+	p.buf.Reset()
+	p.cond.Broadcast()
+}
+
+// 模拟网络中的连接，写入从不阻塞，所以超时设置被忽略
+// A connection in the simulated network. Writes never block, so deadlines are ignored
+type simConn struct {
+	network       *SimNetwork
+	local, remote simAddr
+	in, out       *simPipe
+}
+
+func (c *simConn) Read(b []byte) (int, error) {
+	return c.in.read(b)
+}
+
+func (c *simConn) Write(b []byte) (int, error) {
+	if err := c.network.transmit(c, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *simConn) Close() error {
+	c.in.close()
+	c.out.close()
+	c.network.removeConn(c)
+
+	return nil
+}
+
+func (c *simConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *simConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *simConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *simConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *simConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// 模拟网络中的监听器
+// A listener in the simulated network
+type simListener struct {
+	network   *SimNetwork
+	addr      simAddr
+	conns     chan net.Conn
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *simListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.quit:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *simListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.quit)
+		l.network.removeListener(l)
+	})
+
+	return nil
+}
+
+func (l *simListener) Addr() net.Addr {
+	return l.addr
+}
+
+// 模拟网络的配置
+// Configuration of the simulated network
+type SimConfig struct {
+	Nodes    int           // 节点数 number of nodes
+	Latency  time.Duration // 消息的单向延迟 one-way latency of messages
+	Jitter   time.Duration // 延迟的随机增加量的上限 upper bound of the random extra latency
+	DropRate float64       // 每条消息丢失的概率 chance that a message is lost
+	Seed     int64         // 延迟和丢失的随机数种子 random seed of the latencies and losses
+	Params   ChainParams   // 模拟链的参数，默认挖矿奖励立即成熟 parameters of the simulated chains, by default rewards mature at once
+	Log      io.Writer     // 节点的日志，为nil时丢弃 log of the nodes, discarded when nil
+}
+
+// 模拟网络中的一个节点，有自己的区块链和钱包
+// A node in the simulated network, with its own blockchain and wallet
+type SimNode struct {
+	Name   string
+	Addr   string
+	Node   *Node
+	Chain  *BlockChain
+	Wallet *Wallet
+}
+
+// 模拟网络：在一个进程中运行多个节点，它们通过内存中的连接通信。网络可以设置延迟和
+// 消息丢失，也可以被分割成互相不能通信的部分。消息按TCP的方式丢失：丢失的消息会重置
+// 连接，节点之后重新连接。每个节点的数据库在测试的临时目录中，测试结束时节点停止。
+// 测试可以用它编写多节点的场景，例如：
+//
+//	sim := NewSimNetwork(t, SimConfig{Nodes: 3})
+//	sim.ConnectAll()
+//	sim.Mine(0, 1)
+//	sim.WaitConverged(time.Minute)
+//
+// Simulated network: runs several nodes in one process, talking over in-memory connections.
+// The network can have latency and lose messages, and it can be split into parts that cannot
+// reach each other. Messages are lost the way TCP loses them: a lost message resets the
+// connection and the nodes connect again later. The database of every node is in the temporary
+// directory of the test and the nodes stop when the test ends. Tests can use it to script
+// scenarios with several nodes, like the example above
+type SimNetwork struct {
+	mu        sync.Mutex
+	rand      *rand.Rand
+	latency   time.Duration
+	jitter    time.Duration
+	dropRate  float64
+	groups    map[string]int // 分割时每个主机所在的部分 the part of every host while partitioned
+	listeners map[simAddr]*simListener
+	conns     map[*simConn]bool
+	nextPort  int
+
+	dir    string
+	params ChainParams
+	nodes  []*SimNode
+}
+
+// 建立模拟网络并启动所有节点，节点之间还没有连接
+// Build the simulated network and start every node, the nodes are not connected yet
+func NewSimNetwork(t *testing.T, cfg SimConfig) *SimNetwork {
+	t.Helper()
+
+	if cfg.Nodes < 1 {
+		t.Fatal("a simulated network needs at least one node")
+	}
+	if cfg.DropRate < 0 || cfg.DropRate >= 1 {
+		t.Fatalf("invalid drop rate %g", cfg.DropRate)
+	}
+	log := cfg.Log
+	if log == nil {
+		log = ioutil.Discard
+	}
+
+	s := &SimNetwork{
+		rand:      rand.New(rand.NewSource(cfg.Seed)),
+		latency:   cfg.Latency,
+		jitter:    cfg.Jitter,
+		dropRate:  cfg.DropRate,
+		listeners: make(map[simAddr]*simListener),
+		conns:     make(map[*simConn]bool),
+		nextPort:  simFirstEphemeralPort,
+		dir:       t.TempDir(),
+		params:    cfg.Params,
+	}
+	t.Cleanup(s.close)
+
+	// 所有节点共用一个创世区块
+	// Every node shares one genesis block
+	genesis := solveTestBlock([]*Transaction{NewCoinbaseTransaction(NewWallet().GetAddress(), genesisCoinbaseData)}, []byte{}, 0)
+
+	logMu := &sync.Mutex{}
+	for i := 0; i < cfg.Nodes; i++ {
+		name := fmt.Sprintf("node%d", i)
+		addr := net.JoinHostPort(fmt.Sprintf("10.0.%d.%d", (i+1)/256, (i+1)%256), strconv.Itoa(simListenPort))
+		if err := s.startNode(name, addr, genesis, &simLog{logMu, log, name}); err != nil {
+			t.Fatalf("starting %s: %v", name, err)
+		}
+	}
+
+	return s
+}
+
+func (s *SimNetwork) startNode(name, addr string, genesis *Block, log io.Writer) error {
+	bc, err := createBlockchainDB(filepath.Join(s.dir, name+".db"), genesis, s.params)
+	if err != nil {
+		return err
+	}
+	node, err := NewNode(bc, log)
+	if err != nil {
+		bc.DbClose()
+		return err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	node.Dial = func(addr string) (net.Conn, error) {
+		return s.dial(host, addr)
+	}
+	node.Listen = s.listen
+	if err := node.Start(addr); err != nil {
+		bc.DbClose()
+		return err
+	}
+	s.nodes = append(s.nodes, &SimNode{name, addr, node, bc, NewWallet()})
+
+	return nil
+}
+
+// 停止所有节点，关闭它们的数据库。测试的临时目录随后被删除
+// Stop every node and close their databases. The temporary directory of the test is removed afterwards
+func (s *SimNetwork) close() {
+	for _, sn := range s.nodes {
+		sn.Node.Stop()
+		sn.Chain.DbClose()
+	}
+}
+
+func (s *SimNetwork) Nodes() []*SimNode {
+	return s.nodes
+}
+
+func (s *SimNetwork) Node(i int) *SimNode {
+	return s.nodes[i]
+}
+
+// 修改网络的延迟和丢失率，对已在路上的消息无效
+// Change the latency and the drop rate of the network, messages already on the way are not affected
+func (s *SimNetwork) SetConditions(latency, jitter time.Duration, dropRate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+	s.jitter = jitter
+	s.dropRate = dropRate
+}
+
+func (s *SimNetwork) listen(addr string) (net.Listener, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners[simAddr(addr)] != nil {
+		return nil, fmt.Errorf("address %s already in use", addr)
+	}
+	l := &simListener{
+		network: s,
+		addr:    simAddr(addr),
+		conns:   make(chan net.Conn, simAcceptBacklog),
+		quit:    make(chan struct{}),
+	}
+	s.listeners[l.addr] = l
+
+	return l, nil
+}
+
+func (s *SimNetwork) removeListener(l *simListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners[l.addr] == l {
+		delete(s.listeners, l.addr)
+	}
+}
+
+// 从主机host连接addr
+// Connect from host to addr
+func (s *SimNetwork) dial(host, addr string) (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remoteHost, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.groups[host] != s.groups[remoteHost] {
+		return nil, errSimUnreachable
+	}
+	l := s.listeners[simAddr(addr)]
+	if l == nil {
+		return nil, errSimRefused
+	}
+
+	local := simAddr(net.JoinHostPort(host, strconv.Itoa(s.nextPort)))
+	s.nextPort++
+	toServer, toClient := newSimPipe(), newSimPipe()
+	client := &simConn{s, local, simAddr(addr), toClient, toServer}
+	server := &simConn{s, simAddr(addr), local, toServer, toClient}
+	select {
+	case l.conns <- server:
+	default:
+		return nil, errSimRefused
+	}
+	s.conns[client] = true
+	s.conns[server] = true
+
+	return client, nil
+}
+
+func (s *SimNetwork) removeConn(c *simConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, c)
+}
+
+// 发送一次写入的数据。节点每次写入一条完整的消息，所以丢失以消息为单位
+// Send the data of one write. Nodes write one whole message at a time, so messages are
+// lost as a whole
+func (s *SimNetwork) transmit(c *simConn, data []byte) error {
+	s.mu.Lock()
+	localHost, _, _ := net.SplitHostPort(c.local.String())
+	remoteHost, _, _ := net.SplitHostPort(c.remote.String())
+	partitioned := s.groups[localHost] != s.groups[remoteHost]
+	dropped := s.dropRate > 0 && s.rand.Float64() < s.dropRate
+	delay := s.latency
+	if s.jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.jitter)))
+	}
+	s.mu.Unlock()
+
+	if partitioned {
+		c.Close()
+		return errSimUnreachable
+	}
+	if dropped {
+		c.Close()
+		return errSimReset
+	}
+
+	return c.out.push(data, delay)
+}
+
+// 把网络分割成互相不能通信的部分，每个部分是一组节点序号，不在任何部分中的节点
+// 组成另一个部分。跨越部分的连接被断开
+// Split the network into parts that cannot reach each other, every part is a list of node
+// indexes and the nodes in no part form one more part. Connections across parts are cut
+func (s *SimNetwork) Partition(parts ...[]int) {
+	s.mu.Lock()
+	s.groups = make(map[string]int)
+	for i, part := range parts {
+		for _, index := range part {
+			host, _, _ := net.SplitHostPort(s.nodes[index].Addr)
+			s.groups[host] = i + 1
+		}
+	}
+	var cut []*simConn
+	for c := range s.conns {
+		localHost, _, _ := net.SplitHostPort(c.local.String())
+		remoteHost, _, _ := net.SplitHostPort(c.remote.String())
+		if s.groups[localHost] != s.groups[remoteHost] {
+			cut = append(cut, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range cut {
+		c.Close()
+	}
+}
+
+// 结束分割，节点会重新连接
+// End the partition, the nodes connect again
+func (s *SimNetwork) Heal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = nil
+}
+
+// 让节点i一直与节点j保持连接
+// Keep node i connected to node j
+func (s *SimNetwork) Connect(i, j int) error {
+	return s.nodes[i].Node.AddPersistentPeer(s.nodes[j].Addr)
+}
+
+// 连接所有节点两两之间
+// Connect every pair of nodes
+func (s *SimNetwork) ConnectAll() error {
+	for i := range s.nodes {
+		for j := i + 1; j < len(s.nodes); j++ {
+			if err := s.Connect(i, j); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// 每隔simPollInterval检查一次，直到check返回nil或超时，超时时返回check最后的错误
+// Check every simPollInterval until check returns nil or the timeout passes, returning the
+// last error of check on timeout
+func waitFor(timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s: %v", timeout, err)
+		}
+		time.Sleep(simPollInterval)
+	}
+}
+
+// 默认是所有节点的序号
+// The indexes of every node by default
+func (s *SimNetwork) indexes(nodes []int) []int {
+	if len(nodes) > 0 {
+		return nodes
+	}
+	all := make([]int, len(s.nodes))
+	for i := range all {
+		all[i] = i
+	}
+
+	return all
+}
+
+// 等待每个节点都至少与peers个节点完成握手
+// Wait until every node finished the handshake with at least peers nodes
+func (s *SimNetwork) WaitConnected(timeout time.Duration, peers int) error {
+	return waitFor(timeout, func() error {
+		for _, sn := range s.nodes {
+			connected := 0
+			for _, info := range sn.Node.PeerInfo() {
+				if info.State != "handshake" {
+					connected++
+				}
+			}
+			if connected < peers {
+				return fmt.Errorf("%s has %d peers, expected %d", sn.Name, connected, peers)
+			}
+		}
+		return nil
+	})
+}
+
+// 让节点i挖count个区块，包含它交易池中的交易，奖励发给它的钱包
+// Let node i mine count blocks with the transactions of its mempool, rewarding its wallet
+func (s *SimNetwork) Mine(i, count int) ([]*Block, error) {
+	sn := s.nodes[i]
+	var blocks []*Block
+	err := waitFor(simStepTimeout, func() error {
+		for len(blocks) < count {
+			block, err := sn.Node.GenerateBlock(sn.Wallet.GetAddress(), true)
+			if err != nil {
+				return err
+			}
+			if block == nil {
+				// 节点在同步或链末端刚改变，稍后重试
+				// The node is syncing or the tip just changed, retry later
+				return fmt.Errorf("%s cannot mine while syncing", sn.Name)
+			}
+			blocks = append(blocks, block)
+		}
+		return nil
+	})
+
+	return blocks, err
+}
+
+// 节点from向节点to的钱包转账，交易提交给from并转发给它的节点
+// Node from pays amount to the wallet of node to, the transaction is submitted to from and
+// relayed to its peers
+func (s *SimNetwork) Pay(from, to, amount int) (*Transaction, error) {
+	sn := s.nodes[from]
+
+	return sn.Node.SendFrom(sn.Wallet, []Recipient{{s.nodes[to].Wallet.GetAddress(), amount}}, TxOptions{})
+}
+
+// 等待交易进入给定节点的交易池，没有给定节点时为所有节点
+// Wait until the transaction is in the mempools of the given nodes, or of every node when none is given
+func (s *SimNetwork) WaitMempool(timeout time.Duration, id []byte, nodes ...int) error {
+	return waitFor(timeout, func() error {
+		for _, i := range s.indexes(nodes) {
+			found := false
+			for _, tx := range s.nodes[i].Node.MempoolTransactions() {
+				if bytes.Equal(tx.ID, id) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("transaction %x is not in the mempool of %s", id, s.nodes[i].Name)
+			}
+		}
+		return nil
+	})
+}
+
+// 节点的链状态：链末端、高度和未花费输出集合的摘要
+// The chain state of a node: the tip, the height and a digest of the UTXO set
+type SimChainState struct {
+	Tip     []byte
+	Height  int
+	UTXOSet []byte
+}
+
+func (s *SimNetwork) ChainState(i int) (SimChainState, error) {
+	return s.nodes[i].Node.chainState()
+}
+
+func (n *Node) chainState() (SimChainState, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	block, err := n.bc.GetBlock(n.bc.tip)
+	if err != nil {
+		return SimChainState{}, err
+	}
+	utxo, err := n.bc.utxoSetDigest()
+	if err != nil {
+		return SimChainState{}, err
+	}
+
+	return SimChainState{block.Hash, block.Height, utxo}, nil
+}
+
+// 未花费输出集合的摘要：按键排列的所有键值的SHA-256
+// Digest of the UTXO set: the SHA-256 of all key/values in key order
+func (bc *BlockChain) utxoSetDigest() ([]byte, error) {
+	contents := make(map[string]string)
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(utxoSetBucket))
+		if bucket == nil {
+			return fmt.Errorf("the UTXO set is not enabled")
+		}
+		return bucketContents(bucket, "", contents)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(contents))
+	for k := range contents {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, contents[k])
+	}
+
+	return h.Sum(nil), nil
+}
+
+// 等待给定节点(没有给定时为所有节点)收敛到相同的链末端和未花费输出集合，返回收敛后的状态
+// Wait until the given nodes, or every node when none is given, converge on the same tip and
+// UTXO set, returning the state they converged on
+func (s *SimNetwork) WaitConverged(timeout time.Duration, nodes ...int) (SimChainState, error) {
+	var state SimChainState
+	err := waitFor(timeout, func() error {
+		indexes := s.indexes(nodes)
+		first, err := s.ChainState(indexes[0])
+		if err != nil {
+			return err
+		}
+		for _, i := range indexes[1:] {
+			other, err := s.ChainState(i)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(other.Tip, first.Tip) {
+				return fmt.Errorf("%s is at height %d (%x), %s at height %d (%x)", s.nodes[indexes[0]].Name,
+					first.Height, first.Tip, s.nodes[i].Name, other.Height, other.Tip)
+			}
+			if !bytes.Equal(other.UTXOSet, first.UTXOSet) {
+				return fmt.Errorf("%s and %s have the same tip but different UTXO sets", s.nodes[indexes[0]].Name, s.nodes[i].Name)
+			}
+		}
+		state = first
+		return nil
+	})
+
+	return state, err
+}
+
+// 给每一行日志加上节点名称，多个节点共用一个输出
+// Prefix every log line with the node name, several nodes share one output
+type simLog struct {
+	mu   *sync.Mutex
+	w    io.Writer
+	name string
+}
+
+func (l *simLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := fmt.Fprintf(l.w, "%s: %s", l.name, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// 连接所有节点并等待握手完成。有丢失时连接不断被重置，只等到每个节点至少有一个连接
+// Connect every node and wait for the handshakes. With losses connections keep being reset,
+// so only wait until every node has one
+func (s *SimNetwork) mustConnectAll(t *testing.T) {
+	t.Helper()
+
+	if err := s.ConnectAll(); err != nil {
+		t.Fatal(err)
+	}
+	peers := len(s.nodes) - 1
+	if s.dropRate > 0 {
+		peers = 1
+	}
+	if err := s.WaitConnected(simStepTimeout, peers); err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+}
+
+// 让节点i挖count个区块，然后等待给定节点收敛
+// Let node i mine count blocks, then wait for the given nodes to converge
+func (s *SimNetwork) mustMine(t *testing.T, i, count int, nodes ...int) SimChainState {
+	t.Helper()
+
+	if _, err := s.Mine(i, count); err != nil {
+		t.Fatalf("mining on %s: %v", s.nodes[i].Name, err)
+	}
+	state, err := s.WaitConverged(simStepTimeout, nodes...)
+	if err != nil {
+		t.Fatalf("after mining on %s: %v", s.nodes[i].Name, err)
+	}
+
+	return state
+}
+
+func TestSimNetworkConverges(t *testing.T) {
+	sim := NewSimNetwork(t, SimConfig{Nodes: 4, Latency: simDefaultLatency, Jitter: simDefaultJitter, Seed: 1})
+	sim.mustConnectAll(t)
+
+	for i, sn := range sim.Nodes() {
+		state := sim.mustMine(t, i, 1)
+		t.Logf("%s mined block %d, all nodes converged on %x", sn.Name, state.Height, state.Tip)
+	}
+
+	// 每个节点向下一个节点转账，交易被转发到所有交易池后打包
+	// Every node pays the next one, the payments are mined once relayed to every mempool
+	var payments []*Transaction
+	for i := range sim.Nodes() {
+		tx, err := sim.Pay(i, (i+1)%len(sim.Nodes()), simPaymentAmount)
+		if err != nil {
+			t.Fatalf("paying from %s: %v", sim.Node(i).Name, err)
+		}
+		payments = append(payments, tx)
+	}
+	for _, tx := range payments {
+		if err := sim.WaitMempool(simStepTimeout, tx.ID); err != nil {
+			t.Fatalf("relaying: %v", err)
+		}
+	}
+	state := sim.mustMine(t, len(sim.Nodes())-1, 1)
+
+	for _, sn := range sim.Nodes() {
+		for _, tx := range payments {
+			if _, height, err := sn.Chain.FindTransaction(tx.ID); err != nil || height != state.Height {
+				t.Fatalf("payment %x is not confirmed at height %d on %s", tx.ID, state.Height, sn.Name)
+			}
+		}
+		if count := len(sn.Node.MempoolTransactions()); count > 0 {
+			t.Fatalf("%s still has %d transactions in its mempool", sn.Name, count)
+		}
+	}
+}
+
+func TestSimNetworkPartitionHeals(t *testing.T) {
+	sim := NewSimNetwork(t, SimConfig{Nodes: 4, Latency: simDefaultLatency, Jitter: simDefaultJitter, Seed: 2})
+	sim.mustConnectAll(t)
+	sim.mustMine(t, 0, 1)
+
+	// 前一半挖两个区块，后一半挖一个，恢复后所有节点切换到工作量更多的前一半的链
+	// The first half mines two blocks and the second half one, once healed every node
+	// switches to the chain of the first half, which has more work
+	first, second := []int{0, 1}, []int{2, 3}
+	sim.Partition(first, second)
+	winner := sim.mustMine(t, first[0], 2, first...)
+	loser := sim.mustMine(t, second[0], 1, second...)
+	if bytes.Equal(winner.Tip, loser.Tip) {
+		t.Fatal("the halves did not fork")
+	}
+
+	sim.Heal()
+	state, err := sim.WaitConverged(simStepTimeout)
+	if err != nil {
+		t.Fatalf("after healing: %v", err)
+	}
+	if !bytes.Equal(state.Tip, winner.Tip) || !bytes.Equal(state.UTXOSet, winner.UTXOSet) {
+		t.Fatalf("the nodes converged on %x instead of the chain with more work %x", state.Tip, winner.Tip)
+	}
+}
+
+func TestSimNetworkConvergesWithLosses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("lossy network simulation in short mode")
+	}
+	sim := NewSimNetwork(t, SimConfig{Nodes: 3, Latency: simDefaultLatency, Jitter: simDefaultJitter, DropRate: 0.02, Seed: 3})
+	sim.mustConnectAll(t)
+
+	for i := range sim.Nodes() {
+		sim.mustMine(t, i, 2)
+	}
+}
+
+func TestSimNetworkKeepsMaturityParam(t *testing.T) {
+	sim := NewSimNetwork(t, SimConfig{Nodes: 1, Params: ChainParams{CoinbaseMaturity: 5}})
+
+	for _, sn := range sim.Nodes() {
+		if sn.Chain.params.CoinbaseMaturity != 5 {
+			t.Fatalf("%s has coinbase maturity %d", sn.Name, sn.Chain.params.CoinbaseMaturity)
+		}
+	}
+	if DefaultChainParams().CoinbaseMaturity != defaultCoinbaseMaturity {
+		t.Fatal("the simulated network changed the default chain parameters")
+	}
+}
@@ -0,0 +1,742 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// 未花费输出集合快照的文件格式：文件头(魔数和版本)，区块头数量(4字节大端)和从创世区块开始的
+// 每个区块头(长度 | gob编码的BlockHeader)，链末端区块(长度 | 序列化的区块)，输出数量(8字节大端)，
+// 之后是按键排序的输出记录。承诺值是链末端区块哈希和所有输出记录的SHA-256，
+// 输出记录的编码是固定的，与gob编码无关
+// File format of a UTXO set snapshot: a header (magic and version), the number of headers
+// (4 bytes big endian) and every block header starting with the genesis block
+// (length | gob encoded BlockHeader), the tip block (length | serialized block), the number of
+// outputs (8 bytes big endian) followed by the output records sorted by key.
+// The commitment is the SHA-256 of the tip block hash and all output records, the records
+// have a fixed encoding that does not depend on gob
+const (
+	snapshotFileMagic   = "COINUTXO"
+	snapshotFileVersion = 2
+
+	snapshotKeySize       = 32 + 4 // 交易ID | 输出序号 txid | index
+	maxSnapshotHeaderSize = 4 << 10
+	maxSnapshotScriptSize = 1 << 20
+)
+
+// 元数据中快照的键
+// Keys of the snapshot in the metadata
+const (
+	snapshotHeightKey     = "snapshotheight"
+	snapshotCommitmentKey = "snapshotcommitment"
+	snapshotStateKey      = "snapshotstate"
+)
+
+// 从快照启动的节点中快照的验证状态
+// Validation state of the snapshot of a node started from a snapshot
+const (
+	snapshotUnvalidated = iota // 历史区块尚未验证 the historical blocks are not validated yet
+	snapshotValid              // 重放历史区块得到相同的承诺值 replaying the historical blocks gave the same commitment
+	snapshotInvalid            // 重放历史区块得到不同的承诺值 replaying the historical blocks gave a different commitment
+)
+
+var snapshotStateNames = []string{"unvalidated", "valid", "invalid"}
+
+// 验证状态的名称，元数据中的值损坏时也不会越界
+// Name of a validation state, staying in bounds when the value in the metadata is corrupt
+func snapshotStateName(state int) string {
+	if state < 0 || state >= len(snapshotStateNames) {
+		return fmt.Sprintf("unknown (%d)", state)
+	}
+
+	return snapshotStateNames[state]
+}
+
+// 快照没有通过验证，建立在它上面的链不可信
+// The snapshot failed validation, the chain built on it cannot be trusted
+var errInvalidSnapshot = errors.New("the snapshot failed validation, run validatesnapshot -blocks FILE to fall back to the fully validated chain")
+
+// 快照的概要
+// Summary of a snapshot
+type SnapshotInfo struct {
+	Height     int
+	Tip        []byte
+	Outputs    int
+	Commitment []byte
+}
+
+// 输出记录：交易ID | 输出序号(4字节) | 金额(8字节) | 区块高度(4字节) | 区块时间(8字节) |
+// 是否挖矿奖励(1字节) | 脚本长度(4字节) | 脚本
+// Output record: txid | index(4 bytes) | value(8 bytes) | block height(4 bytes) |
+// block time(8 bytes) | coinbase(1 byte) | script length(4 bytes) | script
+func encodeSnapshotRecord(key []byte, entry *utxoEntry) []byte {
+	var buf bytes.Buffer
+	buf.Write(key)
+	binary.Write(&buf, binary.BigEndian, int64(entry.Output.Value))
+	binary.Write(&buf, binary.BigEndian, uint32(entry.Height))
+	binary.Write(&buf, binary.BigEndian, entry.Time)
+	if entry.Coinbase {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(len(entry.Output.ScriptPubKey)))
+	buf.Write(entry.Output.ScriptPubKey)
+
+	return buf.Bytes()
+}
+
+// 读取下一个输出记录，同时返回记录的原始数据用于计算承诺值
+// Read the next output record, its raw data is returned too for computing the commitment
+func readSnapshotRecord(r io.Reader) ([]byte, *utxoEntry, []byte, error) {
+	fixed := make([]byte, snapshotKeySize+8+4+8+1+4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, nil, nil, err
+	}
+	key := fixed[:snapshotKeySize]
+	fields := fixed[snapshotKeySize:]
+
+	entry := &utxoEntry{
+		Output:   TXOutput{Value: int(int64(binary.BigEndian.Uint64(fields[0:8])))},
+		Height:   int(binary.BigEndian.Uint32(fields[8:12])),
+		Time:     int64(binary.BigEndian.Uint64(fields[12:20])),
+		Coinbase: fields[20] == 1,
+	}
+	if fields[20] > 1 {
+		return nil, nil, nil, fmt.Errorf("invalid coinbase flag %d", fields[20])
+	}
+	size := binary.BigEndian.Uint32(fields[21:25])
+	if size > maxSnapshotScriptSize {
+		return nil, nil, nil, fmt.Errorf("invalid script length %d", size)
+	}
+	entry.Output.ScriptPubKey = make([]byte, size)
+	if _, err := io.ReadFull(r, entry.Output.ScriptPubKey); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return key, entry, append(fixed, entry.Output.ScriptPubKey...), nil
+}
+
+// 写入一项 长度(4字节大端) | 数据
+// Write an item as length(4 bytes big endian) | data
+func writeSnapshotItem(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+
+	return err
+}
+
+func readSnapshotItem(r io.Reader, maxSize uint32) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size == 0 || size > maxSize {
+		return nil, fmt.Errorf("invalid item length %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// 按键的顺序遍历未花费输出集合
+// Walk the UTXO set in key order
+func forEachUTXO(tx *bolt.Tx, fn func(key []byte, entry *utxoEntry) error) error {
+	root := tx.Bucket([]byte(utxoSetBucket))
+	if root == nil {
+		return fmt.Errorf("the UTXO set is not enabled, build it with 'reindex -utxo'")
+	}
+	utxos := root.Bucket([]byte(utxoSubBucket))
+	if utxos == nil {
+		return nil
+	}
+
+	return utxos.ForEach(func(k, v []byte) error {
+		if len(k) != snapshotKeySize {
+			return fmt.Errorf("UTXO set key %x has an unexpected length", k)
+		}
+		var entry utxoEntry
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&entry); err != nil {
+			return err
+		}
+
+		return fn(k, &entry)
+	})
+}
+
+// 新的承诺值哈希，先写入链末端区块哈希
+// New commitment hash, starting with the tip block hash
+func newSnapshotHash(tip []byte) hash.Hash {
+	h := sha256.New()
+	h.Write(tip)
+
+	return h
+}
+
+// 在事务中计算当前链末端的未花费输出集合的承诺值
+// Compute the commitment of the UTXO set at the current tip within the transaction
+func utxoSetCommitment(tx *bolt.Tx) (*SnapshotInfo, error) {
+	tip := chainTip(tx)
+	header, err := readBlockHeader(tx.Bucket([]byte(headersBucket)), tip)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SnapshotInfo{Height: header.Height, Tip: tip}
+	h := newSnapshotHash(tip)
+	err = forEachUTXO(tx, func(key []byte, entry *utxoEntry) error {
+		h.Write(encodeSnapshotRecord(key, entry))
+		info.Outputs++
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.Commitment = h.Sum(nil)
+
+	return info, nil
+}
+
+// 把当前链末端的未花费输出集合写入快照，返回快照的概要
+// Write the UTXO set at the current tip to a snapshot, returns the summary of the snapshot
+func (bc *BlockChain) DumpUTXOSet(w io.Writer) (*SnapshotInfo, error) {
+	bw := bufio.NewWriter(w)
+	var info *SnapshotInfo
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(blocksBucket))
+		headersBkt := tx.Bucket([]byte(headersBucket))
+		tip := chainTip(tx)
+
+		// 从链末端沿区块头回到创世区块，修剪过的链也有所有区块头
+		// Walk the headers from the tip back to the genesis block, a pruned chain has every header too
+		var headers []*ChainHeader
+		for hash := tip; len(hash) > 0; {
+			header, err := readBlockHeader(headersBkt, hash)
+			if err != nil {
+				return err
+			}
+			headers = append([]*ChainHeader{header}, headers...)
+			hash = header.PrevBlockHash
+		}
+		tipBlock, err := DeserializeBlock(blocks.Get(tip))
+		if err != nil {
+			return err
+		}
+		root := tx.Bucket([]byte(utxoSetBucket))
+		if root == nil {
+			return fmt.Errorf("the UTXO set is not enabled, build it with 'reindex -utxo'")
+		}
+		count := 0
+		if utxos := root.Bucket([]byte(utxoSubBucket)); utxos != nil {
+			count = utxos.Stats().KeyN
+		}
+
+		if _, err := bw.WriteString(snapshotFileMagic); err != nil {
+			return err
+		}
+		if err := bw.WriteByte(snapshotFileVersion); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.BigEndian, uint32(len(headers))); err != nil {
+			return err
+		}
+		for _, header := range headers {
+			data, err := gobEncode(header.BlockHeader)
+			if err != nil {
+				return err
+			}
+			if err := writeSnapshotItem(bw, data); err != nil {
+				return err
+			}
+		}
+		if err := writeSnapshotItem(bw, tipBlock.Serialize()); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.BigEndian, uint64(count)); err != nil {
+			return err
+		}
+
+		info = &SnapshotInfo{Height: tipBlock.Height, Tip: tip}
+		h := newSnapshotHash(tip)
+		err = forEachUTXO(tx, func(key []byte, entry *utxoEntry) error {
+			record := encodeSnapshotRecord(key, entry)
+			h.Write(record)
+			info.Outputs++
+			_, err := bw.Write(record)
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if info.Outputs != count {
+			return fmt.Errorf("UTXO set has %d outputs, expected %d", info.Outputs, count)
+		}
+		info.Commitment = h.Sum(nil)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, bw.Flush()
+}
+
+// 读取并验证快照中的区块头和链末端区块：区块头从创世区块开始相连并满足工作量证明，
+// 链末端区块与最后一个区块头相符
+// Read and validate the headers and the tip block of a snapshot: the headers link up from
+// the genesis block and satisfy the proof of work, the tip block matches the last header
+func readSnapshotChain(r io.Reader) ([]*ChainHeader, *Block, error) {
+	magic := make([]byte, len(snapshotFileMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, nil, fmt.Errorf("reading snapshot header: %v", err)
+	}
+	if !bytes.Equal(magic[:len(snapshotFileMagic)], []byte(snapshotFileMagic)) {
+		return nil, nil, fmt.Errorf("not a UTXO snapshot file")
+	}
+	if magic[len(snapshotFileMagic)] != snapshotFileVersion {
+		return nil, nil, fmt.Errorf("unsupported snapshot version %d", magic[len(snapshotFileMagic)])
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, nil, fmt.Errorf("reading header count: %v", err)
+	}
+	if count == 0 {
+		return nil, nil, fmt.Errorf("snapshot has no headers")
+	}
+
+	var headers []*ChainHeader
+	for i := 0; i < int(count); i++ {
+		data, err := readSnapshotItem(r, maxSnapshotHeaderSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("header %d: %v", i, err)
+		}
+		var header BlockHeader
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&header); err != nil {
+			return nil, nil, fmt.Errorf("header %d: %v", i, err)
+		}
+		if err := header.validate(); err != nil {
+			return nil, nil, fmt.Errorf("header %d: %v", i, err)
+		}
+		var prev []byte
+		if i > 0 {
+			prev = headers[i-1].Hash
+		}
+		if !bytes.Equal(header.PrevBlockHash, prev) {
+			return nil, nil, fmt.Errorf("header %d does not extend the previous header", i)
+		}
+		headers = append(headers, &ChainHeader{header, header.BlockHash(), i})
+	}
+
+	data, err := readSnapshotItem(r, maxChainFileBlockSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading tip block: %v", err)
+	}
+	tip, err := DeserializeBlock(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tip block: %v", err)
+	}
+	for _, tx := range tip.Transactions {
+		if !bytes.Equal(tx.Hash(), tx.ID) {
+			return nil, nil, fmt.Errorf("tip block: transaction %x does not match its ID", tx.ID)
+		}
+	}
+	if err := tip.checkHeader(); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(tip.Header().Serialize(), headers[len(headers)-1].Serialize()) {
+		return nil, nil, fmt.Errorf("tip block %x does not match the last header", tip.Hash)
+	}
+
+	return headers, tip, nil
+}
+
+// 从快照创建新的区块链数据库：只有在快照的承诺值等于commitment时才接受它。
+// 链末端以下的区块只有区块头，在历史区块被验证之前就像被修剪了一样
+// Create a new blockchain database from a snapshot: it is only accepted when the commitment
+// of the snapshot equals commitment. Blocks below the tip only have their headers, like pruned
+// blocks, until the historical blocks are validated
+func LoadUTXOSnapshot(r io.Reader, commitment []byte) (*BlockChain, *SnapshotInfo, error) {
+	if dbExists() {
+		return nil, nil, fmt.Errorf("blockchain already exists, loading a snapshot needs a fresh data directory")
+	}
+
+	br := bufio.NewReader(r)
+	headers, tip, err := readSnapshotChain(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	var count uint64
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+		return nil, nil, fmt.Errorf("reading output count: %v", err)
+	}
+
+	db, err := bolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &SnapshotInfo{Height: tip.Height, Tip: tip.Hash, Outputs: int(count)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		blocks, err := tx.CreateBucket([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+		if err := blocks.Put(tip.Hash, tip.Serialize()); err != nil {
+			return err
+		}
+		if err := putChainTip(tx, tip.Hash); err != nil {
+			return err
+		}
+		headersBkt, err := tx.CreateBucket([]byte(headersBucket))
+		if err != nil {
+			return err
+		}
+		for _, header := range headers {
+			if err := headersBkt.Put(header.Hash, header.Serialize()); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte(txIndexBucket)); err != nil {
+			return err
+		}
+		if err := (txIndexer{}).ConnectBlock(tx, tip, nil); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucket([]byte(utxoSetBucket)); err != nil {
+			return err
+		}
+		utxos, _, err := (utxoIndexer{}).buckets(tx)
+		if err != nil {
+			return err
+		}
+		h := newSnapshotHash(tip.Hash)
+		var prevKey []byte
+		for i := uint64(0); i < count; i++ {
+			key, entry, record, err := readSnapshotRecord(br)
+			if err != nil {
+				return fmt.Errorf("output %d: %v", i, err)
+			}
+			if bytes.Compare(key, prevKey) <= 0 {
+				return fmt.Errorf("output %d: outputs are not sorted", i)
+			}
+			prevKey = key
+			h.Write(record)
+
+			data, err := gobEncode(*entry)
+			if err != nil {
+				return err
+			}
+			if err := utxos.Put(key, data); err != nil {
+				return err
+			}
+		}
+		if _, err := br.ReadByte(); err != io.EOF {
+			return fmt.Errorf("unexpected data after the last output")
+		}
+
+		info.Commitment = h.Sum(nil)
+		if !bytes.Equal(info.Commitment, commitment) {
+			return fmt.Errorf("snapshot commitment %x does not match the expected commitment %x", info.Commitment, commitment)
+		}
+
+		// 链末端以下的区块尚不可用
+		// The blocks below the tip are not available yet
+		if err := putMetaInt(tx, pruneHeightKey, tip.Height); err != nil {
+			return err
+		}
+		if err := putMetaInt(tx, snapshotHeightKey, tip.Height); err != nil {
+			return err
+		}
+		if err := putMetaInt(tx, snapshotStateKey, snapshotUnvalidated); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(metaBucket)).Put([]byte(snapshotCommitmentKey), info.Commitment); err != nil {
+			return err
+		}
+
+		return setSchemaVersion(tx, currentSchemaVersion)
+	})
+	if err != nil {
+		db.Close()
+		os.Remove(dbFile)
+		return nil, nil, err
+	}
+
+	return &BlockChain{tip: tip.Hash, db: db, events: NewEventBus(), params: DefaultChainParams()}, info, nil
+}
+
+// 快照的验证状态
+// Validation state of the snapshot
+type SnapshotStatus struct {
+	Height          int    `json:"height"`
+	Commitment      string `json:"commitment"`
+	State           string `json:"state"`
+	ValidatedHeight int    `json:"validatedHeight"`
+	Error           string `json:"error,omitempty"`
+}
+
+// 节点从快照启动时返回快照的验证状态，否则ok为false
+// The validation state of the snapshot when the node was started from one, otherwise ok is false
+func (bc *BlockChain) SnapshotStatus() (status SnapshotStatus, ok bool) {
+	bc.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte(metaBucket))
+		if meta == nil || meta.Get([]byte(snapshotCommitmentKey)) == nil {
+			return nil
+		}
+		ok = true
+		status.Height = metaInt(tx, snapshotHeightKey)
+		status.Commitment = fmt.Sprintf("%x", meta.Get([]byte(snapshotCommitmentKey)))
+		status.State = snapshotStateName(metaInt(tx, snapshotStateKey))
+		if metaInt(tx, snapshotStateKey) == snapshotValid {
+			status.ValidatedHeight = status.Height
+		}
+
+		return nil
+	})
+
+	return status, ok
+}
+
+// 快照没有通过验证时返回errInvalidSnapshot：不能在这条链上挖矿，也不能把它的数据提供给其他人。
+// 未知的状态同样当作无效
+// Returns errInvalidSnapshot when the snapshot failed validation: nothing can be mined on the
+// chain and none of its data can be served. An unknown state counts as invalid too
+func (bc *BlockChain) checkSnapshot() error {
+	status, ok := bc.SnapshotStatus()
+	if ok && status.State != snapshotStateNames[snapshotUnvalidated] && status.State != snapshotStateNames[snapshotValid] {
+		return errInvalidSnapshot
+	}
+
+	return nil
+}
+
+// 用path上的数据库替换区块链的数据库：path上的文件被移动到当前数据库的位置后重新打开
+// Replace the database of the blockchain with the one at path: the file at path is moved to
+// where the current database is and opened there
+func (bc *BlockChain) replaceDB(path string) error {
+	current := bc.db.Path()
+	if err := bc.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path, current); err != nil {
+		if db, reopenErr := bolt.Open(current, 0600, nil); reopenErr == nil {
+			bc.db = db
+		}
+		return err
+	}
+
+	chain, err := openBlockChain(current, bc.params, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	bc.db, bc.tip = chain.db, chain.tip
+
+	return nil
+}
+
+// 在后台验证快照：从链文件读取历史区块，在单独的数据库中从创世区块开始完整验证并连接它们，
+// 到达快照高度后比较未花费输出集合的承诺值。验证期间节点照常使用快照。承诺值不同时快照被标记为
+// 无效，区块链切换到验证过的链，快照之后的区块都被丢弃
+// Validates a snapshot in the background: reads the historical blocks from a chain file,
+// fully validates and connects them from the genesis block in a separate database and
+// compares the commitment of the UTXO set once the snapshot height is reached.
+// The node keeps using the snapshot while validating. When the commitments differ the snapshot
+// is marked invalid and the blockchain switches to the validated chain, dropping every block
+// after the snapshot
+type SnapshotValidator struct {
+	bc   *BlockChain
+	file string
+	path string // 验证用的数据库 database used for validating
+
+	// 在独占区块链期间执行切换到验证过的链，为nil时直接执行
+	// Runs the switch to the validated chain with exclusive use of the blockchain, run directly when nil
+	exclusive func(fallBack func() error) error
+
+	mu     sync.Mutex
+	status SnapshotStatus
+	err    error
+	done   chan struct{}
+}
+
+func NewSnapshotValidator(bc *BlockChain, chainFile string) (*SnapshotValidator, error) {
+	status, ok := bc.SnapshotStatus()
+	if !ok {
+		return nil, fmt.Errorf("the blockchain was not loaded from a snapshot")
+	}
+	if status.State == snapshotStateNames[snapshotValid] {
+		return nil, fmt.Errorf("the snapshot has already been validated")
+	}
+
+	return &SnapshotValidator{bc: bc, file: chainFile, path: bc.db.Path() + ".validate", status: status, done: make(chan struct{})}, nil
+}
+
+// 在新的goroutine中开始验证
+// Start validating in a new goroutine
+func (v *SnapshotValidator) Start() {
+	go func() {
+		err := v.run()
+
+		v.mu.Lock()
+		v.err = err
+		if err != nil {
+			v.status.Error = err.Error()
+		}
+		v.mu.Unlock()
+		close(v.done)
+	}()
+}
+
+// 等待验证结束，返回验证的错误
+// Wait for the validation to finish, returns its error
+func (v *SnapshotValidator) Wait() error {
+	<-v.done
+
+	return v.err
+}
+
+// 当前的验证状态
+// The current validation state
+func (v *SnapshotValidator) Status() SnapshotStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.status
+}
+
+func (v *SnapshotValidator) setState(state int) error {
+	v.mu.Lock()
+	v.status.State = snapshotStateName(state)
+	v.mu.Unlock()
+
+	return v.bc.db.Update(func(tx *bolt.Tx) error {
+		return putMetaInt(tx, snapshotStateKey, state)
+	})
+}
+
+func (v *SnapshotValidator) run() error {
+	// 快照链上每个高度的区块哈希，链文件中的区块必须与它们相同
+	// Block hash of every height of the snapshot chain, the blocks of the chain file must match them
+	var hashes [][]byte
+	err := v.bc.db.View(func(tx *bolt.Tx) error {
+		headers := tx.Bucket([]byte(headersBucket))
+		hash := chainTip(tx)
+		for len(hash) > 0 {
+			header, err := readBlockHeader(headers, hash)
+			if err != nil {
+				return err
+			}
+			if header.Height <= v.status.Height {
+				hashes = append([][]byte{header.Hash}, hashes...)
+			}
+			hash = header.PrevBlockHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(v.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if err := readChainFileHeader(br); err != nil {
+		return err
+	}
+	genesis, err := readChainFileGenesis(br)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(genesis.Hash, hashes[0]) {
+		return fmt.Errorf("the chain file starts with genesis block %x, the snapshot chain with %x", genesis.Hash, hashes[0])
+	}
+
+	os.Remove(v.path)
+	chain, err := createBlockchainDB(v.path, genesis, v.bc.params)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(v.path)
+	defer chain.DbClose()
+
+	for height := 1; height <= v.status.Height; height++ {
+		block, err := readChainFileBlock(br)
+		if err == io.EOF {
+			return fmt.Errorf("the chain file ends at height %d, below the snapshot height %d", height-1, v.status.Height)
+		}
+		if err != nil {
+			return fmt.Errorf("block %d: %v", height, err)
+		}
+		if !bytes.Equal(block.Hash, hashes[height]) {
+			return fmt.Errorf("block %d of the chain file is %x, the snapshot chain has %x", height, block.Hash, hashes[height])
+		}
+		if err := chain.AddBlock(block); err != nil {
+			return fmt.Errorf("block %d: %v", height, err)
+		}
+
+		v.mu.Lock()
+		v.status.ValidatedHeight = height
+		v.mu.Unlock()
+	}
+
+	var info *SnapshotInfo
+	err = chain.db.View(func(tx *bolt.Tx) error {
+		info, err = utxoSetCommitment(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if fmt.Sprintf("%x", info.Commitment) != v.status.Commitment {
+		if err := v.setState(snapshotInvalid); err != nil {
+			return err
+		}
+		mismatch := fmt.Errorf("the validated chain has UTXO commitment %x, the snapshot has %s", info.Commitment, v.status.Commitment)
+		if err := v.fallBack(chain); err != nil {
+			return fmt.Errorf("%v; switching to the validated chain: %v", mismatch, err)
+		}
+		return fmt.Errorf("%v; switched to the validated chain at height %d", mismatch, v.status.Height)
+	}
+
+	return v.setState(snapshotValid)
+}
+
+// 快照无效：关闭验证过的链，用它替换快照的链
+// The snapshot is invalid: close the validated chain and replace the chain of the snapshot with it
+func (v *SnapshotValidator) fallBack(chain *BlockChain) error {
+	path := chain.db.Path()
+	chain.DbClose()
+
+	fallBack := func() error { return v.bc.replaceDB(path) }
+	if v.exclusive != nil {
+		return v.exclusive(fallBack)
+	}
+
+	return fallBack()
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// 把链标记为从height处的快照启动
+// Mark the chain as started from a snapshot at height
+func markTestSnapshot(t *testing.T, bc *BlockChain, height int, commitment []byte, state int) {
+	t.Helper()
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		if err := putMetaInt(tx, snapshotHeightKey, height); err != nil {
+			return err
+		}
+		if err := putMetaInt(tx, snapshotStateKey, state); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte(metaBucket)).Put([]byte(snapshotCommitmentKey), commitment)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exportTestChain(t *testing.T, bc *BlockChain) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "chain.dat")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := bc.ExportChain(f); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// 一条4个区块的链，快照在高度2，返回快照处未花费输出集合的承诺值和快照的区块
+// A chain of 4 blocks with the snapshot at height 2, returns the commitment of the UTXO set at
+// the snapshot and the snapshot block
+func newSnapshotTestChain(t *testing.T) (*BlockChain, []byte, *Block) {
+	t.Helper()
+
+	bc, wallet := newTestChain(t, testChainParams())
+	mineTestBlock(t, bc, wallet.GetAddress())
+	snapshot := mineTestBlock(t, bc, wallet.GetAddress())
+	var info *SnapshotInfo
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = utxoSetCommitment(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, wallet.GetAddress())
+
+	return bc, info.Commitment, snapshot
+}
+
+func TestSnapshotValidatorAcceptsMatchingCommitment(t *testing.T) {
+	bc, commitment, _ := newSnapshotTestChain(t)
+	tip := bc.tip
+	markTestSnapshot(t, bc, 2, commitment, snapshotUnvalidated)
+
+	v, err := NewSnapshotValidator(bc, exportTestChain(t, bc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Start()
+	if err := v.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := bc.SnapshotStatus(); status.State != "valid" {
+		t.Fatalf("snapshot state is %s, expected valid", status.State)
+	}
+	if !bytes.Equal(bc.tip, tip) {
+		t.Fatalf("tip moved to %x", bc.tip)
+	}
+}
+
+// 承诺值不同时快照被标记为无效，区块链切换到验证过的链
+// With a different commitment the snapshot is marked invalid and the blockchain switches to the validated chain
+func TestSnapshotValidatorFallsBackToValidatedChain(t *testing.T) {
+	bc, _, snapshot := newSnapshotTestChain(t)
+	markTestSnapshot(t, bc, 2, sha256Bytes([]byte("wrong commitment")), snapshotUnvalidated)
+
+	v, err := NewSnapshotValidator(bc, exportTestChain(t, bc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Start()
+	if err := v.Wait(); err == nil {
+		t.Fatal("a snapshot with a wrong commitment was validated")
+	}
+	if state := v.Status().State; state != "invalid" {
+		t.Fatalf("validator state is %s, expected invalid", state)
+	}
+
+	// 快照之后的区块被丢弃，链回到验证到的快照高度
+	// The blocks after the snapshot are dropped, the chain is back at the validated snapshot height
+	if !bytes.Equal(bc.tip, snapshot.Hash) {
+		t.Fatalf("tip is %x, expected the snapshot block %x", bc.tip, snapshot.Hash)
+	}
+	if _, ok := bc.SnapshotStatus(); ok {
+		t.Fatal("the chain still uses the snapshot")
+	}
+	if err := bc.checkSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(bc.db.Path() + ".validate"); !os.IsNotExist(err) {
+		t.Fatalf("the validation database was left behind: %v", err)
+	}
+	mineTestBlock(t, bc, NewWallet().GetAddress())
+}
+
+func TestInvalidSnapshotStopsMiningAndServing(t *testing.T) {
+	bc, commitment, _ := newSnapshotTestChain(t)
+	markTestSnapshot(t, bc, 2, commitment, snapshotInvalid)
+
+	if _, err := bc.MineBlock([]*Transaction{NewCoinbaseTransaction(NewWallet().GetAddress(), "")}); !errors.Is(err, errInvalidSnapshot) {
+		t.Fatalf("mining on an invalid snapshot: %v", err)
+	}
+	if _, err := NewNode(bc, ioutil.Discard); !errors.Is(err, errInvalidSnapshot) {
+		t.Fatalf("starting a node on an invalid snapshot: %v", err)
+	}
+
+	server := httptest.NewServer(NewRESTServer(bc).Handler())
+	defer server.Close()
+	for path, expected := range map[string]int{"/blocks/": http.StatusServiceUnavailable, "/snapshot": http.StatusOK} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("GET %s: status %d, expected %d", path, resp.StatusCode, expected)
+		}
+	}
+}
+
+func TestSnapshotStatusWithUnknownState(t *testing.T) {
+	bc, commitment, _ := newSnapshotTestChain(t)
+	markTestSnapshot(t, bc, 2, commitment, 7)
+
+	status, ok := bc.SnapshotStatus()
+	if !ok || status.State != "unknown (7)" {
+		t.Fatalf("snapshot state is %q, expected unknown (7)", status.State)
+	}
+	if err := bc.checkSnapshot(); !errors.Is(err, errInvalidSnapshot) {
+		t.Fatalf("an unknown snapshot state is accepted: %v", err)
+	}
+}
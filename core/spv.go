@@ -0,0 +1,697 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// 元数据中轻节点监视的地址的键，地址改变时要重新过滤所有区块
+// Key of the addresses watched by the light client in the metadata, every block is filtered
+// again when they change
+const watchedAddressesKey = "watchedaddresses"
+
+// 轻节点等待一条消息的超时
+// Timeout of the light client waiting for a message
+const lightClientReadTimeout = time.Minute
+
+// 完整节点为轻节点过滤区块：支付到过滤器中地址的交易匹配，匹配交易的输出加入过滤器，
+// 之后花费这些输出的交易也会匹配
+// A full node filters blocks for a light client: transactions paying to an address of the
+// filter match, the outputs of matching transactions are added to the filter so the
+// transactions spending them later match too
+type addressFilter struct {
+	addresses map[string]bool
+	outpoints map[string]bool
+}
+
+func newAddressFilter(addresses []string, outpoints []Outpoint) *addressFilter {
+	f := &addressFilter{make(map[string]bool), make(map[string]bool)}
+	for _, address := range addresses {
+		f.addresses[address] = true
+	}
+	for _, outpoint := range outpoints {
+		f.outpoints[outpoint.String()] = true
+	}
+
+	return f
+}
+
+func (f *addressFilter) match(tx *Transaction) bool {
+	matched := false
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Vin {
+			if f.outpoints[outpointKey(in.Txid, in.Vout)] {
+				matched = true
+			}
+		}
+	}
+	for i, out := range tx.Vout {
+		if address, ok := ExtractAddress(out.ScriptPubKey); ok && f.addresses[address] {
+			f.outpoints[outpointKey(tx.ID, i)] = true
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// 过滤区块：区块头、交易数和匹配的交易及其证明
+// Filter a block: the header, the number of transactions and the matching transactions with their proofs
+func (f *addressFilter) filterBlock(block *Block) merkleBlockMsg {
+	msg := merkleBlockMsg{Header: block.BlockHeader, TxCount: len(block.Transactions)}
+	for i, tx := range block.Transactions {
+		if f.match(tx) {
+			msg.Matches = append(msg.Matches, txProof{*tx, i, block.TxProof(i)})
+		}
+	}
+
+	return msg
+}
+
+// 证明包含在区块中的交易
+// A transaction proven to be included in a block
+type provenTx struct {
+	BlockHash []byte
+	Height    int
+	Tx        Transaction
+}
+
+// 轻节点(SPV)：只保存区块头，从完整节点请求按钱包地址过滤的区块，根据区块头中的
+// Merkle根验证匹配的交易确实包含在区块中，再用这些交易计算余额
+// Light client (SPV): stores only headers, asks a full node for blocks filtered by the wallet
+// addresses, verifies against the Merkle roots of the headers that the matching transactions
+// are included in the blocks and computes the balances from those transactions
+type LightClient struct {
+	db  *bolt.DB
+	log io.Writer
+}
+
+// 打开轻节点的数据库，不存在时创建
+// Open the database of the light client, it is created when missing
+func OpenLightClient(log io.Writer) (*LightClient, error) {
+	db, err := bolt.Open(lightDBFile, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{headersBucket, metaBucket, provenTxBucket, scannedBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &LightClient{db, log}, nil
+}
+
+func (c *LightClient) Close() {
+	c.db.Close()
+}
+
+func (c *LightClient) logf(format string, args ...interface{}) {
+	fmt.Fprintf(c.log, format+"\n", args...)
+}
+
+// 最佳区块头，还没有同步过时为nil
+// The best header, nil before the first sync
+func (c *LightClient) BestHeader() (*ChainHeader, error) {
+	var best *ChainHeader
+	err := c.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(metaBucket)).Get([]byte(bestHeaderKey)) == nil {
+			return nil
+		}
+		var err error
+		best, err = readBestHeader(tx)
+
+		return err
+	})
+
+	return best, err
+}
+
+// 最佳区块头链，下标为区块高度
+// The best header chain, indexed by height
+func readBestHeaderChain(tx *bolt.Tx) ([]*ChainHeader, error) {
+	best, err := readBestHeader(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return readHeaderChain(tx.Bucket([]byte(headersBucket)), best)
+}
+
+// 与完整节点同步：下载并验证区块头，再过滤还没有过滤过的区块，useCFilters为true时在本地匹配
+// 紧凑区块过滤器，否则让完整节点按地址过滤。第一次同步时必须给出创世区块哈希，之后使用保存的
+// 创世区块
+// Sync with a full node: download and verify the headers, then filter the blocks that have not
+// been filtered yet, matching compact block filters locally when useCFilters is true and letting
+// the full node filter by address otherwise. The genesis hash must be given for the first sync,
+// later syncs use the stored genesis block
+func (c *LightClient) Sync(addr string, genesis []byte, addresses []string, useCFilters bool) error {
+	best, err := c.BestHeader()
+	if err != nil {
+		return err
+	}
+	height := 0
+	if best != nil {
+		var stored []byte
+		err := c.db.View(func(tx *bolt.Tx) error {
+			chain, err := readBestHeaderChain(tx)
+			if err != nil {
+				return err
+			}
+			stored = chain[0].Hash
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if genesis != nil && !bytes.Equal(genesis, stored) {
+			return fmt.Errorf("the light client follows the chain with genesis block %x", stored)
+		}
+		genesis = stored
+		height = best.Height
+	} else if genesis == nil {
+		return errors.New("the genesis block hash is needed for the first sync")
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := c.send(conn, cmdVersion, versionMsg{protocolVersion, genesis, height, 0, 0, 0}); err != nil {
+		return err
+	}
+	var version versionMsg
+	if err := c.receive(conn, cmdVersion, &version); err != nil {
+		return err
+	}
+	if version.Version != protocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", version.Version)
+	}
+	if !bytes.Equal(version.Genesis, genesis) {
+		return fmt.Errorf("peer is on another chain with genesis block %x", version.Genesis)
+	}
+	if version.Services&serviceNetwork == 0 {
+		return errors.New("peer does not serve blocks")
+	}
+	if useCFilters && version.Services&serviceCompactFilters == 0 {
+		return errors.New("peer does not serve compact block filters")
+	}
+	if err := c.send(conn, cmdVerack, nil); err != nil {
+		return err
+	}
+
+	if best == nil {
+		if err := c.fetchGenesis(conn, genesis); err != nil {
+			return err
+		}
+	}
+	if err := c.syncHeaders(conn); err != nil {
+		return err
+	}
+
+	if useCFilters {
+		return c.scanCFilters(conn, addresses)
+	}
+
+	return c.scanBlocks(conn, addresses)
+}
+
+func (c *LightClient) send(conn net.Conn, command string, payload interface{}) error {
+	msg, err := encodeMessage(command, payload)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(peerWriteTimeout))
+	_, err = conn.Write(msg)
+
+	return err
+}
+
+// 读取消息直到收到commands中的一个，其他消息(例如新区块的通知)被忽略。返回收到的命令
+// Read messages until one of commands arrives, other messages (announcements of new blocks
+// for example) are ignored. Returns the command received
+func (c *LightClient) receiveAny(conn net.Conn, commands []string, payloads []interface{}) (string, error) {
+	for {
+		conn.SetReadDeadline(time.Now().Add(lightClientReadTimeout))
+		command, payload, err := readMessage(conn)
+		if err != nil {
+			return "", err
+		}
+		for i, expected := range commands {
+			if command == expected {
+				return command, decodePayload(payload, payloads[i])
+			}
+		}
+	}
+}
+
+func (c *LightClient) receive(conn net.Conn, command string, payload interface{}) error {
+	_, err := c.receiveAny(conn, []string{command}, []interface{}{payload})
+
+	return err
+}
+
+// 下载创世区块，验证它的哈希和工作量证明后保存区块头
+// Download the genesis block, its header is stored after checking its hash and proof of work
+func (c *LightClient) fetchGenesis(conn net.Conn, genesis []byte) error {
+	if err := c.send(conn, cmdGetData, getDataMsg{[]invVect{{invBlock, genesis}}}); err != nil {
+		return err
+	}
+	var msg blockMsg
+	if err := c.receive(conn, cmdBlock, &msg); err != nil {
+		return err
+	}
+	block, err := DeserializeBlock(msg.Block)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.Hash, genesis) || len(block.PrevBlockHash) != 0 {
+		return fmt.Errorf("peer sent block %x instead of the genesis block", block.Hash)
+	}
+	if err := block.checkHeader(); err != nil {
+		return fmt.Errorf("genesis block: %v", err)
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		header := block.Header()
+		if err := tx.Bucket([]byte(headersBucket)).Put(header.Hash, header.Serialize()); err != nil {
+			return err
+		}
+
+		return putBestHeader(tx, header.Hash)
+	})
+}
+
+// 下载区块头直到对方没有更多区块头，每个区块头都验证工作量证明
+// Download headers until the peer has no more, the proof of work of every header is checked
+func (c *LightClient) syncHeaders(conn net.Conn) error {
+	for {
+		var locator [][]byte
+		err := c.db.View(func(tx *bolt.Tx) error {
+			var err error
+			locator, err = headerLocator(tx, nil)
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.send(conn, cmdGetHeaders, getHeadersMsg{Locator: locator}); err != nil {
+			return err
+		}
+
+		var msg headersMsg
+		if err := c.receive(conn, cmdHeaders, &msg); err != nil {
+			return err
+		}
+		if len(msg.Headers) > maxHeadersPerMessage {
+			return fmt.Errorf("%d headers in one message", len(msg.Headers))
+		}
+		err = c.db.Update(func(tx *bolt.Tx) error {
+			_, err := addHeaders(tx, msg.Headers)
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		best, err := c.BestHeader()
+		if err != nil {
+			return err
+		}
+		c.logf("Received %d headers, best header at height %d", len(msg.Headers), best.Height)
+		if len(msg.Headers) < maxHeadersPerMessage {
+			return nil
+		}
+	}
+}
+
+// 保存监视的地址，地址改变时清空已过滤的区块，之前的区块需要用新地址重新过滤
+// Store the watched addresses, the filtered blocks are cleared when they change because the
+// earlier blocks have to be filtered again for the new addresses
+func (c *LightClient) watchAddresses(tx *bolt.Tx, addresses []string) error {
+	sorted := append([]string{}, addresses...)
+	sort.Strings(sorted)
+	data := []byte(strings.Join(sorted, ","))
+
+	meta := tx.Bucket([]byte(metaBucket))
+	if bytes.Equal(meta.Get([]byte(watchedAddressesKey)), data) {
+		return nil
+	}
+	if err := tx.DeleteBucket([]byte(scannedBucket)); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket([]byte(scannedBucket)); err != nil {
+		return err
+	}
+
+	return meta.Put([]byte(watchedAddressesKey), data)
+}
+
+// 准备过滤区块：返回最佳区块头链上还没有过滤过的区块头，以及已知的支付到这些地址的输出
+// Prepare filtering blocks: returns the headers of the best header chain that have not been
+// filtered yet and the known outputs paying to the addresses
+func (c *LightClient) prepareScan(addresses []string) ([]*ChainHeader, []Outpoint, error) {
+	var pending []*ChainHeader
+	var outpoints []Outpoint
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		if err := c.watchAddresses(tx, addresses); err != nil {
+			return err
+		}
+
+		chain, err := readBestHeaderChain(tx)
+		if err != nil {
+			return err
+		}
+		scanned := tx.Bucket([]byte(scannedBucket))
+		for _, header := range chain {
+			if scanned.Get(header.Hash) == nil {
+				pending = append(pending, header)
+			}
+		}
+
+		// 已知的输出也加入过滤器，之后花费它们的交易才会匹配
+		// The known outputs are added to the filter too, so the transactions spending them match
+		watched := make(map[string]bool)
+		for _, address := range addresses {
+			watched[address] = true
+		}
+		return forEachProvenTx(tx, func(proven *provenTx) error {
+			for i, out := range proven.Tx.Vout {
+				if address, ok := ExtractAddress(out.ScriptPubKey); ok && watched[address] {
+					outpoints = append(outpoints, Outpoint{proven.Tx.ID, i})
+				}
+			}
+			return nil
+		})
+	})
+
+	return pending, outpoints, err
+}
+
+// 请求最佳区块头链上还没有过滤过的区块，验证匹配交易的证明后保存它们
+// Request the blocks of the best header chain that have not been filtered yet, the matching
+// transactions are stored once their proofs are verified
+func (c *LightClient) scanBlocks(conn net.Conn, addresses []string) error {
+	pending, outpoints, err := c.prepareScan(addresses)
+	if err != nil {
+		return err
+	}
+	if len(addresses)+len(outpoints) > maxFilterItems {
+		return fmt.Errorf("the filter of %d addresses and outputs is too large", len(addresses)+len(outpoints))
+	}
+	if err := c.send(conn, cmdFilterLoad, filterLoadMsg{addresses, outpoints}); err != nil {
+		return err
+	}
+
+	matched := 0
+	for start := 0; start < len(pending); start += maxInvPerMessage {
+		batch := pending[start:]
+		if len(batch) > maxInvPerMessage {
+			batch = batch[:maxInvPerMessage]
+		}
+		var items []invVect
+		for _, header := range batch {
+			items = append(items, invVect{invFilteredBlock, header.Hash})
+		}
+		if err := c.send(conn, cmdGetData, getDataMsg{items}); err != nil {
+			return err
+		}
+
+		// 回复按请求的顺序到达
+		// The replies arrive in the order of the requests
+		for _, header := range batch {
+			var block merkleBlockMsg
+			var notFound notFoundMsg
+			command, err := c.receiveAny(conn, []string{cmdMerkleBlock, cmdNotFound},
+				[]interface{}{&block, &notFound})
+			if err != nil {
+				return err
+			}
+			if command == cmdNotFound {
+				return fmt.Errorf("peer does not have block %x", notFound.Items[0].Hash)
+			}
+			n, err := c.storeFilteredBlock(header, &block)
+			if err != nil {
+				return err
+			}
+			matched += n
+		}
+	}
+	c.logf("Filtered %d blocks, %d transactions matched", len(pending), matched)
+
+	return nil
+}
+
+// 验证过滤后的区块：区块头必须是请求的区块头，每笔匹配交易的证明都要符合区块头的Merkle根
+// Verify a filtered block: the header must be the requested one and the proof of every
+// matching transaction must agree with the Merkle root of the header
+func (c *LightClient) storeFilteredBlock(header *ChainHeader, block *merkleBlockMsg) (int, error) {
+	if !bytes.Equal(block.Header.BlockHash(), header.Hash) {
+		return 0, fmt.Errorf("peer sent block %x instead of block %x", block.Header.BlockHash(), header.Hash)
+	}
+
+	var txs []*Transaction
+	for i := range block.Matches {
+		match := &block.Matches[i]
+		if !bytes.Equal(match.Tx.Hash(), match.Tx.ID) {
+			return 0, fmt.Errorf("transaction %x in block %x has a wrong ID", match.Tx.ID, header.Hash)
+		}
+		if !header.VerifyTxProof(match.Tx.ID, match.Index, block.TxCount, match.Proof) {
+			return 0, fmt.Errorf("invalid proof for transaction %x in block %x", match.Tx.ID, header.Hash)
+		}
+		txs = append(txs, &match.Tx)
+	}
+
+	return len(txs), c.storeProvenTxs(header, txs)
+}
+
+// 保存区块中证明过的交易，并把区块记为已过滤
+// Store the proven transactions of a block and mark the block as filtered
+func (c *LightClient) storeProvenTxs(header *ChainHeader, txs []*Transaction) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(provenTxBucket))
+		for _, t := range txs {
+			data, err := gobEncode(provenTx{header.Hash, header.Height, *t})
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(append(append([]byte{}, header.Hash...), t.ID...), data); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket([]byte(scannedBucket)).Put(header.Hash, []byte{1})
+	})
+}
+
+// 用紧凑区块过滤器扫描还没有过滤过的区块：在本地用地址的锁定脚本和已知的输出匹配过滤器，
+// 只下载命中的完整区块。完整节点看不到钱包的地址
+// Scan the blocks that have not been filtered yet with compact block filters: the filters are
+// matched locally against the locking scripts of the addresses and the known outputs, and only
+// the full blocks that hit are downloaded. The full node does not see the wallet addresses
+func (c *LightClient) scanCFilters(conn net.Conn, addresses []string) error {
+	pending, outpoints, err := c.prepareScan(addresses)
+	if err != nil {
+		return err
+	}
+
+	var queries [][]byte
+	for _, address := range addresses {
+		script, err := PayToAddrScript(address)
+		if err != nil {
+			return err
+		}
+		queries = append(queries, script)
+	}
+	for _, outpoint := range outpoints {
+		queries = append(queries, filterOutpoint(outpoint.TxID, outpoint.Index))
+	}
+	filter := newAddressFilter(addresses, outpoints)
+
+	total, hits, matched := len(pending), 0, 0
+	for len(pending) > 0 {
+		// 一次请求一段高度连续的区块的过滤器
+		// The filters of a run of consecutive heights are requested at once
+		count := 1
+		for count < len(pending) && count < maxCFiltersPerQuery && pending[count].Height == pending[count-1].Height+1 {
+			count++
+		}
+		batch := pending[:count]
+		pending = pending[count:]
+
+		last := batch[len(batch)-1]
+		if err := c.send(conn, cmdGetCFilters, getCFiltersMsg{batch[0].Height, last.Hash}); err != nil {
+			return err
+		}
+		filters := make([]cfilterMsg, len(batch))
+		for i, header := range batch {
+			if err := c.receive(conn, cmdCFilter, &filters[i]); err != nil {
+				return err
+			}
+			if !bytes.Equal(filters[i].BlockHash, header.Hash) {
+				return fmt.Errorf("peer sent the filter of block %x instead of block %x", filters[i].BlockHash, header.Hash)
+			}
+		}
+
+		for i, header := range batch {
+			hit, err := gcsMatchAny(filters[i].Filter, blockFilterKey(header.Hash), queries)
+			if err != nil {
+				return fmt.Errorf("filter of block %x: %v", header.Hash, err)
+			}
+			var txs []*Transaction
+			if hit {
+				block, err := c.fetchBlock(conn, header)
+				if err != nil {
+					return err
+				}
+				// 命中的区块可以检查过滤器是否正确
+				// The filter of a block that hit can be checked
+				if !bytes.Equal(buildBlockFilter(block), filters[i].Filter) {
+					return fmt.Errorf("peer sent a wrong filter for block %x", header.Hash)
+				}
+				for _, tx := range block.Transactions {
+					if !filter.match(tx) {
+						continue
+					}
+					txs = append(txs, tx)
+					for j, out := range tx.Vout {
+						if address, ok := ExtractAddress(out.ScriptPubKey); ok && filter.addresses[address] {
+							queries = append(queries, filterOutpoint(tx.ID, j))
+						}
+					}
+				}
+				hits++
+				matched += len(txs)
+			}
+			if err := c.storeProvenTxs(header, txs); err != nil {
+				return err
+			}
+		}
+	}
+	c.logf("Matched %d filters, downloaded %d blocks, %d transactions matched", total, hits, matched)
+
+	return nil
+}
+
+// 下载完整区块，检查它的哈希、工作量证明、交易ID和Merkle根
+// Download a full block, checking its hash, proof of work, transaction IDs and Merkle root
+func (c *LightClient) fetchBlock(conn net.Conn, header *ChainHeader) (*Block, error) {
+	if err := c.send(conn, cmdGetData, getDataMsg{[]invVect{{invBlock, header.Hash}}}); err != nil {
+		return nil, err
+	}
+	var msg blockMsg
+	var notFound notFoundMsg
+	command, err := c.receiveAny(conn, []string{cmdBlock, cmdNotFound}, []interface{}{&msg, &notFound})
+	if err != nil {
+		return nil, err
+	}
+	if command == cmdNotFound {
+		return nil, fmt.Errorf("peer does not have block %x", header.Hash)
+	}
+
+	block, err := DeserializeBlock(msg.Block)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(block.Hash, header.Hash) {
+		return nil, fmt.Errorf("peer sent block %x instead of block %x", block.Hash, header.Hash)
+	}
+	for _, tx := range block.Transactions {
+		if !bytes.Equal(tx.Hash(), tx.ID) {
+			return nil, fmt.Errorf("transaction %x in block %x has a wrong ID", tx.ID, header.Hash)
+		}
+	}
+	if err := block.checkHeader(); err != nil {
+		return nil, fmt.Errorf("block %x: %v", header.Hash, err)
+	}
+	block.Height = header.Height
+
+	return block, nil
+}
+
+func forEachProvenTx(tx *bolt.Tx, fn func(*provenTx) error) error {
+	return tx.Bucket([]byte(provenTxBucket)).ForEach(func(k, v []byte) error {
+		var proven provenTx
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&proven); err != nil {
+			return err
+		}
+
+		return fn(&proven)
+	})
+}
+
+// 用最佳区块头链上证明过的交易计算地址的余额：支付到地址、且没有被这些交易花费的输出之和
+// Compute the balance of the addresses from the proven transactions of the best header chain:
+// the sum of the outputs paying to them that none of those transactions spend
+func (c *LightClient) Balances(addresses []string) (map[string]int, error) {
+	balances := make(map[string]int)
+	for _, address := range addresses {
+		balances[address] = 0
+	}
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(metaBucket)).Get([]byte(bestHeaderKey)) == nil {
+			return nil
+		}
+		chain, err := readBestHeaderChain(tx)
+		if err != nil {
+			return err
+		}
+
+		var txs []*provenTx
+		spent := make(map[string]bool)
+		err = forEachProvenTx(tx, func(proven *provenTx) error {
+			// 被分叉替换的区块中的交易不算
+			// Transactions of blocks replaced by a fork do not count
+			if proven.Height >= len(chain) || !bytes.Equal(chain[proven.Height].Hash, proven.BlockHash) {
+				return nil
+			}
+			txs = append(txs, proven)
+			if !proven.Tx.IsCoinbase() {
+				for _, in := range proven.Tx.Vin {
+					spent[outpointKey(in.Txid, in.Vout)] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, proven := range txs {
+			for i, out := range proven.Tx.Vout {
+				address, ok := ExtractAddress(out.ScriptPubKey)
+				if _, watched := balances[address]; ok && watched && !spent[outpointKey(proven.Tx.ID, i)] {
+					balances[address] += out.Value
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return balances, err
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"io"
+	"strings"
+	"time"
 )
 
 // 交易结构体，用来存储一笔交易
@@ -15,8 +17,45 @@ type Transaction struct {
 	ID []byte // 交易id,使用输入输出等信息来哈希，确保信息不被篡改
 	// transaction id, Use information such as
 	//input and output to hash to ensure that the information is not tampered with
-	Vin  []TXInput
-	Vout []TXOutput
+	Vin      []TXInput
+	Vout     []TXOutput
+	LockTime uint32 // 锁定时间：小于LockTimeThreshold为区块高度，否则为时间戳
+	// lock time: a block height below LockTimeThreshold, otherwise a timestamp
+}
+
+// 创建交易时的选项
+// Options used when creating a transaction
+type TxOptions struct {
+	LockTime       uint32       // 交易级锁定时间(高度或时间戳) transaction lock time (height or timestamp)
+	Sequence       uint32       // 输入序列号，0表示默认值 input sequence, 0 means the default
+	OutputLockTime uint32       // 收款输出的CHECKLOCKTIMEVERIFY锁定 CHECKLOCKTIMEVERIFY lock on the payment output
+	CoinSelector   CoinSelector // 选币策略，nil表示默认策略 coin selection strategy, nil means the default
+	Inputs         []Outpoint   // 必须使用的输出 outputs that must be spent
+	Exclude        []Outpoint   // 不能使用的输出，例如交易池中的交易已花费的输出 outputs that must not be spent, like those spent by mempool transactions
+}
+
+// 输入使用的序列号：设置了锁定时间时序列号不能为最大值，否则锁定时间不生效
+// The sequence used for inputs: with a lock time the sequence must not be the max value,
+// otherwise the lock time is not enforced
+func (opts TxOptions) sequence() uint32 {
+	if opts.Sequence != 0 {
+		return opts.Sequence
+	}
+	if opts.LockTime != 0 {
+		return MaxTxInSequenceNum - 1
+	}
+
+	return MaxTxInSequenceNum
+}
+
+// gob按类型第一次被使用的顺序分配类型编号，编号是编码结果的一部分。交易ID和签名哈希
+// 都基于gob编码，所以交易类型必须先于区块等类型注册，否则同一交易在不同进程中的哈希会不同
+// gob numbers types in the order they are first used and the numbers are part of the
+// encoding. Transaction IDs and signature hashes are based on gob, so the transaction
+// types must be registered before blocks and the like, otherwise the same transaction
+// would hash differently depending on what the process encoded first
+func init() {
+	HandleErr(gob.NewEncoder(io.Discard).Encode(Transaction{}))
 }
 
 // 设置交易的ID编号，这里是做hash处理
@@ -33,6 +72,20 @@ func (tx *Transaction) SetID() {
 	tx.ID = hash[:]
 }
 
+// 根据交易内容计算交易ID，普通交易的ID不包含解锁脚本，所以签名不会改变ID
+// Compute the transaction ID from its content, the ID of a regular transaction
+// does not cover the unlocking scripts so signing does not change it
+func (tx *Transaction) Hash() []byte {
+	txCopy := *tx
+	if !tx.IsCoinbase() {
+		txCopy = tx.TrimmedCopy()
+	}
+	txCopy.ID = nil
+	txCopy.SetID()
+
+	return txCopy.ID
+}
+
 // IsCoinbase check whether the transaction is coinbase
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
@@ -42,13 +95,15 @@ func (tx *Transaction) IsCoinbase() bool {
 // Create a mining reward transaction: the transaction has only one output and no input
 func NewCoinbaseTransaction(to, data string) *Transaction {
 	if data == "" {
-		data = fmt.Sprintf("Reward to '%s'", to)
+		// 加入时间保证每个区块的奖励交易ID不同
+		// The time makes the reward transaction ID unique per block
+		data = fmt.Sprintf("Reward to '%s' at %d", to, time.Now().UnixNano())
 	}
-	txin := TXInput{[]byte{}, -1, data} // -1表示该输入没有引用任何输出
+	txin := TXInput{[]byte{}, -1, []byte(data), MaxTxInSequenceNum} // -1表示该输入没有引用任何输出
 	// -1 means that the input does not refer to any output
-	txout := TXOutput{subsidy, to} // 一个块给的奖励subsidy = 10
+	txout := NewTXOutput(subsidy, to) // 一个块给的奖励subsidy = 10
 	// the reward subsidy given by/to a block is 10
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{txout}}
+	tx := Transaction{nil, []TXInput{txin}, []TXOutput{txout}, 0}
 	tx.SetID()
 
 	return &tx
@@ -56,43 +111,210 @@ func NewCoinbaseTransaction(to, data string) *Transaction {
 
 // 创建转账交易记录
 // Create transfer transaction records
-func NewUTXOTransaction(from, to string, amount int, bc *BlockChain) *Transaction {
+func NewUTXOTransaction(from, to string, amount int, opts TxOptions, bc *BlockChain) (*Transaction, error) {
+	return NewMultiRecipientTransaction(from, []Recipient{{to, amount}}, opts, bc)
+}
+
+// 创建一笔支付给多个收款方的交易，所有找零合并为一个输出
+// Create a transaction paying many recipients, with a single change output
+func NewMultiRecipientTransaction(from string, recipients []Recipient, opts TxOptions, bc *BlockChain) (*Transaction, error) {
+	return newSignedTransaction(from, recipients, opts, bc)
+}
+
+// 用钱包中from的密钥创建并签名交易
+// Create a transaction and sign it with the key of from in the wallet
+func newSignedTransaction(from string, recipients []Recipient, opts TxOptions, bc *BlockChain) (*Transaction, error) {
+	wallets, err := NewWallets()
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := newUnsignedTransaction(from, recipients, opts, bc)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.SignTransaction(tx, wallet); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// 创建未签名的转账交易
+// Create an unsigned transfer transaction
+func newUnsignedTransaction(from string, recipients []Recipient, opts TxOptions, bc *BlockChain) (*Transaction, error) {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	// 找到可以用来花费的所有有效交易输出(即是统计出该原地址的所有的币)
-	// Find all valid transaction outputs that can be used for
-	// spending (that is, count all the coins of the original address)
-	acc, validOutputs := bc.FindSpendableOutputs(from, amount)
+	if err := ValidateRecipients(recipients); err != nil {
+		return nil, err
+	}
+	amount := totalAmount(recipients)
 
-	// 判断该地址from的币是否够用来该笔转账
-	// Determine whether the coins from the address "from" is enough for the transfer
-	if acc < amount {
-		log.Panic("Error: Not enough funds to spend.")
+	// 使用选币策略从该地址可以花费的输出中选出这笔转账的输入
+	// Pick the inputs of this transfer from the spendable outputs of the address
+	// using the coin selection strategy
+	selected, err := bc.SelectCoins(from, amount, opts.CoinSelector, opts.Inputs, opts.Exclude)
+	if err != nil {
+		return nil, err
 	}
 
 	// build a list inputs for this transaction
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		HandleErr(err)
-		for _, out := range outs {
-			input := TXInput{txID, out, from}
-			inputs = append(inputs, input)
-		}
+	acc := 0
+	for _, utxo := range selected {
+		inputs = append(inputs, TXInput{utxo.TxID, utxo.Index, nil, opts.sequence()})
+		acc += utxo.Output.Value
 	}
 
 	// build a list of outputs for this transaction
-	// 转账输出给(to)
-	// transaction output to "to"
-	outputs = append(outputs, TXOutput{amount, to})
+	// 转账输出给每个收款方
+	// transaction outputs to every recipient
+	for _, r := range recipients {
+		if opts.OutputLockTime != 0 {
+			// 收款输出在锁定时间之前不能被花费，只有支付到公钥哈希的输出可以加上锁定
+			// The payment output cannot be spent before its lock time, only outputs paying
+			// to a public key hash can be locked
+			version, pubKeyHash, err := decodeAddress(r.Address)
+			if err != nil {
+				return nil, err
+			}
+			if version != addressVersion {
+				return nil, fmt.Errorf("cannot lock the payment to %s, only public key hash addresses support output lock times", r.Address)
+			}
+			outputs = append(outputs, TXOutput{r.Amount, LockTimePubKeyHashScript(opts.OutputLockTime, pubKeyHash)})
+		} else {
+			outputs = append(outputs, NewTXOutput(r.Amount, r.Address))
+		}
+	}
 	if acc > amount {
 		// 找零输出,输出给原账户(from)
 		// change output, given to original account "from"
-		outputs = append(outputs, TXOutput{acc - amount, from})
+		outputs = append(outputs, NewTXOutput(acc-amount, from))
 	}
 
-	tx := Transaction{nil, inputs, outputs}
+	tx := Transaction{nil, inputs, outputs, opts.LockTime}
+
+	// 花费带CHECKLOCKTIMEVERIFY的输出时，交易的锁定时间不能早于输出的锁定时间
+	// When spending outputs guarded by CHECKLOCKTIMEVERIFY, the transaction lock time
+	// must not be earlier than theirs
+	if err := applyOutputLockTimes(&tx, selected); err != nil {
+		return nil, err
+	}
 	tx.SetID()
 
-	return &tx
+	return &tx, nil
+}
+
+// 复制一份去掉所有解锁脚本的交易，用于计算签名哈希
+// Copy the transaction without any unlocking scripts, used for the signature hash
+func (tx *Transaction) TrimmedCopy() Transaction {
+	var inputs []TXInput
+	var outputs []TXOutput
+
+	for _, in := range tx.Vin {
+		inputs = append(inputs, TXInput{in.Txid, in.Vout, nil, in.Sequence})
+	}
+	outputs = append(outputs, tx.Vout...)
+
+	return Transaction{tx.ID, inputs, outputs, tx.LockTime}
+}
+
+// 计算第idx个输入的签名哈希：把该输入的解锁脚本替换为subScript(即被花费输出的锁定脚本)
+// Compute the signature hash of input idx: its unlocking script is replaced
+// by subScript (the locking script of the output being spent)
+func (tx *Transaction) signatureHash(idx int, subScript []byte) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.ID = nil
+	txCopy.Vin[idx].ScriptSig = subScript
+
+	var encoded bytes.Buffer
+	err := gob.NewEncoder(&encoded).Encode(txCopy)
+	HandleErr(err)
+	hash := sha256.Sum256(encoded.Bytes())
+
+	return hash[:]
+}
+
+// 使用钱包对交易的每一个输入进行签名，prevTXs为输入引用的交易
+// Sign every input of the transaction with the wallet, prevTXs are the referenced transactions
+func (tx *Transaction) Sign(wallet *Wallet, prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for idx, in := range tx.Vin {
+		prevTx, ok := prevTXs[hex.EncodeToString(in.Txid)]
+		if !ok || in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+			return fmt.Errorf("previous output %x:%d not found", in.Txid, in.Vout)
+		}
+		pkScript := prevTx.Vout[in.Vout].ScriptPubKey
+
+		switch ClassifyScript(pkScript) {
+		case PubKeyHashTy, LockTimePubKeyHashTy:
+			sig := wallet.Sign(tx.signatureHash(idx, pkScript))
+			tx.Vin[idx].ScriptSig = PayToPubKeyHashSigScript(sig, wallet.PublicKey)
+		default:
+			return fmt.Errorf("cannot sign output %x:%d with script '%s'", in.Txid, in.Vout, DisasmString(pkScript))
+		}
+	}
+
+	return nil
+}
+
+// 执行每个输入的解锁脚本和被花费输出的锁定脚本来验证交易
+// Verify the transaction by executing each input's unlocking script against the spent output's locking script
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for idx, in := range tx.Vin {
+		prevTx, ok := prevTXs[hex.EncodeToString(in.Txid)]
+		if !ok || in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+			return fmt.Errorf("previous output %x:%d not found", in.Txid, in.Vout)
+		}
+		if err := VerifyScript(in.ScriptSig, prevTx.Vout[in.Vout].ScriptPubKey, tx, idx); err != nil {
+			return fmt.Errorf("input %d of transaction %x: %w", idx, tx.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// 可读的交易信息
+// Human readable transaction
+func (tx Transaction) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
+	}
+	for i, in := range tx.Vin {
+		lines = append(lines, fmt.Sprintf("     Input %d:", i))
+		lines = append(lines, fmt.Sprintf("       TXID:      %x", in.Txid))
+		lines = append(lines, fmt.Sprintf("       Out:       %d", in.Vout))
+		if in.Sequence != MaxTxInSequenceNum {
+			lines = append(lines, fmt.Sprintf("       Sequence:  %d", in.Sequence))
+		}
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("       Coinbase:  %s", in.ScriptSig))
+		} else {
+			lines = append(lines, fmt.Sprintf("       ScriptSig: %s", DisasmString(in.ScriptSig)))
+		}
+	}
+	for i, out := range tx.Vout {
+		lines = append(lines, fmt.Sprintf("     Output %d:", i))
+		lines = append(lines, fmt.Sprintf("       Value:  %d", out.Value))
+		lines = append(lines, fmt.Sprintf("       Script: %s", DisasmString(out.ScriptPubKey)))
+		if address, ok := ExtractAddress(out.ScriptPubKey); ok {
+			lines = append(lines, fmt.Sprintf("       Address: %s", address))
+		}
+	}
+
+	return strings.Join(lines, "\n")
 }
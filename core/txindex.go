@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 交易索引：交易ID -> 区块哈希 | 交易在区块中的位置(4)
+// Transaction index: txid -> block hash | position of the tx in the block(4)
+type txIndexer struct{}
+
+func (txIndexer) Name() string {
+	return "txindex"
+}
+
+func (txIndexer) Bucket() []byte {
+	return []byte(txIndexBucket)
+}
+
+func (ix txIndexer) ConnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	b := dbTx.Bucket(ix.Bucket())
+
+	for pos, tx := range block.Transactions {
+		value := make([]byte, len(block.Hash)+4)
+		copy(value, block.Hash)
+		binary.BigEndian.PutUint32(value[len(block.Hash):], uint32(pos))
+		if err := b.Put(tx.ID, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ix txIndexer) DisconnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	b := dbTx.Bucket(ix.Bucket())
+
+	for _, tx := range block.Transactions {
+		if err := b.Delete(tx.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 通过交易索引查找交易所在的区块和位置，索引未启用时ok为false
+// Look up the block and position of a transaction in the transaction index,
+// ok is false when the index is not enabled
+func (bc *BlockChain) lookupTxIndex(ID []byte) (blockHash []byte, pos int, ok bool, err error) {
+	bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+		if b == nil {
+			return nil
+		}
+		ok = true
+
+		value := b.Get(ID)
+		if value == nil {
+			err = fmt.Errorf("transaction %x not found", ID)
+			return nil
+		}
+		if len(value) != sha256.Size+4 {
+			err = fmt.Errorf("malformed transaction index entry for %x", ID)
+			return nil
+		}
+		blockHash = append([]byte{}, value[:sha256.Size]...)
+		pos = int(binary.BigEndian.Uint32(value[sha256.Size:]))
+
+		return nil
+	})
+
+	return blockHash, pos, ok, err
+}
+
+// 查找包含该交易的区块，启用了交易索引时直接读取，否则扫描整条链
+// Find the block containing the transaction, read directly when the transaction
+// index is enabled, otherwise the whole chain is scanned
+func (bc *BlockChain) findTransactionBlock(ID []byte) (*Block, error) {
+	blockHash, pos, ok, err := bc.lookupTxIndex(ID)
+	if ok {
+		if err != nil {
+			return nil, err
+		}
+		block, err := bc.GetBlock(blockHash)
+		if err != nil {
+			return nil, err
+		}
+		if pos >= len(block.Transactions) || !bytes.Equal(block.Transactions[pos].ID, ID) {
+			return nil, fmt.Errorf("transaction index entry for %x does not match block %x", ID, blockHash)
+		}
+		return block, nil
+	}
+
+	pruned := bc.PruneHeight()
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return block, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+		if block.Height <= pruned {
+			return nil, fmt.Errorf("transaction %x not found, the blocks below height %d have been %w", ID, pruned, errBlockPruned)
+		}
+	}
+
+	return nil, fmt.Errorf("transaction %x not found", ID)
+}
+
+// 找到花费了该交易输出的交易，返回输出序号 -> 花费它的交易ID
+// Find the transactions spending the outputs of the transaction, returns output index -> spending txid
+func (bc *BlockChain) FindSpendingTransactions(txID []byte) map[int][]byte {
+	spenders := make(map[int][]byte)
+	pruned := bc.PruneHeight()
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, in := range tx.Vin {
+				if bytes.Equal(in.Txid, txID) {
+					spenders[in.Vout] = tx.ID
+				}
+			}
+		}
+
+		// 交易之前的区块不可能花费它的输出
+		// Blocks before the transaction cannot spend its outputs
+		if len(block.PrevBlockHash) == 0 || block.hasTransaction(txID) || block.Height <= pruned {
+			break
+		}
+	}
+
+	return spenders
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 重组移除区块时交易索引中的记录被删除，同一交易在新分支中被打包时记录指向新区块
+// When a reorganization removes a block its entries are deleted from the transaction index, and
+// when the same transaction is mined on the new branch the entry points to the new block
+func TestTxIndexReorganize(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{NewWallet().GetAddress(), 3}}, TxOptions{}, nil)
+	mined := mineTestBlock(t, bc, NewWallet().GetAddress(), tx)
+
+	blockHash, _, ok, err := bc.lookupTxIndex(tx.ID)
+	if !ok || err != nil || !bytes.Equal(blockHash, mined.Hash) {
+		t.Fatalf("before the reorganization the entry points to %x (%v, %v)", blockHash, ok, err)
+	}
+
+	// 新分支不包含这笔交易
+	// The new branch does not contain the transaction
+	branch := newTestBranch(genesis, 2)
+	if _, err := bc.Reorganize(branch); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, err := bc.lookupTxIndex(tx.ID); !ok || err == nil {
+		t.Fatalf("the entry of a disconnected transaction is still indexed (%v, %v)", ok, err)
+	}
+	if _, _, _, err := bc.lookupTxIndex(mined.Transactions[0].ID); err == nil {
+		t.Fatal("the coinbase of the disconnected block is still indexed")
+	}
+	if _, err := bc.findTransactionBlock(tx.ID); err == nil {
+		t.Fatal("a disconnected transaction was found")
+	}
+
+	// 更长的分支在另一个位置重新打包这笔交易
+	// A longer branch mines the transaction again at another position
+	first := newTestBlock(genesis, NewWallet().GetAddress())
+	second := newTestBlock(first, NewWallet().GetAddress(), tx)
+	third := newTestBlock(second, NewWallet().GetAddress())
+	if _, err := bc.Reorganize([]*Block{first, second, third}); err != nil {
+		t.Fatal(err)
+	}
+	blockHash, pos, ok, err := bc.lookupTxIndex(tx.ID)
+	if !ok || err != nil || !bytes.Equal(blockHash, second.Hash) || pos != 1 {
+		t.Fatalf("after the reorganization the entry points to %x:%d (%v, %v), expected %x:1", blockHash, pos, ok, err, second.Hash)
+	}
+	block, err := bc.findTransactionBlock(tx.ID)
+	if err != nil || !bytes.Equal(block.Hash, second.Hash) {
+		t.Fatalf("found the transaction in %v: %v", block, err)
+	}
+}
+
+// 没有交易索引时通过扫描链查找交易
+// Without the transaction index transactions are found by scanning the chain
+func TestTxIndexDisabledFallsBackToScan(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{NewWallet().GetAddress(), 3}}, TxOptions{}, nil)
+	mined := mineTestBlock(t, bc, NewWallet().GetAddress(), tx)
+	mineTestBlock(t, bc, NewWallet().GetAddress())
+
+	if err := bc.DropIndex(txIndexer{}.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, _ := bc.lookupTxIndex(tx.ID); ok {
+		t.Fatal("the transaction index is still enabled")
+	}
+
+	block, err := bc.findTransactionBlock(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.Hash, mined.Hash) {
+		t.Fatalf("found the transaction in block %x, expected %x", block.Hash, mined.Hash)
+	}
+	found, _, err := bc.FindTransaction(tx.ID)
+	if err != nil || !bytes.Equal(found.ID, tx.ID) {
+		t.Fatalf("FindTransaction returned %x: %v", found.ID, err)
+	}
+	if _, err := bc.findTransactionBlock(sha256Bytes([]byte("missing"))); err == nil {
+		t.Fatal("a missing transaction was found")
+	}
+}
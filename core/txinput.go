@@ -1,11 +1,10 @@
 package core
 
+// 交易输入结构体
+// transaction input struct
 type TXInput struct {
-	Txid      []byte
-	Vout      int
-	ScriptSig string
-}
-
-func (in *TXInput) CanUnlockOutputWith(unlockingData string) bool {
-	return in.ScriptSig == unlockingData
+	Txid      []byte // 引用的交易ID the ID of the referenced transaction
+	Vout      int    // 引用的输出序号 the index of the referenced output
+	ScriptSig []byte // 解锁脚本，提供数据来满足输出的锁定脚本 unlocking script, provides data satisfying the output's ScriptPubKey
+	Sequence  uint32 // 序列号，用于相对锁定 sequence number, used for relative locks
 }
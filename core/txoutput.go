@@ -4,12 +4,23 @@ package core
 // transaction output struct
 type TXOutput struct {
 	Value        int    // 一定量的比特币(Value)
-	ScriptPubKey string // 一个锁定脚本(ScriptPubKey)，要花这笔钱，必须要解锁该脚本。
+	ScriptPubKey []byte // 一个锁定脚本(ScriptPubKey)，要花这笔钱，必须要解锁该脚本。
 	// To spend this value, the ScriptPubKey must be unlocked.
 }
 
-// 判断该输入是否可以被unlockingData解锁
-// Determine whether the input can be unlocked by unlockingData
-func (out *TXOutput) CanBeUnlockedWith(unlockingData string) bool {
-	return out.ScriptPubKey == unlockingData
+// 创建一个支付到地址的输出
+// Create an output paying to the address
+func NewTXOutput(value int, address string) TXOutput {
+	script, err := PayToAddrScript(address)
+	HandleErr(err)
+
+	return TXOutput{value, script}
+}
+
+// 判断该输出是否锁定到address，即address的持有者能否解锁
+// Determine whether the output is locked to address, i.e. whether its owner can unlock it
+func (out *TXOutput) CanBeUnlockedWith(address string) bool {
+	lockedTo, ok := ExtractAddress(out.ScriptPubKey)
+
+	return ok && lockedTo == address
 }
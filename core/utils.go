@@ -38,3 +38,11 @@ func PathExists(path string) (bool, error) {
 	}
 	return false, err
 }
+
+// 反转字节数组
+// Reverse a byte array in place
+func ReverseBytes(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// 未花费的交易输出，以及它所在的区块高度
+// An unspent transaction output together with the height of its block
+type UTXO struct {
+	TxID     []byte
+	Index    int
+	Output   TXOutput
+	Height   int  // 所在区块高度 height of the containing block
+	Coinbase bool // 是否为挖矿奖励 whether it is a coinbase output
+}
+
+// 输出的唯一标识: 交易ID:输出序号
+// Unique key of an output: txid:index
+func outpointKey(txID []byte, index int) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(txID), index)
+}
+
+// 挖矿奖励是否已经成熟：创世区块的奖励是链上的初始资金，不受限制
+// Whether a coinbase output has matured: the genesis reward funds the chain and is exempt
+func (p ChainParams) coinbaseMatured(coinbaseHeight, spendHeight int) bool {
+	return coinbaseHeight == 0 || spendHeight-coinbaseHeight >= p.CoinbaseMaturity
+}
+
+// 是否为未成熟的挖矿奖励
+// Whether the output is an immature coinbase reward
+func (u UTXO) IsImmature(nextHeight int, params ChainParams) bool {
+	return u.Coinbase && !params.coinbaseMatured(u.Height, nextHeight)
+}
+
+// 是否因为CHECKLOCKTIMEVERIFY而被锁定
+// Whether the output is locked by CHECKLOCKTIMEVERIFY
+func (u UTXO) IsLocked(nextHeight int, now int64) bool {
+	lockTime, ok := extractLockTime(u.Output.ScriptPubKey)
+
+	return ok && !lockTimeReached(lockTime, nextHeight, now)
+}
+
+// 是否可以在下一个区块中花费
+// Whether the output can be spent in the next block
+func (u UTXO) IsSpendable(nextHeight int, now int64, params ChainParams) bool {
+	return !u.IsImmature(nextHeight, params) && !u.IsLocked(nextHeight, now)
+}
+
+// 找到address的所有未花费输出
+// Find all unspent outputs of address
+func (bc *BlockChain) FindUTXOs(address string) []UTXO {
+	if bc.indexEnabled(utxoIndexer{}) {
+		UTXOs, err := bc.findUTXOsFromSet(address)
+		HandleErr(err)
+
+		return UTXOs
+	}
+	if bc.indexEnabled(addrIndexer{}) {
+		UTXOs, err := bc.findUTXOsIndexed(address)
+		HandleErr(err)
+
+		return UTXOs
+	}
+
+	var UTXOs []UTXO
+	spentTXOs := make(map[string]bool)
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+
+		// 先记录本区块花费的输出，同一区块内的交易也可能花费前面交易的输出
+		// Record the spends of this block first, a transaction may spend
+		// an output of an earlier transaction in the same block
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, in := range tx.Vin {
+				spentTXOs[outpointKey(in.Txid, in.Vout)] = true
+			}
+		}
+
+		for _, tx := range block.Transactions {
+			for outIdx, out := range tx.Vout {
+				if spentTXOs[outpointKey(tx.ID, outIdx)] || !out.CanBeUnlockedWith(address) {
+					continue
+				}
+				UTXOs = append(UTXOs, UTXO{tx.ID, outIdx, out, block.Height, tx.IsCoinbase()})
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return UTXOs
+}
+
+// 地址余额
+// Balance of an address
+type Balance struct {
+	Confirmed int `json:"confirmed"` // 可以立即花费 spendable right now
+	Immature  int `json:"immature"`  // 未成熟的挖矿奖励 immature coinbase rewards
+	Locked    int `json:"locked"`    // 锁定时间未到 lock time not reached yet
+	Total     int `json:"total"`
+}
+
+// 统计地址的余额，按是否可以花费分类
+// Compute the balance of the address, split by whether it can be spent
+func (bc *BlockChain) GetBalance(address string) Balance {
+	var balance Balance
+	nextHeight := bc.GetBestHeight() + 1
+	now := time.Now().Unix()
+
+	for _, utxo := range bc.FindUTXOs(address) {
+		value := utxo.Output.Value
+		switch {
+		case utxo.IsImmature(nextHeight, bc.params):
+			balance.Immature += value
+		case utxo.IsLocked(nextHeight, now):
+			balance.Locked += value
+		default:
+			balance.Confirmed += value
+		}
+		balance.Total += value
+	}
+
+	return balance
+}
@@ -0,0 +1,287 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 未花费输出集合：保存主链上所有未花费的输出，验证交易和修剪区块时不需要读取历史区块。
+// 集合中还保存每个区块的撤销数据(它花费的输出)，用于从链上移除区块
+// UTXO set: holds every unspent output of the main chain, so validating transactions
+// and pruning blocks do not need the historical blocks. The set also keeps the undo data
+// of every block (the outputs it spent), used to disconnect the block from the chain
+const (
+	utxoSubBucket = "utxo" // 输出: 交易ID | 输出序号(4字节) -> utxoEntry  txid | index(4 bytes) -> utxoEntry
+	undoSubBucket = "undo" // 撤销数据: 区块哈希 -> []spentOutput  block hash -> []spentOutput
+)
+
+// 未花费输出集合中的一项
+// An entry of the UTXO set
+type utxoEntry struct {
+	Output   TXOutput
+	Height   int   // 所在区块高度 height of the containing block
+	Time     int64 // 所在区块时间(秒) time of the containing block in seconds
+	Coinbase bool
+}
+
+// 区块花费的一个输出，按区块中输入的顺序保存
+// An output spent by a block, kept in the order of the block's inputs
+type spentOutput struct {
+	TxID  []byte
+	Index int
+	Entry utxoEntry
+}
+
+func utxoSetKey(txID []byte, index int) []byte {
+	key := make([]byte, len(txID)+4)
+	copy(key, txID)
+	binary.BigEndian.PutUint32(key[len(txID):], uint32(index))
+
+	return key
+}
+
+func gobEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// 未花费输出集合，实现为可选索引
+// UTXO set, implemented as an optional index
+type utxoIndexer struct{}
+
+func (ix utxoIndexer) Name() string {
+	return "utxo"
+}
+
+func (ix utxoIndexer) Bucket() []byte {
+	return []byte(utxoSetBucket)
+}
+
+func (ix utxoIndexer) buckets(dbTx *bolt.Tx) (*bolt.Bucket, *bolt.Bucket, error) {
+	root := dbTx.Bucket(ix.Bucket())
+	utxos, err := root.CreateBucketIfNotExists([]byte(utxoSubBucket))
+	if err != nil {
+		return nil, nil, err
+	}
+	undo, err := root.CreateBucketIfNotExists([]byte(undoSubBucket))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return utxos, undo, nil
+}
+
+// 移除区块花费的输出，加入区块创建的输出，并保存撤销数据
+// Remove the outputs spent by the block, add the outputs it creates and store the undo data
+func (ix utxoIndexer) ConnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	utxos, undo, err := ix.buckets(dbTx)
+	if err != nil {
+		return err
+	}
+
+	var spent []spentOutput
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				key := utxoSetKey(in.Txid, in.Vout)
+				data := utxos.Get(key)
+				if data == nil {
+					return fmt.Errorf("output %s is not in the UTXO set", outpointKey(in.Txid, in.Vout))
+				}
+				var entry utxoEntry
+				if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+					return err
+				}
+				spent = append(spent, spentOutput{in.Txid, in.Vout, entry})
+				if err := utxos.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i, out := range tx.Vout {
+			data, err := gobEncode(utxoEntry{out, block.Height, block.Time(), tx.IsCoinbase()})
+			if err != nil {
+				return err
+			}
+			if err := utxos.Put(utxoSetKey(tx.ID, i), data); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := gobEncode(spent)
+	if err != nil {
+		return err
+	}
+
+	return undo.Put(block.Hash, data)
+}
+
+// 按相反顺序撤销区块：移除它创建的输出，恢复它花费的输出
+// Undo the block in reverse order: remove the outputs it created and restore the outputs it spent
+func (ix utxoIndexer) DisconnectBlock(dbTx *bolt.Tx, block *Block, prevOuts map[string]TXOutput) error {
+	utxos, undo, err := ix.buckets(dbTx)
+	if err != nil {
+		return err
+	}
+
+	spent, err := readBlockUndo(undo, block.Hash)
+	if err != nil {
+		return err
+	}
+
+	next := len(spent)
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		for j := range tx.Vout {
+			if err := utxos.Delete(utxoSetKey(tx.ID, j)); err != nil {
+				return err
+			}
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		if next < len(tx.Vin) {
+			return fmt.Errorf("undo data of block %x does not match its inputs", block.Hash)
+		}
+		for _, s := range spent[next-len(tx.Vin) : next] {
+			data, err := gobEncode(s.Entry)
+			if err != nil {
+				return err
+			}
+			if err := utxos.Put(utxoSetKey(s.TxID, s.Index), data); err != nil {
+				return err
+			}
+		}
+		next -= len(tx.Vin)
+	}
+
+	return undo.Delete(block.Hash)
+}
+
+// 读取区块的撤销数据
+// Read the undo data of the block
+func readBlockUndo(undo *bolt.Bucket, blockHash []byte) ([]spentOutput, error) {
+	data := undo.Get(blockHash)
+	if data == nil {
+		return nil, fmt.Errorf("undo data of block %x is missing", blockHash)
+	}
+	var spent []spentOutput
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&spent); err != nil {
+		return nil, err
+	}
+
+	return spent, nil
+}
+
+// 在未花费输出集合中查找输出，ok表示集合是否已启用，输出不在集合中时entry为nil
+// Look up an output in the UTXO set, ok tells whether the set is enabled and entry
+// is nil when the output is not in the set
+func (bc *BlockChain) lookupUTXOSet(txID []byte, index int) (entry *utxoEntry, ok bool, err error) {
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(utxoSetBucket))
+		if root == nil {
+			return nil
+		}
+		ok = true
+
+		utxos := root.Bucket([]byte(utxoSubBucket))
+		if utxos == nil {
+			return nil
+		}
+		data := utxos.Get(utxoSetKey(txID, index))
+		if data == nil {
+			return nil
+		}
+		entry = &utxoEntry{}
+
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(entry)
+	})
+
+	return entry, ok, err
+}
+
+// 从未花费输出集合中找到address的所有未花费输出
+// Find all unspent outputs of address in the UTXO set
+func (bc *BlockChain) findUTXOsFromSet(address string) ([]UTXO, error) {
+	var UTXOs []UTXO
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		utxos := tx.Bucket([]byte(utxoSetBucket)).Bucket([]byte(utxoSubBucket))
+		if utxos == nil {
+			return nil
+		}
+
+		return utxos.ForEach(func(k, v []byte) error {
+			var entry utxoEntry
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&entry); err != nil {
+				return err
+			}
+			if !entry.Output.CanBeUnlockedWith(address) {
+				return nil
+			}
+			txID := append([]byte{}, k[:len(k)-4]...)
+			index := int(binary.BigEndian.Uint32(k[len(k)-4:]))
+			UTXOs = append(UTXOs, UTXO{txID, index, entry.Output, entry.Height, entry.Coinbase})
+
+			return nil
+		})
+	})
+
+	return UTXOs, err
+}
+
+// 输出所在区块的高度，优先从未花费输出集合读取
+// Height of the block containing the output, read from the UTXO set when possible
+func (bc *BlockChain) outputHeight(txID []byte, index int) (int, error) {
+	entry, _, err := bc.lookupUTXOSet(txID, index)
+	if err != nil {
+		return 0, err
+	}
+	if entry != nil {
+		return entry.Height, nil
+	}
+
+	block, err := bc.findTransactionBlock(txID)
+	if err != nil {
+		return 0, err
+	}
+
+	return block.Height, nil
+}
+
+// 读取已连接区块的撤销数据中它花费的输出，以outpointKey为键，没有撤销数据时返回nil
+// Read the outputs spent by a connected block from its undo data, keyed by outpointKey.
+// nil is returned when there is no undo data
+func (bc *BlockChain) blockSpentOutputs(blockHash []byte) map[string]TXOutput {
+	var outputs map[string]TXOutput
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(utxoSetBucket))
+		if root == nil || root.Bucket([]byte(undoSubBucket)) == nil {
+			return nil
+		}
+		spent, err := readBlockUndo(root.Bucket([]byte(undoSubBucket)), blockHash)
+		if err != nil {
+			return nil
+		}
+		outputs = make(map[string]TXOutput)
+		for _, s := range spent {
+			outputs[outpointKey(s.TxID, s.Index)] = s.Entry.Output
+		}
+
+		return nil
+	})
+
+	return outputs
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// 违反共识规则的错误：区块或交易本身无效，发送它的节点有过错。数据库错误等其他错误与区块本身无关
+// Error of a broken consensus rule: the block or transaction itself is invalid and the peer that
+// sent it is at fault. Other errors, like database errors, are not about the block itself
+type consensusError struct {
+	err error
+}
+
+func (e *consensusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *consensusError) Unwrap() error {
+	return e.err
+}
+
+func consensusErrorf(format string, args ...interface{}) error {
+	return &consensusError{fmt.Errorf(format, args...)}
+}
+
+// 错误是否来自违反共识规则
+// Whether the error comes from a broken consensus rule
+func isConsensusError(err error) bool {
+	var ce *consensusError
+
+	return errors.As(err, &ce)
+}
+
+// 验证将要打包进给定高度和时间区块的交易
+// Validate the transactions to be packed into a block at the given height and time
+func (bc *BlockChain) validateTransactions(transactions []*Transaction, height int, blockTime int64) error {
+	spent := bc.chainSpentOutputs()
+
+	var coinbase *Transaction
+	fees := 0
+	for _, tx := range transactions {
+		fee, err := bc.validateTransaction(tx, height, blockTime, spent)
+		if err != nil {
+			return err
+		}
+		if tx.IsCoinbase() {
+			coinbase = tx
+		}
+		fees += fee
+	}
+
+	// 挖矿奖励不能超过区块奖励加上所有交易费
+	// The coinbase cannot claim more than the block subsidy plus every transaction fee
+	if coinbase != nil {
+		if value := coinbase.outputValue(); value > subsidy+fees {
+			return consensusErrorf("coinbase %x pays %d, more than the subsidy %d plus the fees %d",
+				coinbase.ID, value, subsidy, fees)
+		}
+	}
+
+	return nil
+}
+
+// 验证一笔交易，spent中的输出视为已被花费，通过验证后交易的输入也会加入spent。返回交易费
+// Validate one transaction, the outputs in spent count as spent and the inputs of the
+// transaction are added to it once it passes. Returns the fee
+func (bc *BlockChain) validateTransaction(tx *Transaction, height int, blockTime int64, spent map[string]bool) (int, error) {
+	if err := tx.checkSanity(); err != nil {
+		return 0, err
+	}
+	fee, err := bc.checkTransactionInputs(tx, height, spent)
+	if err != nil {
+		return 0, err
+	}
+	if err := bc.VerifyTransaction(tx); err != nil {
+		return 0, err
+	}
+	if err := bc.CheckTransactionLocks(tx, height, blockTime); err != nil {
+		return 0, err
+	}
+
+	return fee, nil
+}
+
+// 用于验证交易的已花费输出。启用了未花费输出集合时直接在集合中检查输出，返回的空集合只用来
+// 发现交易之间的双花
+// The spent outputs used to validate transactions. With the UTXO set the outputs are checked
+// in the set directly, and the empty set returned only catches double spends among transactions
+func (bc *BlockChain) chainSpentOutputs() map[string]bool {
+	if bc.indexEnabled(utxoIndexer{}) {
+		return make(map[string]bool)
+	}
+
+	return bc.findSpentOutputs()
+}
+
+// 不依赖链的检查：交易至少有一个输入，输出的金额不为负并且总额不溢出
+// Checks that do not need the chain: the transaction has at least one input, no output
+// value is negative and the total does not overflow
+func (tx *Transaction) checkSanity() error {
+	if len(tx.Vin) == 0 {
+		return consensusErrorf("transaction %x has no inputs", tx.ID)
+	}
+
+	total := 0
+	for i, out := range tx.Vout {
+		if out.Value < 0 {
+			return consensusErrorf("transaction %x: output %d has a negative value %d", tx.ID, i, out.Value)
+		}
+		if total+out.Value < total {
+			return consensusErrorf("transaction %x: the total output value overflows", tx.ID)
+		}
+		total += out.Value
+	}
+
+	return nil
+}
+
+// 所有输出的总额
+// The total value of all outputs
+func (tx *Transaction) outputValue() int {
+	total := 0
+	for _, out := range tx.Vout {
+		total += out.Value
+	}
+
+	return total
+}
+
+// 链上所有已被花费的输出
+// All outputs spent on the chain
+func (bc *BlockChain) findSpentOutputs() map[string]bool {
+	spent := make(map[string]bool)
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, in := range tx.Vin {
+				spent[outpointKey(in.Txid, in.Vout)] = true
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return spent
+}
+
+// 检查交易输入引用的输出存在、未被花费，挖矿奖励已经成熟，并且输入总额不少于输出总额
+// 通过检查的输入会记录到spent中，避免同一区块内的双花。返回交易费
+// Check that the outputs referenced by the inputs exist, are unspent, that coinbase
+// outputs have matured and that the inputs cover the outputs. Inputs that pass are
+// added to spent, so the same output cannot be spent twice within a block. Returns the fee
+func (bc *BlockChain) checkTransactionInputs(tx *Transaction, height int, spent map[string]bool) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	inputs := 0
+	for _, in := range tx.Vin {
+		key := outpointKey(in.Txid, in.Vout)
+		if spent[key] {
+			return 0, consensusErrorf("output %s is already spent", key)
+		}
+
+		entry, ok, err := bc.lookupUTXOSet(in.Txid, in.Vout)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if entry == nil {
+				return 0, consensusErrorf("output %s does not exist or is already spent", key)
+			}
+			if entry.Coinbase && !bc.params.coinbaseMatured(entry.Height, height) {
+				return 0, consensusErrorf("coinbase output %s is immature, it can be spent from height %d",
+					key, entry.Height+bc.params.CoinbaseMaturity)
+			}
+			inputs += entry.Output.Value
+			spent[key] = true
+			continue
+		}
+
+		block, err := bc.findTransactionBlock(in.Txid)
+		if err != nil {
+			return 0, err
+		}
+		for _, prevTx := range block.Transactions {
+			if !bytes.Equal(prevTx.ID, in.Txid) {
+				continue
+			}
+			if in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+				return 0, consensusErrorf("output %s does not exist", key)
+			}
+			if prevTx.IsCoinbase() && !bc.params.coinbaseMatured(block.Height, height) {
+				return 0, consensusErrorf("coinbase output %s is immature, it can be spent from height %d",
+					key, block.Height+bc.params.CoinbaseMaturity)
+			}
+			inputs += prevTx.Vout[in.Vout].Value
+		}
+
+		spent[key] = true
+	}
+
+	outputs := tx.outputValue()
+	if inputs < outputs {
+		return 0, consensusErrorf("transaction %x spends %d but its inputs only hold %d", tx.ID, outputs, inputs)
+	}
+
+	return inputs - outputs, nil
+}
+
+// 验证区块头与区块的内容相符：哈希值、工作量证明和交易的Merkle树根
+// Validate that the header matches the content of the block: the hash, the proof of work
+// and the Merkle root of the transactions
+func (b *Block) checkHeader() error {
+	if !bytes.Equal(b.BlockHash(), b.Hash) {
+		return consensusErrorf("block %x: hash does not match its content", b.Hash)
+	}
+	if err := b.BlockHeader.validate(); err != nil {
+		return consensusErrorf("block %x: %v", b.Hash, err)
+	}
+	if !bytes.Equal(b.computeMerkleRoot(), b.MerkleRoot) {
+		return consensusErrorf("block %x: Merkle root does not match its transactions", b.Hash)
+	}
+
+	return nil
+}
+
+// 不依赖链的区块检查：区块头、交易ID、挖矿奖励交易只能在第一个，以及每笔交易的基本检查
+// Checks of a block that do not need the chain: its header, transaction IDs, that a coinbase
+// can only be the first transaction, and the basic checks of every transaction
+func (b *Block) checkBlock() error {
+	if len(b.Transactions) == 0 {
+		return consensusErrorf("block %x: no transactions", b.Hash)
+	}
+	for i, tx := range b.Transactions {
+		if i > 0 && tx.IsCoinbase() {
+			return consensusErrorf("block %x: only the first transaction can be a coinbase", b.Hash)
+		}
+		if !bytes.Equal(tx.Hash(), tx.ID) {
+			return consensusErrorf("block %x: transaction %x does not match its ID", b.Hash, tx.ID)
+		}
+		if err := tx.checkSanity(); err != nil {
+			return fmt.Errorf("block %x: %w", b.Hash, err)
+		}
+	}
+
+	return b.checkHeader()
+}
+
+// 验证区块本身以及其中所有交易
+// Validate a block and every transaction it contains
+func (bc *BlockChain) validateBlock(block *Block) error {
+	if err := block.checkBlock(); err != nil {
+		return err
+	}
+
+	var medianTime int64
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		medianTime, err = medianTimePast(tx.Bucket([]byte(headersBucket)), block.PrevBlockHash)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := block.checkTimestamp(medianTime, time.Now()); err != nil {
+		return fmt.Errorf("block %x: %w", block.Hash, err)
+	}
+
+	// 时间锁定按父区块的中位时间判断，而不是矿工选择的区块时间
+	// Time locks are evaluated against the median time past of the parent, not the block
+	// time chosen by the miner
+	if err := bc.validateTransactions(block.Transactions, block.Height, medianTime/int64(time.Second)); err != nil {
+		return fmt.Errorf("block %x: %w", block.Hash, err)
+	}
+
+	return nil
+}
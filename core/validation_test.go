@@ -0,0 +1,110 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+// 去掉找零输出，差额成为交易费
+// Drop the change output, the difference becomes the fee
+func dropChange(tx *Transaction) {
+	tx.Vout = tx.Vout[:1]
+}
+
+func TestValidateTransactionsNoInputs(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+
+	tx := &Transaction{nil, nil, []TXOutput{NewTXOutput(1, wallet.GetAddress())}, 0}
+	tx.SetID()
+
+	err := bc.validateTransactions([]*Transaction{tx}, 1, 0)
+	if err == nil || !strings.Contains(err.Error(), "no inputs") {
+		t.Fatalf("transaction without inputs: got %v", err)
+	}
+}
+
+func TestValidateTransactionsNegativeOutput(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	to := NewWallet().GetAddress()
+
+	// 负的输出让其他输出可以超过输入的总额
+	// A negative output lets the other outputs exceed the inputs
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{to, 5}}, TxOptions{}, func(tx *Transaction) {
+		tx.Vout = []TXOutput{NewTXOutput(15, to), NewTXOutput(-5, wallet.GetAddress())}
+	})
+
+	err := bc.validateTransactions([]*Transaction{tx}, 1, 0)
+	if err == nil || !strings.Contains(err.Error(), "negative value") {
+		t.Fatalf("negative output: got %v", err)
+	}
+}
+
+func TestValidateTransactionsOutputsExceedInputs(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	to := NewWallet().GetAddress()
+
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{to, 5}}, TxOptions{}, func(tx *Transaction) {
+		tx.Vout[0].Value = subsidy + 1
+		dropChange(tx)
+	})
+
+	err := bc.validateTransactions([]*Transaction{tx}, 1, 0)
+	if err == nil || !strings.Contains(err.Error(), "inputs only hold") {
+		t.Fatalf("outputs above the inputs: got %v", err)
+	}
+}
+
+func TestValidateTransactionsCoinbaseValue(t *testing.T) {
+	bc, wallet := newTestChain(t, testChainParams())
+	miner := NewWallet().GetAddress()
+
+	// 交易费为3，挖矿奖励最多为subsidy+3
+	// The fee is 3, so the coinbase can claim at most subsidy+3
+	tx := newTestTransaction(t, bc, wallet, []Recipient{{NewWallet().GetAddress(), 7}}, TxOptions{}, dropChange)
+
+	coinbase := func(value int) *Transaction {
+		cb := NewCoinbaseTransaction(miner, "")
+		cb.Vout[0].Value = value
+		cb.SetID()
+		return cb
+	}
+
+	if err := bc.validateTransactions([]*Transaction{coinbase(subsidy + 3), tx}, 1, 0); err != nil {
+		t.Fatalf("coinbase claiming the subsidy and the fees: %v", err)
+	}
+	err := bc.validateTransactions([]*Transaction{coinbase(subsidy + 4), tx}, 1, 0)
+	if err == nil || !strings.Contains(err.Error(), "more than the subsidy") {
+		t.Fatalf("coinbase above the subsidy and the fees: got %v", err)
+	}
+	err = bc.validateTransactions([]*Transaction{coinbase(subsidy + 1)}, 1, 0)
+	if err == nil || !strings.Contains(err.Error(), "more than the subsidy") {
+		t.Fatalf("coinbase above the subsidy without fees: got %v", err)
+	}
+}
+
+func TestAddBlockRejectsInflatedCoinbase(t *testing.T) {
+	bc, _ := newTestChain(t, testChainParams())
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coinbase := NewCoinbaseTransaction(NewWallet().GetAddress(), "")
+	coinbase.Vout[0].Value = subsidy * 2
+	coinbase.SetID()
+	block := solveTestBlock([]*Transaction{coinbase}, tip.Hash, tip.Height+1)
+
+	if err := bc.AddBlock(block); err == nil {
+		t.Fatal("block with an inflated coinbase was accepted")
+	}
+	if bc.GetBestHeight() != 0 {
+		t.Fatalf("height %d after rejecting the block", bc.GetBestHeight())
+	}
+
+	// 奖励正确的区块可以连接
+	// A block with the right reward connects
+	mineTestBlock(t, bc, NewWallet().GetAddress())
+	if bc.GetBestHeight() != 1 {
+		t.Fatalf("height %d after a valid block", bc.GetBestHeight())
+	}
+}
@@ -3,13 +3,45 @@ package core
 import "math"
 
 const dbFile = "blockChain.db"
-const blocksBucket = "blocks"  // 区块链在数据库里面的键 The key of the blockchain in the database
-const subsidy = 10             // 一个区块币的数量 the value of a block coin
-const maxNonce = math.MaxInt64 // nonce计算器最大值 the max value of nonce counter
+const walletFile = "wallet.dat"     // 钱包文件 the file storing the wallets
+const blocksBucket = "blocks"       // 区块链在数据库里面的键 The key of the blockchain in the database
+const addrIndexBucket = "addrindex" // 地址索引的键 The key of the address index
+const txIndexBucket = "txindex"     // 交易索引的键 The key of the transaction index
+const metaBucket = "meta"           // 数据库元数据(结构版本)的键 The key of the database metadata (schema version)
+const headersBucket = "headers"     // 区块头的键 The key of the block headers
+const utxoSetBucket = "chainstate"  // 未花费输出集合的键 The key of the UTXO set
+const cfIndexBucket = "cfilters"    // 紧凑区块过滤器的键 The key of the compact block filters
+const peersBucket = "peers"         // 已知节点地址的键 The key of the known node addresses
+const bannedBucket = "banned"       // 被封禁节点的键 The key of the banned nodes
+const subsidy = 10                  // 一个区块币的数量 the value of a block coin
+const maxNonce = math.MaxInt64      // nonce计算器最大值 the max value of nonce counter
 const genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
 
+// 轻节点只保存区块头和证明过的交易
+// The light client stores only headers and proven transactions
+const lightDBFile = "lightClient.db"
+const provenTxBucket = "proventx" // 已证明的交易的键 The key of the proven transactions
+const scannedBucket = "scanned"   // 已过滤的区块的键 The key of the filtered blocks
+
 // 目前我们并不会实现一个动态调整目标的算法，所以将难度定义为一个全局的常量即可
 // At present, we will not implement an algorithm that dynamically
 // adjusts the target, so we define the difficulty as a global constant
 var targetBits = 16 // 挖矿难度值, 值越大，挖矿越难 Mining difficulty value, the larger the value,
 //  the harder it is to mine.
+
+// 挖矿奖励需要经过的区块数才能被花费，避免区块被回滚后奖励消失
+// Number of blocks a coinbase reward must wait before it can be spent,
+// so rewards cannot vanish after being spent when their block is rolled back
+const defaultCoinbaseMaturity = 100
+
+// 链参数：可以按链设置的共识规则，测试用的链可以使用不同的值
+// Chain parameters: the consensus rules that can be set per chain, test chains can use other values
+type ChainParams struct {
+	CoinbaseMaturity int // 挖矿奖励可以花费前需要经过的区块数 blocks a coinbase reward waits before it can be spent
+}
+
+// 主链的参数
+// Parameters of the main chain
+func DefaultChainParams() ChainParams {
+	return ChainParams{CoinbaseMaturity: defaultCoinbaseMaturity}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+const addressVersion = byte(0x00)        // P2PKH地址版本号 version byte of P2PKH addresses
+const scriptHashAddrVersion = byte(0x05) // P2SH地址版本号 version byte of P2SH addresses
+const addressChecksumLen = 4             // 地址校验和长度 length of the address checksum
+const pubKeyHashLen = 20                 // 公钥哈希长度 length of a public key hash
+
+// 钱包，保存一对公私钥
+// Wallet stores a private and public key pair
+type Wallet struct {
+	PrivateKey ecdsa.PrivateKey
+	PublicKey  []byte // 压缩格式的公钥 compressed public key
+}
+
+// 创建新钱包
+// Create a new wallet
+func NewWallet() *Wallet {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	HandleErr(err)
+
+	return newWalletFromKey(private)
+}
+
+func newWalletFromKey(private *ecdsa.PrivateKey) *Wallet {
+	pubKey := elliptic.MarshalCompressed(private.Curve, private.X, private.Y)
+
+	return &Wallet{*private, pubKey}
+}
+
+// 钱包地址: Base58(版本号 + 公钥哈希 + 校验和)
+// Wallet address: Base58(version + public key hash + checksum)
+func (w Wallet) GetAddress() string {
+	return encodeAddress(addressVersion, HashPubKey(w.PublicKey))
+}
+
+// ecdsa.PrivateKey中的椭圆曲线是接口，gob无法直接编码，这里转成DER格式
+// The curve inside ecdsa.PrivateKey is an interface gob cannot encode, so store it as DER
+func (w *Wallet) GobEncode() ([]byte, error) {
+	return x509.MarshalECPrivateKey(&w.PrivateKey)
+}
+
+func (w *Wallet) GobDecode(data []byte) error {
+	private, err := x509.ParseECPrivateKey(data)
+	if err != nil {
+		return err
+	}
+	*w = *newWalletFromKey(private)
+
+	return nil
+}
+
+// 对数据哈希进行签名
+// Sign the hash of some data
+func (w *Wallet) Sign(hash []byte) []byte {
+	sig, err := ecdsa.SignASN1(rand.Reader, &w.PrivateKey, hash)
+	HandleErr(err)
+
+	return sig
+}
+
+// 校验签名，公钥无效时返回false
+// Verify a signature, returns false when the public key is invalid
+func verifySignature(pubKey, sig, hash []byte) bool {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), pubKey)
+	if x == nil {
+		return false
+	}
+	key := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+
+	return ecdsa.VerifyASN1(&key, hash, sig)
+}
+
+// 判断是否为有效的压缩公钥
+// Check whether the bytes are a valid compressed public key
+func verifyPubKey(pubKey []byte) bool {
+	x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), pubKey)
+
+	return x != nil
+}
+
+// 公钥哈希
+// Hash of the public key
+func HashPubKey(pubKey []byte) []byte {
+	return Hash160(pubKey)
+}
+
+// 比特币的HASH160是RIPEMD160(SHA256(data))，标准库里没有RIPEMD160，
+// 所以这里取两次SHA256结果的前20个字节
+// Bitcoin's HASH160 is RIPEMD160(SHA256(data)); the standard library has no RIPEMD160,
+// so we take the first 20 bytes of a double SHA256 instead
+func Hash160(data []byte) []byte {
+	return doubleSHA256(data)[:pubKeyHashLen]
+}
+
+func doubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+
+	return second[:]
+}
+
+// 校验和: 两次SHA256的前4个字节
+// Checksum: the first 4 bytes of a double SHA256
+func checksum(payload []byte) []byte {
+	return doubleSHA256(payload)[:addressChecksumLen]
+}
+
+// 编码地址
+// Encode an address
+func encodeAddress(version byte, hash []byte) string {
+	payload := append([]byte{version}, hash...)
+	payload = append(payload, checksum(payload)...)
+
+	return string(Base58Encode(payload))
+}
+
+// 解码地址，返回版本号和哈希
+// Decode an address into its version and hash
+func decodeAddress(address string) (byte, []byte, error) {
+	payload, ok := Base58Decode([]byte(address))
+	if !ok || len(payload) != 1+pubKeyHashLen+addressChecksumLen {
+		return 0, nil, fmt.Errorf("invalid address '%s'", address)
+	}
+
+	actualChecksum := payload[len(payload)-addressChecksumLen:]
+	versioned := payload[:len(payload)-addressChecksumLen]
+	if !bytes.Equal(actualChecksum, checksum(versioned)) {
+		return 0, nil, errors.New("invalid address checksum")
+	}
+
+	return versioned[0], versioned[1:], nil
+}
+
+// 校验地址是否有效
+// Check if the address is valid
+func ValidateAddress(address string) bool {
+	_, _, err := decodeAddress(address)
+
+	return err == nil
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// 钱包集合，按地址保存在钱包文件中
+// Collection of wallets, stored by address in the wallet file
+type Wallets struct {
+	Wallets map[string]*Wallet
+	Scripts map[string][]byte // 多重签名地址 -> 赎回脚本 multisig address -> redeem script
+}
+
+// 从钱包文件加载钱包集合，文件不存在时返回空集合
+// Load the wallets from the wallet file, an empty collection is returned when it does not exist
+func NewWallets() (*Wallets, error) {
+	wallets := Wallets{make(map[string]*Wallet), make(map[string][]byte)}
+	err := wallets.LoadFromFile()
+
+	return &wallets, err
+}
+
+// 创建一个新钱包并加入集合，返回地址
+// Create a new wallet, add it to the collection and return its address
+func (ws *Wallets) CreateWallet() string {
+	wallet := NewWallet()
+	address := wallet.GetAddress()
+	ws.Wallets[address] = wallet
+
+	return address
+}
+
+// 添加一个M-of-N多重签名地址，返回其P2SH地址
+// Add an M-of-N multisig address to the collection and return its P2SH address
+func (ws *Wallets) AddMultiSig(m int, pubKeys [][]byte) (string, error) {
+	redeemScript, err := MultiSigScript(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	address := ScriptHashAddress(redeemScript)
+	ws.Scripts[address] = redeemScript
+
+	return address, nil
+}
+
+// 根据多重签名地址获取赎回脚本
+// Get the redeem script of a multisig address
+func (ws *Wallets) GetRedeemScript(address string) ([]byte, bool) {
+	script, ok := ws.Scripts[address]
+
+	return script, ok
+}
+
+// 所有钱包地址
+// Addresses of all wallets
+func (ws *Wallets) GetAddresses() []string {
+	var addresses []string
+	for address := range ws.Wallets {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// 根据地址获取钱包
+// Get the wallet of an address
+func (ws *Wallets) GetWallet(address string) (*Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return nil, fmt.Errorf("no wallet for address '%s' in %s", address, walletFile)
+	}
+
+	return wallet, nil
+}
+
+// 从文件加载钱包
+// Load the wallets from the file
+func (ws *Wallets) LoadFromFile() error {
+	if exists, _ := PathExists(walletFile); !exists {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(walletFile)
+	if err != nil {
+		return err
+	}
+
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	return decoder.Decode(ws)
+}
+
+// 把钱包保存到文件
+// Save the wallets to the file
+func (ws *Wallets) SaveToFile() error {
+	var content bytes.Buffer
+
+	encoder := gob.NewEncoder(&content)
+	if err := encoder.Encode(ws); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(walletFile, content.Bytes(), 0600)
+}